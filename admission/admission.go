@@ -0,0 +1,210 @@
+// Package admission decides whether a verified record may be stored.
+//
+// Every path that stores records received from outside of the node,
+// submissions over HTTP and RPC, gossip, anti-entropy, the DHT and
+// archive imports, goes through an Admitter, so that a record rejected
+// on one path can't be stored through another
+package admission
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// Kinds of rejections, used in Error.Kind
+const (
+	KindValidity = "validity"
+	KindDelta    = "delta"
+	KindData     = "data"
+)
+
+// Error is returned by Admit when the record is rejected by the
+// node's policies. Limits that are exceeded are returned as a
+// *limits.Error and conflicts with the store as the store's errors
+type Error struct {
+	// Kind is the check that rejected the record
+	Kind string
+
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// Publisher stores a record and shares it with other nodes.
+// A gossip.Node satisfies it
+type Publisher interface {
+	Publish(rec record.Record) error
+}
+
+// Validator checks the full data of a record against its content
+// type and schema. A schema.Registry satisfies it
+type Validator interface {
+	Validate(rec record.Record, data io.Reader) error
+}
+
+// Options configures an Admitter. The zero value only
+// checks records against their validity window
+type Options struct {
+	// Limiter limits records by signing key, metadata.ID and quota.
+	// Limiting by peer is left to the transport, which knows the
+	// peer's address. Records are unlimited if it is nil
+	Limiter limits.Limiter
+
+	// Publisher stores admitted records in place of the
+	// store. Records are only stored locally if it is nil
+	Publisher Publisher
+
+	// Validator rejects records whose data doesn't match their
+	// content type or schema. Data is not checked if it is nil
+	Validator Validator
+
+	// Validity rejects records that are not yet valid or have
+	// expired. The zero value checks them against time.Now
+	// without any skew
+	Validity record.Validity
+}
+
+// Admitter checks records against the node's policies
+// and stores the ones that pass
+type Admitter interface {
+	// Admit checks the record and stores it. The record must already
+	// be verified against its parent, which is nil for a root record
+	// and must be in the store otherwise
+	Admit(rec, parent record.Record) error
+
+	// AdmitFrom is Admit for a record received along with a Source
+	// of its chunks, such as the peer it was pulled from. The chunks
+	// the store is missing are copied from src before the data they
+	// hold is validated
+	AdmitFrom(rec, parent record.Record, src chunks.Source) error
+
+	// AdmitAncestor is AdmitFrom for a record that is only replicated or
+	// imported to reach a newer record of its chain, which is admitted
+	// with AdmitFrom. Its validity window isn't checked, since the older
+	// records of a chain may expire while its head is still valid
+	AdmitAncestor(rec, parent record.Record, src chunks.Source) error
+}
+
+// New constructs an Admitter that stores records in the store
+func New(s store.Store, options Options) Admitter {
+	return &admitter{store: s, options: options}
+}
+
+type admitter struct {
+	store   store.Store
+	options Options
+}
+
+// Admit checks the validity window, the delta, the data and the
+// limits of the record, in that order, then stores it. Limiter
+// tokens are only taken once every other check has passed
+func (admitter *admitter) Admit(rec, parent record.Record) error {
+	return admitter.AdmitFrom(rec, parent, nil)
+}
+
+// AdmitFrom checks the record as Admit does, copying its chunks
+// from src, if there is one, before its data is validated
+func (admitter *admitter) AdmitFrom(rec, parent record.Record, src chunks.Source) error {
+	if err := admitter.options.Validity.Check(rec); err != nil {
+		return &Error{KindValidity, err.Error()}
+	}
+	return admitter.admit(rec, parent, src)
+}
+
+// AdmitAncestor checks the record as AdmitFrom
+// does, except for its validity window
+func (admitter *admitter) AdmitAncestor(rec, parent record.Record, src chunks.Source) error {
+	return admitter.admit(rec, parent, src)
+}
+
+// admit checks the delta of the record, copies its chunks from src,
+// then checks its data and the limits before storing it. The chunks
+// are copied first so that the data they hold can be validated
+func (admitter *admitter) admit(rec, parent record.Record, src chunks.Source) error {
+	data, err := admitter.data(rec)
+	if err != nil {
+		return err
+	}
+
+	manifest := rec.Metadata().Manifest
+	if manifest != nil && src != nil {
+		if err := chunks.Copy(admitter.store, src, manifest); err != nil {
+			return err
+		}
+	}
+
+	if admitter.options.Validator != nil {
+		if manifest != nil {
+			data = chunks.NewReader(admitter.store, manifest)
+		}
+		if err := admitter.validate(rec, data); err != nil {
+			return err
+		}
+	}
+
+	if admitter.options.Limiter != nil {
+		if err := admitter.options.Limiter.AllowRecord(rec, parent); err != nil {
+			return err
+		}
+	}
+
+	if admitter.options.Publisher != nil {
+		return admitter.options.Publisher.Publish(rec)
+	}
+	return admitter.store.Put(rec)
+}
+
+// validate checks the data read from r with the Validator. An error
+// reading the data, such as a missing chunk, is returned as is
+// rather than as a rejection of the data
+func (admitter *admitter) validate(rec record.Record, r io.Reader) error {
+	reader := &errorReader{reader: r}
+	if err := admitter.options.Validator.Validate(rec, reader); err != nil {
+		if reader.err != nil {
+			return reader.err
+		}
+		return &Error{KindData, err.Error()}
+	}
+	return nil
+}
+
+// data returns a reader of the full data of the record, applying
+// its delta to the full data of its parent
+func (admitter *admitter) data(rec record.Record) (io.Reader, error) {
+	if rec.Metadata().Delta == "" {
+		return bytes.NewReader(rec.Data()), nil
+	}
+
+	parentData, err := admitter.store.Data(rec.ParentHash())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := record.FullData(rec, parentData)
+	if err != nil {
+		return nil, &Error{KindDelta, err.Error()}
+	}
+	return bytes.NewReader(data), nil
+}
+
+// errorReader keeps the first error other than io.EOF
+// that reading from the reader returned
+type errorReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (reader *errorReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if err != nil && err != io.EOF && reader.err == nil {
+		reader.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,266 @@
+package admission_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/delta"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/schema"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingLimiter counts the records it allowed
+type countingLimiter struct {
+	allowed int
+}
+
+func (limiter *countingLimiter) AllowPeer(peer string) error {
+	return nil
+}
+
+func (limiter *countingLimiter) AllowRecord(rec, parent record.Record) error {
+	limiter.allowed++
+	return nil
+}
+
+// rejectingValidator rejects the data of every record
+type rejectingValidator struct{}
+
+func (validator *rejectingValidator) Validate(rec record.Record, data io.Reader) error {
+	return fmt.Errorf("data is not allowed")
+}
+
+// recordingValidator keeps the last data it validated
+type recordingValidator struct {
+	data []byte
+}
+
+func (validator *recordingValidator) Validate(rec record.Record, data io.Reader) error {
+	var err error
+	validator.data, err = ioutil.ReadAll(data)
+	return err
+}
+
+// memoryPublisher keeps the records it was asked to publish
+type memoryPublisher struct {
+	published []record.Record
+}
+
+func (publisher *memoryPublisher) Publish(rec record.Record) error {
+	publisher.published = append(publisher.published, rec)
+	return nil
+}
+
+var _ = Describe("Admitter", func() {
+	var s store.Store
+	var limiter *countingLimiter
+	var root record.Record
+	var privateKey *rsa.PrivateKey
+
+	BeforeEach(func() {
+		s = store.New(store.NewMemoryBackend())
+		limiter = &countingLimiter{}
+		root, privateKey = fixtures.GenerateRootRecord(record.Metadata{})
+	})
+
+	Describe("with the zero Options", func() {
+		It("should store a valid record", func() {
+			Expect(admission.New(s, admission.Options{}).Admit(root, nil)).To(Succeed())
+
+			_, err := s.Get(fixtures.MustHash(root))
+			Expect(err).To(BeNil())
+		})
+
+		It("should reject an expired record", func() {
+			expired := fixtures.GenerateRootRecordWithin(time.Time{}, time.Now().Add(-time.Hour))
+
+			err := admission.New(s, admission.Options{}).Admit(expired, nil)
+			Expect(err).To(BeAssignableToTypeOf(&admission.Error{}))
+			Expect(err.(*admission.Error).Kind).To(Equal(admission.KindValidity))
+
+			_, err = s.Get(fixtures.MustHash(expired))
+			Expect(err).To(Equal(store.ErrNotFound))
+		})
+
+		It("should store an expired ancestor with AdmitAncestor", func() {
+			expired := fixtures.GenerateRootRecordWithin(time.Time{}, time.Now().Add(-time.Hour))
+
+			Expect(admission.New(s, admission.Options{}).AdmitAncestor(expired, nil, nil)).To(Succeed())
+
+			_, err := s.Get(fixtures.MustHash(expired))
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("when the validator rejects the data", func() {
+		var err error
+
+		BeforeEach(func() {
+			err = admission.New(s, admission.Options{Limiter: limiter, Validator: &rejectingValidator{}}).Admit(root, nil)
+		})
+
+		It("should return an Error", func() {
+			Expect(err).To(Equal(&admission.Error{Kind: admission.KindData, Message: "data is not allowed"}))
+		})
+
+		It("should not take a token from the limiter", func() {
+			Expect(limiter.allowed).To(Equal(0))
+		})
+
+		It("should not store the record", func() {
+			_, err := s.Get(fixtures.MustHash(root))
+			Expect(err).To(Equal(store.ErrNotFound))
+		})
+	})
+
+	Describe("with a delta", func() {
+		var validator *recordingValidator
+		var admitter admission.Admitter
+
+		BeforeEach(func() {
+			validator = &recordingValidator{}
+			admitter = admission.New(s, admission.Options{Limiter: limiter, Validator: validator})
+
+			parent := fixtures.GenerateUpdate(root, privateKey, root.Metadata(), []byte(`{"name":"device"}`))
+			Expect(s.Put(root)).To(Succeed())
+			Expect(s.Put(parent)).To(Succeed())
+			root = parent
+		})
+
+		It("should validate the full data", func() {
+			update := fixtures.GenerateDeltaUpdate(root, privateKey, delta.JSONPatch, []byte(`[{"op":"add","path":"/firmware","value":"1.1"}]`))
+			Expect(admitter.Admit(update, root)).To(Succeed())
+			Expect(validator.data).To(MatchJSON(`{"name":"device","firmware":"1.1"}`))
+		})
+
+		It("should reject a delta that doesn't apply before taking a token", func() {
+			update := fixtures.GenerateDeltaUpdate(root, privateKey, delta.JSONPatch, []byte(`[{"op":"remove","path":"/missing"}]`))
+
+			err := admitter.Admit(update, root)
+			Expect(err).To(BeAssignableToTypeOf(&admission.Error{}))
+			Expect(err.(*admission.Error).Kind).To(Equal(admission.KindDelta))
+			Expect(limiter.allowed).To(Equal(0))
+		})
+	})
+
+	Describe("when a limit is exceeded", func() {
+		It("should return the *limits.Error", func() {
+			limiter := limits.New(s, limits.Config{PerIDQuota: limits.Quota{MaxRecords: 1}})
+			admitter := admission.New(s, admission.Options{Limiter: limiter})
+			Expect(admitter.Admit(root, nil)).To(Succeed())
+
+			update := fixtures.GenerateUpdateRecord(root, privateKey, "a")
+			err := admitter.Admit(update, root)
+			Expect(err).To(BeAssignableToTypeOf(&limits.Error{}))
+		})
+	})
+
+	Describe("with a Publisher", func() {
+		It("should publish the record in place of storing it", func() {
+			publisher := &memoryPublisher{}
+			Expect(admission.New(s, admission.Options{Publisher: publisher}).Admit(root, nil)).To(Succeed())
+			Expect(publisher.published).To(Equal([]record.Record{root}))
+
+			_, err := s.Get(fixtures.MustHash(root))
+			Expect(err).To(Equal(store.ErrNotFound))
+		})
+	})
+
+	Describe("AdmitFrom with a record whose data is stored in chunks", func() {
+		var source store.Store
+		var update record.Record
+
+		BeforeEach(func() {
+			source = store.New(store.NewMemoryBackend())
+			manifest, err := chunks.Write(source, bytes.NewReader([]byte("chunked data")), 4)
+			Expect(err).To(BeNil())
+
+			metadata := root.Metadata()
+			metadata.Manifest = manifest
+			update = fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+			Expect(s.Put(root)).To(Succeed())
+		})
+
+		It("should copy the chunks from the source and store the record", func() {
+			Expect(admission.New(s, admission.Options{}).AdmitFrom(update, root, source)).To(Succeed())
+			Expect(s.Data(fixtures.MustHash(update))).To(Equal([]byte("chunked data")))
+		})
+
+		It("should validate the data of the chunks", func() {
+			validator := &recordingValidator{}
+			Expect(admission.New(s, admission.Options{Validator: validator}).AdmitFrom(update, root, source)).To(Succeed())
+			Expect(validator.data).To(Equal([]byte("chunked data")))
+		})
+
+		Describe("when the validator rejects the record", func() {
+			It("should not store the record", func() {
+				admitter := admission.New(s, admission.Options{Validator: &rejectingValidator{}})
+				err := admitter.AdmitFrom(update, root, source)
+				Expect(err).To(BeAssignableToTypeOf(&admission.Error{}))
+				Expect(err.(*admission.Error).Kind).To(Equal(admission.KindData))
+
+				_, err = s.Get(fixtures.MustHash(update))
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+
+		Describe("with a schema", func() {
+			var registry schema.Registry
+
+			BeforeEach(func() {
+				registry = schema.NewRegistry()
+				Expect(registry.Register("person/v1", []byte(`{"type": "object", "required": ["name"]}`))).To(Succeed())
+			})
+
+			admitJSON := func(document string) error {
+				manifest, err := chunks.Write(source, strings.NewReader(document), 4)
+				Expect(err).To(BeNil())
+
+				metadata := root.Metadata()
+				metadata.ContentType = "application/json"
+				metadata.Schema = "person/v1"
+				metadata.Manifest = manifest
+				chunked := fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+				return admission.New(s, admission.Options{Validator: registry}).AdmitFrom(chunked, root, source)
+			}
+
+			It("should accept data that conforms to it", func() {
+				Expect(admitJSON(`{"name": "roy"}`)).To(Succeed())
+			})
+
+			It("should reject data that doesn't", func() {
+				err := admitJSON(`{"age": 30}`)
+				Expect(err).To(BeAssignableToTypeOf(&admission.Error{}))
+				Expect(err).To(MatchError("data at '/' is missing required property 'name'"))
+			})
+		})
+
+		Describe("with a validator but without the chunks", func() {
+			It("should return the error reading them", func() {
+				err := admission.New(s, admission.Options{Validator: &recordingValidator{}}).Admit(update, root)
+				Expect(err).NotTo(BeNil())
+				Expect(err).NotTo(BeAssignableToTypeOf(&admission.Error{}))
+			})
+		})
+
+		Describe("without a source", func() {
+			It("should return a *store.ChunksError", func() {
+				err := admission.New(s, admission.Options{}).Admit(update, root)
+				Expect(err).To(BeAssignableToTypeOf(&store.ChunksError{}))
+			})
+		})
+	})
+})
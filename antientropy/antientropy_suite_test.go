@@ -0,0 +1,13 @@
+package antientropy_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAntientropy(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Antientropy Suite")
+}
@@ -0,0 +1,116 @@
+package antientropy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/wire"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// PathPrefix is the prefix of the routes served by PeerHandler
+const PathPrefix = "/antientropy/"
+
+type peerPrefix struct {
+	Prefix string `json:"prefix"`
+}
+
+type peerHash struct {
+	Hash []byte `json:"hash"`
+}
+
+type peerHashes struct {
+	Hashes [][]byte `json:"hashes"`
+}
+
+type peerBucket struct {
+	Bucket Bucket `json:"bucket"`
+}
+
+type peerRecord struct {
+	Record *encoding.Record `json:"record"`
+}
+
+// NewPeerTransport constructs a Transport that sends each
+// request with the client, which should be a peer.NewHTTPClient
+func NewPeerTransport(client *http.Client) Transport {
+	return &peerTransport{client: client}
+}
+
+type peerTransport struct {
+	client *http.Client
+}
+
+func (transport *peerTransport) Root(peer string) ([]byte, error) {
+	response := &peerHash{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"root", struct{}{}, response); err != nil {
+		return nil, err
+	}
+	return response.Hash, nil
+}
+
+func (transport *peerTransport) Children(peer, prefix string) ([][]byte, error) {
+	response := &peerHashes{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"children", &peerPrefix{prefix}, response); err != nil {
+		return nil, err
+	}
+	return response.Hashes, nil
+}
+
+func (transport *peerTransport) Bucket(peer, prefix string) (Bucket, error) {
+	response := &peerBucket{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"bucket", &peerPrefix{prefix}, response); err != nil {
+		return nil, err
+	}
+	return response.Bucket, nil
+}
+
+func (transport *peerTransport) Fetch(peer string, hash []byte) (*encoding.Record, error) {
+	response := &peerRecord{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"fetch", &peerHash{hash}, response); err != nil {
+		return nil, err
+	}
+	if response.Record == nil {
+		return nil, fmt.Errorf("peer '%v' did not send a record", peer)
+	}
+	return response.Record, nil
+}
+
+// PeerHandler answers the requests of peer transports under
+// PathPrefix. It should be served by a peer.NewHTTPServer
+func PeerHandler(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, PathPrefix) {
+		case "root":
+			if !wire.Read(w, r, &struct{}{}) {
+				return
+			}
+			hash, err := handler.HandleRoot()
+			wire.Write(w, &peerHash{hash}, err)
+		case "children":
+			request := &peerPrefix{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			hashes, err := handler.HandleChildren(request.Prefix)
+			wire.Write(w, &peerHashes{hashes}, err)
+		case "bucket":
+			request := &peerPrefix{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			bucket, err := handler.HandleBucket(request.Prefix)
+			wire.Write(w, &peerBucket{bucket}, err)
+		case "fetch":
+			request := &peerHash{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			rec, err := handler.HandleFetch(request.Hash)
+			wire.Write(w, &peerRecord{rec}, err)
+		default:
+			wire.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package antientropy_test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/antientropy"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerTransport", func() {
+	var localConfig, remoteConfig peer.Config
+	var localStore, remoteStore store.Store
+	var server *http.Server
+	var address string
+	var records []record.Record
+	var report *antientropy.SyncReport
+	var err error
+
+	BeforeEach(func() {
+		localConfig = fixtures.GeneratePeerConfig("local")
+		remoteConfig = fixtures.GeneratePeerConfig("remote")
+		localStore = store.New(store.NewMemoryBackend())
+		remoteStore = store.New(store.NewMemoryBackend())
+
+		records, _ = fixtures.GenerateChain(1)
+		for _, rec := range records {
+			Expect(remoteStore.Put(rec)).To(Succeed())
+		}
+	})
+
+	JustBeforeEach(func() {
+		listener, listenErr := peer.Listen("tcp", "127.0.0.1:0", remoteConfig)
+		Expect(listenErr).To(BeNil())
+		address = listener.Addr().String()
+
+		remote := antientropy.New(remoteStore, antientropy.NewMemoryNetwork().Transport(), antientropy.Options{})
+		mux := http.NewServeMux()
+		mux.Handle(antientropy.PathPrefix, antientropy.PeerHandler(remote))
+		server = peer.NewHTTPServer(mux)
+		go server.Serve(listener)
+
+		transport := antientropy.NewPeerTransport(peer.NewHTTPClient(localConfig, time.Second))
+		sut := antientropy.New(localStore, transport, antientropy.Options{})
+		report, err = sut.SyncWith(address)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("when the nodes permit each other", func() {
+		It("should fetch the chain", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(2))
+
+			for _, rec := range records {
+				_, getErr := localStore.Get(fixtures.MustHash(rec))
+				Expect(getErr).To(BeNil())
+			}
+		})
+	})
+
+	Describe("when the peer denies the node", func() {
+		BeforeEach(func() {
+			remoteConfig.Policy = peer.Policy{Deny: []string{localConfig.Identity.Metadata().ID}}
+		})
+
+		It("should yield an error", func() {
+			Expect(err).NotTo(BeNil())
+			Expect(localStore.IDs()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,416 @@
+// Package antientropy repairs the records that gossip missed while
+// nodes were offline.
+//
+// Every node keeps a Merkle tree over the hashes of its stored
+// records, bucketed by metadata.ID prefix. To sync, a node compares
+// its root with a peer's and descends only into the subtrees whose
+// hashes differ, so the number of requests grows with the number of
+// differing buckets rather than with the size of the store. Syncing
+// pulls the records the peer has that the node is missing, so two
+// nodes converge once each has synced with the other
+package antientropy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// SyncReport describes a single sync with a peer
+type SyncReport struct {
+	Peer string `json:"peer"`
+
+	// Requests is the number of requests sent to the peer
+	Requests int `json:"requests"`
+
+	// Fetched is the number of records that were pulled and stored
+	Fetched int `json:"fetched"`
+
+	// Diverged lists the metadata.IDs whose chain on the peer
+	// does not extend the local one, so could not be synced
+	Diverged []string `json:"diverged"`
+
+	// Incomplete lists the metadata.IDs that are missing locally and
+	// whose chain on the peer was pruned, so could not be verified
+	Incomplete []string `json:"incomplete"`
+
+	// Failed lists the chains that could not be synced because a
+	// record was invalid or rejected, or the peer failed to send
+	// it, sorted by metadata.ID. The other chains are still synced
+	Failed []FailedChain `json:"failed"`
+}
+
+// FailedChain is a chain that could not be synced
+type FailedChain struct {
+	// ID is the metadata.ID of the chain
+	ID string `json:"id"`
+
+	// Error describes why the chain could not be synced
+	Error string `json:"error"`
+}
+
+// Syncer runs anti-entropy between a store and its peers
+type Syncer interface {
+	Handler
+
+	// Run syncs with a random peer every interval
+	// until stop is closed. Errors are ignored
+	Run(interval time.Duration, stop <-chan struct{})
+
+	// SetPeers replaces the addresses that Run picks from. They
+	// are ignored when the Syncer has Options.Members
+	SetPeers(peers []string)
+
+	// SyncWith pulls every record the peer has that the store is
+	// missing, or that extends its chains. A chain that fails to sync
+	// is listed in the report's Failed chains, it only returns an
+	// error if the trees can't be compared
+	SyncWith(peer string) (*SyncReport, error)
+}
+
+// Members returns the addresses of the live nodes in the
+// mesh. A membership.Membership satisfies it
+type Members interface {
+	Addresses() []string
+}
+
+// Options configures a Syncer. Zero values use the defaults
+type Options struct {
+	// Admitter checks and stores pulled records, defaults to
+	// an Admitter that only checks their validity window
+	Admitter admission.Admitter
+
+	// Chunks, if set, is asked for the chunks of pulled records
+	// whose data is stored in chunks, from the peer they were
+	// pulled from. Without it, such records are only stored
+	// if their chunks already are
+	Chunks chunks.Transport
+
+	// Members, if set, is asked for the peers that Run picks
+	// from in place of the peers given to SetPeers
+	Members Members
+
+	// Range, if set, limits the synced chains to the ones it is
+	// responsible for. Other chains the peer has are skipped
+	Range Range
+}
+
+// Range decides which chains a node keeps. A dht.Node satisfies it
+type Range interface {
+	Responsible(id string) bool
+}
+
+// New constructs a Syncer for the store that
+// talks to its peers through the transport
+func New(s store.Store, transport Transport, options Options) Syncer {
+	if options.Admitter == nil {
+		options.Admitter = admission.New(s, admission.Options{})
+	}
+	return &syncer{store: s, transport: transport, admitter: options.Admitter, chunks: options.Chunks, members: options.Members, keyRange: options.Range}
+}
+
+type syncer struct {
+	store     store.Store
+	transport Transport
+	admitter  admission.Admitter
+	chunks    chunks.Transport
+	members   Members
+	keyRange  Range
+
+	lock  sync.RWMutex
+	peers []string
+	tree  *Tree
+}
+
+// HandleRoot rebuilds the tree and returns its root hash. Peers call
+// it first, so the following requests of a sync are answered from
+// a tree that is at most as old as the sync
+func (syncer *syncer) HandleRoot() ([]byte, error) {
+	tree, err := BuildTree(syncer.store)
+	if err != nil {
+		return nil, err
+	}
+
+	syncer.lock.Lock()
+	syncer.tree = tree
+	syncer.lock.Unlock()
+
+	return tree.Root(), nil
+}
+
+// HandleChildren returns the hashes of the children of the node at prefix
+func (syncer *syncer) HandleChildren(prefix string) ([][]byte, error) {
+	tree, err := syncer.currentTree()
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) >= Depth {
+		return nil, fmt.Errorf("prefix '%v' is a leaf bucket", prefix)
+	}
+	return tree.Children(prefix), nil
+}
+
+// HandleBucket returns the chains in the leaf bucket at prefix
+func (syncer *syncer) HandleBucket(prefix string) (Bucket, error) {
+	tree, err := syncer.currentTree()
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) != Depth {
+		return nil, fmt.Errorf("prefix '%v' is not a leaf bucket", prefix)
+	}
+	return tree.Bucket(prefix), nil
+}
+
+// HandleFetch returns the stored record with the hash
+func (syncer *syncer) HandleFetch(hash []byte) (*encoding.Record, error) {
+	rec, err := syncer.store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Proto()
+}
+
+// Run syncs with a random peer every interval
+func (syncer *syncer) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if peer, ok := syncer.randomPeer(); ok {
+			syncer.SyncWith(peer)
+		}
+	}
+}
+
+// SetPeers replaces the peers
+func (syncer *syncer) SetPeers(peers []string) {
+	syncer.lock.Lock()
+	defer syncer.lock.Unlock()
+
+	syncer.peers = append([]string(nil), peers...)
+}
+
+// SyncWith descends into the subtrees that differ from the peer's
+// and pulls the records that are missing from the differing buckets,
+// skipping the chains outside of Options.Range
+func (syncer *syncer) SyncWith(peer string) (*SyncReport, error) {
+	report := &SyncReport{Peer: peer}
+
+	local, err := BuildTree(syncer.store)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Requests++
+	remoteRoot, err := syncer.transport.Root(peer)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(local.Root(), remoteRoot) {
+		return report, nil
+	}
+
+	prefixes, err := syncer.differingBuckets(peer, local, "", report)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, prefix := range prefixes {
+		report.Requests++
+		remote, err := syncer.transport.Bucket(peer, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		localBucket := local.Bucket(prefix)
+		for _, id := range sortedIDs(remote) {
+			if syncer.keyRange != nil && !syncer.keyRange.Responsible(id) {
+				continue
+			}
+			if err := syncer.syncChain(peer, id, localBucket[id], remote[id], report); err != nil {
+				report.Failed = append(report.Failed, FailedChain{ID: id, Error: err.Error()})
+			}
+		}
+	}
+
+	sort.Strings(report.Diverged)
+	sort.Strings(report.Incomplete)
+	sort.Slice(report.Failed, func(i, j int) bool {
+		return report.Failed[i].ID < report.Failed[j].ID
+	})
+	return report, nil
+}
+
+// differingBuckets returns the prefixes of the leaf buckets
+// below prefix whose hashes differ from the peer's
+func (syncer *syncer) differingBuckets(peer string, local *Tree, prefix string, report *SyncReport) ([]string, error) {
+	if len(prefix) == Depth {
+		return []string{prefix}, nil
+	}
+
+	report.Requests++
+	remote, err := syncer.transport.Children(peer, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(remote) != len(hexDigits) {
+		return nil, fmt.Errorf("peer returned %v children for prefix '%v'", len(remote), prefix)
+	}
+
+	var prefixes []string
+	for i, localHash := range local.Children(prefix) {
+		if bytes.Equal(localHash, remote[i]) {
+			continue
+		}
+
+		differing, err := syncer.differingBuckets(peer, local, prefix+string(hexDigits[i]), report)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, differing...)
+	}
+	return prefixes, nil
+}
+
+// syncChain pulls the records of the peer's chain that follow the
+// local head. If the peer's chain doesn't contain the local head,
+// the peer is either behind or has diverged, so nothing is pulled
+func (syncer *syncer) syncChain(peer, id string, localHashes, remoteHashes [][]byte, report *SyncReport) error {
+	start := 0
+	var parent record.Record
+
+	if len(localHashes) != 0 {
+		head := localHashes[len(localHashes)-1]
+		start = indexOf(remoteHashes, head) + 1
+		if start == 0 {
+			if !containsAll(localHashes, remoteHashes) {
+				report.Diverged = append(report.Diverged, id)
+			}
+			return nil
+		}
+
+		var err error
+		parent, err = syncer.store.Get(head)
+		if err != nil {
+			return err
+		}
+	}
+
+	var src chunks.Source
+	if syncer.chunks != nil {
+		src = syncer.chunks.Source(peer)
+	}
+
+	for i, hash := range remoteHashes[start:] {
+		report.Requests++
+		recordPB, err := syncer.transport.Fetch(peer, hash)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(recordPB.GetSeal().GetHash(), hash) {
+			return fmt.Errorf("peer sent a different record than '%v'", hex.EncodeToString(hash))
+		}
+		if parent == nil && len(recordPB.Parent) != 0 {
+			report.Incomplete = append(report.Incomplete, id)
+			return nil
+		}
+
+		rec, err := record.FromProto(recordPB, parent)
+		if err != nil {
+			return err
+		}
+		// only the remote head has to be valid now, the records
+		// before it are fetched to reach it
+		admit := syncer.admitter.AdmitAncestor
+		if start+i == len(remoteHashes)-1 {
+			admit = syncer.admitter.AdmitFrom
+		}
+		if err := admit(rec, parent, src); err != nil {
+			return err
+		}
+
+		report.Fetched++
+		parent = rec
+	}
+	return nil
+}
+
+func (syncer *syncer) currentTree() (*Tree, error) {
+	syncer.lock.RLock()
+	tree := syncer.tree
+	syncer.lock.RUnlock()
+
+	if tree != nil {
+		return tree, nil
+	}
+
+	if _, err := syncer.HandleRoot(); err != nil {
+		return nil, err
+	}
+	return syncer.currentTree()
+}
+
+func (syncer *syncer) randomPeer() (string, bool) {
+	peers := syncer.currentPeers()
+	if len(peers) == 0 {
+		return "", false
+	}
+	return peers[rand.Intn(len(peers))], true
+}
+
+// currentPeers returns the addresses of the live members, or
+// the peers given to SetPeers if there are no Members
+func (syncer *syncer) currentPeers() []string {
+	if syncer.members != nil {
+		return syncer.members.Addresses()
+	}
+
+	syncer.lock.RLock()
+	defer syncer.lock.RUnlock()
+	return syncer.peers
+}
+
+// containsAll returns true if every hash in subset is in hashes
+func containsAll(hashes, subset [][]byte) bool {
+	for _, hash := range subset {
+		if indexOf(hashes, hash) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+func indexOf(hashes [][]byte, hash []byte) int {
+	for i, other := range hashes {
+		if bytes.Equal(other, hash) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedIDs(bucket Bucket) []string {
+	ids := make([]string, 0, len(bucket))
+	for id := range bucket {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,369 @@
+package antientropy_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"time"
+
+	"github.com/royvandewater/meshchain/antientropy"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// staticMembers always returns the same addresses
+type staticMembers []string
+
+func (members staticMembers) Addresses() []string {
+	return members
+}
+
+// idRange is responsible for the chains of the IDs
+type idRange map[string]bool
+
+func (ids idRange) Responsible(id string) bool {
+	return ids[id]
+}
+
+var _ = Describe("Syncer", func() {
+	var network antientropy.MemoryNetwork
+	var localStore, remoteStore store.Store
+	var sut, remote antientropy.Syncer
+	var report *antientropy.SyncReport
+	var err error
+
+	// putChains stores count new chains, each with a root and an
+	// update, in every given store
+	putChains := func(count int, stores ...store.Store) [][]record.Record {
+		var chains [][]record.Record
+		for i := 0; i < count; i++ {
+			records, _ := fixtures.GenerateChain(1)
+			for _, s := range stores {
+				for _, rec := range records {
+					Expect(s.Put(rec)).To(Succeed())
+				}
+			}
+			chains = append(chains, records)
+		}
+		return chains
+	}
+
+	has := func(s store.Store, rec record.Record) bool {
+		hash, err := rec.Hash()
+		Expect(err).To(BeNil())
+
+		_, err = s.Get(hash)
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		network = antientropy.NewMemoryNetwork()
+		localStore = store.New(store.NewMemoryBackend())
+		remoteStore = store.New(store.NewMemoryBackend())
+
+		sut = antientropy.New(localStore, network.Transport(), antientropy.Options{})
+		remote = antientropy.New(remoteStore, network.Transport(), antientropy.Options{})
+		network.Join("local", sut)
+		network.Join("remote", remote)
+	})
+
+	Describe("when the stores are identical", func() {
+		BeforeEach(func() {
+			putChains(20, localStore, remoteStore)
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should only compare the roots", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Requests).To(Equal(1))
+			Expect(report.Fetched).To(Equal(0))
+		})
+	})
+
+	Describe("with a Range", func() {
+		var chains [][]record.Record
+
+		BeforeEach(func() {
+			chains = putChains(2, remoteStore)
+			sut = antientropy.New(localStore, network.Transport(), antientropy.Options{
+				Range: idRange{chains[0][0].Metadata().ID: true},
+			})
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should only fetch the chains in the range", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(2))
+			Expect(has(localStore, chains[0][1])).To(BeTrue())
+			Expect(has(localStore, chains[1][0])).To(BeFalse())
+		})
+	})
+
+	Describe("when the peer has a chain the store is missing", func() {
+		var missing [][]record.Record
+
+		BeforeEach(func() {
+			putChains(50, localStore, remoteStore)
+			missing = putChains(1, remoteStore)
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should fetch the chain", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(2))
+			Expect(has(localStore, missing[0][0])).To(BeTrue())
+			Expect(has(localStore, missing[0][1])).To(BeTrue())
+		})
+
+		It("should only descend into the differing bucket", func() {
+			// root, children of the root, children of the differing
+			// child, the differing bucket and the two records
+			Expect(report.Requests).To(Equal(6))
+		})
+
+		It("should end up with the same tree as the peer", func() {
+			localTree, err := antientropy.BuildTree(localStore)
+			Expect(err).To(BeNil())
+			remoteTree, err := antientropy.BuildTree(remoteStore)
+			Expect(err).To(BeNil())
+			Expect(localTree.Root()).To(Equal(remoteTree.Root()))
+		})
+	})
+
+	Describe("when the peer has updates the store is missing", func() {
+		var records []record.Record
+		var privateKey *rsa.PrivateKey
+
+		BeforeEach(func() {
+			records, privateKey = fixtures.GenerateChain(0)
+			Expect(localStore.Put(records[0])).To(Succeed())
+			Expect(remoteStore.Put(records[0])).To(Succeed())
+
+			update1 := fixtures.GenerateUpdateRecord(records[0], privateKey, "update-1")
+			update2 := fixtures.GenerateUpdateRecord(update1, privateKey, "update-2")
+			records = append(records, update1, update2)
+			Expect(remoteStore.Put(update1)).To(Succeed())
+			Expect(remoteStore.Put(update2)).To(Succeed())
+
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should fetch the updates", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(2))
+
+			head, err := localStore.Head(records[0].Metadata().ID)
+			Expect(err).To(BeNil())
+			Expect(head.Data()).To(Equal([]byte(`update-2`)))
+		})
+	})
+
+	Describe("when the store is ahead of the peer", func() {
+		BeforeEach(func() {
+			putChains(1, localStore)
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should not fetch anything", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(0))
+			Expect(report.Diverged).To(BeEmpty())
+		})
+
+		Describe("when the peer syncs back", func() {
+			BeforeEach(func() {
+				report, err = remote.SyncWith("local")
+			})
+
+			It("should fetch the records", func() {
+				Expect(err).To(BeNil())
+				Expect(report.Fetched).To(Equal(2))
+			})
+		})
+	})
+
+	Describe("when the chains have diverged", func() {
+		var records []record.Record
+
+		BeforeEach(func() {
+			var privateKey *rsa.PrivateKey
+			records, privateKey = fixtures.GenerateChain(0)
+			Expect(localStore.Put(records[0])).To(Succeed())
+			Expect(remoteStore.Put(records[0])).To(Succeed())
+
+			Expect(localStore.Put(fixtures.GenerateUpdateRecord(records[0], privateKey, "local"))).To(Succeed())
+			Expect(remoteStore.Put(fixtures.GenerateUpdateRecord(records[0], privateKey, "remote"))).To(Succeed())
+
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should report the divergence", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(0))
+			Expect(report.Diverged).To(Equal([]string{records[0].Metadata().ID}))
+		})
+	})
+
+	Describe("when the peer has only a pruned chain", func() {
+		var id string
+
+		BeforeEach(func() {
+			records, _ := fixtures.GenerateChain(2)
+			for _, rec := range records {
+				Expect(remoteStore.Put(rec)).To(Succeed())
+			}
+			id = records[0].Metadata().ID
+
+			_, err := remoteStore.Prune(store.RetentionPolicies{Default: store.RetentionPolicy{KeepLast: 1}}, time.Now())
+			Expect(err).To(BeNil())
+
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should report the chain as incomplete", func() {
+			Expect(err).To(BeNil())
+			Expect(report.Fetched).To(Equal(0))
+			Expect(report.Incomplete).To(Equal([]string{id}))
+		})
+	})
+
+	Describe("when the peer has an expired record", func() {
+		var expired record.Record
+		var others [][]record.Record
+
+		BeforeEach(func() {
+			expired = fixtures.GenerateRootRecordWithin(time.Time{}, time.Now().Add(-time.Hour))
+			Expect(remoteStore.Put(expired)).To(Succeed())
+			others = putChains(3, remoteStore)
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should not admit it", func() {
+			Expect(err).To(BeNil())
+			Expect(has(localStore, expired)).To(BeFalse())
+		})
+
+		It("should report the chain as failed", func() {
+			Expect(report.Failed).To(HaveLen(1))
+			Expect(report.Failed[0].ID).To(Equal(expired.Metadata().ID))
+			Expect(report.Failed[0].Error).To(ContainSubstring("record expired at"))
+		})
+
+		It("should still sync the other chains", func() {
+			for _, chain := range others {
+				for _, rec := range chain {
+					Expect(has(localStore, rec)).To(BeTrue())
+				}
+			}
+		})
+	})
+
+	Describe("when the peer has a chain whose root expired but whose head is valid", func() {
+		var root, head record.Record
+
+		BeforeEach(func() {
+			var privateKey *rsa.PrivateKey
+			root, privateKey = fixtures.GenerateRootRecord(record.Metadata{NotAfter: time.Now().Add(-time.Hour)})
+
+			metadata := root.Metadata()
+			metadata.NotAfter = time.Time{}
+			head = fixtures.GenerateUpdate(root, privateKey, metadata, []byte(`valid`))
+
+			Expect(remoteStore.Put(root)).To(Succeed())
+			Expect(remoteStore.Put(head)).To(Succeed())
+			report, err = sut.SyncWith("remote")
+		})
+
+		It("should fetch the whole chain", func() {
+			Expect(err).To(BeNil())
+			Expect(has(localStore, root)).To(BeTrue())
+			Expect(has(localStore, head)).To(BeTrue())
+		})
+	})
+
+	Describe("when the peer has a record whose data is stored in chunks", func() {
+		var chunked record.Record
+
+		BeforeEach(func() {
+			root, privateKey := fixtures.GenerateRootRecord(record.Metadata{})
+			manifest, chunksErr := chunks.Write(remoteStore, bytes.NewReader([]byte("chunked data")), 4)
+			Expect(chunksErr).To(BeNil())
+			metadata := root.Metadata()
+			metadata.Manifest = manifest
+			chunked = fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+
+			Expect(remoteStore.Put(root)).To(Succeed())
+			Expect(remoteStore.Put(chunked)).To(Succeed())
+		})
+
+		It("should fetch the chunks with Options.Chunks", func() {
+			transport := chunks.MemoryTransport{"remote": remoteStore}
+			sut = antientropy.New(localStore, network.Transport(), antientropy.Options{Chunks: transport})
+			report, err = sut.SyncWith("remote")
+
+			Expect(err).To(BeNil())
+			Expect(localStore.Data(fixtures.MustHash(chunked))).To(Equal([]byte("chunked data")))
+		})
+
+		It("should not store the record without Options.Chunks", func() {
+			report, err = sut.SyncWith("remote")
+			Expect(err).To(BeNil())
+			Expect(report.Failed).To(HaveLen(1))
+			Expect(report.Failed[0].Error).To(ContainSubstring("are not stored"))
+			Expect(has(localStore, chunked)).To(BeFalse())
+		})
+	})
+
+	Describe("Run", func() {
+		var stop chan struct{}
+		var missing [][]record.Record
+
+		BeforeEach(func() {
+			missing = putChains(3, remoteStore)
+			sut.SetPeers([]string{"remote"})
+
+			stop = make(chan struct{})
+			go sut.Run(10*time.Millisecond, stop)
+		})
+
+		AfterEach(func() {
+			close(stop)
+		})
+
+		It("should eventually sync with the peer", func() {
+			for _, records := range missing {
+				for _, rec := range records {
+					Eventually(func() bool { return has(localStore, rec) }).Should(BeTrue())
+				}
+			}
+		})
+	})
+
+	Describe("Run with Members", func() {
+		var stop chan struct{}
+		var missing [][]record.Record
+
+		BeforeEach(func() {
+			missing = putChains(1, remoteStore)
+			sut = antientropy.New(localStore, network.Transport(), antientropy.Options{Members: staticMembers{"remote"}})
+			sut.SetPeers([]string{"nowhere"})
+
+			stop = make(chan struct{})
+			go sut.Run(10*time.Millisecond, stop)
+		})
+
+		AfterEach(func() {
+			close(stop)
+		})
+
+		It("should sync with the members", func() {
+			for _, rec := range missing[0] {
+				Eventually(func() bool { return has(localStore, rec) }).Should(BeTrue())
+			}
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package antientropy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// Handler answers the anti-entropy requests of peers
+type Handler interface {
+	// HandleRoot returns the root hash of the node's tree
+	HandleRoot() ([]byte, error)
+
+	// HandleChildren returns the hashes of the children of the node at prefix
+	HandleChildren(prefix string) ([][]byte, error)
+
+	// HandleBucket returns the chains in the leaf bucket at prefix
+	HandleBucket(prefix string) (Bucket, error)
+
+	// HandleFetch returns the record with the hash
+	HandleFetch(hash []byte) (*encoding.Record, error)
+}
+
+// Transport sends anti-entropy requests to peers by address
+type Transport interface {
+	Root(peer string) ([]byte, error)
+	Children(peer, prefix string) ([][]byte, error)
+	Bucket(peer, prefix string) (Bucket, error)
+	Fetch(peer string, hash []byte) (*encoding.Record, error)
+}
+
+// MemoryNetwork connects handlers within a single process.
+// It is intended for tests and simulations
+type MemoryNetwork interface {
+	// Join registers the handler at the address
+	Join(address string, handler Handler)
+
+	// Leave removes the handler at the address
+	Leave(address string)
+
+	// Transport returns a Transport for sending requests
+	Transport() Transport
+}
+
+// NewMemoryNetwork constructs an empty MemoryNetwork
+func NewMemoryNetwork() MemoryNetwork {
+	return &memoryNetwork{handlers: make(map[string]Handler)}
+}
+
+type memoryNetwork struct {
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+func (network *memoryNetwork) Join(address string, handler Handler) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	network.handlers[address] = handler
+}
+
+func (network *memoryNetwork) Leave(address string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	delete(network.handlers, address)
+}
+
+func (network *memoryNetwork) Transport() Transport {
+	return network
+}
+
+func (network *memoryNetwork) Root(peer string) ([]byte, error) {
+	handler, err := network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleRoot()
+}
+
+func (network *memoryNetwork) Children(peer, prefix string) ([][]byte, error) {
+	handler, err := network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleChildren(prefix)
+}
+
+func (network *memoryNetwork) Bucket(peer, prefix string) (Bucket, error) {
+	handler, err := network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleBucket(prefix)
+}
+
+func (network *memoryNetwork) Fetch(peer string, hash []byte) (*encoding.Record, error) {
+	handler, err := network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleFetch(hash)
+}
+
+func (network *memoryNetwork) handler(address string) (Handler, error) {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+
+	handler, ok := network.handlers[address]
+	if !ok {
+		return nil, fmt.Errorf("peer '%v' is unreachable", address)
+	}
+	return handler, nil
+}
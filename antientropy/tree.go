@@ -0,0 +1,120 @@
+package antientropy
+
+import (
+	"crypto/sha256"
+
+	"github.com/royvandewater/meshchain/store"
+)
+
+// hexDigits are the branches of every node in the tree
+const hexDigits = "0123456789abcdef"
+
+// Depth is the number of levels below the root. Leaf buckets are
+// identified by the first Depth characters of the metadata.ID,
+// which is hex encoded
+const Depth = 2
+
+// Bucket maps each metadata.ID in a leaf bucket to the
+// hashes of its stored records, oldest first
+type Bucket map[string][][]byte
+
+// Tree is a Merkle tree over the record hashes in a store. Each leaf
+// bucket holds the chains whose metadata.ID starts with the bucket's
+// prefix and every inner node hashes the hashes of its 16 children
+type Tree struct {
+	hashes  map[string][]byte
+	buckets map[string]Bucket
+}
+
+// BuildTree builds the tree for every chain in the store
+func BuildTree(s store.Store) (*Tree, error) {
+	ids, err := s.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{hashes: make(map[string][]byte), buckets: make(map[string]Bucket)}
+	for _, id := range ids {
+		hashes, err := s.Hashes(id)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := bucketPrefix(id)
+		if tree.buckets[prefix] == nil {
+			tree.buckets[prefix] = make(Bucket)
+		}
+		tree.buckets[prefix][id] = hashes
+	}
+
+	tree.hash("")
+	return tree, nil
+}
+
+// Root returns the hash of the whole tree
+func (tree *Tree) Root() []byte {
+	return tree.hashes[""]
+}
+
+// Children returns the hashes of the 16 children of the
+// node at prefix, in hex digit order. It returns nil for
+// leaf buckets and prefixes that are not in the tree
+func (tree *Tree) Children(prefix string) [][]byte {
+	if len(prefix) >= Depth {
+		return nil
+	}
+
+	children := make([][]byte, len(hexDigits))
+	for i, digit := range hexDigits {
+		children[i] = tree.hashes[prefix+string(digit)]
+	}
+	return children
+}
+
+// Bucket returns the chains in the leaf bucket at prefix
+func (tree *Tree) Bucket(prefix string) Bucket {
+	bucket := tree.buckets[prefix]
+	if bucket == nil {
+		return Bucket{}
+	}
+	return bucket
+}
+
+// hash computes and stores the hash of the node at prefix and its descendants
+func (tree *Tree) hash(prefix string) []byte {
+	hasher := sha256.New()
+
+	if len(prefix) == Depth {
+		for _, id := range sortedIDs(tree.buckets[prefix]) {
+			hasher.Write([]byte(id))
+			hasher.Write([]byte{0})
+			for _, hash := range tree.buckets[prefix][id] {
+				hasher.Write(hash)
+			}
+			hasher.Write([]byte{0})
+		}
+	} else {
+		for _, digit := range hexDigits {
+			hasher.Write(tree.hash(prefix + string(digit)))
+		}
+	}
+
+	hash := hasher.Sum(nil)
+	tree.hashes[prefix] = hash
+	return hash
+}
+
+// bucketPrefix returns the prefix of the leaf bucket for the metadata.ID
+func bucketPrefix(id string) string {
+	prefix := []byte(id)
+	if len(prefix) > Depth {
+		prefix = prefix[:Depth]
+	}
+	for len(prefix) < Depth {
+		prefix = append(prefix, '0')
+	}
+	return string(prefix)
+}
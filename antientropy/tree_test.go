@@ -0,0 +1,67 @@
+package antientropy_test
+
+import (
+	"github.com/royvandewater/meshchain/antientropy"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tree", func() {
+	var s store.Store
+
+	BeforeEach(func() {
+		s = store.New(store.NewMemoryBackend())
+	})
+
+	Describe("BuildTree", func() {
+		It("should build the same root for the same records", func() {
+			records, _ := fixtures.GenerateChain(1)
+			other := store.New(store.NewMemoryBackend())
+			for _, rec := range records {
+				Expect(s.Put(rec)).To(Succeed())
+				Expect(other.Put(rec)).To(Succeed())
+			}
+
+			tree, err := antientropy.BuildTree(s)
+			Expect(err).To(BeNil())
+			otherTree, err := antientropy.BuildTree(other)
+			Expect(err).To(BeNil())
+			Expect(tree.Root()).To(Equal(otherTree.Root()))
+		})
+
+		It("should change the root and a single path when an update is added", func() {
+			records, privateKey := fixtures.GenerateChain(0)
+			Expect(s.Put(records[0])).To(Succeed())
+			before, err := antientropy.BuildTree(s)
+			Expect(err).To(BeNil())
+
+			Expect(s.Put(fixtures.GenerateUpdateRecord(records[0], privateKey, "update"))).To(Succeed())
+			after, err := antientropy.BuildTree(s)
+			Expect(err).To(BeNil())
+
+			Expect(after.Root()).NotTo(Equal(before.Root()))
+
+			differing := 0
+			beforeChildren := before.Children("")
+			for i, hash := range after.Children("") {
+				if string(hash) != string(beforeChildren[i]) {
+					differing++
+				}
+			}
+			Expect(differing).To(Equal(1))
+		})
+
+		It("should put each chain in the bucket of its ID prefix", func() {
+			records, _ := fixtures.GenerateChain(0)
+			Expect(s.Put(records[0])).To(Succeed())
+			id := records[0].Metadata().ID
+
+			tree, err := antientropy.BuildTree(s)
+			Expect(err).To(BeNil())
+			Expect(tree.Bucket(id[:antientropy.Depth])).To(HaveKey(id))
+		})
+	})
+})
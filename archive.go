@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/archive"
+)
+
+// runExport writes the chains for the metadata.IDs given as
+// arguments, or every chain, to an archive file
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir, keys := storeFlags(flags)
+	out := flags.String("out", "", "path of the archive file to write (required)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return fmt.Errorf("--out is required")
+	}
+
+	s, lock, err := openStore(*dir, *keys)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	header, err := archive.Export(file, s, flags.Args())
+	if err != nil {
+		file.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return printJSON(header)
+}
+
+// runImport verifies the archive file given as an argument and
+// imports its chains into the store. If it fails part way, running
+// it again resumes the import
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dir, keys := storeFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: meshchain import --store <dir> <archive>")
+	}
+
+	s, lock, err := openStore(*dir, *keys)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := archive.Import(file, s, admission.New(s, admission.Options{}))
+	if err != nil && report != nil {
+		// the records imported so far are kept, importing
+		// the archive again resumes after them
+		if printErr := printJSON(report); printErr != nil {
+			return printErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return printJSON(report)
+}
+
+// printJSON prints the value to stdout as indented JSON
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,106 @@
+// Package archive implements a portable, self-describing file format
+// for moving complete chains between stores.
+//
+// An archive starts with the magic bytes "MCARCHV" followed by a
+// sequence of frames: a header, the list of metadata.IDs, every record
+// in dependency order (each chain starting at its RootRecord), and an
+// end frame. A record whose data is stored in chunks is preceded by
+// the leaves of its tree and the chunks that weren't archived yet,
+// since version 2. Every frame is
+//
+//     [1 byte type][4 byte big endian length][payload][4 byte CRC-32C]
+//
+// where the checksum covers the type, length and payload.
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Version is the version of the archive format written by Export
+const Version = 2
+
+// magic identifies a meshchain archive
+var magic = []byte("MCARCHV")
+
+// maxFrameSize guards against allocating
+// absurd amounts of memory for a corrupt length
+const maxFrameSize = 64 << 20
+
+const (
+	frameHeader byte = iota + 1
+	frameIDs
+	frameRecord
+	frameEnd
+	frameTree
+	frameChunk
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Header describes the contents of an archive
+type Header struct {
+	// Version is the version of the archive format
+	Version int `json:"version"`
+
+	// CreatedAt is when the archive was exported
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Records is the number of records in the archive
+	Records int `json:"records"`
+
+	// Chunks is the number of chunks in the archive
+	Chunks int `json:"chunks"`
+}
+
+// writeFrame writes a single checksummed frame
+func writeFrame(w io.Writer, frameType byte, payload []byte) error {
+	prefix := make([]byte, 5)
+	prefix[0] = frameType
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(payload)))
+
+	checksum := crc32.Update(crc32.Checksum(prefix, crcTable), crcTable, payload)
+	suffix := make([]byte, 4)
+	binary.BigEndian.PutUint32(suffix, checksum)
+
+	for _, part := range [][]byte{prefix, payload, suffix} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads a single frame and verifies its checksum
+func readFrame(r io.Reader) (byte, []byte, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return 0, nil, fmt.Errorf("Failed to read frame: %v", err.Error())
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %v bytes exceeds the maximum frame size", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("Failed to read frame: %v", err.Error())
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := io.ReadFull(r, suffix); err != nil {
+		return 0, nil, fmt.Errorf("Failed to read frame: %v", err.Error())
+	}
+
+	checksum := crc32.Update(crc32.Checksum(prefix, crcTable), crcTable, payload)
+	if checksum != binary.BigEndian.Uint32(suffix) {
+		return 0, nil, fmt.Errorf("frame checksum does not match")
+	}
+
+	return prefix[0], payload, nil
+}
@@ -0,0 +1,364 @@
+package archive_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/archive"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive", func() {
+	var backend store.Backend
+	var source, destination store.Store
+	var chain1, chain2 []record.Record
+	var privateKey1 *rsa.PrivateKey
+	var buffer *bytes.Buffer
+	var err error
+
+	BeforeEach(func() {
+		backend = store.NewMemoryBackend()
+		source = store.New(backend)
+		destination = store.New(store.NewMemoryBackend())
+		buffer = &bytes.Buffer{}
+
+		chain1, privateKey1 = fixtures.GenerateChain(2)
+		chain2, _ = fixtures.GenerateChain(1)
+		for _, rec := range append(chain1, chain2...) {
+			Expect(source.Put(rec)).To(Succeed())
+		}
+	})
+
+	Describe("Export", func() {
+		var header *archive.Header
+
+		Describe("without IDs", func() {
+			BeforeEach(func() {
+				header, err = archive.Export(buffer, source, nil)
+				Expect(err).To(BeNil())
+			})
+
+			It("should export every record", func() {
+				Expect(header.Version).To(Equal(archive.Version))
+				Expect(header.Records).To(Equal(5))
+			})
+
+			Describe("when imported into an empty store", func() {
+				var report *archive.ImportReport
+
+				BeforeEach(func() {
+					report, err = archive.Import(buffer, destination, admission.New(destination, admission.Options{}))
+					Expect(err).To(BeNil())
+				})
+
+				It("should import every record", func() {
+					Expect(report.Imported).To(Equal(5))
+					Expect(report.Skipped).To(Equal(0))
+				})
+
+				It("should recreate the chains", func() {
+					sourceIDs, itErr := source.IDs()
+					Expect(itErr).To(BeNil())
+					Expect(destination.IDs()).To(Equal(sourceIDs))
+
+					head, headErr := destination.Head(chain1[0].Metadata().ID)
+					Expect(headErr).To(BeNil())
+					Expect(head.Data()).To(Equal([]byte("b")))
+				})
+			})
+		})
+
+		Describe("with a list of IDs", func() {
+			BeforeEach(func() {
+				header, err = archive.Export(buffer, source, []string{chain2[0].Metadata().ID})
+				Expect(err).To(BeNil())
+			})
+
+			It("should only export those chains", func() {
+				contents, itErr := archive.Read(bytes.NewReader(buffer.Bytes()))
+				Expect(itErr).To(BeNil())
+				Expect(contents.IDs).To(Equal([]string{chain2[0].Metadata().ID}))
+				Expect(contents.Chains).To(HaveLen(1))
+				Expect(contents.Chains[0].Records()).To(HaveLen(2))
+			})
+		})
+
+		Describe("with a pruned chain", func() {
+			BeforeEach(func() {
+				policies := store.RetentionPolicies{Default: store.RetentionPolicy{KeepLast: 1}}
+				_, err = source.Prune(policies, time.Now())
+				Expect(err).To(BeNil())
+
+				_, err = archive.Export(buffer, source, []string{chain1[0].Metadata().ID})
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(ContainSubstring("was pruned and cannot be exported"))
+			})
+		})
+	})
+
+	Describe("Import", func() {
+		var data []byte
+
+		BeforeEach(func() {
+			_, err = archive.Export(buffer, source, []string{chain1[0].Metadata().ID})
+			Expect(err).To(BeNil())
+			data = buffer.Bytes()
+		})
+
+		Describe("when a byte is corrupted", func() {
+			BeforeEach(func() {
+				data[len(data)-20] ^= 0xff
+				_, err = archive.Import(bytes.NewReader(data), destination, admission.New(destination, admission.Options{}))
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("frame checksum does not match"))
+			})
+
+			It("should not write anything", func() {
+				Expect(destination.IDs()).To(BeEmpty())
+			})
+		})
+
+		Describe("when the archive is truncated", func() {
+			BeforeEach(func() {
+				_, err = archive.Import(bytes.NewReader(data[:len(data)-9]), destination, admission.New(destination, admission.Options{}))
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+			})
+
+			It("should not write anything", func() {
+				Expect(destination.IDs()).To(BeEmpty())
+			})
+		})
+
+		Describe("when the store already has part of the chain", func() {
+			var report *archive.ImportReport
+
+			BeforeEach(func() {
+				Expect(destination.Put(chain1[0])).To(Succeed())
+				report, err = archive.Import(bytes.NewReader(data), destination, admission.New(destination, admission.Options{}))
+				Expect(err).To(BeNil())
+			})
+
+			It("should only import the missing records", func() {
+				Expect(report.Imported).To(Equal(2))
+				Expect(report.Skipped).To(Equal(1))
+			})
+		})
+
+		Describe("when the store is ahead of the archive", func() {
+			var report *archive.ImportReport
+
+			BeforeEach(func() {
+				update := fixtures.GenerateUpdateRecord(chain1[2], privateKey1, "newer")
+				for _, rec := range append(chain1, update) {
+					Expect(destination.Put(rec)).To(Succeed())
+				}
+
+				report, err = archive.Import(bytes.NewReader(data), destination, admission.New(destination, admission.Options{}))
+				Expect(err).To(BeNil())
+			})
+
+			It("should skip every record", func() {
+				Expect(report.Imported).To(Equal(0))
+				Expect(report.Skipped).To(Equal(3))
+			})
+		})
+
+		Describe("when the admitter rejects a record", func() {
+			var report *archive.ImportReport
+
+			BeforeEach(func() {
+				limiter := limits.New(destination, limits.Config{PerIDQuota: limits.Quota{MaxRecords: 2}})
+				report, err = archive.Import(bytes.NewReader(data), destination, admission.New(destination, admission.Options{Limiter: limiter}))
+			})
+
+			It("should yield the admitter's error", func() {
+				Expect(err).To(BeAssignableToTypeOf(&limits.Error{}))
+				Expect(err.(*limits.Error).Kind).To(Equal(limits.KindQuota))
+			})
+
+			It("should report and keep the records imported before it", func() {
+				Expect(report.Imported).To(Equal(2))
+
+				head, itErr := destination.Head(chain1[0].Metadata().ID)
+				Expect(itErr).To(BeNil())
+				Expect(head.Hash()).To(Equal(fixtures.MustHash(chain1[1])))
+			})
+
+			Describe("when imported again", func() {
+				BeforeEach(func() {
+					report, err = archive.Import(bytes.NewReader(data), destination, admission.New(destination, admission.Options{}))
+					Expect(err).To(BeNil())
+				})
+
+				It("should resume after the imported records", func() {
+					Expect(report.Imported).To(Equal(1))
+					Expect(report.Skipped).To(Equal(2))
+
+					head, itErr := destination.Head(chain1[0].Metadata().ID)
+					Expect(itErr).To(BeNil())
+					Expect(head.Hash()).To(Equal(fixtures.MustHash(chain1[2])))
+				})
+			})
+		})
+
+		Describe("when a record is stored while the archive is imported", func() {
+			var report *archive.ImportReport
+
+			BeforeEach(func() {
+				admitter := &storingAdmitter{Admitter: admission.New(destination, admission.Options{}), store: destination, early: chain1[1]}
+				report, err = archive.Import(bytes.NewReader(data), destination, admitter)
+				Expect(err).To(BeNil())
+			})
+
+			It("should skip it", func() {
+				Expect(report.Imported).To(Equal(2))
+				Expect(report.Skipped).To(Equal(1))
+			})
+		})
+
+		Describe("when the store has diverged", func() {
+			var fork record.Record
+
+			BeforeEach(func() {
+				fork = fixtures.GenerateUpdateRecord(chain1[0], privateKey1, "fork")
+				Expect(destination.Put(chain1[0])).To(Succeed())
+				Expect(destination.Put(fork)).To(Succeed())
+
+				_, err = archive.Import(bytes.NewReader(data), destination, admission.New(destination, admission.Options{}))
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("chain for metadata.ID '" + chain1[0].Metadata().ID + "' has diverged from the store"))
+			})
+
+			It("should not write anything", func() {
+				head, itErr := destination.Head(chain1[0].Metadata().ID)
+				Expect(itErr).To(BeNil())
+				Expect(head.Data()).To(Equal([]byte("fork")))
+			})
+		})
+	})
+
+	Describe("with records whose data is stored in chunks", func() {
+		var chunked, rechunked record.Record
+		var data []byte
+
+		BeforeEach(func() {
+			data = bytes.Repeat([]byte("0123456789"), 10)
+			manifest, chunksErr := chunks.Write(source, bytes.NewReader(data), 16)
+			Expect(chunksErr).To(BeNil())
+			metadata := chain1[2].Metadata()
+			metadata.Manifest = manifest
+			chunked = fixtures.GenerateUpdate(chain1[2], privateKey1, metadata, nil)
+			Expect(source.Put(chunked)).To(Succeed())
+
+			manifest, chunksErr = chunks.Write(source, bytes.NewReader(append(data, []byte("more")...)), 16)
+			Expect(chunksErr).To(BeNil())
+			metadata.Manifest = manifest
+			rechunked = fixtures.GenerateUpdate(chunked, privateKey1, metadata, nil)
+			Expect(source.Put(rechunked)).To(Succeed())
+		})
+
+		It("should export each chunk once and import them with the records", func() {
+			header, err := archive.Export(buffer, source, []string{chain1[0].Metadata().ID})
+			Expect(err).To(BeNil())
+			// the 6th chunk of the data repeats the 1st, and the
+			// update only changes the last chunk
+			Expect(header.Chunks).To(Equal(7))
+
+			_, err = archive.Import(buffer, destination, admission.New(destination, admission.Options{}))
+			Expect(err).To(BeNil())
+			Expect(destination.Data(fixtures.MustHash(chunked))).To(Equal(data))
+			Expect(destination.Data(fixtures.MustHash(rechunked))).To(Equal(append(data, []byte("more")...)))
+		})
+
+		It("should import them from an archive file", func() {
+			file, fileErr := ioutil.TempFile("", "meshchain-archive")
+			Expect(fileErr).To(BeNil())
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			_, err = archive.Export(file, source, []string{chain1[0].Metadata().ID})
+			Expect(err).To(BeNil())
+
+			report, err := archive.Import(file, destination, admission.New(destination, admission.Options{}))
+			Expect(err).To(BeNil())
+			Expect(report.Imported).To(Equal(5))
+			Expect(destination.Data(fixtures.MustHash(rechunked))).To(Equal(append(data, []byte("more")...)))
+		})
+
+		Describe("when a chunk of the archive changes after it was read", func() {
+			It("should fail to read the chunk", func() {
+				_, err = archive.Export(buffer, source, []string{chain1[0].Metadata().ID})
+				Expect(err).To(BeNil())
+				archived := buffer.Bytes()
+
+				contents, readErr := archive.Read(bytes.NewReader(archived))
+				Expect(readErr).To(BeNil())
+
+				index := bytes.Index(archived, data[:16])
+				Expect(index).To(BeNumerically(">", 0))
+				archived[index] = 'x'
+
+				_, err = contents.Chunks.Chunk(chunks.LeafHash(data[:16]))
+				Expect(err).To(MatchError("frame checksum does not match"))
+			})
+		})
+
+		Describe("when the store is missing a chunk", func() {
+			It("should not export the chain", func() {
+				leaves, treeErr := source.Tree(chunked.Metadata().Manifest.Root)
+				Expect(treeErr).To(BeNil())
+				Expect(backend.Delete("chunks/" + hex.EncodeToString(leaves[3]))).To(Succeed())
+
+				_, err = archive.Export(buffer, source, nil)
+				Expect(err).To(MatchError(ContainSubstring("Failed to read chunk '3'")))
+			})
+		})
+	})
+})
+
+// storingAdmitter stores the early record as soon as the first
+// record is admitted, like a record that arrives over gossip
+// while an archive is imported
+type storingAdmitter struct {
+	admission.Admitter
+	store store.Store
+	early record.Record
+}
+
+func (admitter *storingAdmitter) AdmitFrom(rec, parent record.Record, src chunks.Source) error {
+	if err := admitter.Admitter.AdmitFrom(rec, parent, src); err != nil {
+		return err
+	}
+	return admitter.store.Put(admitter.early)
+}
+
+func (admitter *storingAdmitter) AdmitAncestor(rec, parent record.Record, src chunks.Source) error {
+	if err := admitter.Admitter.AdmitAncestor(rec, parent, src); err != nil {
+		return err
+	}
+	return admitter.store.Put(admitter.early)
+}
@@ -0,0 +1,152 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// Export writes an archive of the chains for the given metadata.IDs
+// to w. When no IDs are given, every chain in the store is exported.
+// Only complete chains can be exported, as a pruned chain could not
+// be verified by the importer. The chunks of records whose data is
+// stored in chunks are exported with them, each one once
+func Export(w io.Writer, s store.Store, ids []string) (*Header, error) {
+	if len(ids) == 0 {
+		var err error
+		if ids, err = s.IDs(); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []record.Record
+	for _, id := range ids {
+		chain, err := s.Chain(id)
+		if err == store.ErrNotFound {
+			return nil, fmt.Errorf("no chain exists for metadata.ID '%v'", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !chain.Complete() {
+			return nil, fmt.Errorf("chain for metadata.ID '%v' was pruned and cannot be exported", id)
+		}
+
+		records = append(records, chain.Records()...)
+	}
+
+	trees, chunkCount, err := archivedTrees(s, records)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &Header{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Records:   len(records),
+		Chunks:    chunkCount,
+	}
+
+	if _, err := w.Write(magic); err != nil {
+		return nil, err
+	}
+	if err := writeJSONFrame(w, frameHeader, header); err != nil {
+		return nil, err
+	}
+	if err := writeJSONFrame(w, frameIDs, ids); err != nil {
+		return nil, err
+	}
+
+	written := make(map[string]bool)
+	for i, rec := range records {
+		if leaves, ok := trees[i]; ok {
+			if err := writeChunks(w, s, rec.Metadata().Manifest, leaves, written); err != nil {
+				return nil, err
+			}
+		}
+
+		recordPB, err := rec.Proto()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := proto.Marshal(recordPB)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeFrame(w, frameRecord, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeFrame(w, frameEnd, nil); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// archivedTrees returns the verified leaves of the tree of every
+// record whose data is stored in chunks, by the record's index, and
+// the number of distinct chunks they have
+func archivedTrees(s store.Store, records []record.Record) (map[int][][]byte, int, error) {
+	trees := make(map[int][][]byte)
+	distinct := make(map[string]bool)
+
+	for i, rec := range records {
+		manifest := rec.Metadata().Manifest
+		if manifest == nil {
+			continue
+		}
+
+		leaves, err := chunks.VerifiedLeaves(s, manifest)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to export the chunks of metadata.ID '%v': %v", rec.Metadata().ID, err.Error())
+		}
+		trees[i] = leaves
+		for _, leaf := range leaves {
+			distinct[hex.EncodeToString(leaf)] = true
+		}
+	}
+	return trees, len(distinct), nil
+}
+
+// writeChunks writes the leaves of the manifest's tree,
+// followed by every chunk that isn't written yet
+func writeChunks(w io.Writer, s store.Store, manifest *chunks.Manifest, leaves [][]byte, written map[string]bool) error {
+	if err := writeFrame(w, frameTree, bytes.Join(leaves, nil)); err != nil {
+		return err
+	}
+
+	for i, leaf := range leaves {
+		if written[hex.EncodeToString(leaf)] {
+			continue
+		}
+
+		chunk, err := chunks.VerifiedChunk(s, manifest, leaves, i)
+		if err != nil {
+			return err
+		}
+		if err := writeFrame(w, frameChunk, chunk); err != nil {
+			return err
+		}
+		written[hex.EncodeToString(leaf)] = true
+	}
+	return nil
+}
+
+func writeJSONFrame(w io.Writer, frameType byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, frameType, data)
+}
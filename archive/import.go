@@ -0,0 +1,425 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// Contents is the fully verified contents of an archive
+type Contents struct {
+	Header *Header
+	IDs    []string
+	Chains []record.Chain
+
+	// Chunks holds the trees and reads the chunks of
+	// the records whose data is stored in chunks
+	Chunks chunks.Source
+}
+
+// ImportReport describes the result of a call to Import
+type ImportReport struct {
+	// Header is the header of the imported archive
+	Header *Header `json:"header"`
+
+	// IDs lists the metadata.IDs of the chains in the archive
+	IDs []string `json:"ids"`
+
+	// Imported is the number of records written to the store
+	Imported int `json:"imported"`
+
+	// Skipped is the number of records the store already had
+	Skipped int `json:"skipped"`
+}
+
+// Read parses the archive in r, verifying every checksum, hash,
+// signature and parent link, and the chunks of every record whose
+// data is stored in chunks, without writing anything. The archive is
+// read in a single pass that keeps its records and trees, but not its
+// chunks. Contents.Chunks reads them from r again when they're needed,
+// so r must not be closed while they are
+func Read(r io.ReaderAt) (*Contents, error) {
+	frames := &frameReader{r: bufio.NewReader(io.NewSectionReader(r, 0, math.MaxInt64))}
+
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(frames, prefix); err != nil || !bytes.Equal(prefix, magic) {
+		return nil, fmt.Errorf("not a meshchain archive")
+	}
+
+	contents := &Contents{Header: &Header{}}
+	if err := readJSONFrame(frames, frameHeader, contents.Header); err != nil {
+		return nil, err
+	}
+	if contents.Header.Version < 1 || contents.Header.Version > Version {
+		return nil, fmt.Errorf("unsupported archive version '%v'", contents.Header.Version)
+	}
+	if err := readJSONFrame(frames, frameIDs, &contents.IDs); err != nil {
+		return nil, err
+	}
+
+	chains := make(map[string][]record.Record)
+	archived := &archivedChunks{archive: r, trees: make(map[string][][]byte), chunks: make(map[string]int64)}
+	var order []string
+	count := 0
+	chunkCount := 0
+
+	for {
+		offset := frames.offset
+		frameType, payload, err := readFrame(frames)
+		if err != nil {
+			return nil, err
+		}
+		if frameType == frameEnd {
+			break
+		}
+		if frameType == frameTree {
+			if err := archived.addTree(payload); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if frameType == frameChunk {
+			chunkCount++
+			archived.chunks[hex.EncodeToString(chunks.LeafHash(payload))] = offset
+			continue
+		}
+		if frameType != frameRecord {
+			return nil, fmt.Errorf("unexpected frame of type '%v'", frameType)
+		}
+		count++
+
+		recordPB := &encoding.Record{}
+		if err := proto.Unmarshal(payload, recordPB); err != nil {
+			return nil, fmt.Errorf("record %v is corrupt: %v", count, err.Error())
+		}
+
+		id := recordPB.GetMetadata().GetId()
+		records, started := chains[id]
+
+		var parent record.Record
+		if len(recordPB.Parent) == 0 {
+			if started {
+				return nil, fmt.Errorf("record %v is a second root record for metadata.ID '%v'", count, id)
+			}
+			order = append(order, id)
+		} else {
+			if !started {
+				return nil, fmt.Errorf("record %v appears before its root record", count)
+			}
+			parent = records[len(records)-1]
+		}
+
+		rec, err := record.FromProto(recordPB, parent)
+		if err != nil {
+			return nil, fmt.Errorf("record %v is invalid: %v", count, err.Error())
+		}
+		if manifest := rec.Metadata().Manifest; manifest != nil {
+			if err := archived.verify(manifest); err != nil {
+				return nil, fmt.Errorf("record %v is missing its chunks: %v", count, err.Error())
+			}
+		}
+		chains[id] = append(records, rec)
+	}
+
+	if _, err := frames.Read(make([]byte, 1)); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the end of the archive")
+	}
+	if count != contents.Header.Records {
+		return nil, fmt.Errorf("archive contains %v records, but the header lists %v", count, contents.Header.Records)
+	}
+	if chunkCount != contents.Header.Chunks {
+		return nil, fmt.Errorf("archive contains %v chunks, but the header lists %v", chunkCount, contents.Header.Chunks)
+	}
+	contents.Chunks = archived
+
+	if !sameIDs(contents.IDs, order) {
+		return nil, fmt.Errorf("archive chains do not match the listed metadata.IDs")
+	}
+
+	for _, id := range order {
+		chain, err := record.NewChain(chains[id])
+		if err != nil {
+			return nil, err
+		}
+		contents.Chains = append(contents.Chains, chain)
+	}
+
+	return contents, nil
+}
+
+// Import reads an archive and writes its chains to the store through
+// the admitter, along with the chunks of their records. The whole
+// archive is verified, and checked against the chains already in the
+// store, before anything is written. A chain in the store must be a
+// prefix of the archived chain or the archived chain a prefix of it.
+// Chains are written one at a time, each starting after the records
+// the store has by then, and records that are stored meanwhile are
+// skipped. An import that fails part way, such as when the admitter
+// rejects a record, can be resumed by importing the archive again.
+// Chunks are read from r again as they are written, so an r that
+// isn't an io.ReaderAt, such as a pipe, is spooled to a temporary
+// file first rather than held in memory
+func Import(r io.Reader, s store.Store, admitter admission.Admitter) (*ImportReport, error) {
+	archive, ok := r.(io.ReaderAt)
+	if !ok {
+		spool, err := spoolArchive(r)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		archive = spool
+	}
+
+	contents, err := Read(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Header: contents.Header, IDs: contents.IDs}
+
+	for _, chain := range contents.Chains {
+		if _, err := importStart(s, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, chain := range contents.Chains {
+		if err := importChain(s, admitter, chain, contents.Chunks, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// importChain writes the records of the archived chain
+// that the store doesn't have yet, adding them to the report
+func importChain(s store.Store, admitter admission.Admitter, chain record.Chain, src chunks.Source, report *ImportReport) error {
+	start, err := importStart(s, chain)
+	if err != nil {
+		return err
+	}
+	report.Skipped += start
+
+	records := chain.Records()
+	var parent record.Record
+	if start > 0 {
+		parent = records[start-1]
+	}
+
+	for i, rec := range records[start:] {
+		stored, err := isStored(s, rec)
+		if err != nil {
+			return err
+		}
+
+		if stored {
+			report.Skipped++
+		} else {
+			// only the head has to be valid now, the
+			// records before it are imported to reach it
+			admit := admitter.AdmitAncestor
+			if start+i == len(records)-1 {
+				admit = admitter.AdmitFrom
+			}
+			if err := admit(rec, parent, src); err != nil {
+				return err
+			}
+			report.Imported++
+		}
+		parent = rec
+	}
+	return nil
+}
+
+// isStored returns true if the store already has the record
+func isStored(s store.Store, rec record.Record) (bool, error) {
+	hash, err := rec.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.Get(hash)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// importStart returns the index of the first record of the
+// archived chain that the store does not have yet
+func importStart(s store.Store, chain record.Chain) (int, error) {
+	stored, err := s.Chain(chain.ID())
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	hashes := make([]string, len(chain.Records()))
+	for i, rec := range chain.Records() {
+		hash, err := rec.Hash()
+		if err != nil {
+			return 0, err
+		}
+		hashes[i] = hex.EncodeToString(hash)
+	}
+
+	storedHead, err := stored.Head().Hash()
+	if err != nil {
+		return 0, err
+	}
+	for i, hashHex := range hashes {
+		if hashHex == hex.EncodeToString(storedHead) {
+			return i + 1, nil
+		}
+	}
+
+	for _, rec := range stored.Records() {
+		hash, err := rec.Hash()
+		if err != nil {
+			return 0, err
+		}
+		if hex.EncodeToString(hash) == hashes[len(hashes)-1] {
+			return len(hashes), nil
+		}
+	}
+
+	return 0, fmt.Errorf("chain for metadata.ID '%v' has diverged from the store", chain.ID())
+}
+
+// sameIDs returns true if both lists hold the same metadata.IDs
+func sameIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// spoolArchive copies the archive in r to a temporary file
+func spoolArchive(r io.Reader) (*os.File, error) {
+	spool, err := ioutil.TempFile("", "meshchain-import")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(spool, r); err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("Failed to spool the archive: %v", err.Error())
+	}
+	return spool, nil
+}
+
+// frameReader keeps track of the offset
+// in the archive that it has read up to
+type frameReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (frames *frameReader) Read(p []byte) (int, error) {
+	n, err := frames.r.Read(p)
+	frames.offset += int64(n)
+	return n, err
+}
+
+// archivedChunks holds the trees read from an archive and
+// the offsets of its chunk frames, which it reads again from
+// the archive when the chunk is needed
+type archivedChunks struct {
+	archive io.ReaderAt
+	trees   map[string][][]byte
+	chunks  map[string]int64
+}
+
+func (archived *archivedChunks) Chunk(hash []byte) ([]byte, error) {
+	offset, ok := archived.chunks[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	frameType, chunk, err := readFrame(io.NewSectionReader(archived.archive, offset, math.MaxInt64-offset))
+	if err != nil {
+		return nil, err
+	}
+	if frameType != frameChunk {
+		return nil, fmt.Errorf("unexpected frame of type '%v'", frameType)
+	}
+	return chunk, nil
+}
+
+func (archived *archivedChunks) Tree(root []byte) ([][]byte, error) {
+	leaves, ok := archived.trees[hex.EncodeToString(root)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return leaves, nil
+}
+
+// addTree keeps the concatenated leaves of a tree under their root
+func (archived *archivedChunks) addTree(payload []byte) error {
+	if len(payload) == 0 || len(payload)%sha256.Size != 0 {
+		return fmt.Errorf("tree of %v bytes is corrupt", len(payload))
+	}
+
+	leaves := make([][]byte, len(payload)/sha256.Size)
+	for i := range leaves {
+		leaves[i] = payload[i*sha256.Size : (i+1)*sha256.Size]
+	}
+	archived.trees[hex.EncodeToString(chunks.Root(leaves))] = leaves
+	return nil
+}
+
+// verify checks that the tree and every chunk
+// described by the manifest were archived
+func (archived *archivedChunks) verify(manifest *chunks.Manifest) error {
+	leaves, err := chunks.VerifiedLeaves(archived, manifest)
+	if err != nil {
+		return err
+	}
+	for i := range leaves {
+		if _, err := chunks.VerifiedChunk(archived, manifest, leaves, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJSONFrame(r io.Reader, frameType byte, value interface{}) error {
+	actualType, payload, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if actualType != frameType {
+		return fmt.Errorf("unexpected frame of type '%v'", actualType)
+	}
+	return json.Unmarshal(payload, value)
+}
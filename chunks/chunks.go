@@ -0,0 +1,163 @@
+// Package chunks stores data too large to hold in memory, such as
+// firmware images, outside of the records that describe it. The data
+// is split into chunks that are addressed by their hash, so a chunk
+// shared by several versions is only stored once. The chunk hashes
+// are the leaves of a Merkle tree, and a record's signed
+// metadata.Manifest holds the tree's root instead of the data itself.
+//
+// To sign a record from an io.Reader, Write the data to a Store and
+// set the returned Manifest on the metadata before signing a record
+// without data. NewReader streams the data back, verifying every
+// chunk before it is returned. The chunks must be stored before the
+// record that describes them, so nodes Copy them from each other
+// before they store a record they received
+package chunks
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultChunkSize is the chunk size used by Write by default
+const DefaultChunkSize = 256 << 10
+
+// Manifest describes data stored in chunks
+type Manifest struct {
+	// Root is the root of the Merkle tree of the chunks
+	Root []byte
+
+	// Size is the number of bytes of data
+	Size int64
+
+	// ChunkSize is the size of every chunk but the last one,
+	// which holds the rest of the data
+	ChunkSize int
+}
+
+// Chunks returns the number of chunks the data is split in.
+// Empty data is a single empty chunk
+func (manifest *Manifest) Chunks() int {
+	if manifest.Size == 0 || manifest.ChunkSize <= 0 {
+		return 1
+	}
+	return int((manifest.Size + int64(manifest.ChunkSize) - 1) / int64(manifest.ChunkSize))
+}
+
+// Validate returns an error if the manifest can't describe any data
+func (manifest *Manifest) Validate() error {
+	if len(manifest.Root) != 32 {
+		return fmt.Errorf("manifest.Root must be a sha256 hash")
+	}
+	if manifest.ChunkSize <= 0 || int64(manifest.ChunkSize) > math.MaxUint32 {
+		return fmt.Errorf("manifest.ChunkSize '%v' is out of range", manifest.ChunkSize)
+	}
+	if manifest.Size < 0 {
+		return fmt.Errorf("manifest.Size must not be negative")
+	}
+	return nil
+}
+
+// chunkLength returns the length of the chunk at index
+func (manifest *Manifest) chunkLength(index int) int {
+	if index < manifest.Chunks()-1 {
+		return manifest.ChunkSize
+	}
+	return int(manifest.Size - int64(index)*int64(manifest.ChunkSize))
+}
+
+// Source provides chunks and the leaves of their trees, without
+// any guarantee that they are correct. Chunks are copied from a
+// Source with Copy, which verifies them
+type Source interface {
+	// Chunk returns the chunk with the LeafHash
+	Chunk(hash []byte) ([]byte, error)
+
+	// Tree returns the leaves of the tree with the root
+	Tree(root []byte) ([][]byte, error)
+}
+
+// Store keeps chunks and the leaves of their trees. A store.Store
+// satisfies it
+type Store interface {
+	Source
+
+	// PutChunk stores the chunk under its LeafHash and returns the
+	// hash. Putting a chunk that is already stored is a no-op
+	PutChunk(chunk []byte) ([]byte, error)
+
+	// PutTree stores the leaves of the tree with the root. It
+	// returns an error if the leaves don't have that Root
+	PutTree(root []byte, leaves [][]byte) error
+}
+
+// Write splits the data read from r into chunks of chunkSize bytes, or
+// DefaultChunkSize if it is 0, and stores them and the leaves of their
+// tree. Only one chunk is held in memory at a time
+func Write(s Store, r io.Reader, chunkSize int) (*Manifest, error) {
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < 0 || int64(chunkSize) > math.MaxUint32 {
+		return nil, fmt.Errorf("chunkSize '%v' is out of range", chunkSize)
+	}
+
+	var leaves [][]byte
+	var size int64
+	buffer := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Failed to read data: %v", err.Error())
+		}
+		if n == 0 && len(leaves) != 0 {
+			break
+		}
+
+		hash, putErr := s.PutChunk(buffer[:n])
+		if putErr != nil {
+			return nil, fmt.Errorf("Failed to store chunk '%v': %v", len(leaves), putErr.Error())
+		}
+		leaves = append(leaves, hash)
+		size += int64(n)
+
+		if err != nil {
+			break
+		}
+	}
+
+	manifest := &Manifest{Root: Root(leaves), Size: size, ChunkSize: chunkSize}
+	if err := s.PutTree(manifest.Root, leaves); err != nil {
+		return nil, fmt.Errorf("Failed to store tree: %v", err.Error())
+	}
+	return manifest, nil
+}
+
+// Copy stores the chunks of the data described by the manifest that
+// the store is missing, reading them from src and verifying them as
+// NewReader does. The tree is stored last, once every chunk is
+func Copy(s Store, src Source, manifest *Manifest) error {
+	leaves, err := VerifiedLeaves(src, manifest)
+	if err != nil {
+		return err
+	}
+
+	for i, leaf := range leaves {
+		if _, err := s.Chunk(leaf); err == nil {
+			continue
+		}
+
+		chunk, err := VerifiedChunk(src, manifest, leaves, i)
+		if err != nil {
+			return err
+		}
+		if _, err := s.PutChunk(chunk); err != nil {
+			return fmt.Errorf("Failed to store chunk '%v': %v", i, err.Error())
+		}
+	}
+
+	if err := s.PutTree(manifest.Root, leaves); err != nil {
+		return fmt.Errorf("Failed to store tree: %v", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package chunks_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestChunks(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Chunks Suite")
+}
@@ -0,0 +1,198 @@
+package chunks_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chunks", func() {
+	var backend store.Backend
+	var s store.Store
+
+	// storedChunks returns the number of chunks in the backend
+	storedChunks := func() int {
+		keys, err := backend.Keys("chunks/")
+		Expect(err).To(BeNil())
+		return len(keys)
+	}
+
+	BeforeEach(func() {
+		backend = store.NewMemoryBackend()
+		s = store.New(backend)
+	})
+
+	Describe("Write", func() {
+		var data []byte
+		var manifest *chunks.Manifest
+
+		BeforeEach(func() {
+			data = make([]byte, 2500)
+			_, err := rand.Read(data)
+			Expect(err).To(BeNil())
+
+			manifest, err = chunks.Write(s, bytes.NewReader(data), 1000)
+			Expect(err).To(BeNil())
+		})
+
+		It("should describe the data", func() {
+			Expect(manifest.Size).To(Equal(int64(2500)))
+			Expect(manifest.ChunkSize).To(Equal(1000))
+			Expect(manifest.Chunks()).To(Equal(3))
+			Expect(manifest.Validate()).To(Succeed())
+		})
+
+		It("should store every chunk", func() {
+			Expect(storedChunks()).To(Equal(3))
+		})
+
+		It("should be read back by NewReader", func() {
+			read, err := ioutil.ReadAll(chunks.NewReader(s, manifest))
+			Expect(err).To(BeNil())
+			Expect(read).To(Equal(data))
+		})
+
+		Describe("when the data is written again with a changed end", func() {
+			var updated *chunks.Manifest
+
+			BeforeEach(func() {
+				changed := append(append([]byte(nil), data[:2000]...), []byte("new ending")...)
+
+				var err error
+				updated, err = chunks.Write(s, bytes.NewReader(changed), 1000)
+				Expect(err).To(BeNil())
+			})
+
+			It("should have a different root", func() {
+				Expect(updated.Root).NotTo(Equal(manifest.Root))
+			})
+
+			It("should only store the chunk that changed", func() {
+				Expect(storedChunks()).To(Equal(4))
+			})
+		})
+
+		Describe("when a chunk is corrupted", func() {
+			BeforeEach(func() {
+				leaves, err := s.Tree(manifest.Root)
+				Expect(err).To(BeNil())
+				Expect(backend.Put("chunks/"+hex.EncodeToString(leaves[1]), []byte("corrupted"))).To(Succeed())
+			})
+
+			It("should return the chunks before it, then an error", func() {
+				reader := chunks.NewReader(s, manifest)
+
+				first := make([]byte, 1000)
+				_, err := io.ReadFull(reader, first)
+				Expect(err).To(BeNil())
+				Expect(first).To(Equal(data[:1000]))
+
+				_, err = reader.Read(make([]byte, 1000))
+				Expect(err).To(MatchError("chunk '1' does not match its hash"))
+			})
+		})
+
+		Describe("when the tree doesn't match the manifest", func() {
+			BeforeEach(func() {
+				leaves, err := s.Tree(manifest.Root)
+				Expect(err).To(BeNil())
+				swapped := append(append([]byte(nil), leaves[1]...), leaves[0]...)
+				swapped = append(swapped, leaves[2]...)
+				Expect(backend.Put("trees/"+hex.EncodeToString(manifest.Root), swapped)).To(Succeed())
+			})
+
+			It("should not return any data", func() {
+				read, err := ioutil.ReadAll(chunks.NewReader(s, manifest))
+				Expect(err).To(MatchError("tree does not match manifest.Root"))
+				Expect(read).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Write with data that fills the last chunk", func() {
+		It("should not add an empty chunk", func() {
+			manifest, err := chunks.Write(s, bytes.NewReader(make([]byte, 2000)), 1000)
+			Expect(err).To(BeNil())
+			Expect(manifest.Chunks()).To(Equal(2))
+
+			read, err := ioutil.ReadAll(chunks.NewReader(s, manifest))
+			Expect(err).To(BeNil())
+			Expect(read).To(HaveLen(2000))
+		})
+	})
+
+	Describe("Write with empty data", func() {
+		It("should store a single empty chunk", func() {
+			manifest, err := chunks.Write(s, bytes.NewReader(nil), 0)
+			Expect(err).To(BeNil())
+			Expect(manifest.Chunks()).To(Equal(1))
+			Expect(manifest.ChunkSize).To(Equal(chunks.DefaultChunkSize))
+
+			read, err := ioutil.ReadAll(chunks.NewReader(s, manifest))
+			Expect(err).To(BeNil())
+			Expect(read).To(BeEmpty())
+		})
+	})
+
+	Describe("Copy", func() {
+		var source store.Store
+		var manifest *chunks.Manifest
+		var data []byte
+
+		BeforeEach(func() {
+			source = store.New(store.NewMemoryBackend())
+			data = []byte("some data in chunks")
+
+			var err error
+			manifest, err = chunks.Write(source, bytes.NewReader(data), 4)
+			Expect(err).To(BeNil())
+		})
+
+		It("should store the chunks and the tree", func() {
+			Expect(chunks.Copy(s, source, manifest)).To(Succeed())
+
+			read, err := ioutil.ReadAll(chunks.NewReader(s, manifest))
+			Expect(err).To(BeNil())
+			Expect(read).To(Equal(data))
+		})
+
+		It("should only store the chunks that are missing", func() {
+			_, err := chunks.Write(s, bytes.NewReader(data[:8]), 4)
+			Expect(err).To(BeNil())
+			Expect(storedChunks()).To(Equal(2))
+
+			Expect(chunks.Copy(s, source, manifest)).To(Succeed())
+			Expect(storedChunks()).To(Equal(manifest.Chunks()))
+		})
+
+		Describe("when a chunk of the source is corrupted", func() {
+			It("should not store the tree", func() {
+				leaves, err := source.Tree(manifest.Root)
+				Expect(err).To(BeNil())
+				corrupted := store.New(store.NewMemoryBackend())
+				for i, leaf := range leaves {
+					chunk, err := source.Chunk(leaf)
+					Expect(err).To(BeNil())
+					if i == 2 {
+						chunk = []byte("evil")
+					}
+					_, err = corrupted.PutChunk(chunk)
+					Expect(err).To(BeNil())
+				}
+				Expect(corrupted.PutTree(manifest.Root, leaves)).To(Succeed())
+
+				Expect(chunks.Copy(s, corrupted, manifest)).To(MatchError(ContainSubstring("Failed to read chunk '2'")))
+				_, err = s.Tree(manifest.Root)
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package chunks
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/wire"
+)
+
+// PathPrefix is the prefix of the routes served by PeerHandler
+const PathPrefix = "/chunks/"
+
+type peerHash struct {
+	Hash []byte `json:"hash"`
+}
+
+type peerChunk struct {
+	Chunk []byte `json:"chunk"`
+}
+
+type peerLeaves struct {
+	Leaves [][]byte `json:"leaves"`
+}
+
+// NewPeerTransport constructs a Transport that sends each
+// request with the client, which should be a peer.NewHTTPClient.
+// Chunks must fit in a wire message, as the DefaultChunkSize does
+func NewPeerTransport(client *http.Client) Transport {
+	return &peerTransport{client: client}
+}
+
+type peerTransport struct {
+	client *http.Client
+}
+
+func (transport *peerTransport) Source(peer string) Source {
+	return &peerSource{client: transport.client, peer: peer}
+}
+
+type peerSource struct {
+	client *http.Client
+	peer   string
+}
+
+func (source *peerSource) Chunk(hash []byte) ([]byte, error) {
+	response := &peerChunk{}
+	if err := wire.Call(source.client, source.peer, PathPrefix+"chunk", &peerHash{hash}, response); err != nil {
+		return nil, err
+	}
+	return response.Chunk, nil
+}
+
+func (source *peerSource) Tree(root []byte) ([][]byte, error) {
+	response := &peerLeaves{}
+	if err := wire.Call(source.client, source.peer, PathPrefix+"tree", &peerHash{root}, response); err != nil {
+		return nil, err
+	}
+	return response.Leaves, nil
+}
+
+// PeerHandler answers the requests of peer transports under
+// PathPrefix from the source, usually the node's store. It
+// should be served by a peer.NewHTTPServer
+func PeerHandler(source Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, PathPrefix) {
+		case "chunk":
+			request := &peerHash{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			chunk, err := source.Chunk(request.Hash)
+			wire.Write(w, &peerChunk{chunk}, err)
+		case "tree":
+			request := &peerHash{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			leaves, err := source.Tree(request.Hash)
+			wire.Write(w, &peerLeaves{leaves}, err)
+		default:
+			wire.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package chunks_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerTransport", func() {
+	var remoteStore, localStore store.Store
+	var server *http.Server
+	var source chunks.Source
+	var manifest *chunks.Manifest
+
+	BeforeEach(func() {
+		remoteStore = store.New(store.NewMemoryBackend())
+		localStore = store.New(store.NewMemoryBackend())
+
+		var err error
+		manifest, err = chunks.Write(remoteStore, bytes.NewReader([]byte("data held by the remote")), 8)
+		Expect(err).To(BeNil())
+
+		listener, err := peer.Listen("tcp", "127.0.0.1:0", fixtures.GeneratePeerConfig("remote"))
+		Expect(err).To(BeNil())
+
+		mux := http.NewServeMux()
+		mux.Handle(chunks.PathPrefix, chunks.PeerHandler(remoteStore))
+		server = peer.NewHTTPServer(mux)
+		go server.Serve(listener)
+
+		transport := chunks.NewPeerTransport(peer.NewHTTPClient(fixtures.GeneratePeerConfig("local"), time.Second))
+		source = transport.Source(listener.Addr().String())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should Copy the chunks from the peer", func() {
+		Expect(chunks.Copy(localStore, source, manifest)).To(Succeed())
+
+		read, err := ioutil.ReadAll(chunks.NewReader(localStore, manifest))
+		Expect(err).To(BeNil())
+		Expect(read).To(Equal([]byte("data held by the remote")))
+	})
+
+	It("should yield an error for a chunk the peer doesn't have", func() {
+		_, err := source.Chunk(chunks.LeafHash([]byte("unknown")))
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+	})
+})
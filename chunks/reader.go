@@ -0,0 +1,102 @@
+package chunks
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// NewReader returns a reader of the data described by the manifest.
+// Before the first chunk is read, the leaves from the store are
+// checked against manifest.Root. Each chunk is then checked against
+// its leaf as it is read, so a reader only ever returns verified
+// data and stops with an error at the first chunk that isn't
+func NewReader(s Store, manifest *Manifest) io.Reader {
+	return &reader{store: s, manifest: manifest}
+}
+
+type reader struct {
+	store    Store
+	manifest *Manifest
+
+	leaves [][]byte
+	index  int
+	chunk  []byte
+	err    error
+}
+
+func (reader *reader) Read(p []byte) (int, error) {
+	for len(reader.chunk) == 0 && reader.err == nil {
+		reader.err = reader.next()
+	}
+	if len(reader.chunk) == 0 {
+		return 0, reader.err
+	}
+
+	n := copy(p, reader.chunk)
+	reader.chunk = reader.chunk[n:]
+	return n, nil
+}
+
+// next loads and verifies the next chunk. It
+// returns io.EOF once every chunk has been read
+func (reader *reader) next() error {
+	if reader.leaves == nil {
+		leaves, err := VerifiedLeaves(reader.store, reader.manifest)
+		if err != nil {
+			return err
+		}
+		reader.leaves = leaves
+	}
+
+	if reader.index == len(reader.leaves) {
+		return io.EOF
+	}
+
+	chunk, err := VerifiedChunk(reader.store, reader.manifest, reader.leaves, reader.index)
+	if err != nil {
+		return err
+	}
+	reader.chunk = chunk
+	reader.index++
+	return nil
+}
+
+// VerifiedChunk reads the chunk at index from the source and checks it
+// against its leaf, which must come from leaves verified against the
+// manifest, such as the ones returned by VerifiedLeaves
+func VerifiedChunk(s Source, manifest *Manifest, leaves [][]byte, index int) ([]byte, error) {
+	leaf := leaves[index]
+	chunk, err := s.Chunk(leaf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read chunk '%v' (%v): %v", index, hex.EncodeToString(leaf), err.Error())
+	}
+	if !bytes.Equal(LeafHash(chunk), leaf) {
+		return nil, fmt.Errorf("chunk '%v' does not match its hash", index)
+	}
+	if len(chunk) != manifest.chunkLength(index) {
+		return nil, fmt.Errorf("chunk '%v' is %v bytes instead of %v", index, len(chunk), manifest.chunkLength(index))
+	}
+	return chunk, nil
+}
+
+// VerifiedLeaves reads the leaves of the manifest's tree from
+// the source and checks them against manifest.Root
+func VerifiedLeaves(s Source, manifest *Manifest) ([][]byte, error) {
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	leaves, err := s.Tree(manifest.Root)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the tree of '%v': %v", hex.EncodeToString(manifest.Root), err.Error())
+	}
+	if len(leaves) != manifest.Chunks() {
+		return nil, fmt.Errorf("tree has %v leaves instead of %v", len(leaves), manifest.Chunks())
+	}
+	if !bytes.Equal(Root(leaves), manifest.Root) {
+		return nil, fmt.Errorf("tree does not match manifest.Root")
+	}
+	return leaves, nil
+}
@@ -0,0 +1,32 @@
+package chunks
+
+import "fmt"
+
+// Transport reads the chunks stored by peers
+type Transport interface {
+	// Source returns a Source that reads from the peer at the address
+	Source(peer string) Source
+}
+
+// MemoryTransport reads from the Source registered at each
+// address. It is intended for tests and simulations
+type MemoryTransport map[string]Source
+
+// Source returns the Source at the address, or one
+// that fails as if the peer were unreachable
+func (transport MemoryTransport) Source(peer string) Source {
+	if source, ok := transport[peer]; ok {
+		return source
+	}
+	return unreachableSource(peer)
+}
+
+type unreachableSource string
+
+func (peer unreachableSource) Chunk(hash []byte) ([]byte, error) {
+	return nil, fmt.Errorf("peer '%v' is unreachable", string(peer))
+}
+
+func (peer unreachableSource) Tree(root []byte) ([][]byte, error) {
+	return nil, fmt.Errorf("peer '%v' is unreachable", string(peer))
+}
@@ -0,0 +1,99 @@
+package chunks
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// The tree hashes leaves and interior nodes with different
+// prefixes, as in RFC 6962, so that a leaf can't be passed
+// off as an interior node
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash returns the hash a chunk is addressed by,
+// which is also its leaf in the Merkle tree
+func LeafHash(chunk []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{leafPrefix})
+	hasher.Write(chunk)
+	return hasher.Sum(nil)
+}
+
+// Root returns the root of the Merkle tree of the leaves. A
+// tree of n leaves splits them after the largest power of
+// two smaller than n, so the tree of a single leaf is the leaf
+func Root(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return nil
+	case 1:
+		return leaves[0]
+	}
+
+	split := splitPoint(len(leaves))
+	return nodeHash(Root(leaves[:split]), Root(leaves[split:]))
+}
+
+// Proof returns the hashes needed to verify the leaf at
+// index against the Root of the leaves, from the bottom up
+func Proof(leaves [][]byte, index int) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+
+	split := splitPoint(len(leaves))
+	if index < split {
+		return append(Proof(leaves[:split], index), Root(leaves[split:]))
+	}
+	return append(Proof(leaves[split:], index-split), Root(leaves[:split]))
+}
+
+// VerifyProof returns true if the chunk is the one at index
+// of the count chunks whose tree has the root. It lets a chunk
+// be verified on its own, in any order, given its Proof
+func VerifyProof(root []byte, index, count int, chunk []byte, proof [][]byte) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+
+	node, last := uint64(index), uint64(count-1)
+	hash := LeafHash(chunk)
+	for _, sibling := range proof {
+		if last == 0 {
+			return false
+		}
+
+		if node&1 == 1 || node == last {
+			hash = nodeHash(sibling, hash)
+			for node&1 == 0 && node != 0 {
+				node >>= 1
+				last >>= 1
+			}
+		} else {
+			hash = nodeHash(hash, sibling)
+		}
+		node >>= 1
+		last >>= 1
+	}
+	return last == 0 && bytes.Equal(hash, root)
+}
+
+func nodeHash(left, right []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{nodePrefix})
+	hasher.Write(left)
+	hasher.Write(right)
+	return hasher.Sum(nil)
+}
+
+// splitPoint returns the largest power of two smaller than count
+func splitPoint(count int) int {
+	split := 1
+	for split<<1 < count {
+		split <<= 1
+	}
+	return split
+}
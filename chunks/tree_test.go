@@ -0,0 +1,78 @@
+package chunks_test
+
+import (
+	"fmt"
+
+	"github.com/royvandewater/meshchain/chunks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tree", func() {
+	// generateChunks returns count distinct chunks and their leaves
+	generateChunks := func(count int) ([][]byte, [][]byte) {
+		data := make([][]byte, count)
+		leaves := make([][]byte, count)
+		for i := range data {
+			data[i] = []byte(fmt.Sprintf("chunk %v", i))
+			leaves[i] = chunks.LeafHash(data[i])
+		}
+		return data, leaves
+	}
+
+	Describe("Root", func() {
+		It("should be the leaf for a single chunk", func() {
+			_, leaves := generateChunks(1)
+			Expect(chunks.Root(leaves)).To(Equal(leaves[0]))
+		})
+
+		It("should change when any chunk changes", func() {
+			_, leaves := generateChunks(5)
+			root := chunks.Root(leaves)
+
+			leaves[3] = chunks.LeafHash([]byte("changed"))
+			Expect(chunks.Root(leaves)).NotTo(Equal(root))
+		})
+
+		It("should depend on the order of the chunks", func() {
+			_, leaves := generateChunks(2)
+			root := chunks.Root(leaves)
+
+			leaves[0], leaves[1] = leaves[1], leaves[0]
+			Expect(chunks.Root(leaves)).NotTo(Equal(root))
+		})
+	})
+
+	Describe("VerifyProof", func() {
+		It("should verify every chunk of trees of any size", func() {
+			for count := 1; count <= 9; count++ {
+				data, leaves := generateChunks(count)
+				root := chunks.Root(leaves)
+
+				for index := 0; index < count; index++ {
+					proof := chunks.Proof(leaves, index)
+					Expect(chunks.VerifyProof(root, index, count, data[index], proof)).To(BeTrue(), "chunk %v of %v", index, count)
+				}
+			}
+		})
+
+		It("should reject a different chunk", func() {
+			_, leaves := generateChunks(7)
+			proof := chunks.Proof(leaves, 4)
+			Expect(chunks.VerifyProof(chunks.Root(leaves), 4, 7, []byte("forged"), proof)).To(BeFalse())
+		})
+
+		It("should reject a chunk at the wrong index", func() {
+			data, leaves := generateChunks(7)
+			proof := chunks.Proof(leaves, 4)
+			Expect(chunks.VerifyProof(chunks.Root(leaves), 5, 7, data[4], proof)).To(BeFalse())
+		})
+
+		It("should reject a truncated proof", func() {
+			data, leaves := generateChunks(7)
+			proof := chunks.Proof(leaves, 4)
+			Expect(chunks.VerifyProof(chunks.Root(leaves), 4, 7, data[4], proof[:len(proof)-1])).To(BeFalse())
+		})
+	})
+})
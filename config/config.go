@@ -0,0 +1,288 @@
+// Package config loads the configuration of a meshchain node from a
+// TOML file, overridden by environment variables. For example:
+//
+//	[http]
+//	listen = ":8080"
+//
+//	[rpc]
+//	listen = ":9090"
+//
+//	[store]
+//	path = "/var/lib/meshchain"
+//	keys = ["/etc/meshchain/store.key"]
+//
+//	[peer]
+//	listen = ":7946"
+//	address = "node-1.example.com:7946"
+//	key = "/etc/meshchain/node.pem"
+//	peers = ["node-2.example.com:7946"]
+//	deny = []
+//
+//	[membership]
+//	interval = "1s"
+//
+//	[antientropy]
+//	interval = "1m"
+//
+//	[dht]
+//	interval = "10m"
+//
+//	[limits.perPeer]
+//	perSecond = 5.0
+//	burst = 20
+//
+//	[schemas]
+//	"person/v1" = "/etc/meshchain/schemas/person.json"
+//
+//	[validity]
+//	skew = "30s"
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/royvandewater/meshchain/limits"
+)
+
+// DefaultHTTPListen is the address the HTTP API is served on by default
+const DefaultHTTPListen = ":8080"
+
+// Config configures a node
+type Config struct {
+	HTTP   HTTP          `toml:"http"`
+	RPC    RPC           `toml:"rpc"`
+	Store  Store         `toml:"store"`
+	Peer   Peer          `toml:"peer"`
+	Limits limits.Config `toml:"limits"`
+
+	Membership  Membership  `toml:"membership"`
+	AntiEntropy AntiEntropy `toml:"antientropy"`
+	DHT         DHT         `toml:"dht"`
+
+	// Schemas maps the refs that records may set as their
+	// metadata.Schema to the JSON Schema files they are
+	// validated against
+	Schemas map[string]string `toml:"schemas"`
+
+	Validity Validity `toml:"validity"`
+}
+
+// HTTP configures the HTTP API
+type HTTP struct {
+	// Listen is the address to serve the API on,
+	// defaults to :8080. Overridden by $MESHCHAIN_HTTP_LISTEN
+	Listen string `toml:"listen"`
+}
+
+// RPC configures the gRPC RecordService
+type RPC struct {
+	// Listen is the address to serve the RecordService on. It
+	// is disabled when empty. Overridden by $MESHCHAIN_RPC_LISTEN
+	Listen string `toml:"listen"`
+}
+
+// Store configures where records are kept
+type Store struct {
+	// Path is the directory of the store, created if missing.
+	// It is required. Overridden by $MESHCHAIN_STORE_PATH
+	Path string `toml:"path"`
+
+	// Keys are the paths of the files holding the master keys that the
+	// store's values are encrypted with, see store.ReadMasterKey. New
+	// values are encrypted with the first, the others only decrypt
+	// values written before it was rotated in. Values are stored in
+	// the clear when it is empty. Overridden by the comma separated
+	// $MESHCHAIN_STORE_KEYS
+	Keys []string `toml:"keys"`
+}
+
+// Validity configures how the metadata.NotBefore and
+// metadata.NotAfter of submitted records are checked
+type Validity struct {
+	// Skew is how far the clocks of the nodes that sign records
+	// may be off from this node's clock, defaults to 0
+	Skew Duration `toml:"skew"`
+}
+
+// Duration is a time.Duration written as
+// a string such as "30s" or "5m"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses the duration
+func (duration *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	duration.Duration = parsed
+	return nil
+}
+
+// Peer configures the mutually authenticated connections
+// that records are gossiped to other nodes over
+type Peer struct {
+	// Listen is the address to accept peer connections on. Peer
+	// networking is disabled when it is empty. Overridden by
+	// $MESHCHAIN_PEER_LISTEN
+	Listen string `toml:"listen"`
+
+	// Address is the address other nodes reach this node's Listen
+	// address at, defaults to Listen. Overridden by
+	// $MESHCHAIN_PEER_ADDRESS
+	Address string `toml:"address"`
+
+	// Key is the name of a stored key or the path of a pem private
+	// key that identifies the node. It is required when Listen is
+	// set. Overridden by $MESHCHAIN_PEER_KEY
+	Key string `toml:"key"`
+
+	// Peers are the addresses of the nodes to gossip with.
+	// Overridden by the comma separated $MESHCHAIN_PEERS
+	Peers []string `toml:"peers"`
+
+	// Allow, when not empty, lists the only node IDs that may
+	// connect. Overridden by the comma separated $MESHCHAIN_PEER_ALLOW
+	Allow []string `toml:"allow"`
+
+	// Deny lists node IDs that may not connect. Overridden
+	// by the comma separated $MESHCHAIN_PEER_DENY
+	Deny []string `toml:"deny"`
+}
+
+// Membership configures the protocol that detects
+// which nodes are live, see the membership package
+type Membership struct {
+	// Interval is the protocol period. A member that doesn't
+	// acknowledge a probe within half of it is probed indirectly.
+	// Membership is disabled when it is 0, then records are gossiped
+	// to the configured peers only
+	Interval Duration `toml:"interval"`
+}
+
+// AntiEntropy configures the repair of the
+// records that gossip missed, see the antientropy package
+type AntiEntropy struct {
+	// Interval is how often the node syncs with a random peer.
+	// Syncing is disabled when it is 0, but peers can still
+	// sync with the node
+	Interval Duration `toml:"interval"`
+}
+
+// DHT configures the sharding of chains
+// across nodes, see the dht package
+type DHT struct {
+	// Interval is how often the routing table is refreshed and the
+	// chains the node holds are republished, evicting the ones it is
+	// no longer responsible for. The DHT is disabled when it is 0
+	Interval Duration `toml:"interval"`
+}
+
+// Load reads the configuration from the TOML file at path, if path
+// is not empty, applies the environment variable overrides and the
+// defaults, and validates the result
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if path != "" {
+		metadata, err := toml.DecodeFile(path, config)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse config file '%v': %v", path, err.Error())
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) != 0 {
+			return nil, fmt.Errorf("config file '%v' has unknown key '%v'", path, undecoded[0].String())
+		}
+	}
+
+	config.applyEnv()
+	config.applyDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that the required settings are present
+func (config *Config) Validate() error {
+	if config.Store.Path == "" {
+		return fmt.Errorf("store.path is required")
+	}
+	if config.Peer.Listen != "" && config.Peer.Key == "" {
+		return fmt.Errorf("peer.key is required when peer.listen is set")
+	}
+	if config.Validity.Skew.Duration < 0 {
+		return fmt.Errorf("validity.skew must not be negative")
+	}
+
+	intervals := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"membership.interval", config.Membership.Interval.Duration},
+		{"antientropy.interval", config.AntiEntropy.Interval.Duration},
+		{"dht.interval", config.DHT.Interval.Duration},
+	}
+	for _, setting := range intervals {
+		if setting.interval < 0 {
+			return fmt.Errorf("%v must not be negative", setting.name)
+		}
+		if setting.interval > 0 && config.Peer.Listen == "" {
+			return fmt.Errorf("%v requires peer.listen", setting.name)
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides settings with the environment variables that are set
+func (config *Config) applyEnv() {
+	values := map[string]*string{
+		"MESHCHAIN_HTTP_LISTEN":  &config.HTTP.Listen,
+		"MESHCHAIN_RPC_LISTEN":   &config.RPC.Listen,
+		"MESHCHAIN_STORE_PATH":   &config.Store.Path,
+		"MESHCHAIN_PEER_LISTEN":  &config.Peer.Listen,
+		"MESHCHAIN_PEER_ADDRESS": &config.Peer.Address,
+		"MESHCHAIN_PEER_KEY":     &config.Peer.Key,
+	}
+	for name, setting := range values {
+		if value, ok := os.LookupEnv(name); ok {
+			*setting = value
+		}
+	}
+
+	lists := map[string]*[]string{
+		"MESHCHAIN_STORE_KEYS": &config.Store.Keys,
+		"MESHCHAIN_PEERS":      &config.Peer.Peers,
+		"MESHCHAIN_PEER_ALLOW": &config.Peer.Allow,
+		"MESHCHAIN_PEER_DENY":  &config.Peer.Deny,
+	}
+	for name, setting := range lists {
+		if value, ok := os.LookupEnv(name); ok {
+			*setting = splitList(value)
+		}
+	}
+}
+
+func (config *Config) applyDefaults() {
+	if config.HTTP.Listen == "" {
+		config.HTTP.Listen = DefaultHTTPListen
+	}
+	if config.Peer.Address == "" {
+		config.Peer.Address = config.Peer.Listen
+	}
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
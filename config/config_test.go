@@ -0,0 +1,190 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/royvandewater/meshchain/config"
+	"github.com/royvandewater/meshchain/limits"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load", func() {
+	var dir string
+
+	// writeConfig writes the TOML to a file and returns its path
+	writeConfig := func(contents string) string {
+		path := filepath.Join(dir, "meshchain.toml")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config-test")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		for _, name := range []string{"MESHCHAIN_STORE_PATH", "MESHCHAIN_STORE_KEYS", "MESHCHAIN_HTTP_LISTEN", "MESHCHAIN_PEERS"} {
+			os.Unsetenv(name)
+		}
+	})
+
+	Describe("with a complete file", func() {
+		var loaded *config.Config
+
+		BeforeEach(func() {
+			var err error
+			loaded, err = config.Load(writeConfig(`
+[http]
+listen = "127.0.0.1:9000"
+
+[rpc]
+listen = "127.0.0.1:9090"
+
+[store]
+path = "/var/lib/meshchain"
+keys = ["/etc/meshchain/new.key", "/etc/meshchain/old.key"]
+
+[peer]
+listen = ":7946"
+key = "node"
+peers = ["a:7946", "b:7946"]
+deny = ["bad-node"]
+
+[limits.perPeer]
+perSecond = 5.0
+burst = 20
+
+[limits.perIdQuota]
+maxRecords = 100
+
+[schemas]
+"person/v1" = "/etc/meshchain/person.json"
+
+[validity]
+skew = "30s"
+
+[membership]
+interval = "1s"
+
+[antientropy]
+interval = "1m"
+
+[dht]
+interval = "10m"
+`))
+			Expect(err).To(BeNil())
+		})
+
+		It("should read every section", func() {
+			Expect(loaded.HTTP.Listen).To(Equal("127.0.0.1:9000"))
+			Expect(loaded.RPC.Listen).To(Equal("127.0.0.1:9090"))
+			Expect(loaded.Store.Path).To(Equal("/var/lib/meshchain"))
+			Expect(loaded.Store.Keys).To(Equal([]string{"/etc/meshchain/new.key", "/etc/meshchain/old.key"}))
+			Expect(loaded.Peer.Peers).To(Equal([]string{"a:7946", "b:7946"}))
+			Expect(loaded.Peer.Deny).To(Equal([]string{"bad-node"}))
+			Expect(loaded.Schemas).To(Equal(map[string]string{"person/v1": "/etc/meshchain/person.json"}))
+			Expect(loaded.Validity.Skew.Duration).To(Equal(30 * time.Second))
+			Expect(loaded.Membership.Interval.Duration).To(Equal(time.Second))
+			Expect(loaded.AntiEntropy.Interval.Duration).To(Equal(time.Minute))
+			Expect(loaded.DHT.Interval.Duration).To(Equal(10 * time.Minute))
+		})
+
+		It("should read the limits using the same keys as their JSON", func() {
+			Expect(loaded.Limits.PerPeer).To(Equal(limits.Rate{PerSecond: 5, Burst: 20}))
+			Expect(loaded.Limits.PerIDQuota.MaxRecords).To(Equal(100))
+		})
+
+		It("should default the advertised address to the listen address", func() {
+			Expect(loaded.Peer.Address).To(Equal(":7946"))
+		})
+	})
+
+	Describe("with environment variables", func() {
+		var loaded *config.Config
+
+		BeforeEach(func() {
+			os.Setenv("MESHCHAIN_STORE_PATH", "/from/env")
+			os.Setenv("MESHCHAIN_STORE_KEYS", "/from/env.key")
+			os.Setenv("MESHCHAIN_PEERS", "c:7946, d:7946,")
+
+			var err error
+			loaded, err = config.Load(writeConfig(`
+[store]
+path = "/from/file"
+`))
+			Expect(err).To(BeNil())
+		})
+
+		It("should override the file", func() {
+			Expect(loaded.Store.Path).To(Equal("/from/env"))
+			Expect(loaded.Store.Keys).To(Equal([]string{"/from/env.key"}))
+		})
+
+		It("should split lists on commas", func() {
+			Expect(loaded.Peer.Peers).To(Equal([]string{"c:7946", "d:7946"}))
+		})
+
+		It("should apply the defaults", func() {
+			Expect(loaded.HTTP.Listen).To(Equal(config.DefaultHTTPListen))
+		})
+	})
+
+	Describe("without a file", func() {
+		It("should be configurable from the environment alone", func() {
+			os.Setenv("MESHCHAIN_STORE_PATH", "/from/env")
+			loaded, err := config.Load("")
+			Expect(err).To(BeNil())
+			Expect(loaded.Store.Path).To(Equal("/from/env"))
+		})
+
+		It("should require the store path", func() {
+			_, err := config.Load("")
+			Expect(err).To(MatchError("store.path is required"))
+		})
+	})
+
+	Describe("with an unknown key", func() {
+		It("should fail", func() {
+			_, err := config.Load(writeConfig(`
+[store]
+path = "/tmp"
+pth = "typo"
+`))
+			Expect(err).To(MatchError(ContainSubstring("unknown key 'store.pth'")))
+		})
+	})
+
+	Describe("with peer networking but no key", func() {
+		It("should fail", func() {
+			_, err := config.Load(writeConfig(`
+[store]
+path = "/tmp"
+
+[peer]
+listen = ":7946"
+`))
+			Expect(err).To(MatchError("peer.key is required when peer.listen is set"))
+		})
+	})
+
+	Describe("with anti-entropy but no peer networking", func() {
+		It("should fail", func() {
+			_, err := config.Load(writeConfig(`
+[store]
+path = "/tmp"
+
+[antientropy]
+interval = "1m"
+`))
+			Expect(err).To(MatchError("antientropy.interval requires peer.listen"))
+		})
+	})
+})
@@ -2,8 +2,10 @@ package cryptohelpers
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 )
@@ -62,3 +64,48 @@ func RSAPublicKeyToBase64(publicKeyStr string) (string, error) {
 	encoded := base64.StdEncoding.EncodeToString(publicKeyDer)
 	return encoded, nil
 }
+
+// RSAPublicKeyDERToPEM converts a publicKey given as DER encoded
+// PKIX bytes to a string in pem format
+func RSAPublicKeyDERToPEM(publicKeyDer []byte) (string, error) {
+	pub, err := x509.ParsePKIXPublicKey(publicKeyDer)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		return "", fmt.Errorf("publicKey is of the wrong type. Must be rsa")
+	}
+
+	publicKeyBlock := pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyDer,
+	}
+	return string(pem.EncodeToMemory(&publicKeyBlock)), nil
+}
+
+// RSAPublicKeyFingerprint returns the hex encoded sha256 hash of the
+// DER representation of a publicKey given in RSA pem format
+func RSAPublicKeyFingerprint(publicKeyStr string) (string, error) {
+	publicKey, err := BuildRSAPublicKey(publicKeyStr)
+	if err != nil {
+		return "", err
+	}
+
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(publicKeyDer)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// RSAPublicKeyToPEM converts a publicKey to a string in pem format
+func RSAPublicKeyToPEM(publicKey *rsa.PublicKey) (string, error) {
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return RSAPublicKeyDERToPEM(publicKeyDer)
+}
@@ -0,0 +1,135 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// A binary delta is the length of the target as a uvarint, followed
+// by instructions that each append to the target:
+//
+//	0x01 <offset uvarint> <length uvarint>  copy a range of the base
+//	0x02 <length uvarint> <bytes>           insert new bytes
+const (
+	opCopy   = 0x01
+	opInsert = 0x02
+)
+
+// blockSize is the length of the ranges of the base that
+// CreateBinary looks for in the target. Shorter matches
+// are inserted instead of copied
+const blockSize = 16
+
+// ApplyBinary applies the binary delta to the base
+func ApplyBinary(base, patch []byte) ([]byte, error) {
+	reader := bytes.NewReader(patch)
+	size, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("binary delta is truncated")
+	}
+
+	// the length is only a hint until the target
+	// is built, it is not trusted to allocate
+	capacity := uint64(len(base) + len(patch))
+	if size < capacity {
+		capacity = size
+	}
+	target := make([]byte, 0, capacity)
+	for reader.Len() > 0 {
+		op, _ := reader.ReadByte()
+		switch op {
+		case opCopy:
+			offset, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, fmt.Errorf("binary delta is truncated")
+			}
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, fmt.Errorf("binary delta is truncated")
+			}
+			if offset > uint64(len(base)) || length > uint64(len(base))-offset {
+				return nil, fmt.Errorf("binary delta copies past the end of the base")
+			}
+			target = append(target, base[offset:offset+length]...)
+		case opInsert:
+			length, err := binary.ReadUvarint(reader)
+			if err != nil || length > uint64(reader.Len()) {
+				return nil, fmt.Errorf("binary delta is truncated")
+			}
+			inserted := make([]byte, length)
+			reader.Read(inserted)
+			target = append(target, inserted...)
+		default:
+			return nil, fmt.Errorf("binary delta has an unknown instruction '%v'", op)
+		}
+		if uint64(len(target)) > size {
+			return nil, fmt.Errorf("binary delta produced more than '%v' bytes", size)
+		}
+	}
+
+	if uint64(len(target)) != size {
+		return nil, fmt.Errorf("binary delta produced '%v' bytes instead of '%v'", len(target), size)
+	}
+	return target, nil
+}
+
+// CreateBinary returns a binary delta that turns the base into the
+// target. It copies every block of the base that appears in the
+// target, extended as far as the two keep matching, and inserts
+// the rest
+func CreateBinary(base, target []byte) []byte {
+	blocks := make(map[string]int)
+	for offset := 0; offset+blockSize <= len(base); offset += blockSize {
+		key := string(base[offset : offset+blockSize])
+		if _, ok := blocks[key]; !ok {
+			blocks[key] = offset
+		}
+	}
+
+	patch := &bytes.Buffer{}
+	writeUvarint(patch, uint64(len(target)))
+
+	var pending []byte
+	for i := 0; i < len(target); {
+		offset, ok := -1, false
+		if i+blockSize <= len(target) {
+			offset, ok = blocks[string(target[i:i+blockSize])]
+		}
+		if !ok {
+			pending = append(pending, target[i])
+			i++
+			continue
+		}
+
+		length := blockSize
+		for offset+length < len(base) && i+length < len(target) && base[offset+length] == target[i+length] {
+			length++
+		}
+
+		writeInsert(patch, pending)
+		pending = nil
+		patch.WriteByte(opCopy)
+		writeUvarint(patch, uint64(offset))
+		writeUvarint(patch, uint64(length))
+		i += length
+	}
+	writeInsert(patch, pending)
+
+	return patch.Bytes()
+}
+
+// writeInsert writes an insert instruction, unless there is nothing to insert
+func writeInsert(patch *bytes.Buffer, inserted []byte) {
+	if len(inserted) == 0 {
+		return
+	}
+	patch.WriteByte(opInsert)
+	writeUvarint(patch, uint64(len(inserted)))
+	patch.Write(inserted)
+}
+
+func writeUvarint(patch *bytes.Buffer, value uint64) {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	patch.Write(buffer[:binary.PutUvarint(buffer, value)])
+}
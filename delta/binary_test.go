@@ -0,0 +1,83 @@
+package delta_test
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	"github.com/royvandewater/meshchain/delta"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Binary", func() {
+	var base []byte
+
+	BeforeEach(func() {
+		base = make([]byte, 4096)
+		_, err := rand.Read(base)
+		Expect(err).To(BeNil())
+	})
+
+	Describe("with a small change in the middle", func() {
+		var target, patch []byte
+
+		BeforeEach(func() {
+			target = append(append(append([]byte(nil), base[:2000]...), []byte("changed")...), base[2010:]...)
+			patch = delta.CreateBinary(base, target)
+		})
+
+		It("should be much smaller than the target", func() {
+			Expect(len(patch)).To(BeNumerically("<", 100))
+		})
+
+		It("should turn the base into the target", func() {
+			result, err := delta.ApplyBinary(base, patch)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(target))
+		})
+	})
+
+	Describe("with data that repeats a range of the base", func() {
+		It("should turn the base into the target", func() {
+			target := bytes.Repeat(base[100:200], 3)
+			result, err := delta.ApplyBinary(base, delta.CreateBinary(base, target))
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(target))
+		})
+	})
+
+	Describe("with an empty base or target", func() {
+		It("should turn the base into the target", func() {
+			result, err := delta.ApplyBinary(nil, delta.CreateBinary(nil, base))
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(base))
+
+			result, err = delta.ApplyBinary(base, delta.CreateBinary(base, nil))
+			Expect(err).To(BeNil())
+			Expect(result).To(BeEmpty())
+		})
+	})
+
+	Describe("ApplyBinary", func() {
+		It("should reject a copy past the end of the base", func() {
+			_, err := delta.ApplyBinary([]byte("short"), []byte{10, 0x01, 0, 10})
+			Expect(err).To(MatchError("binary delta copies past the end of the base"))
+		})
+
+		It("should reject a truncated insert", func() {
+			_, err := delta.ApplyBinary(nil, []byte{5, 0x02, 5, 'a', 'b'})
+			Expect(err).To(MatchError("binary delta is truncated"))
+		})
+
+		It("should reject a target of the wrong length", func() {
+			_, err := delta.ApplyBinary(nil, []byte{5, 0x02, 2, 'a', 'b'})
+			Expect(err).To(MatchError("binary delta produced '2' bytes instead of '5'"))
+		})
+
+		It("should reject an unknown instruction", func() {
+			_, err := delta.ApplyBinary(nil, []byte{1, 0x07})
+			Expect(err).To(MatchError("binary delta has an unknown instruction '7'"))
+		})
+	})
+})
@@ -0,0 +1,53 @@
+// Package delta encodes the data of an update as a patch against the
+// data of its parent, so that a large document that changes by a few
+// fields per update doesn't have to be carried in full by every
+// record. A record's signed metadata.Delta names the kind of patch its
+// data is, and record.Chain applies the patches to materialize the
+// full data at any version.
+//
+// JSONPatch is an RFC 6902 JSON Patch, for JSON documents. Binary is a
+// compact list of instructions to copy ranges of the parent's data or
+// insert new bytes, for any other data
+package delta
+
+import "fmt"
+
+const (
+	// JSONPatch marks data that is an RFC 6902 JSON Patch
+	JSONPatch = "json-patch"
+
+	// Binary marks data that is a binary delta
+	Binary = "binary"
+)
+
+// Validate returns an error if kind is not a known kind of delta
+func Validate(kind string) error {
+	switch kind {
+	case JSONPatch, Binary:
+		return nil
+	}
+	return fmt.Errorf("unknown delta '%v', must be '%v' or '%v'", kind, JSONPatch, Binary)
+}
+
+// Apply applies the patch of the kind to the base
+// and returns the resulting data
+func Apply(kind string, base, patch []byte) ([]byte, error) {
+	switch kind {
+	case JSONPatch:
+		return ApplyJSONPatch(base, patch)
+	case Binary:
+		return ApplyBinary(base, patch)
+	}
+	return nil, Validate(kind)
+}
+
+// Create returns a patch of the kind that turns the base into target
+func Create(kind string, base, target []byte) ([]byte, error) {
+	switch kind {
+	case JSONPatch:
+		return CreateJSONPatch(base, target)
+	case Binary:
+		return CreateBinary(base, target), nil
+	}
+	return nil, Validate(kind)
+}
@@ -0,0 +1,423 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// operation is a single operation of a JSON Patch
+type operation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyJSONPatch applies the RFC 6902 JSON Patch to the document. The
+// result is compact JSON with the keys of every object sorted, so
+// the same patch always produces the same bytes
+func ApplyJSONPatch(document, patch []byte) ([]byte, error) {
+	value, err := decodeJSON(document)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON: %v", err.Error())
+	}
+
+	var operations []operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON array of operations: %v", err.Error())
+	}
+
+	for i, op := range operations {
+		if value, err = op.apply(value); err != nil {
+			return nil, fmt.Errorf("operation at index '%v' failed: %v", i, err.Error())
+		}
+	}
+	return encodeJSON(value)
+}
+
+// CreateJSONPatch returns an RFC 6902 JSON Patch that turns the
+// document into the target. Objects are compared key by key, any
+// other value that differs, including an array, is replaced
+func CreateJSONPatch(document, target []byte) ([]byte, error) {
+	from, err := decodeJSON(document)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON: %v", err.Error())
+	}
+	to, err := decodeJSON(target)
+	if err != nil {
+		return nil, fmt.Errorf("target is not valid JSON: %v", err.Error())
+	}
+
+	operations, err := diff("", from, to, []operation{})
+	if err != nil {
+		return nil, err
+	}
+	return encodeJSON(operations)
+}
+
+// diff appends the operations that turn from into to at the path
+func diff(path string, from, to interface{}, operations []operation) ([]operation, error) {
+	if reflect.DeepEqual(from, to) {
+		return operations, nil
+	}
+
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if !fromIsObject || !toIsObject {
+		return appendOperation(operations, "replace", path, to)
+	}
+
+	keys := make([]string, 0, len(fromObject)+len(toObject))
+	for key := range fromObject {
+		keys = append(keys, key)
+	}
+	for key := range toObject {
+		if _, ok := fromObject[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var err error
+	for _, key := range keys {
+		childPath := path + "/" + escapeToken(key)
+		fromValue, inFrom := fromObject[key]
+		toValue, inTo := toObject[key]
+
+		switch {
+		case !inTo:
+			operations = append(operations, operation{Op: "remove", Path: childPath})
+		case !inFrom:
+			operations, err = appendOperation(operations, "add", childPath, toValue)
+		default:
+			operations, err = diff(childPath, fromValue, toValue, operations)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return operations, nil
+}
+
+func appendOperation(operations []operation, op, path string, value interface{}) ([]operation, error) {
+	encoded, err := encodeJSON(value)
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(encoded)
+	return append(operations, operation{Op: op, Path: path, Value: &raw}), nil
+}
+
+// apply applies the operation to the document and returns the result
+func (op operation) apply(document interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "test" {
+			current, err := get(document, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equalJSON(current, value) {
+				return nil, fmt.Errorf("test failed, '%v' does not have the expected value", op.Path)
+			}
+			return document, nil
+		}
+		return put(document, path, value, op.Op == "replace")
+	case "remove":
+		return remove(document, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return put(document, path, copyJSON(value), false)
+		}
+		if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+			return nil, fmt.Errorf("'%v' can't be moved into itself", op.From)
+		}
+		if document, err = remove(document, from); err != nil {
+			return nil, err
+		}
+		return put(document, path, value, false)
+	}
+	return nil, fmt.Errorf("unknown op '%v'", op.Op)
+}
+
+func (op operation) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("'%v' requires a value", op.Op)
+	}
+	return decodeJSON(*op.Value)
+}
+
+// get returns the value at the path
+func get(document interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch container := document.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("'%v' does not exist", formatPointer(path[:i+1]))
+			}
+			document = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, fmt.Errorf("'%v' %v", formatPointer(path[:i+1]), err.Error())
+			}
+			document = container[index]
+		default:
+			return nil, fmt.Errorf("'%v' is not an object or array", formatPointer(path[:i]))
+		}
+	}
+	return document, nil
+}
+
+// put adds the value at the path, or replaces the value
+// at the path if replace is true, which must exist
+func put(document interface{}, path []string, value interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := container[token]; replace && !ok {
+			return nil, fmt.Errorf("'%v' does not exist", formatPointer(path))
+		}
+		container[token] = value
+		return document, nil
+	case []interface{}:
+		if replace {
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, fmt.Errorf("'%v' %v", formatPointer(path), err.Error())
+			}
+			container[index] = value
+			return document, nil
+		}
+
+		index := len(container)
+		if token != "-" {
+			if index, err = arrayIndex(token, len(container)); err != nil {
+				return nil, fmt.Errorf("'%v' %v", formatPointer(path), err.Error())
+			}
+		}
+		grown := append(container, nil)
+		copy(grown[index+1:], grown[index:])
+		grown[index] = value
+		return setContainer(document, path[:len(path)-1], grown)
+	}
+	return nil, fmt.Errorf("'%v' is not an object or array", formatPointer(path[:len(path)-1]))
+}
+
+// remove removes the value at the path, which must exist
+func remove(document interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("the whole document can't be removed")
+	}
+
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := container[token]; !ok {
+			return nil, fmt.Errorf("'%v' does not exist", formatPointer(path))
+		}
+		delete(container, token)
+		return document, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, fmt.Errorf("'%v' %v", formatPointer(path), err.Error())
+		}
+		shrunk := append(container[:index:index], container[index+1:]...)
+		return setContainer(document, path[:len(path)-1], shrunk)
+	}
+	return nil, fmt.Errorf("'%v' is not an object or array", formatPointer(path[:len(path)-1]))
+}
+
+// setContainer replaces the array at the path with one that grew or
+// shrunk, since that changes the slice rather than its contents
+func setContainer(document interface{}, path []string, container []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return container, nil
+	}
+
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch grandparent := parent.(type) {
+	case map[string]interface{}:
+		grandparent[token] = container
+	case []interface{}:
+		index, _ := arrayIndex(token, len(grandparent)-1)
+		grandparent[index] = container
+	}
+	return document, nil
+}
+
+// arrayIndex parses an array index, which must be at most max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("is not a valid array index")
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("is not a valid array index")
+	}
+	if index > max {
+		return 0, fmt.Errorf("is out of range")
+	}
+	return index, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its
+// unescaped tokens. The empty pointer is the whole document
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("path '%v' must be empty or start with '/'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	escaped := make([]string, len(tokens))
+	for i, token := range tokens {
+		escaped[i] = "/" + escapeToken(token)
+	}
+	return strings.Join(escaped, "")
+}
+
+func escapeToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// decodeJSON decodes a single JSON value, keeping
+// numbers as they were written
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// encodeJSON encodes the value as compact JSON
+// without escaping HTML characters
+func encodeJSON(value interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// copyJSON returns a deep copy of a decoded JSON value
+func copyJSON(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, child := range typed {
+			copied[key] = copyJSON(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, child := range typed {
+			copied[i] = copyJSON(child)
+		}
+		return copied
+	}
+	return value
+}
+
+// equalJSON compares decoded JSON values, treating
+// numbers that are written differently as equal
+func equalJSON(a, b interface{}) bool {
+	switch typedA := a.(type) {
+	case json.Number:
+		typedB, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if typedA == typedB {
+			return true
+		}
+		floatA, errA := typedA.Float64()
+		floatB, errB := typedB.Float64()
+		return errA == nil && errB == nil && floatA == floatB
+	case map[string]interface{}:
+		typedB, ok := b.(map[string]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for key, childA := range typedA {
+			childB, ok := typedB[key]
+			if !ok || !equalJSON(childA, childB) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		typedB, ok := b.([]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for i := range typedA {
+			if !equalJSON(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,130 @@
+package delta_test
+
+import (
+	"github.com/royvandewater/meshchain/delta"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON Patch", func() {
+	Describe("ApplyJSONPatch", func() {
+		// apply applies the patch to the document and returns the result
+		apply := func(document, patch string) (string, error) {
+			result, err := delta.ApplyJSONPatch([]byte(document), []byte(patch))
+			return string(result), err
+		}
+
+		It("should add, replace and remove object members", func() {
+			result, err := apply(`{"name":"roy","age":30,"tags":{"a":1}}`, `[
+				{"op":"add","path":"/city","value":"phoenix"},
+				{"op":"replace","path":"/age","value":31},
+				{"op":"remove","path":"/tags/a"}
+			]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`{"age":31,"city":"phoenix","name":"roy","tags":{}}`))
+		})
+
+		It("should insert into, append to and remove from arrays", func() {
+			result, err := apply(`{"list":[1,2,3]}`, `[
+				{"op":"add","path":"/list/1","value":"x"},
+				{"op":"add","path":"/list/-","value":4},
+				{"op":"remove","path":"/list/0"}
+			]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`{"list":["x",2,3,4]}`))
+		})
+
+		It("should move and copy values", func() {
+			result, err := apply(`{"a":{"b":[1,2]},"c":null}`, `[
+				{"op":"copy","from":"/a/b","path":"/d"},
+				{"op":"move","from":"/a/b/0","path":"/c"}
+			]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`{"a":{"b":[2]},"c":1,"d":[1,2]}`))
+		})
+
+		It("should unescape the tokens of a path", func() {
+			result, err := apply(`{"a/b":1,"c~d":2}`, `[
+				{"op":"replace","path":"/a~1b","value":3},
+				{"op":"remove","path":"/c~0d"}
+			]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`{"a/b":3}`))
+		})
+
+		It("should keep numbers as they were written", func() {
+			result, err := apply(`{"big":12345678901234567890,"float":1.50}`, `[]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`{"big":12345678901234567890,"float":1.50}`))
+		})
+
+		It("should replace the whole document at the empty path", func() {
+			result, err := apply(`{"a":1}`, `[{"op":"replace","path":"","value":[true]}]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`[true]`))
+		})
+
+		It("should pass a test for an equal value", func() {
+			result, err := apply(`{"a":[1,{"b":2.0}]}`, `[{"op":"test","path":"/a","value":[1,{"b":2}]}]`)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(`{"a":[1,{"b":2.0}]}`))
+		})
+
+		It("should fail a test for a different value", func() {
+			_, err := apply(`{"a":1}`, `[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`)
+			Expect(err).To(MatchError("operation at index '1' failed: test failed, '/a' does not have the expected value"))
+		})
+
+		It("should fail to replace a member that doesn't exist", func() {
+			_, err := apply(`{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`)
+			Expect(err).To(MatchError("operation at index '0' failed: '/b' does not exist"))
+		})
+
+		It("should fail to add past the end of an array", func() {
+			_, err := apply(`[1]`, `[{"op":"add","path":"/2","value":2}]`)
+			Expect(err).To(MatchError("operation at index '0' failed: '/2' is out of range"))
+		})
+
+		It("should fail to move a value into itself", func() {
+			_, err := apply(`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`)
+			Expect(err).To(MatchError("operation at index '0' failed: '/a' can't be moved into itself"))
+		})
+
+		It("should reject an unknown op", func() {
+			_, err := apply(`{}`, `[{"op":"merge","path":"/a"}]`)
+			Expect(err).To(MatchError("operation at index '0' failed: unknown op 'merge'"))
+		})
+
+		It("should reject a patch that isn't an array", func() {
+			_, err := apply(`{}`, `{"op":"add"}`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("CreateJSONPatch", func() {
+		It("should create a patch that turns the document into the target", func() {
+			document := []byte(`{"name":"roy","age":30,"nested":{"keep":true,"drop":1},"list":[1,2]}`)
+			target := []byte(`{"name":"roy","age":31,"nested":{"keep":true,"new":"x"},"list":[1,2,3]}`)
+
+			patch, err := delta.CreateJSONPatch(document, target)
+			Expect(err).To(BeNil())
+			Expect(string(patch)).To(Equal(`[` +
+				`{"op":"replace","path":"/age","value":31},` +
+				`{"op":"replace","path":"/list","value":[1,2,3]},` +
+				`{"op":"remove","path":"/nested/drop"},` +
+				`{"op":"add","path":"/nested/new","value":"x"}` +
+				`]`))
+
+			result, err := delta.ApplyJSONPatch(document, patch)
+			Expect(err).To(BeNil())
+			Expect(result).To(MatchJSON(target))
+		})
+
+		It("should create an empty patch for equal documents", func() {
+			patch, err := delta.CreateJSONPatch([]byte(`{"a":1}`), []byte(`{ "a": 1 }`))
+			Expect(err).To(BeNil())
+			Expect(string(patch)).To(Equal(`[]`))
+		})
+	})
+})
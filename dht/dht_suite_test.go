@@ -0,0 +1,13 @@
+package dht_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDHT(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DHT Suite")
+}
@@ -0,0 +1,96 @@
+package dht
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// idLength is the length of an ID in bytes
+const idLength = sha256.Size
+
+// ID identifies both nodes and keys in the DHT. Nodes are
+// responsible for the keys with the smallest XOR distance
+// to their own ID
+type ID [idLength]byte
+
+// KeyFor returns the key that a record's metadata.ID is stored under
+func KeyFor(id string) ID {
+	return ID(sha256.Sum256([]byte("record:" + id)))
+}
+
+// NodeIDFor returns the ID of the node at the address
+func NodeIDFor(address string) ID {
+	return ID(sha256.Sum256([]byte("node:" + address)))
+}
+
+// String returns the hex encoded ID
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// distance returns the XOR distance between the IDs
+func distance(a, b ID) ID {
+	var result ID
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+	return result
+}
+
+// less returns true if a is a smaller distance than b
+func less(a, b ID) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// bucketIndex returns the index of the k-bucket that other belongs
+// in for a node with the ID self: the number of leading bits they
+// share. It returns idLength*8 when the IDs are equal
+func bucketIndex(self, other ID) int {
+	d := distance(self, other)
+	for i, b := range d {
+		if b == 0 {
+			continue
+		}
+		prefix := i * 8
+		for mask := byte(0x80); b&mask == 0; mask >>= 1 {
+			prefix++
+		}
+		return prefix
+	}
+	return idLength * 8
+}
+
+// byDistance sorts addresses by the distance of
+// their node IDs to the target, closest first
+type byDistance struct {
+	target    ID
+	addresses []string
+}
+
+func (addresses byDistance) Len() int { return len(addresses.addresses) }
+func (addresses byDistance) Swap(i, j int) {
+	addresses.addresses[i], addresses.addresses[j] = addresses.addresses[j], addresses.addresses[i]
+}
+func (addresses byDistance) Less(i, j int) bool {
+	return less(
+		distance(NodeIDFor(addresses.addresses[i]), addresses.target),
+		distance(NodeIDFor(addresses.addresses[j]), addresses.target),
+	)
+}
+
+// Closest returns at most count of the addresses,
+// sorted by the distance of their node IDs to the target
+func Closest(target ID, addresses []string, count int) []string {
+	sorted := append([]string(nil), addresses...)
+	sort.Sort(byDistance{target: target, addresses: sorted})
+	if len(sorted) > count {
+		sorted = sorted[:count]
+	}
+	return sorted
+}
@@ -0,0 +1,533 @@
+// Package dht shards records across nodes with a Kademlia-style
+// distributed hash table, so that no node has to store every chain.
+//
+// Nodes and keys share a 256 bit ID space. A chain is stored under
+// the sha256 of its metadata.ID on the K nodes whose IDs have the
+// smallest XOR distance to that key. Lookups walk the routing tables
+// of successively closer nodes until they reach them. Every node
+// periodically republishes the chains it holds, which restores the
+// replication factor after nodes leave, and evicts the chains that
+// closer nodes have joined for.
+//
+// Chains are replicated from their RootRecord and every record is
+// verified before it is stored, so a pruned chain can only be
+// replicated to nodes that already hold its anchor
+package dht
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+)
+
+const (
+	defaultK     = 8
+	defaultAlpha = 3
+)
+
+// Options configures a Node. Zero values use the defaults
+type Options struct {
+	// K is the size of the k-buckets and the number of
+	// nodes each chain is stored on, defaults to 8
+	K int
+
+	// Alpha is how many nodes a lookup queries
+	// in parallel, defaults to 3
+	Alpha int
+
+	// Admitter checks and stores the records that peers store on
+	// the node and that lookups fetch, defaults to an Admitter
+	// that only checks their validity window
+	Admitter admission.Admitter
+
+	// Chunks, if set, is asked for the chunks of records whose
+	// data is stored in chunks, from the node that sent them.
+	// Without it, such records are only stored if their
+	// chunks already are
+	Chunks chunks.Transport
+}
+
+// Node is a member of the DHT
+type Node interface {
+	Handler
+
+	// Bootstrap adds the peers to the routing table and refreshes
+	// it, looking up the node's own ID to discover its neighbourhood
+	// and a random ID in each more distant bucket. It returns an
+	// error if none of the peers respond
+	Bootstrap(peers []string) error
+
+	// Get looks up the chain for the metadata.ID and
+	// returns its head once it is verified
+	Get(id string) (record.Record, error)
+
+	// Put stores the record locally and on the K nodes closest to
+	// its key. The parent of an update is looked up if it is
+	// not in the local store
+	Put(rec record.Record) error
+
+	// Republish stores every chain the node holds on the K nodes
+	// currently closest to its key. A chain is then evicted from the
+	// store if the node is not one of them and all of them stored it
+	Republish() error
+
+	// Responsible returns true if the node is one of the K nodes
+	// closest to the key of the metadata.ID that are in its routing
+	// table, so it should keep the chain. It doesn't look up the
+	// key, so it may be true for a node that Republish evicts
+	// the chain from later
+	Responsible(id string) bool
+
+	// Run refreshes the routing table and republishes
+	// every interval until stop is closed. Errors are ignored
+	Run(interval time.Duration, stop <-chan struct{})
+}
+
+// New constructs the Node at the address, which keeps the chains
+// it is responsible for in the store and talks to its peers
+// through the transport
+func New(address string, s store.Store, transport Transport, options Options) Node {
+	if options.K <= 0 {
+		options.K = defaultK
+	}
+	if options.Alpha <= 0 {
+		options.Alpha = defaultAlpha
+	}
+	if options.Admitter == nil {
+		options.Admitter = admission.New(s, admission.Options{})
+	}
+
+	return &node{
+		address:   address,
+		id:        NodeIDFor(address),
+		store:     s,
+		transport: transport,
+		options:   options,
+		table:     newRoutingTable(NodeIDFor(address), options.K),
+	}
+}
+
+type node struct {
+	address   string
+	id        ID
+	store     store.Store
+	transport Transport
+	options   Options
+	table     *routingTable
+}
+
+// HandlePing responds if the node is up
+func (node *node) HandlePing(from string) error {
+	node.saw(from)
+	return nil
+}
+
+// HandleFindNode returns the K known nodes closest to the target
+func (node *node) HandleFindNode(from string, target ID) ([]string, error) {
+	node.saw(from)
+	return node.table.closest(target, node.options.K), nil
+}
+
+// HandleFindValue returns the stored chain for the metadata.ID,
+// or the K known nodes closest to its key
+func (node *node) HandleFindValue(from string, id string) ([]*encoding.Record, []string, error) {
+	node.saw(from)
+
+	records, err := node.chain(id)
+	if err == store.ErrNotFound {
+		return nil, node.table.closest(KeyFor(id), node.options.K), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, nil, nil
+}
+
+// HandleStore verifies the chain and stores
+// the records that are not in the store yet
+func (node *node) HandleStore(from string, records []*encoding.Record) error {
+	node.saw(from)
+	src := node.chunkSource(from)
+
+	var parent record.Record
+	for i, recordPB := range records {
+		if existing, err := node.store.Get(recordPB.GetSeal().GetHash()); err == nil {
+			parent = existing
+			continue
+		} else if err != store.ErrNotFound {
+			return err
+		}
+
+		if len(recordPB.Parent) == 0 {
+			parent = nil
+		} else if parent == nil || !bytes.Equal(hashOf(parent), recordPB.Parent) {
+			stored, err := node.store.Get(recordPB.Parent)
+			if err != nil {
+				return fmt.Errorf("parent of record at index '%v' is unknown: %v", i, err.Error())
+			}
+			parent = stored
+		}
+
+		rec, err := record.FromProto(recordPB, parent)
+		if err != nil {
+			return fmt.Errorf("record at index '%v' is invalid: %v", i, err.Error())
+		}
+		if err := node.admit(rec, parent, src, i == len(records)-1); err != nil {
+			return err
+		}
+		parent = rec
+	}
+	return nil
+}
+
+func (node *node) Bootstrap(peers []string) error {
+	reachable := 0
+	for _, peer := range peers {
+		if peer == node.address {
+			continue
+		}
+		if err := node.transport.Ping(peer); err != nil {
+			continue
+		}
+		node.saw(peer)
+		reachable++
+	}
+	if reachable == 0 && len(peers) != 0 {
+		return fmt.Errorf("none of the bootstrap peers responded")
+	}
+
+	node.refresh()
+	return nil
+}
+
+func (node *node) Get(id string) (record.Record, error) {
+	if head, err := node.store.Head(id); err != store.ErrNotFound {
+		return head, err
+	}
+
+	records, _, _ := node.lookup(KeyFor(id), id)
+	if records == nil {
+		return nil, store.ErrNotFound
+	}
+	return records[len(records)-1], nil
+}
+
+func (node *node) Put(rec record.Record) error {
+	id := rec.Metadata().ID
+
+	if parentHash := rec.ParentHash(); len(parentHash) != 0 {
+		if _, err := node.store.Get(parentHash); err == store.ErrNotFound {
+			if err := node.fetchChain(id); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := node.store.Put(rec); err != nil {
+		return err
+	}
+	_, err := node.replicate(id)
+	return err
+}
+
+func (node *node) Republish() error {
+	ids, err := node.store.IDs()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, id := range ids {
+		evict, err := node.replicate(id)
+		if err == nil && evict {
+			err = node.store.Evict(id)
+		}
+		if err != nil && err != store.ErrNotFound {
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to republish '%v' of '%v' chains: %v", len(failed), len(ids), failed)
+	}
+	return nil
+}
+
+func (node *node) Responsible(id string) bool {
+	key := KeyFor(id)
+	known := append(node.table.closest(key, node.options.K), node.address)
+	for _, address := range Closest(key, known, node.options.K) {
+		if address == node.address {
+			return true
+		}
+	}
+	return false
+}
+
+func (node *node) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		node.refresh()
+		node.Republish()
+	}
+}
+
+// refresh looks up the node's own ID, then a random ID in every
+// bucket up to the deepest one, so that the routing table learns
+// about nodes at every distance
+func (node *node) refresh() {
+	node.lookup(node.id, "")
+	for i := node.table.deepest() - 1; i >= 0; i-- {
+		node.lookup(node.table.randomIDInBucket(i), "")
+	}
+}
+
+// chain returns the stored chain for the metadata.ID as protobufs
+func (node *node) chain(id string) ([]*encoding.Record, error) {
+	chain, err := node.store.Chain(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*encoding.Record
+	for _, rec := range chain.Records() {
+		recordPB, err := rec.Proto()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recordPB)
+	}
+	return records, nil
+}
+
+// admit admits a record of a chain that is being replicated. Only
+// the head has to be valid now, the records before it are stored
+// to reach it
+func (node *node) admit(rec, parent record.Record, src chunks.Source, head bool) error {
+	if head {
+		return node.options.Admitter.AdmitFrom(rec, parent, src)
+	}
+	return node.options.Admitter.AdmitAncestor(rec, parent, src)
+}
+
+// fetchChain looks up the chain for the metadata.ID
+// and stores it locally
+func (node *node) fetchChain(id string) error {
+	records, from, _ := node.lookup(KeyFor(id), id)
+	if records == nil {
+		return fmt.Errorf("no node stores metadata.ID '%v'", id)
+	}
+
+	src := node.chunkSource(from)
+	var parent record.Record
+	for i, rec := range records {
+		if _, err := node.store.Get(hashOf(rec)); err == store.ErrNotFound {
+			if err := node.admit(rec, parent, src, i == len(records)-1); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		parent = rec
+	}
+	return nil
+}
+
+// replicate stores the local chain for the metadata.ID on the K
+// nodes closest to its key. It returns true if this node is not
+// one of them and every one of them stored the chain, so that the
+// local copy can be evicted
+func (node *node) replicate(id string) (bool, error) {
+	records, err := node.chain(id)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, closest := node.lookup(KeyFor(id), "")
+	stored := 0
+	responsible := false
+	var lastErr error
+	for _, peer := range closest {
+		if peer == node.address {
+			responsible = true
+			stored++
+			continue
+		}
+		if err := node.transport.Store(peer, records); err != nil {
+			lastErr = err
+			continue
+		}
+		stored++
+	}
+	if stored == 0 && lastErr != nil {
+		return false, fmt.Errorf("Failed to store metadata.ID '%v' on any node: %v", id, lastErr.Error())
+	}
+	return !responsible && stored != 0 && lastErr == nil, nil
+}
+
+// lookupResult is the response of a single node to a lookup
+type lookupResult struct {
+	peer      string
+	records   []*encoding.Record
+	addresses []string
+	err       error
+}
+
+// lookup iteratively queries the nodes closest to the target until
+// the K closest known nodes have all responded. If id is set, it
+// asks for the chain of the metadata.ID and returns the longest
+// verified chain any node holds, along with that node. It always
+// returns the K closest responsive nodes, which include this node
+// if it is among them
+func (node *node) lookup(target ID, id string) ([]record.Record, string, []string) {
+	candidates := map[string]bool{node.address: true}
+	queried := map[string]bool{node.address: true}
+	failed := make(map[string]bool)
+	for _, peer := range node.table.closest(target, node.options.K) {
+		candidates[peer] = true
+	}
+
+	var best []record.Record
+	var bestPeer string
+	for {
+		var batch []string
+		for _, peer := range Closest(target, keys(candidates), node.options.K) {
+			if !queried[peer] && len(batch) < node.options.Alpha {
+				batch = append(batch, peer)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, result := range node.query(batch, target, id) {
+			queried[result.peer] = true
+			if result.err != nil {
+				failed[result.peer] = true
+				delete(candidates, result.peer)
+				node.table.remove(result.peer)
+				continue
+			}
+
+			node.saw(result.peer)
+			for _, address := range result.addresses {
+				if !failed[address] {
+					candidates[address] = true
+				}
+			}
+			if result.records != nil {
+				if chain, err := verifyChain(id, result.records); err == nil && len(chain) > len(best) {
+					best, bestPeer = chain, result.peer
+				}
+			}
+		}
+	}
+
+	return best, bestPeer, Closest(target, keys(candidates), node.options.K)
+}
+
+// chunkSource returns the Source of the chunks held
+// by the peer, or nil if the node has no Options.Chunks
+func (node *node) chunkSource(peer string) chunks.Source {
+	if node.options.Chunks == nil {
+		return nil
+	}
+	return node.options.Chunks.Source(peer)
+}
+
+// query sends FindNode, or FindValue if id is set, to the peers in parallel
+func (node *node) query(peers []string, target ID, id string) []lookupResult {
+	results := make([]lookupResult, len(peers))
+
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+
+			results[i].peer = peer
+			if id == "" {
+				results[i].addresses, results[i].err = node.transport.FindNode(peer, target)
+				return
+			}
+			results[i].records, results[i].addresses, results[i].err = node.transport.FindValue(peer, id)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// saw adds the peer to the routing table. If its bucket is full,
+// the least recently seen node is pinged and evicted if it is down
+func (node *node) saw(peer string) {
+	if peer == node.address {
+		return
+	}
+
+	oldest := node.table.add(peer)
+	if oldest == "" {
+		return
+	}
+	if err := node.transport.Ping(oldest); err != nil {
+		node.table.replace(oldest, peer)
+		return
+	}
+	node.table.touch(oldest)
+}
+
+// verifyChain verifies that the records form a
+// chain from the RootRecord of the metadata.ID
+func verifyChain(id string, records []*encoding.Record) ([]record.Record, error) {
+	chain := make([]record.Record, 0, len(records))
+	var parent record.Record
+	for i, recordPB := range records {
+		rec, err := record.FromProto(recordPB, parent)
+		if err != nil {
+			return nil, fmt.Errorf("record at index '%v' is invalid: %v", i, err.Error())
+		}
+		if rec.Metadata().ID != id {
+			return nil, fmt.Errorf("record at index '%v' has metadata.ID '%v' instead of '%v'", i, rec.Metadata().ID, id)
+		}
+		chain = append(chain, rec)
+		parent = rec
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("chain is empty")
+	}
+	return chain, nil
+}
+
+// hashOf returns the hash of the record, or nil if it cannot be computed
+func hashOf(rec record.Record) []byte {
+	hash, err := rec.Hash()
+	if err != nil {
+		return nil
+	}
+	return hash
+}
+
+// keys returns the keys of the set
+func keys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	return result
+}
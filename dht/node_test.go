@@ -0,0 +1,238 @@
+package dht_test
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/dht"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node", func() {
+	var network dht.MemoryNetwork
+	var addresses []string
+	var nodes map[string]dht.Node
+	var stores map[string]store.Store
+	var records []record.Record
+	var id string
+
+	// holders returns the addresses of the nodes
+	// whose store has the record
+	holders := func(rec record.Record) []string {
+		hash, err := rec.Hash()
+		Expect(err).To(BeNil())
+
+		var result []string
+		for _, address := range addresses {
+			if _, err := stores[address].Get(hash); err == nil {
+				result = append(result, address)
+			}
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		network = dht.NewMemoryNetwork()
+		addresses = nil
+		nodes = make(map[string]dht.Node)
+		stores = make(map[string]store.Store)
+
+		for i := 0; i < 20; i++ {
+			address := fmt.Sprintf("node-%02d", i)
+			stores[address] = store.New(store.NewMemoryBackend())
+			nodes[address] = dht.New(address, stores[address], network.Transport(address), dht.Options{K: 3})
+			network.Join(address, nodes[address])
+			addresses = append(addresses, address)
+		}
+		for _, address := range addresses[1:] {
+			Expect(nodes[address].Bootstrap([]string{addresses[0]})).To(Succeed())
+		}
+
+		records, _ = fixtures.GenerateChain(1)
+		id = records[0].Metadata().ID
+	})
+
+	Describe("Bootstrap", func() {
+		It("should fail if no peer responds", func() {
+			node := dht.New("lonely", store.New(store.NewMemoryBackend()), network.Transport("lonely"), dht.Options{})
+			Expect(node.Bootstrap([]string{"nobody"})).To(MatchError("none of the bootstrap peers responded"))
+		})
+	})
+
+	Describe("Put", func() {
+		var closest []string
+
+		BeforeEach(func() {
+			Expect(nodes["node-05"].Put(records[0])).To(Succeed())
+			closest = dht.Closest(dht.KeyFor(id), addresses, 3)
+		})
+
+		It("should store the record on the K closest nodes", func() {
+			for _, address := range closest {
+				Expect(holders(records[0])).To(ContainElement(address))
+			}
+		})
+
+		It("should not store the record anywhere else", func() {
+			Expect(len(holders(records[0]))).To(BeNumerically("<=", 4))
+		})
+
+		Describe("when an update is put from a node without the chain", func() {
+			var publisher string
+
+			BeforeEach(func() {
+				for _, address := range addresses {
+					if _, err := stores[address].Head(id); err == store.ErrNotFound {
+						publisher = address
+						break
+					}
+				}
+				Expect(nodes[publisher].Put(records[1])).To(Succeed())
+			})
+
+			It("should store the update on the K closest nodes", func() {
+				for _, address := range closest {
+					Expect(holders(records[1])).To(ContainElement(address))
+				}
+			})
+		})
+
+		Describe("Get", func() {
+			It("should find the head from any node", func() {
+				for _, address := range addresses {
+					head, err := nodes[address].Get(id)
+					Expect(err).To(BeNil())
+					Expect(head.Data()).To(Equal(records[0].Data()))
+				}
+			})
+
+			It("should return ErrNotFound for an unknown chain", func() {
+				_, err := nodes["node-10"].Get("unknown")
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+
+		Describe("when every node republishes", func() {
+			BeforeEach(func() {
+				for _, address := range addresses {
+					Expect(nodes[address].Republish()).To(Succeed())
+				}
+			})
+
+			It("should only keep the chain on the K closest nodes", func() {
+				Expect(holders(records[0])).To(ConsistOf(closest))
+			})
+		})
+
+		Describe("Responsible", func() {
+			It("should be true for the K closest nodes", func() {
+				for _, address := range closest {
+					Expect(nodes[address].Responsible(id)).To(BeTrue())
+				}
+			})
+
+			It("should only be true for a node that knows fewer than K closer nodes", func() {
+				node := dht.New("new", store.New(store.NewMemoryBackend()), network.Transport("new"), dht.Options{K: 3})
+				network.Join("new", node)
+				Expect(node.Bootstrap(closest)).To(Succeed())
+
+				newClosest := dht.Closest(dht.KeyFor(id), append([]string{"new"}, closest...), 3)
+				Expect(node.Responsible(id)).To(Equal(newClosest[0] == "new" || newClosest[1] == "new" || newClosest[2] == "new"))
+			})
+		})
+
+		Describe("when the closest node leaves", func() {
+			var remaining []string
+
+			BeforeEach(func() {
+				network.Leave(closest[0])
+				for _, address := range addresses {
+					if address != closest[0] {
+						remaining = append(remaining, address)
+					}
+				}
+
+				// the first round evicts the departed node from the
+				// routing tables of the nodes around it, the second
+				// reaches the node that replaces it
+				for round := 0; round < 2; round++ {
+					for _, address := range remaining {
+						nodes[address].Republish()
+					}
+				}
+			})
+
+			It("should restore the replication factor", func() {
+				for _, address := range dht.Closest(dht.KeyFor(id), remaining, 3) {
+					Expect(holders(records[0])).To(ContainElement(address))
+				}
+			})
+
+			It("should still find the record", func() {
+				head, err := nodes[remaining[0]].Get(id)
+				Expect(err).To(BeNil())
+				Expect(head.Data()).To(Equal(records[0].Data()))
+			})
+		})
+	})
+
+	Describe("HandleStore", func() {
+		It("should reject a forged record", func() {
+			recordPB, err := records[0].Proto()
+			Expect(err).To(BeNil())
+			recordPB.Data = []byte(`forged`)
+
+			err = nodes["node-01"].HandleStore("node-02", []*encoding.Record{recordPB})
+			Expect(err).To(MatchError(ContainSubstring("record at index '0' is invalid")))
+		})
+
+		It("should reject an update with an unknown parent", func() {
+			recordPB, err := records[1].Proto()
+			Expect(err).To(BeNil())
+
+			err = nodes["node-01"].HandleStore("node-02", []*encoding.Record{recordPB})
+			Expect(err).To(MatchError(ContainSubstring("parent of record at index '0' is unknown")))
+		})
+
+		It("should not admit an expired record", func() {
+			expired := fixtures.GenerateRootRecordWithin(time.Time{}, time.Now().Add(-time.Hour))
+			recordPB, err := expired.Proto()
+			Expect(err).To(BeNil())
+
+			err = nodes["node-01"].HandleStore("node-02", []*encoding.Record{recordPB})
+			Expect(err).To(MatchError(ContainSubstring("record expired at")))
+			Expect(stores["node-01"].IDs()).To(BeEmpty())
+		})
+
+		It("should fetch the chunks of a record from the sender with Options.Chunks", func() {
+			sender := store.New(store.NewMemoryBackend())
+			root, privateKey := fixtures.GenerateRootRecord(record.Metadata{})
+			manifest, err := chunks.Write(sender, bytes.NewReader([]byte("chunked data")), 4)
+			Expect(err).To(BeNil())
+			metadata := root.Metadata()
+			metadata.Manifest = manifest
+			chunked := fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+
+			var recordPBs []*encoding.Record
+			for _, rec := range []record.Record{root, chunked} {
+				recordPB, err := rec.Proto()
+				Expect(err).To(BeNil())
+				recordPBs = append(recordPBs, recordPB)
+			}
+
+			s := store.New(store.NewMemoryBackend())
+			transport := chunks.MemoryTransport{"sender": sender}
+			node := dht.New("receiver", s, network.Transport("receiver"), dht.Options{Chunks: transport})
+			Expect(node.HandleStore("sender", recordPBs)).To(Succeed())
+			Expect(s.Data(fixtures.MustHash(chunked))).To(Equal([]byte("chunked data")))
+		})
+	})
+})
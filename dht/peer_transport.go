@@ -0,0 +1,159 @@
+package dht
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/wire"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// PathPrefix is the prefix of the routes served by PeerHandler
+const PathPrefix = "/dht/"
+
+type peerFindNode struct {
+	Target []byte `json:"target"`
+}
+
+type peerFindValue struct {
+	ID string `json:"id"`
+}
+
+type peerNodes struct {
+	Records []*encoding.Record `json:"records,omitempty"`
+	Closest []string           `json:"closest"`
+}
+
+type peerStore struct {
+	Records []*encoding.Record `json:"records"`
+}
+
+// NewPeerTransport constructs a Transport that sends each message
+// with the client, which should be a peer.NewHTTPClient. Peers add
+// the address in the client's identity to their routing tables, so
+// this node must serve a PeerHandler there
+func NewPeerTransport(client *http.Client) Transport {
+	return &peerTransport{client: client}
+}
+
+type peerTransport struct {
+	client *http.Client
+}
+
+func (transport *peerTransport) Ping(peer string) error {
+	return wire.Call(transport.client, peer, PathPrefix+"ping", struct{}{}, nil)
+}
+
+func (transport *peerTransport) FindNode(peer string, target ID) ([]string, error) {
+	response := &peerNodes{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"find-node", &peerFindNode{target[:]}, response); err != nil {
+		return nil, err
+	}
+	return response.Closest, nil
+}
+
+func (transport *peerTransport) FindValue(peer string, id string) ([]*encoding.Record, []string, error) {
+	response := &peerNodes{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"find-value", &peerFindValue{id}, response); err != nil {
+		return nil, nil, err
+	}
+	return response.Records, response.Closest, nil
+}
+
+func (transport *peerTransport) Store(peer string, records []*encoding.Record) error {
+	return wire.Call(transport.client, peer, PathPrefix+"store", &peerStore{records}, nil)
+}
+
+// PeerHandler answers the messages of peer transports under
+// PathPrefix. It should be served by a peer.NewHTTPServer. The
+// sender of each message is the address in its verified identity
+// record, so peers can't put other addresses in the routing table.
+// Every store message takes a token for its sender from the
+// limiter, unless it is nil
+func PeerHandler(handler Handler, limiter limits.Limiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, PathPrefix) {
+		case "ping":
+			if !wire.Read(w, r, &struct{}{}) {
+				return
+			}
+			from, err := senderAddress(r)
+			if err == nil {
+				err = handler.HandlePing(from)
+			}
+			wire.Write(w, nil, err)
+		case "find-node":
+			request := &peerFindNode{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			response := &peerNodes{}
+			from, err := senderAddress(r)
+			if err == nil && len(request.Target) != idLength {
+				err = fmt.Errorf("target must be %v bytes long", idLength)
+			}
+			if err == nil {
+				var target ID
+				copy(target[:], request.Target)
+				response.Closest, err = handler.HandleFindNode(from, target)
+			}
+			wire.Write(w, response, err)
+		case "find-value":
+			request := &peerFindValue{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			response := &peerNodes{}
+			from, err := senderAddress(r)
+			if err == nil {
+				response.Records, response.Closest, err = handler.HandleFindValue(from, request.ID)
+			}
+			wire.Write(w, response, err)
+		case "store":
+			if err := allowSender(limiter, r); err != nil {
+				wire.Write(w, nil, err)
+				return
+			}
+			request := &peerStore{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			from, err := senderAddress(r)
+			if err == nil {
+				err = handler.HandleStore(from, request.Records)
+			}
+			wire.Write(w, nil, err)
+		default:
+			wire.NotFound(w, r)
+		}
+	})
+}
+
+// senderAddress returns the address in the verified identity
+// record of the peer that sent the request
+func senderAddress(r *http.Request) (string, error) {
+	conn, ok := peer.RequestConn(r)
+	if !ok {
+		return "", fmt.Errorf("connection is not authenticated")
+	}
+	return membership.IdentityAddress(conn.PeerIdentity())
+}
+
+// allowSender takes a token from the limiter for the peer that sent
+// the request, keyed on the metadata.ID of its verified identity
+// record, since its address is only what the identity claims
+func allowSender(limiter limits.Limiter, r *http.Request) error {
+	if limiter == nil {
+		return nil
+	}
+
+	conn, ok := peer.RequestConn(r)
+	if !ok {
+		return fmt.Errorf("connection is not authenticated")
+	}
+	return limiter.AllowPeer(conn.PeerIdentity().Metadata().ID)
+}
@@ -0,0 +1,82 @@
+package dht_test
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/dht"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerTransport", func() {
+	var servers []*http.Server
+	var nodes []dht.Node
+	var stores []store.Store
+	var records []record.Record
+
+	// start runs a node that serves the DHT on a peer listener
+	start := func() (dht.Node, string) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		address := listener.Addr().String()
+		config := fixtures.GeneratePeerConfig(address)
+
+		peerListener, err := peer.NewListener(listener, config)
+		Expect(err).To(BeNil())
+
+		transport := dht.NewPeerTransport(peer.NewHTTPClient(config, time.Second))
+		s := store.New(store.NewMemoryBackend())
+		node := dht.New(address, s, transport, dht.Options{K: 2})
+
+		mux := http.NewServeMux()
+		mux.Handle(dht.PathPrefix, dht.PeerHandler(node, nil))
+		server := peer.NewHTTPServer(mux)
+		go server.Serve(peerListener)
+
+		servers, nodes, stores = append(servers, server), append(nodes, node), append(stores, s)
+		return node, address
+	}
+
+	BeforeEach(func() {
+		servers, nodes, stores = nil, nil, nil
+
+		_, seed := start()
+		for i := 0; i < 3; i++ {
+			node, _ := start()
+			Expect(node.Bootstrap([]string{seed})).To(Succeed())
+		}
+
+		records, _ = fixtures.GenerateChain(1)
+		Expect(nodes[1].Put(records[0])).To(Succeed())
+		Expect(nodes[1].Put(records[1])).To(Succeed())
+	})
+
+	AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	})
+
+	It("should replicate the chain to other nodes", func() {
+		replicas := 0
+		for i, s := range stores {
+			if _, err := s.Get(fixtures.MustHash(records[1])); i != 1 && err == nil {
+				replicas++
+			}
+		}
+		Expect(replicas).To(BeNumerically(">=", 1))
+	})
+
+	It("should let another node find the chain", func() {
+		head, err := nodes[3].Get(records[0].Metadata().ID)
+		Expect(err).To(BeNil())
+		Expect(fixtures.MustHash(head)).To(Equal(fixtures.MustHash(records[1])))
+	})
+})
@@ -0,0 +1,126 @@
+package dht
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// routingTable holds the known nodes in k-buckets. Bucket i holds
+// nodes whose IDs share exactly i leading bits with the local ID,
+// least recently seen first
+type routingTable struct {
+	self ID
+	k    int
+
+	lock    sync.RWMutex
+	buckets [idLength*8 + 1][]string
+}
+
+func newRoutingTable(self ID, k int) *routingTable {
+	return &routingTable{self: self, k: k}
+}
+
+// add records that the node at the address was seen. It returns
+// the least recently seen node of the bucket if the bucket is full,
+// in which case the caller should ping it and call replace
+// or touch depending on whether it responds
+func (table *routingTable) add(address string) string {
+	index := bucketIndex(table.self, NodeIDFor(address))
+	if index == idLength*8 {
+		return ""
+	}
+
+	table.lock.Lock()
+	defer table.lock.Unlock()
+
+	bucket := table.buckets[index]
+	for i, known := range bucket {
+		if known == address {
+			table.buckets[index] = append(append(bucket[:i:i], bucket[i+1:]...), address)
+			return ""
+		}
+	}
+
+	if len(bucket) < table.k {
+		table.buckets[index] = append(bucket, address)
+		return ""
+	}
+	return bucket[0]
+}
+
+// replace evicts the unresponsive node in favour of the new one
+func (table *routingTable) replace(unresponsive, address string) {
+	table.remove(unresponsive)
+	table.add(address)
+}
+
+// touch marks the node as the most recently seen of its bucket
+func (table *routingTable) touch(address string) {
+	table.add(address)
+}
+
+// remove forgets the node at the address
+func (table *routingTable) remove(address string) {
+	index := bucketIndex(table.self, NodeIDFor(address))
+	if index == idLength*8 {
+		return
+	}
+
+	table.lock.Lock()
+	defer table.lock.Unlock()
+
+	bucket := table.buckets[index]
+	for i, known := range bucket {
+		if known == address {
+			table.buckets[index] = append(bucket[:i:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// addresses returns every known node
+func (table *routingTable) addresses() []string {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	var addresses []string
+	for _, bucket := range table.buckets {
+		addresses = append(addresses, bucket...)
+	}
+	return addresses
+}
+
+// closest returns the count known nodes closest to the target
+func (table *routingTable) closest(target ID, count int) []string {
+	return Closest(target, table.addresses(), count)
+}
+
+// deepest returns the index of the deepest non-empty bucket, or -1
+func (table *routingTable) deepest() int {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	for i := len(table.buckets) - 1; i >= 0; i-- {
+		if len(table.buckets[i]) != 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// randomIDInBucket returns a random ID that belongs in bucket index:
+// it shares index leading bits with the local ID and differs in the next
+func (table *routingTable) randomIDInBucket(index int) ID {
+	var id ID
+	rand.Read(id[:])
+
+	for bit := 0; bit <= index; bit++ {
+		mask := byte(0x80) >> uint(bit%8)
+		selfBit := table.self[bit/8] & mask
+		if bit == index {
+			selfBit ^= mask
+		}
+		id[bit/8] = id[bit/8]&^mask | selfBit
+	}
+	return id
+}
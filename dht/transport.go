@@ -0,0 +1,134 @@
+package dht
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// Handler serves the DHT protocol for a node. Every call
+// carries the address of the sender, which the receiver
+// adds to its routing table
+type Handler interface {
+	// HandlePing responds if the node is up
+	HandlePing(from string) error
+
+	// HandleFindNode returns the addresses of the
+	// known nodes closest to the target
+	HandleFindNode(from string, target ID) ([]string, error)
+
+	// HandleFindValue returns the stored chain for the metadata.ID,
+	// oldest first. If the node doesn't store it, it returns the
+	// addresses of the known nodes closest to its key instead
+	HandleFindValue(from string, id string) ([]*encoding.Record, []string, error)
+
+	// HandleStore verifies and stores a chain, oldest first
+	HandleStore(from string, records []*encoding.Record) error
+}
+
+// Transport delivers DHT messages to peers by address
+type Transport interface {
+	// Ping checks that the peer is up
+	Ping(peer string) error
+
+	// FindNode asks the peer for the nodes closest to the target
+	FindNode(peer string, target ID) ([]string, error)
+
+	// FindValue asks the peer for the chain of the metadata.ID
+	FindValue(peer string, id string) ([]*encoding.Record, []string, error)
+
+	// Store asks the peer to store the chain
+	Store(peer string, records []*encoding.Record) error
+}
+
+// MemoryNetwork connects handlers within a single process.
+// It is intended for tests and simulations
+type MemoryNetwork interface {
+	// Join registers the handler at the address
+	Join(address string, handler Handler)
+
+	// Leave removes the handler at the address. Messages
+	// sent to it afterwards fail as if it were unreachable
+	Leave(address string)
+
+	// Transport returns a Transport that sends
+	// messages on behalf of the address
+	Transport(address string) Transport
+}
+
+// NewMemoryNetwork constructs an empty MemoryNetwork
+func NewMemoryNetwork() MemoryNetwork {
+	return &memoryNetwork{handlers: make(map[string]Handler)}
+}
+
+type memoryNetwork struct {
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+func (network *memoryNetwork) Join(address string, handler Handler) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	network.handlers[address] = handler
+}
+
+func (network *memoryNetwork) Leave(address string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	delete(network.handlers, address)
+}
+
+func (network *memoryNetwork) Transport(address string) Transport {
+	return &memoryTransport{network: network, address: address}
+}
+
+func (network *memoryNetwork) handler(address string) (Handler, error) {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+
+	handler, ok := network.handlers[address]
+	if !ok {
+		return nil, fmt.Errorf("peer '%v' is unreachable", address)
+	}
+	return handler, nil
+}
+
+type memoryTransport struct {
+	network *memoryNetwork
+	address string
+}
+
+func (transport *memoryTransport) Ping(peer string) error {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return err
+	}
+	return handler.HandlePing(transport.address)
+}
+
+func (transport *memoryTransport) FindNode(peer string, target ID) ([]string, error) {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleFindNode(transport.address, target)
+}
+
+func (transport *memoryTransport) FindValue(peer string, id string) ([]*encoding.Record, []string, error) {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return handler.HandleFindValue(transport.address, id)
+}
+
+func (transport *memoryTransport) Store(peer string, records []*encoding.Record) error {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return err
+	}
+	return handler.HandleStore(transport.address, records)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/royvandewater/meshchain/store"
+)
+
+// runFsck checks the store for corruption and prints a JSON
+// report. It fails if any problems were found
+func runFsck(args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	dir, keys := storeFlags(flags)
+	repair := flags.Bool("repair", false, "rebuild the chain indexes from the raw records")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	s, lock, err := openStore(*dir, *keys)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	report, err := s.Fsck(store.FsckOptions{Repair: *repair})
+	if err != nil {
+		return err
+	}
+
+	if err := printJSON(report); err != nil {
+		return err
+	}
+
+	if len(report.Problems) > 0 && !report.Repaired {
+		return fmt.Errorf("found %v problem(s)", len(report.Problems))
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+// Package gossip propagates newly accepted records across the mesh.
+//
+// When a node accepts a record it announces the record's hash to a
+// random subset of its peers. A peer that has not seen the hash before
+// pulls the record, and any missing ancestors, from the announcer,
+// verifies it, stores it and announces it to its own peers until the
+// announcement's TTL runs out
+package gossip
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+)
+
+const (
+	defaultFanout    = 3
+	defaultTTL       = 4
+	defaultSeenSize  = 10000
+	defaultWorkers   = 8
+	defaultQueueSize = 1024
+
+	// maxAncestors is the most ancestors that are pulled
+	// from a peer to connect a record to the local chain
+	maxAncestors = 256
+)
+
+// Options configures a Node. Zero values use the defaults
+type Options struct {
+	// Fanout is how many random peers each record is announced to,
+	// defaults to 3
+	Fanout int
+
+	// TTL is how many hops an announcement of a record accepted
+	// by this node may travel, defaults to 4
+	TTL int
+
+	// SeenSize is how many announced hashes are remembered in
+	// order to suppress duplicates, defaults to 10000
+	SeenSize int
+
+	// Workers is how many pulls and announcements are
+	// sent at the same time, defaults to 8
+	Workers int
+
+	// QueueSize is how many pulls and announcements may wait for
+	// a worker, defaults to 1024. Announcements that don't fit
+	// are dropped, since gossip is best effort
+	QueueSize int
+
+	// OnError is called with the error of every pull that failed.
+	// Errors are ignored if it is nil
+	OnError func(err error)
+
+	// Admitter checks and stores pulled records, defaults to
+	// an Admitter that only checks their validity window
+	Admitter admission.Admitter
+
+	// Chunks, if set, is asked for the chunks of pulled records
+	// whose data is stored in chunks, from the peer they were
+	// pulled from. Without it, such records are only stored
+	// if their chunks already are
+	Chunks chunks.Transport
+
+	// Members, if set, is asked for the peers of every
+	// announcement in place of the peers given to SetPeers
+	Members Members
+
+	// Range, if set, limits the pulled records to the chains it is
+	// responsible for. Records of other chains are neither stored
+	// nor announced further
+	Range Range
+}
+
+// Members returns the addresses of the live nodes in the
+// mesh. A membership.Membership satisfies it
+type Members interface {
+	Addresses() []string
+}
+
+// Range decides which chains a node keeps. A dht.Node satisfies it
+type Range interface {
+	Responsible(id string) bool
+}
+
+// errOutOfRange is returned by pull for a record
+// of a chain that is outside of Options.Range
+var errOutOfRange = errors.New("record is outside of the node's range")
+
+// ErrQueueFull is returned by HandleAnnounce when the
+// announced record can't be queued to be pulled
+var ErrQueueFull = errors.New("gossip queue is full")
+
+// Node gossips records between a store and its peers. Pulls and
+// announcements are queued and sent by a fixed number of workers,
+// so neither Publish nor HandleAnnounce waits for the network
+type Node interface {
+	Handler
+
+	// Close stops the workers. Queued pulls
+	// and announcements are dropped
+	Close()
+
+	// Publish stores a record that was accepted
+	// locally and announces it to peers
+	Publish(rec record.Record) error
+
+	// SetPeers replaces the addresses that records are announced
+	// to. They are ignored when the Node has Options.Members
+	SetPeers(peers []string)
+}
+
+// New constructs a Node that stores gossiped records in the
+// store and talks to its peers through the transport. Close
+// must be called to stop its workers
+func New(s store.Store, transport Transport, options Options) Node {
+	if options.Fanout <= 0 {
+		options.Fanout = defaultFanout
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultTTL
+	}
+	if options.SeenSize <= 0 {
+		options.SeenSize = defaultSeenSize
+	}
+	if options.Workers <= 0 {
+		options.Workers = defaultWorkers
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultQueueSize
+	}
+	if options.Admitter == nil {
+		options.Admitter = admission.New(s, admission.Options{})
+	}
+
+	node := &node{
+		store:     s,
+		transport: transport,
+		options:   options,
+		seen:      newSeenSet(options.SeenSize),
+		queue:     make(chan func(), options.QueueSize),
+		done:      make(chan struct{}),
+	}
+	for i := 0; i < options.Workers; i++ {
+		go node.work()
+	}
+	return node
+}
+
+type node struct {
+	store     store.Store
+	transport Transport
+	options   Options
+	seen      *seenSet
+
+	queue     chan func()
+	done      chan struct{}
+	closeOnce sync.Once
+
+	lock  sync.RWMutex
+	peers []string
+}
+
+// HandleAnnounce queues the announced record to be pulled
+// if it hasn't been seen before, or returns ErrQueueFull
+func (node *node) HandleAnnounce(from string, announcement Announcement) error {
+	if !node.seen.add(announcement.Hash) {
+		return nil
+	}
+
+	if _, err := node.store.Get(announcement.Hash); err != store.ErrNotFound {
+		// already stored, or the store is failing. Either
+		// way there is nothing to pull
+		return err
+	}
+
+	if !node.enqueue(func() { node.receive(from, announcement) }) {
+		node.seen.remove(announcement.Hash)
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// Close stops the workers
+func (node *node) Close() {
+	node.closeOnce.Do(func() { close(node.done) })
+}
+
+// HandleFetch returns the stored record with the hash
+func (node *node) HandleFetch(hash []byte) (*encoding.Record, error) {
+	rec, err := node.store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Proto()
+}
+
+// Publish stores the record and announces it to peers
+func (node *node) Publish(rec record.Record) error {
+	if err := node.store.Put(rec); err != nil {
+		return err
+	}
+
+	hash, err := rec.Hash()
+	if err != nil {
+		return err
+	}
+
+	node.seen.add(hash)
+	node.announce(Announcement{Hash: hash, TTL: node.options.TTL}, "")
+	return nil
+}
+
+// SetPeers replaces the peers
+func (node *node) SetPeers(peers []string) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	node.peers = append([]string(nil), peers...)
+}
+
+// receive pulls, verifies and stores the announced
+// record, then announces it further
+func (node *node) receive(from string, announcement Announcement) {
+	err := node.pull(from, announcement.Hash)
+	if err == errOutOfRange {
+		return
+	}
+	if err != nil {
+		// forget the hash so that a later announcement can retry
+		node.seen.remove(announcement.Hash)
+		if node.options.OnError != nil {
+			node.options.OnError(fmt.Errorf("Failed to pull '%v' from '%v': %v", hex.EncodeToString(announcement.Hash), from, err.Error()))
+		}
+		return
+	}
+
+	if announcement.TTL > 1 {
+		node.announce(Announcement{Hash: announcement.Hash, TTL: announcement.TTL - 1}, from)
+	}
+}
+
+// announce queues the announcement to up to Fanout random peers,
+// skipping the peer it was received from. Gossip is best effort,
+// so announcements that don't fit in the queue and peers that
+// can't be reached are ignored
+func (node *node) announce(announcement Announcement, from string) {
+	for _, peer := range node.pickPeers(from) {
+		peer := peer
+		node.enqueue(func() { node.transport.Announce(peer, announcement) })
+	}
+}
+
+// enqueue queues the job for a worker, returning
+// false if the queue is full or the node is closed
+func (node *node) enqueue(job func()) bool {
+	select {
+	case <-node.done:
+		return false
+	default:
+	}
+
+	select {
+	case node.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// work runs queued jobs until the node is closed
+func (node *node) work() {
+	for {
+		select {
+		case <-node.done:
+			return
+		case job := <-node.queue:
+			job()
+		}
+	}
+}
+
+func (node *node) pickPeers(exclude string) []string {
+	peers := node.currentPeers()
+
+	var picked []string
+	for _, i := range rand.Perm(len(peers)) {
+		if len(picked) == node.options.Fanout {
+			break
+		}
+		if peers[i] == exclude {
+			continue
+		}
+		picked = append(picked, peers[i])
+	}
+	return picked
+}
+
+// currentPeers returns the addresses of the live members, or
+// the peers given to SetPeers if there are no Members
+func (node *node) currentPeers() []string {
+	if node.options.Members != nil {
+		return node.options.Members.Addresses()
+	}
+
+	node.lock.RLock()
+	defer node.lock.RUnlock()
+	return node.peers
+}
+
+// pull fetches the record with the hash from the peer, along with
+// any ancestors that aren't stored yet, and admits them oldest first.
+// Each record is verified against its parent before it is admitted
+func (node *node) pull(peer string, hash []byte) error {
+	var fetched []*encoding.Record
+	var parent record.Record
+
+	for next := hash; ; {
+		if len(fetched) > maxAncestors {
+			return fmt.Errorf("record has more than %v missing ancestors", maxAncestors)
+		}
+
+		recordPB, err := node.fetch(peer, next)
+		if err != nil {
+			return err
+		}
+		if len(fetched) == 0 && node.options.Range != nil && !node.options.Range.Responsible(recordPB.GetMetadata().GetId()) {
+			return errOutOfRange
+		}
+		fetched = append(fetched, recordPB)
+
+		if len(recordPB.Parent) == 0 {
+			break
+		}
+
+		parent, err = node.store.Get(recordPB.Parent)
+		if err == nil {
+			break
+		}
+		if err != store.ErrNotFound {
+			return err
+		}
+		next = recordPB.Parent
+	}
+
+	var src chunks.Source
+	if node.options.Chunks != nil {
+		src = node.options.Chunks.Source(peer)
+	}
+
+	for i := len(fetched) - 1; i >= 0; i-- {
+		rec, err := record.FromProto(fetched[i], parent)
+		if err != nil {
+			return err
+		}
+		// only the gossiped record has to be valid now, the
+		// missing ancestors are fetched to reach it
+		admit := node.options.Admitter.AdmitAncestor
+		if i == 0 {
+			admit = node.options.Admitter.AdmitFrom
+		}
+		if err := admit(rec, parent, src); err != nil {
+			return err
+		}
+		parent = rec
+	}
+	return nil
+}
+
+// fetch requests the record from the peer and makes
+// sure the peer sent the record that was asked for
+func (node *node) fetch(peer string, hash []byte) (*encoding.Record, error) {
+	recordPB, err := node.transport.Fetch(peer, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(recordPB.GetSeal().GetHash(), hash) {
+		return nil, fmt.Errorf("peer sent a different record than '%v'", hex.EncodeToString(hash))
+	}
+	return recordPB, nil
+}
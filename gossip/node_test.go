@@ -0,0 +1,375 @@
+package gossip_test
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/gossip"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingHandler counts the fetches served by the handler it wraps
+type countingHandler struct {
+	gossip.Handler
+
+	lock    sync.Mutex
+	fetches int
+}
+
+func (handler *countingHandler) HandleFetch(hash []byte) (*encoding.Record, error) {
+	handler.lock.Lock()
+	handler.fetches++
+	handler.lock.Unlock()
+
+	return handler.Handler.HandleFetch(hash)
+}
+
+// lyingHandler serves the same record for every hash
+type lyingHandler struct {
+	recordPB *encoding.Record
+}
+
+func (handler *lyingHandler) HandleAnnounce(from string, announcement gossip.Announcement) error {
+	return nil
+}
+
+func (handler *lyingHandler) HandleFetch(hash []byte) (*encoding.Record, error) {
+	return handler.recordPB, nil
+}
+
+// staticMembers always returns the same addresses
+type staticMembers []string
+
+func (members staticMembers) Addresses() []string {
+	return members
+}
+
+// noRange is responsible for no chain
+type noRange struct{}
+
+func (noRange) Responsible(id string) bool {
+	return false
+}
+
+// blockingHandler serves fetches once blocked is closed
+type blockingHandler struct {
+	blocked chan struct{}
+}
+
+func (handler *blockingHandler) HandleAnnounce(from string, announcement gossip.Announcement) error {
+	return nil
+}
+
+func (handler *blockingHandler) HandleFetch(hash []byte) (*encoding.Record, error) {
+	<-handler.blocked
+	return nil, fmt.Errorf("not found")
+}
+
+var _ = Describe("Node", func() {
+	var network gossip.MemoryNetwork
+	var addresses []string
+	var nodes map[string]gossip.Node
+	var stores map[string]store.Store
+	var handlers map[string]*countingHandler
+	var errs chan error
+	var records []record.Record
+
+	// join adds a node to the network. It starts without peers
+	join := func(address string, options gossip.Options) {
+		options.OnError = func(err error) { errs <- err }
+		stores[address] = store.New(store.NewMemoryBackend())
+		nodes[address] = gossip.New(stores[address], network.Transport(address), options)
+		handlers[address] = &countingHandler{Handler: nodes[address]}
+		network.Join(address, handlers[address])
+		addresses = append(addresses, address)
+	}
+
+	// connectAll makes every node a peer of every other node
+	connectAll := func() {
+		for _, address := range addresses {
+			var peers []string
+			for _, peer := range addresses {
+				if peer != address {
+					peers = append(peers, peer)
+				}
+			}
+			nodes[address].SetPeers(peers)
+		}
+	}
+
+	has := func(address string, rec record.Record) bool {
+		hash, err := rec.Hash()
+		Expect(err).To(BeNil())
+
+		_, err = stores[address].Get(hash)
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		network = gossip.NewMemoryNetwork()
+		addresses = nil
+		nodes = make(map[string]gossip.Node)
+		stores = make(map[string]store.Store)
+		handlers = make(map[string]*countingHandler)
+		errs = make(chan error, 100)
+		records, _ = fixtures.GenerateChain(2)
+	})
+
+	AfterEach(func() {
+		for _, node := range nodes {
+			node.Close()
+		}
+	})
+
+	Describe("in a fully connected network", func() {
+		BeforeEach(func() {
+			for i := 0; i < 5; i++ {
+				join(fmt.Sprintf("node-%v", i), gossip.Options{Fanout: 4})
+			}
+			connectAll()
+
+			// each record propagates before the next is published, since
+			// a concurrent pull of a child fetches its missing parent too
+			for _, rec := range records {
+				Expect(nodes["node-0"].Publish(rec)).To(Succeed())
+				for _, address := range addresses {
+					Eventually(func() bool { return has(address, rec) }).Should(BeTrue(), address)
+				}
+			}
+		})
+
+		It("should propagate every record to every node", func() {
+			for _, address := range addresses {
+				for _, rec := range records {
+					Expect(has(address, rec)).To(BeTrue(), address)
+				}
+			}
+		})
+
+		It("should fetch each record at most once per node", func() {
+			fetches := func() int {
+				total := 0
+				for _, handler := range handlers {
+					handler.lock.Lock()
+					total += handler.fetches
+					handler.lock.Unlock()
+				}
+				return total
+			}
+			Eventually(fetches).Should(Equal(len(records) * (len(addresses) - 1)))
+			Consistently(fetches, "100ms").Should(Equal(len(records) * (len(addresses) - 1)))
+		})
+	})
+
+	Describe("in a line of nodes", func() {
+		BeforeEach(func() {
+			for i := 0; i < 4; i++ {
+				join(fmt.Sprintf("node-%v", i), gossip.Options{TTL: 2})
+			}
+			for i, address := range addresses {
+				var peers []string
+				if i > 0 {
+					peers = append(peers, addresses[i-1])
+				}
+				if i < len(addresses)-1 {
+					peers = append(peers, addresses[i+1])
+				}
+				nodes[address].SetPeers(peers)
+			}
+
+			Expect(nodes["node-0"].Publish(records[0])).To(Succeed())
+		})
+
+		It("should stop propagating once the TTL runs out", func() {
+			Eventually(func() bool { return has("node-1", records[0]) }).Should(BeTrue())
+			Eventually(func() bool { return has("node-2", records[0]) }).Should(BeTrue())
+			Consistently(func() bool { return has("node-3", records[0]) }, "100ms").Should(BeFalse())
+		})
+	})
+
+	Describe("when a node missed earlier records", func() {
+		BeforeEach(func() {
+			join("node-0", gossip.Options{})
+			join("node-1", gossip.Options{})
+			connectAll()
+
+			Expect(stores["node-0"].Put(records[0])).To(Succeed())
+			Expect(stores["node-0"].Put(records[1])).To(Succeed())
+			Expect(nodes["node-0"].Publish(records[2])).To(Succeed())
+		})
+
+		It("should pull the missing ancestors", func() {
+			for _, rec := range records {
+				Eventually(func() bool { return has("node-1", rec) }).Should(BeTrue())
+			}
+		})
+	})
+
+	Describe("when a peer serves a different record than announced", func() {
+		var err error
+
+		BeforeEach(func() {
+			join("node-0", gossip.Options{})
+
+			recordPB, protoErr := records[0].Proto()
+			Expect(protoErr).To(BeNil())
+			network.Join("liar", &lyingHandler{recordPB: recordPB})
+
+			hash, hashErr := records[1].Hash()
+			Expect(hashErr).To(BeNil())
+			err = nodes["node-0"].HandleAnnounce("liar", gossip.Announcement{Hash: hash, TTL: 1})
+		})
+
+		It("should report an error", func() {
+			Expect(err).To(BeNil())
+			Eventually(errs).Should(Receive(MatchError(ContainSubstring("peer sent a different record"))))
+		})
+
+		It("should not store anything", func() {
+			Eventually(errs).Should(Receive())
+			ids, err := stores["node-0"].IDs()
+			Expect(err).To(BeNil())
+			Expect(ids).To(BeEmpty())
+		})
+	})
+
+	Describe("when a peer serves a tampered record", func() {
+		var err error
+
+		BeforeEach(func() {
+			join("node-0", gossip.Options{})
+
+			recordPB, protoErr := records[0].Proto()
+			Expect(protoErr).To(BeNil())
+			recordPB.Data = []byte(`tampered`)
+			network.Join("liar", &lyingHandler{recordPB: recordPB})
+
+			err = nodes["node-0"].HandleAnnounce("liar", gossip.Announcement{Hash: recordPB.Seal.Hash, TTL: 1})
+		})
+
+		It("should report an error", func() {
+			Expect(err).To(BeNil())
+			Eventually(errs).Should(Receive(MatchError(ContainSubstring("None of the PublicKeys matches the signature"))))
+		})
+
+		It("should retry when the record is announced again", func() {
+			Eventually(errs).Should(Receive())
+			recordPB, protoErr := records[0].Proto()
+			Expect(protoErr).To(BeNil())
+			network.Join("liar", &lyingHandler{recordPB: recordPB})
+
+			hash, hashErr := records[0].Hash()
+			Expect(hashErr).To(BeNil())
+			Expect(nodes["node-0"].HandleAnnounce("liar", gossip.Announcement{Hash: hash, TTL: 1})).To(Succeed())
+			Eventually(func() bool { return has("node-0", records[0]) }).Should(BeTrue())
+		})
+	})
+
+	Describe("with Members", func() {
+		BeforeEach(func() {
+			join("node-0", gossip.Options{Members: staticMembers{"node-1"}})
+			join("node-1", gossip.Options{})
+			nodes["node-0"].SetPeers([]string{"nowhere"})
+
+			Expect(nodes["node-0"].Publish(records[0])).To(Succeed())
+		})
+
+		It("should announce to the members", func() {
+			Eventually(func() bool { return has("node-1", records[0]) }).Should(BeTrue())
+		})
+	})
+
+	Describe("with a Range that excludes the chain", func() {
+		BeforeEach(func() {
+			join("node-0", gossip.Options{})
+			join("node-1", gossip.Options{Range: noRange{}})
+			join("node-2", gossip.Options{})
+			nodes["node-0"].SetPeers([]string{"node-1"})
+			nodes["node-1"].SetPeers([]string{"node-2"})
+
+			Expect(nodes["node-0"].Publish(records[0])).To(Succeed())
+		})
+
+		It("should neither store the record nor announce it further", func() {
+			Eventually(func() int {
+				handlers["node-0"].lock.Lock()
+				defer handlers["node-0"].lock.Unlock()
+				return handlers["node-0"].fetches
+			}).Should(Equal(1))
+			Consistently(func() bool { return has("node-1", records[0]) || has("node-2", records[0]) }).Should(BeFalse())
+			Expect(errs).NotTo(Receive())
+		})
+	})
+
+	Describe("with Chunks", func() {
+		var chunked record.Record
+
+		BeforeEach(func() {
+			transport := chunks.MemoryTransport{}
+			join("node-0", gossip.Options{Chunks: transport})
+			join("node-1", gossip.Options{Chunks: transport})
+			connectAll()
+			for _, address := range addresses {
+				transport[address] = stores[address]
+			}
+
+			root, privateKey := fixtures.GenerateRootRecord(record.Metadata{})
+			manifest, err := chunks.Write(stores["node-0"], bytes.NewReader([]byte("chunked data")), 4)
+			Expect(err).To(BeNil())
+			metadata := root.Metadata()
+			metadata.Manifest = manifest
+			chunked = fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+
+			Expect(nodes["node-0"].Publish(root)).To(Succeed())
+			Expect(nodes["node-0"].Publish(chunked)).To(Succeed())
+		})
+
+		It("should pull the chunks of the record along with it", func() {
+			Eventually(func() bool { return has("node-1", chunked) }).Should(BeTrue())
+			Expect(stores["node-1"].Data(fixtures.MustHash(chunked))).To(Equal([]byte("chunked data")))
+		})
+	})
+
+	Describe("when the announced record is rejected by the admitter", func() {
+		var expired record.Record
+
+		BeforeEach(func() {
+			join("node-0", gossip.Options{})
+			join("node-1", gossip.Options{})
+			connectAll()
+
+			expired = fixtures.GenerateRootRecordWithin(time.Time{}, time.Now().Add(-time.Hour))
+			Expect(stores["node-0"].Put(expired)).To(Succeed())
+			Expect(nodes["node-1"].HandleAnnounce("node-0", gossip.Announcement{Hash: fixtures.MustHash(expired), TTL: 1})).To(Succeed())
+		})
+
+		It("should not store it", func() {
+			Eventually(errs).Should(Receive(MatchError(ContainSubstring("record expired at"))))
+			Expect(has("node-1", expired)).To(BeFalse())
+		})
+	})
+
+	Describe("when the queue is full", func() {
+		It("should reject announcements that don't fit", func() {
+			blocked := make(chan struct{})
+			defer close(blocked)
+			network.Join("slow", &blockingHandler{blocked: blocked})
+			join("node-0", gossip.Options{Workers: 1, QueueSize: 1})
+
+			var results []error
+			for _, rec := range records {
+				results = append(results, nodes["node-0"].HandleAnnounce("slow", gossip.Announcement{Hash: fixtures.MustHash(rec), TTL: 1}))
+			}
+			Expect(results).To(ContainElement(gossip.ErrQueueFull))
+		})
+	})
+})
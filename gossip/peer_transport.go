@@ -0,0 +1,120 @@
+package gossip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/wire"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// PathPrefix is the prefix of the routes served by PeerHandler
+const PathPrefix = "/gossip/"
+
+// peerAnnounce is an Announcement. The receiver fetches the record
+// from the address in the sender's verified identity record, never
+// from an address the sender names in the message
+type peerAnnounce struct {
+	Hash []byte `json:"hash"`
+	TTL  int    `json:"ttl"`
+}
+
+type peerFetch struct {
+	Hash []byte `json:"hash"`
+}
+
+type peerRecord struct {
+	Record *encoding.Record `json:"record"`
+}
+
+// NewPeerTransport constructs a Transport that sends each message
+// with the client, which should be a peer.NewHTTPClient. Peers fetch
+// announced records from the address in the client's identity, so
+// this node must serve a PeerHandler there
+func NewPeerTransport(client *http.Client) Transport {
+	return &peerTransport{client: client}
+}
+
+type peerTransport struct {
+	client *http.Client
+}
+
+func (transport *peerTransport) Announce(address string, announcement Announcement) error {
+	request := &peerAnnounce{Hash: announcement.Hash, TTL: announcement.TTL}
+	return wire.Call(transport.client, address, PathPrefix+"announce", request, nil)
+}
+
+func (transport *peerTransport) Fetch(address string, hash []byte) (*encoding.Record, error) {
+	response := &peerRecord{}
+	if err := wire.Call(transport.client, address, PathPrefix+"fetch", &peerFetch{Hash: hash}, response); err != nil {
+		return nil, err
+	}
+	if response.Record == nil {
+		return nil, fmt.Errorf("peer '%v' did not send a record", address)
+	}
+	return response.Record, nil
+}
+
+// PeerHandler answers the requests of peer transports under
+// PathPrefix. It should be served by a peer.NewHTTPServer,
+// so that announcements come from authenticated peers. Every
+// announcement takes a token for its sender from the limiter,
+// unless it is nil
+func PeerHandler(handler Handler, limiter limits.Limiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, PathPrefix) {
+		case "announce":
+			if err := allowSender(limiter, r); err != nil {
+				wire.Write(w, nil, err)
+				return
+			}
+			request := &peerAnnounce{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			from, err := senderAddress(r)
+			if err == nil {
+				err = handler.HandleAnnounce(from, Announcement{Hash: request.Hash, TTL: request.TTL})
+			}
+			wire.Write(w, nil, err)
+		case "fetch":
+			request := &peerFetch{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			rec, err := handler.HandleFetch(request.Hash)
+			wire.Write(w, &peerRecord{Record: rec}, err)
+		default:
+			wire.NotFound(w, r)
+		}
+	})
+}
+
+// senderAddress returns the address in the verified identity
+// record of the peer that sent the request
+func senderAddress(r *http.Request) (string, error) {
+	conn, ok := peer.RequestConn(r)
+	if !ok {
+		return "", fmt.Errorf("connection is not authenticated")
+	}
+	return membership.IdentityAddress(conn.PeerIdentity())
+}
+
+// allowSender takes a token from the limiter for the peer that sent
+// the request, keyed on the metadata.ID of its verified identity
+// record, since its address is only what the identity claims
+func allowSender(limiter limits.Limiter, r *http.Request) error {
+	if limiter == nil {
+		return nil
+	}
+
+	conn, ok := peer.RequestConn(r)
+	if !ok {
+		return fmt.Errorf("connection is not authenticated")
+	}
+	return limiter.AllowPeer(conn.PeerIdentity().Metadata().ID)
+}
@@ -0,0 +1,165 @@
+package gossip_test
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/gossip"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerTransport", func() {
+	var servers []*http.Server
+	var stores []store.Store
+	var nodes []gossip.Node
+	var errs chan error
+	var records []record.Record
+	var limiter limits.Limiter
+
+	// listen reserves an address for a node and returns
+	// the config of a node with that address
+	listen := func() (net.Listener, peer.Config) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		return listener, fixtures.GeneratePeerConfig(listener.Addr().String())
+	}
+
+	// start runs a node that serves gossip on a peer listener
+	start := func(listener net.Listener, config peer.Config) (gossip.Node, string) {
+		peerListener, err := peer.NewListener(listener, config)
+		Expect(err).To(BeNil())
+
+		s := store.New(store.NewMemoryBackend())
+		node := gossip.New(s, gossip.NewPeerTransport(peer.NewHTTPClient(config, time.Second)), gossip.Options{
+			OnError: func(err error) { errs <- err },
+		})
+
+		mux := http.NewServeMux()
+		mux.Handle(gossip.PathPrefix, gossip.PeerHandler(node, limiter))
+		server := peer.NewHTTPServer(mux)
+		go server.Serve(peerListener)
+		servers = append(servers, server)
+
+		stores = append(stores, s)
+		nodes = append(nodes, node)
+		return node, listener.Addr().String()
+	}
+
+	BeforeEach(func() {
+		servers, stores, nodes = nil, nil, nil
+		limiter = nil
+		errs = make(chan error, 10)
+		records, _ = fixtures.GenerateChain(1)
+	})
+
+	AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+		for _, node := range nodes {
+			node.Close()
+		}
+	})
+
+	Describe("when two nodes permit each other", func() {
+		BeforeEach(func() {
+			a, _ := start(listen())
+			_, addressB := start(listen())
+			a.SetPeers([]string{addressB})
+
+			Expect(a.Publish(records[0])).To(Succeed())
+			Expect(a.Publish(records[1])).To(Succeed())
+		})
+
+		It("should deliver the records", func() {
+			hash, err := records[1].Hash()
+			Expect(err).To(BeNil())
+
+			Eventually(func() error {
+				_, err := stores[1].Get(hash)
+				return err
+			}).Should(Succeed())
+		})
+	})
+
+	Describe("when the receiver denies the sender", func() {
+		var err error
+
+		BeforeEach(func() {
+			listenerA, configA := listen()
+			listenerB, configB := listen()
+			configB.Policy = peer.Policy{Deny: []string{configA.Identity.Metadata().ID}}
+
+			start(listenerA, configA)
+			_, addressB := start(listenerB, configB)
+
+			hash, hashErr := records[0].Hash()
+			Expect(hashErr).To(BeNil())
+			err = gossip.NewPeerTransport(peer.NewHTTPClient(configA, time.Second)).Announce(addressB, gossip.Announcement{Hash: hash, TTL: 1})
+		})
+
+		It("should fail to deliver", func() {
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Describe("when the sender's identity has the address of another node", func() {
+		var err error
+		var addressC string
+
+		BeforeEach(func() {
+			listenerA, _ := listen()
+			listenerC, configC := listen()
+			addressC = listenerC.Addr().String()
+			configA := fixtures.GeneratePeerConfig(listenerC.Addr().String())
+
+			a, _ := start(listenerA, configA)
+			start(listenerC, configC)
+			_, addressB := start(listen())
+
+			Expect(a.Publish(records[0])).To(Succeed())
+
+			hash, hashErr := records[0].Hash()
+			Expect(hashErr).To(BeNil())
+			err = gossip.NewPeerTransport(peer.NewHTTPClient(configA, time.Second)).Announce(addressB, gossip.Announcement{Hash: hash, TTL: 1})
+		})
+
+		It("should fetch from the address in the identity", func() {
+			Expect(err).To(BeNil())
+			Eventually(errs).Should(Receive(MatchError(ContainSubstring("from '" + addressC + "'"))))
+			_, getErr := stores[2].Get(fixtures.MustHash(records[0]))
+			Expect(getErr).To(Equal(store.ErrNotFound))
+		})
+	})
+
+	Describe("when the receiver limits each sender", func() {
+		var configA peer.Config
+		var addressB string
+
+		BeforeEach(func() {
+			limiter = limits.New(store.New(store.NewMemoryBackend()), limits.Config{PerPeer: limits.Rate{PerSecond: 0.001, Burst: 1}})
+
+			var listenerA net.Listener
+			listenerA, configA = listen()
+			start(listenerA, configA)
+			_, addressB = start(listen())
+		})
+
+		It("should refuse announcements past the limit of the sender's identity", func() {
+			transport := gossip.NewPeerTransport(peer.NewHTTPClient(configA, time.Second))
+			hash := fixtures.MustHash(records[0])
+
+			Expect(transport.Announce(addressB, gossip.Announcement{Hash: hash, TTL: 1})).To(Succeed())
+			err := transport.Announce(addressB, gossip.Announcement{Hash: hash, TTL: 1})
+			Expect(err).To(MatchError(ContainSubstring("rate limit for peer '" + configA.Identity.Metadata().ID + "' exceeded")))
+		})
+	})
+})
@@ -0,0 +1,57 @@
+package gossip
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// seenSet remembers the most recently added hashes,
+// forgetting the oldest once it is full
+type seenSet struct {
+	lock   sync.Mutex
+	size   int
+	hashes map[string]bool
+	order  []string
+}
+
+func newSeenSet(size int) *seenSet {
+	return &seenSet{size: size, hashes: make(map[string]bool)}
+}
+
+// add records the hash, returning false if it was already seen
+func (seen *seenSet) add(hash []byte) bool {
+	seen.lock.Lock()
+	defer seen.lock.Unlock()
+
+	key := hex.EncodeToString(hash)
+	if seen.hashes[key] {
+		return false
+	}
+
+	if len(seen.order) == seen.size {
+		delete(seen.hashes, seen.order[0])
+		seen.order = seen.order[1:]
+	}
+	seen.hashes[key] = true
+	seen.order = append(seen.order, key)
+	return true
+}
+
+// remove forgets the hash
+func (seen *seenSet) remove(hash []byte) {
+	seen.lock.Lock()
+	defer seen.lock.Unlock()
+
+	key := hex.EncodeToString(hash)
+	if !seen.hashes[key] {
+		return
+	}
+
+	delete(seen.hashes, key)
+	for i, other := range seen.order {
+		if other == key {
+			seen.order = append(seen.order[:i], seen.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gossip
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// Announcement tells a peer that a record with
+// the hash is available from the sender
+type Announcement struct {
+	Hash []byte
+
+	// TTL is the number of hops the announcement may still
+	// travel. A peer that receives it with a TTL of 1
+	// stores the record but does not announce it further
+	TTL int
+}
+
+// Handler serves the gossip protocol for a node
+type Handler interface {
+	// HandleAnnounce is called when the peer at from announces a record
+	HandleAnnounce(from string, announcement Announcement) error
+
+	// HandleFetch returns the record with the hash
+	HandleFetch(hash []byte) (*encoding.Record, error)
+}
+
+// Transport delivers gossip messages to peers by address
+type Transport interface {
+	// Announce delivers the announcement to the peer
+	Announce(peer string, announcement Announcement) error
+
+	// Fetch requests the record with the hash from the peer
+	Fetch(peer string, hash []byte) (*encoding.Record, error)
+}
+
+// MemoryNetwork connects handlers within a single process.
+// It is intended for tests and simulations
+type MemoryNetwork interface {
+	// Join registers the handler at the address
+	Join(address string, handler Handler)
+
+	// Leave removes the handler at the address. Messages
+	// sent to it afterwards fail as if it were unreachable
+	Leave(address string)
+
+	// Transport returns a Transport that sends
+	// messages on behalf of the address
+	Transport(address string) Transport
+}
+
+// NewMemoryNetwork constructs an empty MemoryNetwork
+func NewMemoryNetwork() MemoryNetwork {
+	return &memoryNetwork{handlers: make(map[string]Handler)}
+}
+
+type memoryNetwork struct {
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+func (network *memoryNetwork) Join(address string, handler Handler) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	network.handlers[address] = handler
+}
+
+func (network *memoryNetwork) Leave(address string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	delete(network.handlers, address)
+}
+
+func (network *memoryNetwork) Transport(address string) Transport {
+	return &memoryTransport{network: network, address: address}
+}
+
+func (network *memoryNetwork) handler(address string) (Handler, error) {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+
+	handler, ok := network.handlers[address]
+	if !ok {
+		return nil, fmt.Errorf("peer '%v' is unreachable", address)
+	}
+	return handler, nil
+}
+
+type memoryTransport struct {
+	network *memoryNetwork
+	address string
+}
+
+func (transport *memoryTransport) Announce(peer string, announcement Announcement) error {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return err
+	}
+	return handler.HandleAnnounce(transport.address, announcement)
+}
+
+func (transport *memoryTransport) Fetch(peer string, hash []byte) (*encoding.Record, error) {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleFetch(hash)
+}
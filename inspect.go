@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// runRecordVerify fully validates the record in the file, including
+// its validity window. An update is verified against its parent, read
+// from --parent or looked up in the verified history of the chain
+// on --node
+func runRecordVerify(args []string) error {
+	flags := flag.NewFlagSet("record verify", flag.ContinueOnError)
+	parentPath := flags.String("parent", "", "file of the parent record, required to verify an update without --node")
+	node := flags.String("node", "", "URL of a node to fetch the parent's chain from")
+	skew := flags.Duration("skew", 0, "how far the signer's clock may be off when checking metadata.NotBefore and metadata.NotAfter")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: meshchain record verify [--parent file | --node URL] <file>")
+	}
+
+	recordPB, err := readRecordFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	parent, err := resolveParent(recordPB, *parentPath, *node)
+	if err != nil {
+		return err
+	}
+
+	rec, err := record.FromProto(recordPB, parent)
+	if err != nil {
+		return fmt.Errorf("record is invalid: %v", err.Error())
+	}
+	if err := (record.Validity{Skew: *skew}).Check(rec); err != nil {
+		return fmt.Errorf("record is invalid: %v", err.Error())
+	}
+
+	hash, err := rec.Hash()
+	if err != nil {
+		return err
+	}
+	signingKey, err := record.SigningKey(rec, parent)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(signingKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("OK %v signed by %v\n", hex.EncodeToString(hash), fingerprint)
+	return nil
+}
+
+// runRecordInspect prints the contents of the record in the file.
+// The record is validated too when its parent is available, but
+// an invalid record is still printed
+func runRecordInspect(args []string) error {
+	flags := flag.NewFlagSet("record inspect", flag.ContinueOnError)
+	parentPath := flags.String("parent", "", "file of the parent record, used to find the key that signed an update")
+	node := flags.String("node", "", "URL of a node to fetch the parent's chain from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: meshchain record inspect [--parent file | --node URL] <file>")
+	}
+
+	recordPB, err := readRecordFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	metadata, err := record.MetadataFromProto(recordPB.Metadata)
+	if err != nil {
+		return fmt.Errorf("record is invalid: %v", err.Error())
+	}
+
+	kind := "root"
+	if len(recordPB.Parent) != 0 {
+		kind = "update"
+	}
+
+	fmt.Printf("ID:          %v\n", metadata.ID)
+	fmt.Printf("Local ID:    %v\n", metadata.LocalID)
+	fmt.Printf("Type:        %v\n", kind)
+	fmt.Printf("Version:     %v\n", recordPB.Metadata.Sequence)
+	fmt.Printf("Seal hash:   %v\n", hex.EncodeToString(recordPB.GetSeal().GetHash()))
+	if kind == "update" {
+		fmt.Printf("Parent:      %v\n", hex.EncodeToString(recordPB.Parent))
+	}
+	if !metadata.NotBefore.IsZero() || !metadata.NotAfter.IsZero() {
+		fmt.Printf("Validity:    %v\n", describeWindow(metadata, time.Now()))
+	}
+
+	if len(metadata.Annotations) != 0 {
+		fmt.Println("Annotations:")
+		keys := make([]string, 0, len(metadata.Annotations))
+		for key := range metadata.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  %v=%v\n", key, metadata.Annotations[key])
+		}
+	}
+
+	fmt.Println("Public keys:")
+	for i, publicKey := range metadata.PublicKeys {
+		fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(publicKey)
+		if err != nil {
+			fingerprint = "invalid: " + err.Error()
+		}
+		fmt.Printf("  [%v] %v\n", i, fingerprint)
+	}
+
+	signedBy, valid := inspectSignature(recordPB, *parentPath, *node)
+	fmt.Printf("Signed by:   %v\n", signedBy)
+	fmt.Printf("Valid:       %v\n", valid)
+
+	format, data := describeData(recordPB.Data)
+	size := len(recordPB.Data)
+	if manifest := metadata.Manifest; manifest != nil {
+		format = fmt.Sprintf("in %v chunks of %v bytes, root %v", manifest.Chunks(), manifest.ChunkSize, hex.EncodeToString(manifest.Root))
+		data, size = "", int(manifest.Size)
+	}
+	if metadata.Delta != "" {
+		format = metadata.Delta + " delta of the parent, " + format
+	}
+	if metadata.ContentType != "" {
+		format += ", " + metadata.ContentType
+	}
+	if metadata.Schema != "" {
+		format += ", schema " + metadata.Schema
+	}
+	fmt.Printf("Data:        %v bytes, %v\n", size, format)
+	if data != "" {
+		fmt.Println(indent(data, "  "))
+	}
+	return nil
+}
+
+// inspectSignature describes the key that signed the record and
+// whether the record is valid, or why either can't be determined
+func inspectSignature(recordPB *encoding.Record, parentPath, node string) (string, string) {
+	var parent record.Record
+	if len(recordPB.Parent) != 0 {
+		if parentPath == "" && node == "" {
+			reason := "unknown, pass --parent or --node to verify an update"
+			return reason, reason
+		}
+
+		var err error
+		parent, err = resolveParent(recordPB, parentPath, node)
+		if err != nil {
+			return "unknown", "unknown, " + err.Error()
+		}
+	}
+
+	rec, err := record.FromProto(recordPB, parent)
+	if err != nil {
+		return "unknown", "no, " + err.Error()
+	}
+
+	signingKey, err := record.SigningKey(rec, parent)
+	if err != nil {
+		return "unknown, " + err.Error(), "yes"
+	}
+
+	fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(signingKey)
+	if err != nil {
+		return "unknown, " + err.Error(), "yes"
+	}
+
+	publicKeys := rec.Metadata().PublicKeys
+	owner := "the record"
+	if parent != nil {
+		publicKeys = parent.Metadata().PublicKeys
+		owner = "the parent"
+	}
+	for i, publicKey := range publicKeys {
+		if publicKey == signingKey {
+			return fmt.Sprintf("%v (key [%v] of %v)", fingerprint, i, owner), "yes"
+		}
+	}
+	return fingerprint, "yes"
+}
+
+// describeData names the format of the data and renders it: JSON
+// is indented, text is printed as is and binary data is hex dumped
+func describeData(data []byte) (string, string) {
+	if len(data) == 0 {
+		return "empty", ""
+	}
+
+	var indented bytes.Buffer
+	if json.Indent(&indented, data, "", "  ") == nil {
+		return "JSON", indented.String()
+	}
+	if utf8.Valid(data) && isPrintable(string(data)) {
+		return "text", string(data)
+	}
+	return "binary", strings.TrimRight(hex.Dump(data), "\n")
+}
+
+// isPrintable returns true if the text contains no control
+// characters other than whitespace
+func isPrintable(text string) bool {
+	for _, r := range text {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// indent prefixes every line of the text
+func indent(text, prefix string) string {
+	return prefix + strings.Replace(strings.TrimRight(text, "\n"), "\n", "\n"+prefix, -1)
+}
+
+// readRecordFile reads a record from the file, or stdin if the path
+// is -. The file may contain the JSON or the protobuf encoding
+func readRecordFile(path string) (*encoding.Record, error) {
+	contents, err := readFileOrStdin(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(contents); len(trimmed) != 0 && trimmed[0] == '{' {
+		recordPB, err := record.ParseJSON(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse '%v' as JSON: %v", path, err.Error())
+		}
+		return recordPB, nil
+	}
+
+	recordPB := &encoding.Record{}
+
+	if err := proto.Unmarshal(contents, recordPB); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%v' as JSON or protobuf: %v", path, err.Error())
+	}
+	return recordPB, nil
+}
+
+// resolveParent returns the parent of an update, or nil for a root.
+// The parent is read from the file, whose ancestry is trusted, or
+// found in the history of the chain on the node, which is verified
+func resolveParent(recordPB *encoding.Record, parentPath, node string) (record.Record, error) {
+	if len(recordPB.Parent) == 0 {
+		return nil, nil
+	}
+
+	var parent record.Record
+	switch {
+	case parentPath != "":
+		parentPB, err := readRecordFile(parentPath)
+		if err != nil {
+			return nil, err
+		}
+		parent, err = record.FromTrustedProto(parentPB)
+		if err != nil {
+			return nil, fmt.Errorf("parent record is invalid: %v", err.Error())
+		}
+	case node != "":
+		var err error
+		parent, err = fetchParent(node, recordPB)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("record is an update, its signature can only be verified against its parent. Pass --parent or --node")
+	}
+
+	hash, err := parent.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hash, recordPB.Parent) {
+		return nil, fmt.Errorf("parent record has hash '%v' instead of '%v'", hex.EncodeToString(hash), hex.EncodeToString(recordPB.Parent))
+	}
+	return parent, nil
+}
+
+// historyJSON is the body of GET /records/{id}/history
+type historyJSON struct {
+	Records []json.RawMessage `json:"records"`
+}
+
+// fetchParent verifies the history of the record's chain on
+// the node and returns the record's parent from it
+func fetchParent(node string, recordPB *encoding.Record) (record.Record, error) {
+	id := recordPB.GetMetadata().GetId()
+	body, err := fetchNode(node, "/records/"+id+"/history")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch the history of '%v': %v", id, err.Error())
+	}
+
+	history := &historyJSON{}
+	if err := json.Unmarshal(body, history); err != nil {
+		return nil, fmt.Errorf("Failed to parse the history of '%v': %v", id, err.Error())
+	}
+
+	records := make([]record.Record, 0, len(history.Records))
+	for i, recordJSON := range history.Records {
+		historyPB, err := record.ParseJSON(recordJSON)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse record at index '%v' of the history: %v", i, err.Error())
+		}
+		rec, err := record.FromTrustedProto(historyPB)
+		if err != nil {
+			return nil, fmt.Errorf("record at index '%v' of the history is invalid: %v", i, err.Error())
+		}
+		records = append(records, rec)
+	}
+
+	chain, err := record.NewChain(records)
+	if err != nil {
+		return nil, fmt.Errorf("history of '%v' is invalid: %v", id, err.Error())
+	}
+
+	for _, rec := range chain.Records() {
+		hash, err := rec.Hash()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(hash, recordPB.Parent) {
+			return rec, nil
+		}
+	}
+	return nil, fmt.Errorf("parent '%v' is not in the history of '%v' on the node", hex.EncodeToString(recordPB.Parent), id)
+}
+
+// describeWindow describes the validity window of the
+// metadata and whether the time is inside of it
+func describeWindow(metadata record.Metadata, now time.Time) string {
+	from, until := "any time", "no expiry"
+	if !metadata.NotBefore.IsZero() {
+		from = metadata.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if !metadata.NotAfter.IsZero() {
+		until = metadata.NotAfter.UTC().Format(time.RFC3339)
+	}
+
+	status := "current"
+	if err := metadata.ValidAt(now, 0); err != nil {
+		status = err.Error()
+	}
+	return fmt.Sprintf("%v until %v (%v)", from, until, status)
+}
@@ -0,0 +1,117 @@
+// Package fixtures generates the keys and records shared by the
+// tests of the other packages. Every function has assertions on all
+// error cases, so it throws if anything goes wrong. The suite that
+// uses it must register gomega's fail handler
+package fixtures
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+)
+
+// GenerateKeys creates a key pair, returning the public
+// key in pem format along with the private key
+func GenerateKeys() (string, *rsa.PrivateKey) {
+	return generateKeys(512)
+}
+
+// GenerateChain creates a root record followed by count updates,
+// all signed with the returned privateKey
+func GenerateChain(count int) ([]record.Record, *rsa.PrivateKey) {
+	root, privateKey := GenerateRootRecord(record.Metadata{})
+
+	records := []record.Record{root}
+	for i := 0; i < count; i++ {
+		records = append(records, GenerateUpdateRecord(records[i], privateKey, string(rune('a'+i))))
+	}
+	return records, privateKey
+}
+
+// GenerateRootRecord creates a root record with the data `root`
+// and a new key pair. The metadata's ID and PublicKeys are set
+// from the key, its other properties are kept
+func GenerateRootRecord(metadata record.Metadata) (record.Record, *rsa.PrivateKey) {
+	publicKey, privateKey := GenerateKeys()
+	metadata.ID = generators.ID(metadata.LocalID, []string{publicKey})
+	metadata.PublicKeys = []string{publicKey}
+
+	unsigned, err := record.NewUnsignedRootRecord(metadata, []byte(`root`))
+	Expect(err).To(BeNil())
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+	rec, err := record.NewRootRecord(metadata, []byte(`root`), signature)
+	Expect(err).To(BeNil())
+	return rec, privateKey
+}
+
+// GenerateRootRecordWithin creates a root record that is only
+// valid from notBefore until notAfter
+func GenerateRootRecordWithin(notBefore, notAfter time.Time) record.Record {
+	rec, _ := GenerateRootRecord(record.Metadata{NotBefore: notBefore, NotAfter: notAfter})
+	return rec
+}
+
+// GenerateUpdateRecord creates an update of the parent that keeps
+// the parent's metadata
+func GenerateUpdateRecord(parent record.Record, privateKey *rsa.PrivateKey, data string) record.Record {
+	return GenerateUpdate(parent, privateKey, parent.Metadata(), []byte(data))
+}
+
+// GenerateDeltaUpdate creates an update of the parent that keeps the
+// parent's metadata and whose data is a patch of the kind
+func GenerateDeltaUpdate(parent record.Record, privateKey *rsa.PrivateKey, kind string, patch []byte) record.Record {
+	metadata := parent.Metadata()
+	metadata.Delta = kind
+	return GenerateUpdate(parent, privateKey, metadata, patch)
+}
+
+// GenerateRotation creates an update of the parent, signed with
+// privateKey, that replaces the parent's PublicKeys with a new key.
+// It returns the update and the new key's private key
+func GenerateRotation(parent record.Record, privateKey *rsa.PrivateKey) (record.Record, *rsa.PrivateKey) {
+	publicKey, newPrivateKey := GenerateKeys()
+
+	metadata := parent.Metadata()
+	metadata.PublicKeys = []string{publicKey}
+	return GenerateUpdate(parent, privateKey, metadata, []byte(`rotated`)), newPrivateKey
+}
+
+// GenerateUpdate creates an update of the parent with the
+// metadata and data, signed with privateKey
+func GenerateUpdate(parent record.Record, privateKey *rsa.PrivateKey, metadata record.Metadata, data []byte) record.Record {
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, data)
+	Expect(err).To(BeNil())
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+	rec, err := record.NewUpdateRecord(parent, metadata, data, signature)
+	Expect(err).To(BeNil())
+	return rec
+}
+
+// MustHash returns the hash of the record
+func MustHash(rec record.Record) []byte {
+	hash, err := rec.Hash()
+	Expect(err).To(BeNil())
+	return hash
+}
+
+func generateKeys(bits int) (string, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	Expect(err).To(BeNil())
+
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	Expect(err).To(BeNil())
+
+	publicKeyBlock := pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyDer,
+	}
+	return string(pem.EncodeToMemory(&publicKeyBlock)), privateKey
+}
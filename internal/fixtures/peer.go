@@ -0,0 +1,31 @@
+package fixtures
+
+import (
+	"crypto/rsa"
+
+	. "github.com/onsi/gomega"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record"
+)
+
+// GeneratePeerConfig creates the identity and private key of a node
+// at the address for peer connections. TLS needs keys of at least
+// 1024 bits
+func GeneratePeerConfig(address string) peer.Config {
+	identity, privateKey := generateIdentity(address, 1024)
+	return peer.Config{Identity: identity, PrivateKey: privateKey}
+}
+
+// GenerateIdentity creates an identity record for a node at the address
+func GenerateIdentity(address string) record.Record {
+	identity, _ := generateIdentity(address, 512)
+	return identity
+}
+
+func generateIdentity(address string, bits int) (record.Record, *rsa.PrivateKey) {
+	publicKey, privateKey := generateKeys(bits)
+	identity, err := membership.NewIdentity(address, publicKey, privateKey)
+	Expect(err).To(BeNil())
+	return identity, privateKey
+}
@@ -0,0 +1,96 @@
+// Package wire carries the JSON requests and responses of the
+// protocols that nodes speak to each other. Each request is POSTed
+// to the route of its message, usually over a peer connection, see
+// peer.NewHTTPClient and peer.NewHTTPServer. A failed request is
+// answered with a 500 and a JSON object of the form
+//
+//	{"error": "..."}
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxBodySize bounds the bodies of requests and responses
+const maxBodySize = 16 << 20
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Call POSTs the request as JSON to the path on the node at the
+// address and decodes the JSON response into response, which may be
+// nil if the response is empty
+func Call(client *http.Client, address, path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	httpResponse, err := client.Post("http://"+address+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	decoder := json.NewDecoder(io.LimitReader(httpResponse.Body, maxBodySize))
+	if httpResponse.StatusCode != http.StatusOK {
+		failure := &errorResponse{}
+		if err := decoder.Decode(failure); err != nil || failure.Error == "" {
+			return fmt.Errorf("peer '%v' responded with status %v", address, httpResponse.StatusCode)
+		}
+		return fmt.Errorf("peer '%v' responded: %v", address, failure.Error)
+	}
+
+	if response == nil {
+		return nil
+	}
+	if err := decoder.Decode(response); err != nil {
+		return fmt.Errorf("Failed to parse the response of peer '%v': %v", address, err.Error())
+	}
+	return nil
+}
+
+// Read decodes the JSON body of a POST request into request. If it
+// can't, it writes the error response and returns false
+func Read(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if r.Method != "POST" {
+		writeJSON(w, http.StatusMethodNotAllowed, &errorResponse{"method '" + r.Method + "' is not allowed"})
+		return false
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(request); err != nil {
+		writeJSON(w, http.StatusBadRequest, &errorResponse{"Failed to parse request: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// Write writes the response as JSON, or the error
+// response if err is set. A nil response is written as {}
+func Write(w http.ResponseWriter, response interface{}, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &errorResponse{err.Error()})
+		return
+	}
+	if response == nil {
+		response = struct{}{}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// NotFound writes the error response for a path without a route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusNotFound, &errorResponse{"no route for '" + r.URL.Path + "'"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/keyring"
+)
+
+const keyUsage = `usage: meshchain key <subcommand> [arguments]
+
+subcommands:
+  generate [--bits N] <name>     generate a key and print its public key
+  list [--json]                  list the stored keys and their fingerprints
+  export [--private] <name>      print the public (or private) key in pem format
+  import <name> <file>           store a pem encoded RSA private key, - reads stdin
+  fingerprint <name|file>        print the fingerprint of a stored key or pem file
+
+Keys are stored in --dir, which defaults to $MESHCHAIN_KEYS or
+~/.meshchain/keys. A fingerprint is the hex encoded sha256 of the
+DER encoded public key, the same as
+
+  openssl pkey -pubin -outform der | sha256sum`
+
+// runKey manages the keys used to sign records
+func runKey(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%v", keyUsage)
+	}
+
+	switch args[0] {
+	case "generate":
+		return runKeyGenerate(args[1:])
+	case "list":
+		return runKeyList(args[1:])
+	case "export":
+		return runKeyExport(args[1:])
+	case "import":
+		return runKeyImport(args[1:])
+	case "fingerprint":
+		return runKeyFingerprint(args[1:])
+	}
+	return fmt.Errorf("unknown subcommand '%v'\n%v", args[0], keyUsage)
+}
+
+// keyFlags returns a FlagSet for the key subcommand with the --dir flag
+func keyFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("key "+name, flag.ContinueOnError)
+	dir := flags.String("dir", keyring.DefaultDir(), "directory the keys are stored in")
+	return flags, dir
+}
+
+func runKeyGenerate(args []string) error {
+	flags, dir := keyFlags("generate")
+	bits := flags.Int("bits", keyring.DefaultBits, "size of the key in bits")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: meshchain key generate [--bits N] <name>")
+	}
+
+	ring, err := keyring.New(*dir)
+	if err != nil {
+		return err
+	}
+
+	key, err := ring.Generate(flags.Arg(0), *bits)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "generated key '%v' with fingerprint %v\n", key.Name, key.Fingerprint)
+	fmt.Print(key.PublicKey)
+	return nil
+}
+
+func runKeyList(args []string) error {
+	flags, dir := keyFlags("list")
+	asJSON := flags.Bool("json", false, "print the keys, including their public keys, as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ring, err := keyring.New(*dir)
+	if err != nil {
+		return err
+	}
+
+	keys, err := ring.List()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(keys)
+	}
+	for _, key := range keys {
+		fmt.Printf("%v\t%v\n", key.Name, key.Fingerprint)
+	}
+	return nil
+}
+
+func runKeyExport(args []string) error {
+	flags, dir := keyFlags("export")
+	private := flags.Bool("private", false, "print the private key instead of the public key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: meshchain key export [--private] <name>")
+	}
+
+	ring, err := keyring.New(*dir)
+	if err != nil {
+		return err
+	}
+
+	if *private {
+		privateKey, err := ring.Get(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return pem.Encode(os.Stdout, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	}
+
+	key, err := ring.Key(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Print(key.PublicKey)
+	return nil
+}
+
+func runKeyImport(args []string) error {
+	flags, dir := keyFlags("import")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: meshchain key import <name> <file>")
+	}
+
+	privateKeyPEM, err := readFileOrStdin(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	ring, err := keyring.New(*dir)
+	if err != nil {
+		return err
+	}
+
+	key, err := ring.Import(flags.Arg(0), privateKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "imported key '%v' with fingerprint %v\n", key.Name, key.Fingerprint)
+	fmt.Print(key.PublicKey)
+	return nil
+}
+
+func runKeyFingerprint(args []string) error {
+	flags, dir := keyFlags("fingerprint")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: meshchain key fingerprint <name|file>")
+	}
+
+	publicKey, err := loadPublicKey(*dir, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	fmt.Println(fingerprint)
+	return nil
+}
+
+// loadPublicKey returns the public key in pem format of the stored
+// key with the name, or of the public or private key in the pem
+// file at the path if no key has the name
+func loadPublicKey(dir, nameOrPath string) (string, error) {
+	if _, err := os.Stat(nameOrPath); err != nil {
+		ring, err := keyring.New(dir)
+		if err != nil {
+			return "", err
+		}
+		key, err := ring.Key(nameOrPath)
+		if err != nil {
+			return "", err
+		}
+		return key.PublicKey, nil
+	}
+
+	keyPEM, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := cryptohelpers.BuildRSAPublicKey(string(keyPEM)); err == nil {
+		return string(keyPEM), nil
+	}
+
+	privateKey, err := keyring.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return "", fmt.Errorf("'%v' contains neither an RSA public key nor an RSA private key", nameOrPath)
+	}
+	return cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+}
+
+// readFileOrStdin reads the file at the path, or stdin if the path is -
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// loadPrivateKey returns the stored key with the name, or the
+// private key in the pem file at the path if no key has the name
+func loadPrivateKey(dir, nameOrPath string) (*rsa.PrivateKey, error) {
+	if _, err := os.Stat(nameOrPath); err != nil {
+		ring, err := keyring.New(dir)
+		if err != nil {
+			return nil, err
+		}
+		return ring.Get(nameOrPath)
+	}
+
+	keyPEM, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.ParsePrivateKey(keyPEM)
+}
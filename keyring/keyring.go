@@ -0,0 +1,234 @@
+// Package keyring keeps the RSA private keys used to sign records in
+// a directory, one PEM file per key. The public halves are the keys
+// listed in a record's metadata.PublicKeys
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+)
+
+// DefaultBits is the size of generated keys
+const DefaultBits = 2048
+
+// extension is the file extension of stored keys
+const extension = ".pem"
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Key describes a stored key
+type Key struct {
+	Name string `json:"name"`
+
+	// PublicKey is the public key in pem format, as it
+	// appears in a record's metadata.PublicKeys
+	PublicKey string `json:"publicKey"`
+
+	// Fingerprint is the hex encoded sha256 of the
+	// DER encoded public key
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Keyring stores private keys by name
+type Keyring interface {
+	// Generate creates a new key with the name. It fails
+	// if a key with the name already exists
+	Generate(name string, bits int) (*Key, error)
+
+	// Get returns the private key with the name
+	Get(name string) (*rsa.PrivateKey, error)
+
+	// Import stores a pem encoded RSA private key, in PKCS #1
+	// or PKCS #8 form, with the name. It fails if a key with
+	// the name already exists
+	Import(name string, privateKeyPEM []byte) (*Key, error)
+
+	// Key describes the key with the name
+	Key(name string) (*Key, error)
+
+	// List describes every stored key, sorted by name
+	List() ([]*Key, error)
+}
+
+// New constructs a Keyring that stores keys in dir,
+// creating dir if needed
+func New(dir string) (Keyring, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &keyring{dir: dir}, nil
+}
+
+// DefaultDir returns $MESHCHAIN_KEYS if it is
+// set, or ~/.meshchain/keys otherwise
+func DefaultDir() string {
+	if dir := os.Getenv("MESHCHAIN_KEYS"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".meshchain", "keys")
+}
+
+type keyring struct {
+	dir string
+}
+
+func (keyring *keyring) Generate(name string, bits int) (*Key, error) {
+	if bits <= 0 {
+		bits = DefaultBits
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.write(name, privateKey)
+}
+
+func (keyring *keyring) Get(name string) (*rsa.PrivateKey, error) {
+	path, err := keyring.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyPEM, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no key named '%v' exists", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("key '%v' is invalid: %v", name, err.Error())
+	}
+	return privateKey, nil
+}
+
+func (keyring *keyring) Import(name string, privateKeyPEM []byte) (*Key, error) {
+	privateKey, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.write(name, privateKey)
+}
+
+func (keyring *keyring) Key(name string) (*Key, error) {
+	privateKey, err := keyring.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return describe(name, privateKey)
+}
+
+func (keyring *keyring) List() ([]*Key, error) {
+	infos, err := ioutil.ReadDir(keyring.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), extension) {
+			names = append(names, strings.TrimSuffix(info.Name(), extension))
+		}
+	}
+	sort.Strings(names)
+
+	keys := make([]*Key, 0, len(names))
+	for _, name := range names {
+		key, err := keyring.Key(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// path returns the path of the file for the key with the name
+func (keyring *keyring) path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("key name '%v' is invalid, it may only contain letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(keyring.dir, name+extension), nil
+}
+
+// write stores the private key as PKCS #1 pem, readable
+// only by the owner
+func (keyring *keyring) write(name string, privateKey *rsa.PrivateKey) (*Key, error) {
+	path, err := keyring.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("a key named '%v' already exists", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+	if err := pem.Encode(file, block); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	return describe(name, privateKey)
+}
+
+// ParsePrivateKey parses a pem encoded RSA private
+// key in PKCS #1 or PKCS #8 form
+func ParsePrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block containing the private key")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private key is neither PKCS #1 nor PKCS #8: %v", err.Error())
+	}
+
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("privateKey is of the wrong type. Must be rsa")
+	}
+	return privateKey, nil
+}
+
+// describe builds the Key for the private key
+func describe(name string, privateKey *rsa.PrivateKey) (*Key, error) {
+	publicKey, err := cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{Name: name, PublicKey: publicKey, Fingerprint: fingerprint}, nil
+}
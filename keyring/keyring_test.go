@@ -0,0 +1,132 @@
+package keyring_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/keyring"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keyring", func() {
+	var dir string
+	var ring keyring.Keyring
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "keyring-test")
+		Expect(err).To(BeNil())
+
+		ring, err = keyring.New(filepath.Join(dir, "keys"))
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Generate", func() {
+		var key *keyring.Key
+
+		BeforeEach(func() {
+			var err error
+			key, err = ring.Generate("device", 1024)
+			Expect(err).To(BeNil())
+		})
+
+		It("should return a pem public key", func() {
+			_, err := cryptohelpers.BuildRSAPublicKey(key.PublicKey)
+			Expect(err).To(BeNil())
+		})
+
+		It("should return the fingerprint of the public key", func() {
+			fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(key.PublicKey)
+			Expect(err).To(BeNil())
+			Expect(key.Fingerprint).To(Equal(fingerprint))
+		})
+
+		It("should store a private key matching the public key", func() {
+			privateKey, err := ring.Get("device")
+			Expect(err).To(BeNil())
+
+			publicKey, err := cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+			Expect(err).To(BeNil())
+			Expect(publicKey).To(Equal(key.PublicKey))
+		})
+
+		It("should only let the owner read the key", func() {
+			info, err := os.Stat(filepath.Join(dir, "keys", "device.pem"))
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("should refuse to overwrite the key", func() {
+			_, err := ring.Generate("device", 1024)
+			Expect(err).To(MatchError("a key named 'device' already exists"))
+		})
+	})
+
+	Describe("Import", func() {
+		var privateKey *rsa.PrivateKey
+
+		BeforeEach(func() {
+			var err error
+			privateKey, err = rsa.GenerateKey(rand.Reader, 1024)
+			Expect(err).To(BeNil())
+		})
+
+		It("should import a PKCS #1 key", func() {
+			privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+			_, err := ring.Import("pkcs1", privateKeyPEM)
+			Expect(err).To(BeNil())
+
+			imported, err := ring.Get("pkcs1")
+			Expect(err).To(BeNil())
+			Expect(imported.N).To(Equal(privateKey.N))
+		})
+
+		It("should reject something that is not a private key", func() {
+			publicKey, err := cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+			Expect(err).To(BeNil())
+
+			_, err = ring.Import("public", []byte(publicKey))
+			Expect(err).To(MatchError(ContainSubstring("private key is neither PKCS #1 nor PKCS #8")))
+		})
+
+		It("should reject a name that could escape the directory", func() {
+			privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+			_, err := ring.Import("../escape", privateKeyPEM)
+			Expect(err).To(MatchError(ContainSubstring("key name '../escape' is invalid")))
+		})
+	})
+
+	Describe("List", func() {
+		It("should describe every key sorted by name", func() {
+			_, err := ring.Generate("b", 1024)
+			Expect(err).To(BeNil())
+			_, err = ring.Generate("a", 1024)
+			Expect(err).To(BeNil())
+
+			keys, err := ring.List()
+			Expect(err).To(BeNil())
+			Expect(keys).To(HaveLen(2))
+			Expect(keys[0].Name).To(Equal("a"))
+			Expect(keys[1].Name).To(Equal("b"))
+		})
+	})
+
+	Describe("Get", func() {
+		It("should fail for an unknown key", func() {
+			_, err := ring.Get("missing")
+			Expect(err).To(MatchError("no key named 'missing' exists"))
+		})
+	})
+})
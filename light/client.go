@@ -0,0 +1,252 @@
+// Package light lets clients that can't hold a full store verify
+// the head of a chain served by untrusted peers. A peer answers a
+// ProofRequest with the records from the client's last verified
+// record (or the RootRecord) up to the head. Every update's hash
+// binds its parent, so each record in between, including the ones
+// that rotate keys, is needed to verify the head and none more.
+//
+// A peer can't forge a record, but it can withhold newer ones. The
+// Client asks several peers and reports the ones whose verified
+// head is older than the newest head any peer could prove.
+package light
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record"
+)
+
+// Result is the outcome of asking several peers for a head
+type Result struct {
+	// Head is the newest record any peer proved
+	Head record.Record
+
+	// Height is the number of updates between the
+	// RootRecord and Head. It is 0 for a RootRecord
+	Height int
+
+	// Verified lists the peers that proved Head
+	Verified []string
+
+	// Stale lists the peers that proved an ancestor of Head,
+	// or could not prove anything as new as the checkpoint.
+	// They are behind or withholding newer versions
+	Stale []string
+
+	// Conflicting lists the peers that proved a record
+	// that is not an ancestor of Head. This happens when
+	// the keys of a chain signed two different updates
+	Conflicting []string
+
+	// Failed lists the peers that could not be reached
+	// or returned an invalid proof, with the reason
+	Failed map[string]error
+}
+
+// Client verifies chain heads on behalf of a light client
+type Client interface {
+	// Checkpoint returns the most recent record verified for the
+	// metadata.ID and its height, or nil if there is none
+	Checkpoint(id string) (record.Record, int)
+
+	// Head asks each peer for a proof of the current head of the
+	// chain and verifies it locally, along with the head's validity
+	// window. It returns an error if no peer produced a valid proof,
+	// or if peers proved two different records at the greatest height
+	Head(id string, peers []string) (*Result, error)
+}
+
+// Options configures a Client
+type Options struct {
+	// Validity rejects proofs whose head is not yet valid or has
+	// expired. The zero value checks them against time.Now
+	// without any skew
+	Validity record.Validity
+}
+
+// NewClient constructs a Client that sends requests using the transport
+func NewClient(transport Transport, options Options) Client {
+	return &client{transport: transport, validity: options.Validity, checkpoints: make(map[string]*checkpoint)}
+}
+
+type client struct {
+	transport   Transport
+	validity    record.Validity
+	lock        sync.Mutex
+	checkpoints map[string]*checkpoint
+}
+
+// checkpoint is the most recent record verified for a chain
+type checkpoint struct {
+	record record.Record
+	hash   []byte
+	height int
+}
+
+// verifiedProof is a proof that passed verification
+type verifiedProof struct {
+	head   record.Record
+	height int
+
+	// path maps each height covered by the
+	// proof to the hash of the record at it
+	path map[int][]byte
+}
+
+func (proof *verifiedProof) headHash() []byte {
+	return proof.path[proof.height]
+}
+
+func (client *client) Checkpoint(id string) (record.Record, int) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	known, ok := client.checkpoints[id]
+	if !ok {
+		return nil, 0
+	}
+	return known.record, known.height
+}
+
+func (client *client) Head(id string, peers []string) (*Result, error) {
+	client.lock.Lock()
+	known := client.checkpoints[id]
+	client.lock.Unlock()
+
+	result := &Result{Failed: make(map[string]error)}
+	proofs := make(map[string]*verifiedProof)
+	var newest *verifiedProof
+	var newestPeer string
+
+	for _, peer := range peers {
+		proof, err := client.transport.Proof(peer, ProofRequest{ID: id, Since: known.hashOrNil()})
+		if err != nil {
+			result.Failed[peer] = err
+			continue
+		}
+
+		verified, err := verifyProof(id, known, proof)
+		if err == errCheckpointMissing {
+			if verified.height > known.height {
+				result.Conflicting = append(result.Conflicting, peer)
+			} else {
+				result.Stale = append(result.Stale, peer)
+			}
+			continue
+		}
+		if err != nil {
+			result.Failed[peer] = err
+			continue
+		}
+		if err := client.validity.Check(verified.head); err != nil {
+			result.Failed[peer] = fmt.Errorf("head is invalid: %v", err.Error())
+			continue
+		}
+
+		proofs[peer] = verified
+		if newest == nil || verified.height > newest.height {
+			newest, newestPeer = verified, peer
+			continue
+		}
+		if verified.height == newest.height && !bytes.Equal(verified.headHash(), newest.headHash()) {
+			return nil, fmt.Errorf("peers '%v' and '%v' proved different records at height '%v'", newestPeer, peer, newest.height)
+		}
+	}
+
+	if newest == nil {
+		return nil, fmt.Errorf("no peer proved the head of metadata.ID '%v'", id)
+	}
+
+	result.Head, result.Height = newest.head, newest.height
+	for _, peer := range peers {
+		proof, ok := proofs[peer]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case proof.height == newest.height:
+			result.Verified = append(result.Verified, peer)
+		case bytes.Equal(newest.path[proof.height], proof.headHash()):
+			result.Stale = append(result.Stale, peer)
+		default:
+			result.Conflicting = append(result.Conflicting, peer)
+		}
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if current := client.checkpoints[id]; current == nil || current.height < newest.height {
+		client.checkpoints[id] = &checkpoint{record: newest.head, hash: newest.headHash(), height: newest.height}
+	}
+	return result, nil
+}
+
+// errCheckpointMissing is returned by verifyProof, along with the
+// proof, when a valid proof from the RootRecord skips the checkpoint
+var errCheckpointMissing = fmt.Errorf("proof does not include the checkpoint")
+
+// verifyProof verifies that the proof extends the checkpoint, or
+// starts at a RootRecord for the metadata.ID. A proof from the
+// RootRecord must pass through the checkpoint if there is one
+func verifyProof(id string, known *checkpoint, proof *Proof) (*verifiedProof, error) {
+	verified := &verifiedProof{height: -1, path: make(map[int][]byte)}
+	var parent record.Record
+	if known != nil {
+		verified.head, verified.height = known.record, known.height
+		verified.path[known.height] = known.hash
+		parent = known.record
+	}
+
+	if len(proof.Records) == 0 {
+		if known == nil {
+			return nil, fmt.Errorf("proof is empty")
+		}
+		return verified, nil
+	}
+
+	needCheckpoint := false
+	first := proof.Records[0]
+	if len(first.Parent) == 0 {
+		needCheckpoint = known != nil
+		verified.height, parent = -1, nil
+	} else if known == nil || !bytes.Equal(first.Parent, known.hash) {
+		return nil, fmt.Errorf("proof starts at parent '%v' instead of the RootRecord or the checkpoint", hex.EncodeToString(first.Parent))
+	}
+
+	for i, recordPB := range proof.Records {
+		rec, err := record.FromProto(recordPB, parent)
+		if err != nil {
+			return nil, fmt.Errorf("record at index '%v' is invalid: %v", i, err.Error())
+		}
+		if rec.Metadata().ID != id {
+			return nil, fmt.Errorf("record at index '%v' has metadata.ID '%v' instead of '%v'", i, rec.Metadata().ID, id)
+		}
+
+		hash, err := rec.Hash()
+		if err != nil {
+			return nil, err
+		}
+		verified.height++
+		verified.path[verified.height] = hash
+		if needCheckpoint && verified.height == known.height && bytes.Equal(hash, known.hash) {
+			needCheckpoint = false
+		}
+		verified.head, parent = rec, rec
+	}
+
+	if needCheckpoint {
+		return verified, errCheckpointMissing
+	}
+	return verified, nil
+}
+
+func (known *checkpoint) hashOrNil() []byte {
+	if known == nil {
+		return nil
+	}
+	return known.hash
+}
@@ -0,0 +1,286 @@
+package light_test
+
+import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/light"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingHandler records the requests served by the handler it wraps
+type recordingHandler struct {
+	light.Handler
+
+	requests []light.ProofRequest
+	proofs   []*light.Proof
+}
+
+func (handler *recordingHandler) HandleProof(request light.ProofRequest) (*light.Proof, error) {
+	handler.requests = append(handler.requests, request)
+	proof, err := handler.Handler.HandleProof(request)
+	handler.proofs = append(handler.proofs, proof)
+	return proof, err
+}
+
+// tamperingHandler changes the data of the last record of every proof
+type tamperingHandler struct {
+	light.Handler
+}
+
+func (handler *tamperingHandler) HandleProof(request light.ProofRequest) (*light.Proof, error) {
+	proof, err := handler.Handler.HandleProof(request)
+	if err != nil {
+		return nil, err
+	}
+	proof.Records[len(proof.Records)-1].Data = []byte(`forged`)
+	return proof, nil
+}
+
+var _ = Describe("Client", func() {
+	var network light.MemoryNetwork
+	var client light.Client
+	var records []record.Record
+	var newKey *rsa.PrivateKey
+
+	// serve joins a full node holding the records to the network
+	serve := func(address string, records []record.Record) *recordingHandler {
+		s := store.New(store.NewMemoryBackend())
+		for _, rec := range records {
+			Expect(s.Put(rec)).To(Succeed())
+		}
+		handler := &recordingHandler{Handler: light.NewServer(s)}
+		network.Join(address, handler)
+		return handler
+	}
+
+	BeforeEach(func() {
+		network = light.NewMemoryNetwork()
+		client = light.NewClient(network.Transport(), light.Options{})
+
+		chain, key := fixtures.GenerateChain(2)
+		var rotation record.Record
+		rotation, newKey = fixtures.GenerateRotation(chain[2], key)
+		records = append(chain, rotation, fixtures.GenerateUpdateRecord(rotation, newKey, "after rotation"))
+	})
+
+	Describe("when a single peer holds the chain", func() {
+		var handler *recordingHandler
+		var result *light.Result
+		var err error
+
+		BeforeEach(func() {
+			handler = serve("full", records)
+			result, err = client.Head(records[0].Metadata().ID, []string{"full"})
+		})
+
+		It("should verify the head through the key rotation", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Head.Data()).To(Equal([]byte("after rotation")))
+			Expect(result.Height).To(Equal(4))
+			Expect(result.Verified).To(Equal([]string{"full"}))
+		})
+
+		It("should remember the head as the checkpoint", func() {
+			checkpoint, height := client.Checkpoint(records[0].Metadata().ID)
+			Expect(checkpoint.Data()).To(Equal([]byte("after rotation")))
+			Expect(height).To(Equal(4))
+		})
+
+		Describe("when the chain is updated", func() {
+			BeforeEach(func() {
+				update := fixtures.GenerateUpdateRecord(records[4], newKey, "latest")
+				handler = serve("full", append(records, update))
+				result, err = client.Head(records[0].Metadata().ID, []string{"full"})
+			})
+
+			It("should only need the new record", func() {
+				Expect(handler.proofs[0].Records).To(HaveLen(1))
+			})
+
+			It("should verify it against the checkpoint", func() {
+				Expect(err).To(BeNil())
+				Expect(result.Head.Data()).To(Equal([]byte("latest")))
+				Expect(result.Height).To(Equal(5))
+			})
+		})
+
+		Describe("when asked again", func() {
+			BeforeEach(func() {
+				result, err = client.Head(records[0].Metadata().ID, []string{"full"})
+			})
+
+			It("should only request the records after the checkpoint", func() {
+				hash, _ := records[4].Hash()
+				Expect(handler.requests[1].Since).To(Equal(hash))
+				Expect(handler.proofs[1].Records).To(BeEmpty())
+			})
+
+			It("should return the same head", func() {
+				Expect(err).To(BeNil())
+				Expect(result.Height).To(Equal(4))
+				Expect(result.Verified).To(Equal([]string{"full"}))
+			})
+		})
+	})
+
+	Describe("when a peer withholds the newest records", func() {
+		var result *light.Result
+		var err error
+
+		BeforeEach(func() {
+			serve("honest", records)
+			serve("withholding", records[:3])
+			result, err = client.Head(records[0].Metadata().ID, []string{"withholding", "honest"})
+		})
+
+		It("should return the newest head", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Height).To(Equal(4))
+			Expect(result.Verified).To(Equal([]string{"honest"}))
+		})
+
+		It("should report the withholding peer as stale", func() {
+			Expect(result.Stale).To(Equal([]string{"withholding"}))
+		})
+	})
+
+	Describe("when a peer is behind the checkpoint", func() {
+		var result *light.Result
+		var err error
+
+		BeforeEach(func() {
+			serve("honest", records)
+			_, err = client.Head(records[0].Metadata().ID, []string{"honest"})
+			Expect(err).To(BeNil())
+
+			serve("behind", records[:2])
+			result, err = client.Head(records[0].Metadata().ID, []string{"behind", "honest"})
+		})
+
+		It("should report it as stale", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Stale).To(Equal([]string{"behind"}))
+			Expect(result.Verified).To(Equal([]string{"honest"}))
+		})
+	})
+
+	Describe("when a peer forges a record", func() {
+		var result *light.Result
+		var err error
+
+		BeforeEach(func() {
+			s := store.New(store.NewMemoryBackend())
+			for _, rec := range records {
+				Expect(s.Put(rec)).To(Succeed())
+			}
+			network.Join("forger", &tamperingHandler{Handler: light.NewServer(s)})
+			serve("honest", records[:4])
+			result, err = client.Head(records[0].Metadata().ID, []string{"forger", "honest"})
+		})
+
+		It("should reject the forged proof with the reason", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Failed).To(HaveKey("forger"))
+			Expect(result.Failed["forger"]).To(MatchError(ContainSubstring("record at index '4' is invalid")))
+		})
+
+		It("should use the valid proof", func() {
+			Expect(result.Height).To(Equal(3))
+			Expect(result.Verified).To(Equal([]string{"honest"}))
+		})
+	})
+
+	Describe("when a peer serves a different chain", func() {
+		BeforeEach(func() {
+			other, _ := fixtures.GenerateChain(1)
+			serve("other", other)
+		})
+
+		It("should fail", func() {
+			_, err := client.Head(records[0].Metadata().ID, []string{"other"})
+			Expect(err).To(MatchError(ContainSubstring("no peer proved the head")))
+		})
+	})
+
+	Describe("when peers prove different updates of the same record", func() {
+		var err error
+
+		BeforeEach(func() {
+			chain, key := fixtures.GenerateChain(1)
+			serve("a", append(chain[:2:2], fixtures.GenerateUpdateRecord(chain[1], key, "x")))
+			serve("b", append(chain[:2:2], fixtures.GenerateUpdateRecord(chain[1], key, "y")))
+			_, err = client.Head(chain[0].Metadata().ID, []string{"a", "b"})
+		})
+
+		It("should return an error", func() {
+			Expect(err).To(MatchError("peers 'a' and 'b' proved different records at height '2'"))
+		})
+	})
+
+	Describe("when a peer forked after the checkpoint", func() {
+		var result *light.Result
+		var err error
+
+		BeforeEach(func() {
+			serve("honest", records)
+			_, err = client.Head(records[0].Metadata().ID, []string{"honest"})
+			Expect(err).To(BeNil())
+
+			fork := fixtures.GenerateUpdateRecord(records[3], newKey, "fork")
+			serve("forked", append(records[:4:4], fork, fixtures.GenerateUpdateRecord(fork, newKey, "fork 2")))
+			result, err = client.Head(records[0].Metadata().ID, []string{"honest", "forked"})
+		})
+
+		It("should report it as conflicting", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Conflicting).To(Equal([]string{"forked"}))
+			Expect(result.Verified).To(Equal([]string{"honest"}))
+		})
+	})
+
+	Describe("when the newest head has expired", func() {
+		var root record.Record
+		var result *light.Result
+		var err error
+
+		BeforeEach(func() {
+			var key *rsa.PrivateKey
+			root, key = fixtures.GenerateRootRecord(record.Metadata{NotAfter: time.Now().Add(3 * time.Hour)})
+			metadata := root.Metadata()
+			metadata.NotAfter = time.Now().Add(time.Hour)
+			expired := fixtures.GenerateUpdate(root, key, metadata, []byte(`expired`))
+
+			serve("expired", []record.Record{root, expired})
+			serve("behind", []record.Record{root})
+
+			later := func() time.Time { return time.Now().Add(2 * time.Hour) }
+			client = light.NewClient(network.Transport(), light.Options{Validity: record.Validity{Now: later}})
+			result, err = client.Head(root.Metadata().ID, []string{"expired", "behind"})
+		})
+
+		It("should return the newest head that is valid", func() {
+			Expect(err).To(BeNil())
+			Expect(fixtures.MustHash(result.Head)).To(Equal(fixtures.MustHash(root)))
+			Expect(result.Verified).To(Equal([]string{"behind"}))
+		})
+
+		It("should report the peer that proved the expired head as failed", func() {
+			Expect(result.Failed["expired"]).To(MatchError(ContainSubstring("head is invalid: record expired at")))
+		})
+	})
+
+	Describe("when a peer is unreachable", func() {
+		It("should report it as failed", func() {
+			serve("full", records)
+			result, err := client.Head(records[0].Metadata().ID, []string{"gone", "full"})
+			Expect(err).To(BeNil())
+			Expect(result.Failed["gone"]).To(MatchError("peer 'gone' is unreachable"))
+		})
+	})
+})
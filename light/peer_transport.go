@@ -0,0 +1,49 @@
+package light
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/wire"
+)
+
+// PathPrefix is the prefix of the routes served by PeerHandler
+const PathPrefix = "/light/"
+
+// NewPeerTransport constructs a Transport that sends each request
+// with the client. A light client that isn't a member of the mesh
+// can use a plain http.Client with the HTTP API addresses of nodes
+// that serve a PeerHandler there, since it verifies every proof
+// itself. Members should use a peer.NewHTTPClient
+func NewPeerTransport(client *http.Client) Transport {
+	return &peerTransport{client: client}
+}
+
+type peerTransport struct {
+	client *http.Client
+}
+
+func (transport *peerTransport) Proof(peer string, request ProofRequest) (*Proof, error) {
+	proof := &Proof{}
+	if err := wire.Call(transport.client, peer, PathPrefix+"proof", &request, proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// PeerHandler answers the requests of peer transports under PathPrefix
+func PeerHandler(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, PathPrefix) {
+		case "proof":
+			request := ProofRequest{}
+			if !wire.Read(w, r, &request) {
+				return
+			}
+			proof, err := handler.HandleProof(request)
+			wire.Write(w, proof, err)
+		default:
+			wire.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package light_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/light"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerTransport", func() {
+	var records []record.Record
+	var mux *http.ServeMux
+	var result *light.Result
+	var err error
+
+	BeforeEach(func() {
+		records, _ = fixtures.GenerateChain(2)
+
+		s := store.New(store.NewMemoryBackend())
+		for _, rec := range records {
+			Expect(s.Put(rec)).To(Succeed())
+		}
+		mux = http.NewServeMux()
+		mux.Handle(light.PathPrefix, light.PeerHandler(light.NewServer(s)))
+	})
+
+	Describe("over a peer connection", func() {
+		var server *http.Server
+
+		BeforeEach(func() {
+			listener, listenErr := peer.Listen("tcp", "127.0.0.1:0", fixtures.GeneratePeerConfig("full"))
+			Expect(listenErr).To(BeNil())
+			server = peer.NewHTTPServer(mux)
+			go server.Serve(listener)
+
+			httpClient := peer.NewHTTPClient(fixtures.GeneratePeerConfig("member"), time.Second)
+			client := light.NewClient(light.NewPeerTransport(httpClient), light.Options{})
+			result, err = client.Head(records[0].Metadata().ID, []string{listener.Addr().String()})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should verify the head", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Head.Data()).To(Equal([]byte("b")))
+			Expect(result.Height).To(Equal(2))
+		})
+	})
+
+	Describe("over the HTTP API", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(mux)
+			address := strings.TrimPrefix(server.URL, "http://")
+
+			client := light.NewClient(light.NewPeerTransport(http.DefaultClient), light.Options{})
+			result, err = client.Head(records[0].Metadata().ID, []string{address, "127.0.0.1:1"})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should verify the head", func() {
+			Expect(err).To(BeNil())
+			Expect(result.Head.Data()).To(Equal([]byte("b")))
+			Expect(result.Verified).To(HaveLen(1))
+		})
+
+		It("should report the unreachable peer", func() {
+			Expect(result.Failed).To(HaveKey("127.0.0.1:1"))
+		})
+	})
+})
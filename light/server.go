@@ -0,0 +1,68 @@
+package light
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// NewServer constructs a Handler that answers proof requests
+// from the chains in the store
+func NewServer(s store.Store) Handler {
+	return &server{store: s}
+}
+
+type server struct {
+	store store.Store
+}
+
+// HandleProof returns the records after request.Since, or the
+// whole chain if Since is empty or unknown. A pruned chain can
+// only serve clients that already verified a retained record
+func (server *server) HandleProof(request ProofRequest) (*Proof, error) {
+	chain, err := server.store.Chain(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	records := chain.Records()
+	start := 0
+	if len(request.Since) != 0 {
+		if i, err := indexOf(records, request.Since); err != nil {
+			return nil, err
+		} else if i >= 0 {
+			start = i + 1
+		}
+	}
+	if start == 0 && !chain.Complete() {
+		return nil, fmt.Errorf("chain for metadata.ID '%v' was pruned and cannot be proven from its RootRecord", request.ID)
+	}
+
+	proof := &Proof{Records: make([]*encoding.Record, 0, len(records)-start)}
+	for _, rec := range records[start:] {
+		recordPB, err := rec.Proto()
+		if err != nil {
+			return nil, err
+		}
+		proof.Records = append(proof.Records, recordPB)
+	}
+	return proof, nil
+}
+
+// indexOf returns the index of the record with
+// the hash, or -1 if it isn't in records
+func indexOf(records []record.Record, hash []byte) (int, error) {
+	for i, rec := range records {
+		recordHash, err := rec.Hash()
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(recordHash, hash) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
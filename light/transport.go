@@ -0,0 +1,104 @@
+package light
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// ProofRequest asks a peer for the records needed
+// to verify the current head of a chain
+type ProofRequest struct {
+	ID string
+
+	// Since is the hash of the most recent record the client
+	// has already verified. The peer only returns the records
+	// after it. When empty, the proof starts at the RootRecord
+	Since []byte
+}
+
+// Proof is a peer's answer to a ProofRequest: the records
+// from the one after ProofRequest.Since up to the head,
+// oldest first. A peer that does not know Since returns
+// the chain from its RootRecord instead
+type Proof struct {
+	Records []*encoding.Record
+}
+
+// Handler serves the light-client protocol for a full node
+type Handler interface {
+	// HandleProof returns the proof for the request
+	HandleProof(request ProofRequest) (*Proof, error)
+}
+
+// Transport delivers light-client requests to peers by address
+type Transport interface {
+	// Proof requests a proof from the peer
+	Proof(peer string, request ProofRequest) (*Proof, error)
+}
+
+// MemoryNetwork connects handlers within a single process.
+// It is intended for tests and simulations
+type MemoryNetwork interface {
+	// Join registers the handler at the address
+	Join(address string, handler Handler)
+
+	// Leave removes the handler at the address. Requests
+	// sent to it afterwards fail as if it were unreachable
+	Leave(address string)
+
+	// Transport returns a Transport that sends requests
+	Transport() Transport
+}
+
+// NewMemoryNetwork constructs an empty MemoryNetwork
+func NewMemoryNetwork() MemoryNetwork {
+	return &memoryNetwork{handlers: make(map[string]Handler)}
+}
+
+type memoryNetwork struct {
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+func (network *memoryNetwork) Join(address string, handler Handler) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	network.handlers[address] = handler
+}
+
+func (network *memoryNetwork) Leave(address string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	delete(network.handlers, address)
+}
+
+func (network *memoryNetwork) Transport() Transport {
+	return &memoryTransport{network: network}
+}
+
+func (network *memoryNetwork) handler(address string) (Handler, error) {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+
+	handler, ok := network.handlers[address]
+	if !ok {
+		return nil, fmt.Errorf("peer '%v' is unreachable", address)
+	}
+	return handler, nil
+}
+
+type memoryTransport struct {
+	network *memoryNetwork
+}
+
+func (transport *memoryTransport) Proof(peer string, request ProofRequest) (*Proof, error) {
+	handler, err := transport.network.handler(peer)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleProof(request)
+}
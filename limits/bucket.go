@@ -0,0 +1,157 @@
+package limits
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Rate is a token bucket that holds up to Burst tokens and is
+// refilled at PerSecond tokens a second. The zero Rate is unlimited
+type Rate struct {
+	PerSecond float64 `json:"perSecond"`
+	Burst     int     `json:"burst"`
+}
+
+// unlimited returns true if the rate doesn't limit anything
+func (rate Rate) unlimited() bool {
+	return rate.PerSecond <= 0 && rate.Burst <= 0
+}
+
+// capacity is the most tokens a bucket holds. A rate
+// without a Burst still allows a single token at a time
+func (rate Rate) capacity() float64 {
+	if rate.Burst < 1 {
+		return 1
+	}
+	return float64(rate.Burst)
+}
+
+// maxBuckets is how many buckets a keyedBuckets holds. Once it is
+// reached, the least recently used bucket is forgotten for every new
+// key, which is most likely to have refilled already
+const maxBuckets = 10000
+
+type bucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+// keyedBuckets keeps a token bucket with the same Rate for every key,
+// holding at most maxBuckets of them
+type keyedBuckets struct {
+	rate Rate
+
+	lock    sync.Mutex
+	buckets map[string]*list.Element
+
+	// recent orders the buckets from the most
+	// to the least recently used
+	recent *list.List
+}
+
+func newKeyedBuckets(rate Rate) *keyedBuckets {
+	return &keyedBuckets{rate: rate, buckets: make(map[string]*list.Element), recent: list.New()}
+}
+
+// check returns whether the key's bucket has a token, without taking
+// it. If the bucket is empty, it also returns how long until a token
+// will be available
+func (buckets *keyedBuckets) check(key string, now time.Time) (bool, time.Duration) {
+	if buckets.rate.unlimited() {
+		return true, 0
+	}
+
+	buckets.lock.Lock()
+	defer buckets.lock.Unlock()
+
+	element, ok := buckets.buckets[key]
+	if !ok {
+		return true, 0
+	}
+
+	b := element.Value.(*bucket)
+	buckets.refill(b, now)
+	return buckets.available(b)
+}
+
+// take removes a token from the key's bucket. If the bucket is empty,
+// it returns false and how long until a token will be available
+func (buckets *keyedBuckets) take(key string, now time.Time) (bool, time.Duration) {
+	if buckets.rate.unlimited() {
+		return true, 0
+	}
+
+	buckets.lock.Lock()
+	defer buckets.lock.Unlock()
+
+	b := buckets.get(key, now)
+	buckets.refill(b, now)
+	ok, wait := buckets.available(b)
+	if ok {
+		b.tokens--
+	}
+	return ok, wait
+}
+
+// giveBack returns a token that was taken from the key's bucket
+func (buckets *keyedBuckets) giveBack(key string, now time.Time) {
+	if buckets.rate.unlimited() {
+		return
+	}
+
+	buckets.lock.Lock()
+	defer buckets.lock.Unlock()
+
+	b := buckets.get(key, now)
+	buckets.refill(b, now)
+	b.tokens++
+	if b.tokens > buckets.rate.capacity() {
+		b.tokens = buckets.rate.capacity()
+	}
+}
+
+// get returns the key's bucket, marking it as the most recently
+// used, or a new full bucket. It must be called with the lock held
+func (buckets *keyedBuckets) get(key string, now time.Time) *bucket {
+	if element, ok := buckets.buckets[key]; ok {
+		buckets.recent.MoveToFront(element)
+		return element.Value.(*bucket)
+	}
+
+	if buckets.recent.Len() >= maxBuckets {
+		oldest := buckets.recent.Back()
+		buckets.recent.Remove(oldest)
+		delete(buckets.buckets, oldest.Value.(*bucket).key)
+	}
+
+	b := &bucket{key: key, tokens: buckets.rate.capacity(), updated: now}
+	buckets.buckets[key] = buckets.recent.PushFront(b)
+	return b
+}
+
+// available returns whether the bucket has a token and,
+// if it doesn't, how long until it will
+func (buckets *keyedBuckets) available(b *bucket) (bool, time.Duration) {
+	if b.tokens >= 1 {
+		return true, 0
+	}
+
+	if buckets.rate.PerSecond <= 0 {
+		return false, 0
+	}
+	wait := (1 - b.tokens) / buckets.rate.PerSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (buckets *keyedBuckets) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * buckets.rate.PerSecond
+		if b.tokens > buckets.rate.capacity() {
+			b.tokens = buckets.rate.capacity()
+		}
+	}
+	b.updated = now
+}
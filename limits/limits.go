@@ -0,0 +1,208 @@
+// Package limits protects a node from clients that submit too many
+// records. Submissions are limited by token buckets per network peer,
+// per signing public key and per metadata.ID, and the records stored
+// for each metadata.ID are limited by a quota
+package limits
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// Kinds of limits, used in Error.Kind
+const (
+	KindPeer      = "peer"
+	KindPublicKey = "publicKey"
+	KindID        = "id"
+	KindQuota     = "quota"
+)
+
+// Quota limits what is stored for a single metadata.ID.
+// Zero values are unlimited
+type Quota struct {
+	// MaxRecords is the most records stored in a chain
+	MaxRecords int `json:"maxRecords"`
+
+	// MaxBytes is the most bytes of data stored in a chain,
+	// counting the size of the data stored in chunks
+	MaxBytes int64 `json:"maxBytes"`
+}
+
+// Config configures the limits. The zero Config is unlimited
+type Config struct {
+	// PerPeer limits submissions from a single network address, and
+	// the records gossiped or stored by a single peer node, which
+	// are keyed on the metadata.ID of its identity
+	PerPeer Rate `json:"perPeer"`
+
+	// PerPublicKey limits the records signed by a single key
+	PerPublicKey Rate `json:"perPublicKey"`
+
+	// PerID limits the records for a single metadata.ID
+	PerID Rate `json:"perId"`
+
+	// PerIDQuota limits what is stored for a single metadata.ID
+	PerIDQuota Quota `json:"perIdQuota"`
+}
+
+// Error is returned when a limit is exceeded
+type Error struct {
+	// Kind is the kind of limit that was exceeded
+	Kind string
+
+	// Key identifies what was limited: the peer's address or
+	// identity, the public key's fingerprint or the metadata.ID
+	Key string
+
+	// RetryAfter is how long until the submission would be allowed.
+	// It is zero for quotas, which don't recover on their own
+	RetryAfter time.Duration
+
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// Limiter decides whether a submission is allowed
+type Limiter interface {
+	// AllowPeer takes a token for a submission from the peer. It
+	// should be called before the submission is parsed or verified
+	AllowPeer(peer string) error
+
+	// AllowRecord takes a token for the record's metadata.ID and signing
+	// key, and checks the metadata.ID's quota. No token is taken if any
+	// of them doesn't allow the record. It must only be called
+	// once the record has been verified against its parent, which is
+	// nil for root records, so that the tokens of others can't be spent
+	AllowRecord(rec, parent record.Record) error
+}
+
+// New constructs a Limiter that checks quotas against the store
+func New(s store.Store, config Config) Limiter {
+	return &limiter{
+		store:        s,
+		config:       config,
+		perPeer:      newKeyedBuckets(config.PerPeer),
+		perPublicKey: newKeyedBuckets(config.PerPublicKey),
+		perID:        newKeyedBuckets(config.PerID),
+	}
+}
+
+type limiter struct {
+	store        store.Store
+	config       Config
+	perPeer      *keyedBuckets
+	perPublicKey *keyedBuckets
+	perID        *keyedBuckets
+}
+
+// AllowPeer takes a token for the peer
+func (limiter *limiter) AllowPeer(peer string) error {
+	return limiter.take(limiter.perPeer, KindPeer, peer)
+}
+
+// AllowRecord checks the quota and the buckets of the record's
+// signing key and metadata.ID, then takes a token from each bucket.
+// No token is taken unless every limit allows the record
+func (limiter *limiter) AllowRecord(rec, parent record.Record) error {
+	if err := limiter.checkQuota(rec); err != nil {
+		return err
+	}
+
+	reservations := []reservation{}
+	if !limiter.config.PerPublicKey.unlimited() {
+		signingKey, err := record.SigningKey(rec, parent)
+		if err != nil {
+			return err
+		}
+		fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(signingKey)
+		if err != nil {
+			return err
+		}
+		reservations = append(reservations, reservation{limiter.perPublicKey, KindPublicKey, fingerprint})
+	}
+	reservations = append(reservations, reservation{limiter.perID, KindID, rec.Metadata().ID})
+
+	now := time.Now()
+	for _, r := range reservations {
+		if ok, retryAfter := r.buckets.check(r.key, now); !ok {
+			return limitError(r.kind, r.key, retryAfter)
+		}
+	}
+
+	// Another submission may have emptied a bucket since it was
+	// checked, then the tokens that were already taken are given back
+	for i, r := range reservations {
+		if ok, retryAfter := r.buckets.take(r.key, now); !ok {
+			for _, taken := range reservations[:i] {
+				taken.buckets.giveBack(taken.key, now)
+			}
+			return limitError(r.kind, r.key, retryAfter)
+		}
+	}
+	return nil
+}
+
+// reservation is a token that AllowRecord takes from a bucket
+type reservation struct {
+	buckets *keyedBuckets
+	kind    string
+	key     string
+}
+
+func (limiter *limiter) take(buckets *keyedBuckets, kind, key string) error {
+	ok, retryAfter := buckets.take(key, time.Now())
+	if ok {
+		return nil
+	}
+	return limitError(kind, key, retryAfter)
+}
+
+func limitError(kind, key string, retryAfter time.Duration) *Error {
+	return &Error{
+		Kind:       kind,
+		Key:        key,
+		RetryAfter: retryAfter,
+		Message:    fmt.Sprintf("rate limit for %v '%v' exceeded", kind, key),
+	}
+}
+
+// checkQuota returns an error if storing the record
+// would exceed the quota of its metadata.ID
+func (limiter *limiter) checkQuota(rec record.Record) error {
+	quota := limiter.config.PerIDQuota
+	if quota.MaxRecords <= 0 && quota.MaxBytes <= 0 {
+		return nil
+	}
+
+	id := rec.Metadata().ID
+	usage, err := limiter.store.Usage(id)
+	if err == store.ErrNotFound {
+		usage = &store.Usage{}
+	} else if err != nil {
+		return err
+	}
+
+	if quota.MaxRecords > 0 && usage.Records+1 > quota.MaxRecords {
+		return &Error{
+			Kind:    KindQuota,
+			Key:     id,
+			Message: fmt.Sprintf("metadata.ID '%v' already has %v records stored, the quota is %v", id, usage.Records, quota.MaxRecords),
+		}
+	}
+
+	if quota.MaxBytes > 0 && usage.Bytes+store.DataSize(rec) > quota.MaxBytes {
+		return &Error{
+			Kind:    KindQuota,
+			Key:     id,
+			Message: fmt.Sprintf("metadata.ID '%v' would exceed its quota of %v bytes", id, quota.MaxBytes),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package limits_test
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// limitKind returns the Kind of a *limits.Error
+func limitKind(err error) string {
+	Expect(err).To(BeAssignableToTypeOf(&limits.Error{}))
+	return err.(*limits.Error).Kind
+}
+
+var _ = Describe("Limiter", func() {
+	var sut limits.Limiter
+	var s store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+
+	BeforeEach(func() {
+		s = store.New(store.NewMemoryBackend())
+		records, privateKey = fixtures.GenerateChain(0)
+	})
+
+	Describe("with the zero Config", func() {
+		BeforeEach(func() {
+			sut = limits.New(s, limits.Config{})
+		})
+
+		It("should allow everything", func() {
+			for i := 0; i < 100; i++ {
+				Expect(sut.AllowPeer("127.0.0.1")).To(Succeed())
+				Expect(sut.AllowRecord(records[0], nil)).To(Succeed())
+			}
+		})
+	})
+
+	Describe("AllowPeer", func() {
+		BeforeEach(func() {
+			sut = limits.New(s, limits.Config{PerPeer: limits.Rate{PerSecond: 0.5, Burst: 2}})
+		})
+
+		It("should allow a burst, then limit the peer", func() {
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+
+			err := sut.AllowPeer("10.0.0.1")
+			Expect(limitKind(err)).To(Equal(limits.KindPeer))
+			Expect(err.(*limits.Error).Key).To(Equal("10.0.0.1"))
+			Expect(err.(*limits.Error).RetryAfter).To(BeNumerically("~", 2*time.Second, 100*time.Millisecond))
+		})
+
+		It("should limit each peer separately", func() {
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+			Expect(sut.AllowPeer("10.0.0.2")).To(Succeed())
+		})
+	})
+
+	Describe("with more peers than it keeps buckets for", func() {
+		BeforeEach(func() {
+			sut = limits.New(s, limits.Config{PerPeer: limits.Rate{PerSecond: 0.001, Burst: 1}})
+		})
+
+		It("should forget the least recently used peer", func() {
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+			Expect(sut.AllowPeer("10.0.0.1")).NotTo(Succeed())
+
+			for i := 0; i < 10000; i++ {
+				Expect(sut.AllowPeer(fmt.Sprintf("10.1.%v.%v", i/256, i%256))).To(Succeed())
+			}
+
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+		})
+	})
+
+	Describe("when the bucket refills", func() {
+		BeforeEach(func() {
+			sut = limits.New(s, limits.Config{PerPeer: limits.Rate{PerSecond: 100, Burst: 1}})
+		})
+
+		It("should allow the peer again", func() {
+			Expect(sut.AllowPeer("10.0.0.1")).To(Succeed())
+			Expect(sut.AllowPeer("10.0.0.1")).NotTo(Succeed())
+			Eventually(func() error { return sut.AllowPeer("10.0.0.1") }).Should(Succeed())
+		})
+	})
+
+	Describe("AllowRecord", func() {
+		Describe("with a limit per public key", func() {
+			BeforeEach(func() {
+				sut = limits.New(s, limits.Config{PerPublicKey: limits.Rate{PerSecond: 0.001, Burst: 1}})
+			})
+
+			It("should limit the records signed by the same key", func() {
+				other, _ := fixtures.GenerateChain(0)
+				Expect(sut.AllowRecord(records[0], nil)).To(Succeed())
+				Expect(sut.AllowRecord(other[0], nil)).To(Succeed())
+
+				update := fixtures.GenerateUpdateRecord(records[0], privateKey, "update")
+				Expect(limitKind(sut.AllowRecord(update, records[0]))).To(Equal(limits.KindPublicKey))
+			})
+		})
+
+		Describe("with a limit per ID", func() {
+			BeforeEach(func() {
+				sut = limits.New(s, limits.Config{PerID: limits.Rate{PerSecond: 0.001, Burst: 1}})
+			})
+
+			It("should limit the records for the same ID", func() {
+				Expect(sut.AllowRecord(records[0], nil)).To(Succeed())
+
+				update := fixtures.GenerateUpdateRecord(records[0], privateKey, "update")
+				Expect(limitKind(sut.AllowRecord(update, records[0]))).To(Equal(limits.KindID))
+			})
+		})
+
+		Describe("with limits per public key and per ID", func() {
+			BeforeEach(func() {
+				sut = limits.New(s, limits.Config{
+					PerPublicKey: limits.Rate{PerSecond: 0.001, Burst: 2},
+					PerID:        limits.Rate{PerSecond: 0.001, Burst: 1},
+				})
+			})
+
+			It("should not take a token for the public key when the ID is limited", func() {
+				Expect(sut.AllowRecord(records[0], nil)).To(Succeed())
+
+				update := fixtures.GenerateUpdateRecord(records[0], privateKey, "update")
+				for i := 0; i < 3; i++ {
+					Expect(limitKind(sut.AllowRecord(update, records[0]))).To(Equal(limits.KindID))
+				}
+			})
+		})
+
+		Describe("with a quota of records", func() {
+			BeforeEach(func() {
+				sut = limits.New(s, limits.Config{PerIDQuota: limits.Quota{MaxRecords: 2}})
+			})
+
+			It("should refuse records beyond the quota", func() {
+				update := fixtures.GenerateUpdateRecord(records[0], privateKey, "update")
+				Expect(sut.AllowRecord(records[0], nil)).To(Succeed())
+				Expect(s.Put(records[0])).To(Succeed())
+				Expect(sut.AllowRecord(update, records[0])).To(Succeed())
+				Expect(s.Put(update)).To(Succeed())
+
+				next := fixtures.GenerateUpdateRecord(update, privateKey, "next")
+				err := sut.AllowRecord(next, update)
+				Expect(limitKind(err)).To(Equal(limits.KindQuota))
+				Expect(err.(*limits.Error).RetryAfter).To(BeZero())
+			})
+		})
+
+		Describe("with a quota of bytes", func() {
+			BeforeEach(func() {
+				sut = limits.New(s, limits.Config{PerIDQuota: limits.Quota{MaxBytes: 10}})
+				Expect(s.Put(records[0])).To(Succeed())
+			})
+
+			It("should refuse data beyond the quota", func() {
+				small := fixtures.GenerateUpdateRecord(records[0], privateKey, "small")
+				Expect(sut.AllowRecord(small, records[0])).To(Succeed())
+
+				large := fixtures.GenerateUpdateRecord(records[0], privateKey, "much too large")
+				Expect(limitKind(sut.AllowRecord(large, records[0]))).To(Equal(limits.KindQuota))
+			})
+
+			It("should count the size of data stored in chunks", func() {
+				metadata := records[0].Metadata()
+				metadata.Manifest = &chunks.Manifest{Root: make([]byte, 32), Size: 1000, ChunkSize: 100}
+				chunked := fixtures.GenerateUpdate(records[0], privateKey, metadata, nil)
+				Expect(limitKind(sut.AllowRecord(chunked, records[0]))).To(Equal(limits.KindQuota))
+			})
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/royvandewater/meshchain/store"
+)
+
+// command is a meshchain subcommand. It receives the
+// arguments that follow the subcommand name
+type command struct {
+	run         func(args []string) error
+	description string
+}
+
+var commands = map[string]command{
+	"export":    {runExport, "export chains from a store to an archive file"},
+	"fsck":      {runFsck, "check a store for corruption, optionally repairing it"},
+	"import":    {runImport, "verify an archive file and import its chains into a store"},
+	"key":       {runKey, "generate, list, export, import and fingerprint signing keys"},
+	"record":    {runRecord, "create, update, verify and inspect signed records"},
+	"reencrypt": {runReencrypt, "rewrite the values of an encrypted store with its active key"},
+	"serve":     {runServe, "serve a store over HTTP"},
+	"version":   {runVersion, "print the version"},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command '%v'\n", os.Args[1])
+		usage()
+		os.Exit(1)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// storeFlags adds the flags that locate a store
+// and the master keys it is encrypted with
+func storeFlags(flags *flag.FlagSet) (dir, keys *string) {
+	dir = flags.String("store", "", "path to the store directory (required)")
+	keys = flags.String("keys", os.Getenv("MESHCHAIN_STORE_KEYS"), "comma separated paths of the master key files of an encrypted store, the active key first. Defaults to $MESHCHAIN_STORE_KEYS")
+	return dir, keys
+}
+
+// openStore opens the store in dir, which must already exist,
+// decrypting it with the master keys in the comma separated
+// key files. The store stays locked until the lock is closed
+func openStore(dir, keys string) (store.Store, io.Closer, error) {
+	if dir == "" {
+		return nil, nil, fmt.Errorf("--store is required")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, nil, err
+	}
+
+	keyFiles := []string{}
+	for _, path := range strings.Split(keys, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			keyFiles = append(keyFiles, path)
+		}
+	}
+
+	backend, lock, err := openBackend(dir, keyFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store.New(backend), lock, nil
+}
+
+// openBackend locks the store directory dir, so that no other
+// command opens it meanwhile, and opens the file backend in it.
+// When key files are given its values are encrypted with the
+// master key in the first and decrypted with any of them
+func openBackend(dir string, keyFiles []string) (store.Backend, io.Closer, error) {
+	lock, err := store.Lock(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backend, err := newBackend(dir, keyFiles)
+	if err != nil {
+		lock.Close()
+		return nil, nil, err
+	}
+	return backend, lock, nil
+}
+
+// newBackend opens the file backend in dir, encrypted
+// with the master keys in keyFiles if any are given
+func newBackend(dir string, keyFiles []string) (store.Backend, error) {
+	backend, err := store.NewFileBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyFiles) == 0 {
+		return backend, nil
+	}
+
+	masterKeys := make([]store.MasterKey, len(keyFiles))
+	for i, path := range keyFiles {
+		masterKeys[i], err = store.ReadMasterKey(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return store.NewEncryptedBackend(backend, masterKeys[0], masterKeys[1:]...)
+}
+
+func runVersion(args []string) error {
+	fmt.Println(VERSION)
+	return nil
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: meshchain <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10v %v\n", name, commands[name].description)
+	}
+}
@@ -0,0 +1,86 @@
+package membership
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/record/generators"
+)
+
+// IdentityLocalID is the metadata.LocalID of every node identity record
+const IdentityLocalID = "meshchain-node"
+
+// identityData is the data of a node identity record
+type identityData struct {
+	Address string `json:"address"`
+}
+
+// NewIdentity creates the signed root record that identifies a node.
+// Its metadata.ID is the node's ID and its data holds the address the
+// node can be reached at, so that peers can't announce a node at an
+// address it never claimed
+func NewIdentity(address, publicKey string, privateKey *rsa.PrivateKey) (record.RootRecord, error) {
+	data, err := json.Marshal(&identityData{Address: address})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := record.Metadata{
+		ID:         generators.ID(IdentityLocalID, []string{publicKey}),
+		LocalID:    IdentityLocalID,
+		PublicKeys: []string{publicKey},
+	}
+
+	unsigned, err := record.NewUnsignedRootRecord(metadata, data)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return record.NewRootRecord(metadata, data, signature)
+}
+
+// VerifyIdentity verifies the identity record
+// and returns the address it was signed for
+func VerifyIdentity(identityPB *encoding.Record) (record.Record, string, error) {
+	if identityPB == nil {
+		return nil, "", fmt.Errorf("identity record is required")
+	}
+	if len(identityPB.Parent) != 0 {
+		return nil, "", fmt.Errorf("identity record must be a root record")
+	}
+
+	identity, err := record.FromProto(identityPB, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("identity record is invalid: %v", err.Error())
+	}
+	if identity.Metadata().LocalID != IdentityLocalID {
+		return nil, "", fmt.Errorf("identity record must have the metadata.LocalID '%v'", IdentityLocalID)
+	}
+
+	address, err := IdentityAddress(identity)
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, address, nil
+}
+
+// IdentityAddress returns the address the identity record was signed
+// for. It does not verify the record, see VerifyIdentity
+func IdentityAddress(identity record.Record) (string, error) {
+	data := &identityData{}
+	if err := json.Unmarshal(identity.Data(), data); err != nil {
+		return "", fmt.Errorf("Failed to parse identity record data: %v", err.Error())
+	}
+	if data.Address == "" {
+		return "", fmt.Errorf("identity record has no address")
+	}
+	return data.Address, nil
+}
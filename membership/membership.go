@@ -0,0 +1,683 @@
+// Package membership maintains the list of live nodes in the mesh
+// using SWIM-style failure detection.
+//
+// Every protocol period a node probes one member directly. If the
+// member doesn't acknowledge, the node asks a few other members to
+// probe it indirectly, and only if none of them succeed is the member
+// suspected. A suspected member that doesn't refute the suspicion,
+// by announcing itself alive with a higher incarnation, is declared
+// failed after a number of periods, and forgotten after a number of
+// periods more. Membership changes are piggybacked on probes and
+// acknowledgements.
+//
+// Each node is identified by a signed identity record, see NewIdentity.
+// Identity records are verified before a member is added
+package membership
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// State is the state of a member
+type State int
+
+const (
+	// Alive members are probed and returned by Addresses
+	Alive State = iota
+
+	// Suspect members failed a probe, but are still returned by
+	// Addresses until they are declared Dead
+	Suspect
+
+	// Dead members are no longer probed or returned by Addresses
+	Dead
+)
+
+func (state State) String() string {
+	switch state {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	}
+	return fmt.Sprintf("State(%d)", int(state))
+}
+
+// EventType describes a membership change
+type EventType string
+
+const (
+	// Joined is emitted when a member is first seen
+	Joined EventType = "joined"
+
+	// Suspected is emitted when a member becomes Suspect
+	Suspected EventType = "suspected"
+
+	// Recovered is emitted when a Suspect or Dead member becomes Alive again
+	Recovered EventType = "recovered"
+
+	// Failed is emitted when a member is declared Dead
+	Failed EventType = "failed"
+
+	// Removed is emitted when a Dead member is forgotten
+	Removed EventType = "removed"
+)
+
+// Event is emitted on the Events channel for every membership change
+type Event struct {
+	Type   EventType
+	Member Member
+}
+
+// Member is a node in the mesh
+type Member struct {
+	// ID is the metadata.ID of the member's identity record
+	ID          string
+	Address     string
+	State       State
+	Incarnation uint64
+	Identity    record.Record
+}
+
+const (
+	defaultIndirectProbes   = 3
+	defaultSuspicionPeriods = 3
+	defaultDeadPeriods      = 30
+	defaultEventBuffer      = 64
+	defaultRetransmits      = 3
+)
+
+// Options configures a Membership. Zero values use the defaults
+type Options struct {
+	// IndirectProbes is how many members are asked to probe a member
+	// that didn't acknowledge a direct probe, defaults to 3
+	IndirectProbes int
+
+	// SuspicionPeriods is how many protocol periods a member stays
+	// Suspect before it is declared Dead, defaults to 3
+	SuspicionPeriods int
+
+	// DeadPeriods is how many protocol periods a Dead member is
+	// remembered before it is forgotten, defaults to 30. A Dead
+	// member is remembered so that old updates announcing it Alive
+	// are ignored
+	DeadPeriods int
+
+	// EventBuffer is the capacity of the Events channel, defaults
+	// to 64. Events are dropped when the channel is full
+	EventBuffer int
+
+	// Retransmits multiplied by the log of the cluster size is how many
+	// times each update is piggybacked, defaults to 3
+	Retransmits int
+}
+
+// Membership is a node's view of the mesh
+type Membership interface {
+	Handler
+
+	// Addresses returns the address of every member that is not
+	// Dead, sorted. Pass the Membership as gossip.Options.Members
+	// and antientropy.Options.Members to gossip and sync with them
+	Addresses() []string
+
+	// Events returns the channel that membership changes are sent on
+	Events() <-chan Event
+
+	// Join probes the node at the address to exchange membership
+	Join(address string) error
+
+	// Members returns every other known member, sorted by ID
+	Members() []Member
+
+	// Probe runs a single protocol period
+	Probe()
+
+	// Run runs a protocol period every interval until stop is closed
+	Run(interval time.Duration, stop <-chan struct{})
+}
+
+// New constructs the Membership of the node identified by the
+// identity record, see NewIdentity. It starts out without members
+func New(identity record.Record, transport Transport, options Options) (Membership, error) {
+	identityPB, err := identity.Proto()
+	if err != nil {
+		return nil, err
+	}
+
+	_, address, err := VerifyIdentity(identityPB)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.IndirectProbes <= 0 {
+		options.IndirectProbes = defaultIndirectProbes
+	}
+	if options.SuspicionPeriods <= 0 {
+		options.SuspicionPeriods = defaultSuspicionPeriods
+	}
+	if options.DeadPeriods <= 0 {
+		options.DeadPeriods = defaultDeadPeriods
+	}
+	if options.EventBuffer <= 0 {
+		options.EventBuffer = defaultEventBuffer
+	}
+	if options.Retransmits <= 0 {
+		options.Retransmits = defaultRetransmits
+	}
+
+	membership := &membership{
+		self:        &member{Member: Member{ID: identity.Metadata().ID, Address: address, State: Alive, Identity: identity}, identityPB: identityPB},
+		transport:   transport,
+		options:     options,
+		members:     make(map[string]*member),
+		events:      make(chan Event, options.EventBuffer),
+		broadcasts:  make(map[string]*broadcast),
+		suspectedAt: make(map[string]int),
+		deadAt:      make(map[string]int),
+	}
+	membership.enqueue(membership.self)
+	return membership, nil
+}
+
+type member struct {
+	Member
+	identityPB *encoding.Record
+}
+
+func (member *member) update() Update {
+	return Update{Identity: member.identityPB, State: member.State, Incarnation: member.Incarnation}
+}
+
+// broadcast is an update waiting to be piggybacked
+type broadcast struct {
+	update    Update
+	transmits int
+}
+
+type membership struct {
+	transport Transport
+	options   Options
+	events    chan Event
+
+	lock        sync.Mutex
+	self        *member
+	members     map[string]*member
+	broadcasts  map[string]*broadcast
+	period      int
+	suspectedAt map[string]int
+	deadAt      map[string]int
+	probeOrder  []string
+}
+
+// Addresses returns the address of every member that is not Dead
+func (membership *membership) Addresses() []string {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	var addresses []string
+	for _, member := range membership.members {
+		if member.State != Dead {
+			addresses = append(addresses, member.Address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// Events returns the channel that membership changes are sent on
+func (membership *membership) Events() <-chan Event {
+	return membership.events
+}
+
+// HandlePing merges the updates and acknowledges the probe. A
+// new member gets the full membership in the acknowledgement. A
+// member that announces itself Alive while it is known as Suspect
+// or Dead, such as a node that restarted at incarnation 0, gets
+// the state it is known by so that it can refute it
+func (membership *membership) HandlePing(message Message) (Message, error) {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	sendAll := false
+	for _, update := range message.Updates {
+		if id, ok := updateID(update); ok && membership.members[id] == nil && id != membership.self.ID {
+			sendAll = true
+		}
+	}
+
+	membership.merge(message.Updates)
+
+	if sendAll {
+		return Message{Updates: membership.allUpdates()}, nil
+	}
+	return Message{Updates: append(membership.piggyback(), membership.outdated(message.Updates)...)}, nil
+}
+
+// HandlePingReq probes the target on behalf of the sender
+func (membership *membership) HandlePingReq(target string, message Message) (Message, error) {
+	membership.lock.Lock()
+	membership.merge(message.Updates)
+	outgoing := Message{Updates: membership.piggyback()}
+	membership.lock.Unlock()
+
+	ack, err := membership.transport.Ping(target, outgoing)
+	if err != nil {
+		return Message{}, err
+	}
+
+	membership.lock.Lock()
+	membership.merge(ack.Updates)
+	membership.lock.Unlock()
+
+	return ack, nil
+}
+
+// Join probes the node at the address to exchange membership. If the
+// node knows this one as Suspect or Dead, which happens when this node
+// restarted, it is probed again with the refuting incarnation
+func (membership *membership) Join(address string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		membership.lock.Lock()
+		incarnation := membership.self.Incarnation
+		outgoing := Message{Updates: append(membership.piggyback(), membership.self.update())}
+		membership.lock.Unlock()
+
+		ack, err := membership.transport.Ping(address, outgoing)
+		if err != nil {
+			return fmt.Errorf("Failed to join '%v': %v", address, err.Error())
+		}
+
+		membership.lock.Lock()
+		membership.merge(ack.Updates)
+		refuted := membership.self.Incarnation != incarnation
+		membership.lock.Unlock()
+
+		if !refuted {
+			break
+		}
+	}
+	return nil
+}
+
+// Members returns every other known member, sorted by ID
+func (membership *membership) Members() []Member {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	members := make([]Member, 0, len(membership.members))
+	for _, id := range membership.sortedIDs() {
+		members = append(members, membership.members[id].Member)
+	}
+	return members
+}
+
+// Probe probes the next member, directly and then indirectly,
+// suspecting it if neither succeeds, declares members whose
+// suspicion has timed out Dead and forgets members that have
+// been Dead for DeadPeriods periods
+func (membership *membership) Probe() {
+	membership.lock.Lock()
+	membership.period++
+	target, ok := membership.nextTarget()
+	outgoing := Message{Updates: membership.piggyback()}
+	membership.lock.Unlock()
+
+	if ok {
+		ack, err := membership.transport.Ping(target.Address, outgoing)
+		if err != nil {
+			ack, err = membership.probeIndirectly(target, outgoing)
+		}
+
+		membership.lock.Lock()
+		if err == nil {
+			membership.merge(ack.Updates)
+		} else {
+			membership.suspect(target.ID, target.Incarnation)
+		}
+		membership.lock.Unlock()
+	}
+
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+	membership.expireSuspicions()
+	membership.forgetDead()
+}
+
+// Run runs a protocol period every interval
+func (membership *membership) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			membership.Probe()
+		}
+	}
+}
+
+// probeIndirectly asks up to IndirectProbes other members to probe the
+// target, returning the first acknowledgement
+func (membership *membership) probeIndirectly(target Member, outgoing Message) (Message, error) {
+	membership.lock.Lock()
+	var helpers []string
+	for _, id := range membership.sortedIDs() {
+		member := membership.members[id]
+		if member.ID != target.ID && member.State == Alive {
+			helpers = append(helpers, member.Address)
+		}
+	}
+	membership.lock.Unlock()
+
+	err := fmt.Errorf("no members are available to probe '%v' indirectly", target.Address)
+	for i, index := range rand.Perm(len(helpers)) {
+		if i == membership.options.IndirectProbes {
+			break
+		}
+
+		var ack Message
+		ack, err = membership.transport.PingReq(helpers[index], target.Address, outgoing)
+		if err == nil {
+			return ack, nil
+		}
+	}
+	return Message{}, err
+}
+
+// nextTarget returns the next member to probe. Members are probed in a
+// random order, which is reshuffled after every member has been probed
+func (membership *membership) nextTarget() (Member, bool) {
+	for len(membership.probeOrder) != 0 {
+		id := membership.probeOrder[0]
+		membership.probeOrder = membership.probeOrder[1:]
+
+		if member, ok := membership.members[id]; ok && member.State != Dead {
+			return member.Member, true
+		}
+	}
+
+	var candidates []string
+	for _, id := range membership.sortedIDs() {
+		if membership.members[id].State != Dead {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return Member{}, false
+	}
+
+	for _, i := range rand.Perm(len(candidates)) {
+		membership.probeOrder = append(membership.probeOrder, candidates[i])
+	}
+	return membership.nextTarget()
+}
+
+// suspect marks the member Suspect, unless it has since
+// refuted the suspicion with a higher incarnation
+func (membership *membership) suspect(id string, incarnation uint64) {
+	member, ok := membership.members[id]
+	if !ok || member.State != Alive || member.Incarnation != incarnation {
+		return
+	}
+
+	member.State = Suspect
+	membership.suspectedAt[id] = membership.period
+	membership.enqueue(member)
+	membership.emit(Suspected, member)
+}
+
+// expireSuspicions declares members that have been
+// Suspect for SuspicionPeriods periods Dead
+func (membership *membership) expireSuspicions() {
+	for _, id := range membership.sortedIDs() {
+		member := membership.members[id]
+		if member.State != Suspect {
+			continue
+		}
+		if membership.period-membership.suspectedAt[id] < membership.options.SuspicionPeriods {
+			continue
+		}
+
+		member.State = Dead
+		delete(membership.suspectedAt, id)
+		membership.deadAt[id] = membership.period
+		membership.enqueue(member)
+		membership.emit(Failed, member)
+	}
+}
+
+// forgetDead removes members that have been Dead for DeadPeriods
+// periods. A forgotten member that comes back joins as a new member
+func (membership *membership) forgetDead() {
+	for _, id := range membership.sortedIDs() {
+		member := membership.members[id]
+		if member.State != Dead {
+			continue
+		}
+		if membership.period-membership.deadAt[id] < membership.options.DeadPeriods {
+			continue
+		}
+
+		delete(membership.members, id)
+		delete(membership.deadAt, id)
+		delete(membership.broadcasts, id)
+		membership.emit(Removed, member)
+	}
+}
+
+// merge applies the updates that are newer than what is known. Updates
+// with invalid identity records are ignored
+func (membership *membership) merge(updates []Update) {
+	for _, update := range updates {
+		identity, address, err := membership.verify(update)
+		if err != nil {
+			continue
+		}
+		id := identity.Metadata().ID
+
+		if id == membership.self.ID {
+			membership.refute(update)
+			continue
+		}
+
+		current, ok := membership.members[id]
+		if !ok {
+			if update.State == Dead {
+				continue
+			}
+
+			current = &member{
+				Member:     Member{ID: id, Address: address, State: update.State, Incarnation: update.Incarnation, Identity: identity},
+				identityPB: update.Identity,
+			}
+			membership.members[id] = current
+			membership.enqueue(current)
+			membership.emit(Joined, current)
+			if update.State == Suspect {
+				membership.suspectedAt[id] = membership.period
+				membership.emit(Suspected, current)
+			}
+			continue
+		}
+
+		if !overrides(update, current.Member) {
+			continue
+		}
+
+		previous := current.State
+		current.State = update.State
+		current.Incarnation = update.Incarnation
+		current.Address = address
+		current.Identity = identity
+		current.identityPB = update.Identity
+		membership.enqueue(current)
+
+		switch {
+		case update.State == Alive && previous != Alive:
+			delete(membership.suspectedAt, id)
+			delete(membership.deadAt, id)
+			membership.emit(Recovered, current)
+		case update.State == Suspect && previous != Suspect:
+			delete(membership.deadAt, id)
+			membership.suspectedAt[id] = membership.period
+			membership.emit(Suspected, current)
+		case update.State == Dead && previous != Dead:
+			delete(membership.suspectedAt, id)
+			membership.deadAt[id] = membership.period
+			membership.emit(Failed, current)
+		}
+	}
+}
+
+// outdated returns the known state of every member that the updates
+// announce Alive, but that is known as Suspect or Dead at the same or
+// a higher incarnation. The member refutes it once it receives it
+func (membership *membership) outdated(updates []Update) []Update {
+	var outdated []Update
+	for _, update := range updates {
+		id, ok := updateID(update)
+		if !ok || update.State != Alive {
+			continue
+		}
+
+		known := membership.members[id]
+		if known != nil && known.State != Alive && !overrides(update, known.Member) {
+			outdated = append(outdated, known.update())
+		}
+	}
+	return outdated
+}
+
+// verify verifies the identity record of the update, skipping the
+// verification if it is the record that is already known for the member
+func (membership *membership) verify(update Update) (record.Record, string, error) {
+	if id, ok := updateID(update); ok {
+		known := membership.members[id]
+		if id == membership.self.ID {
+			known = membership.self
+		}
+
+		if known != nil && bytes.Equal(known.identityPB.GetSeal().GetHash(), update.Identity.GetSeal().GetHash()) {
+			return known.Identity, known.Address, nil
+		}
+	}
+
+	return VerifyIdentity(update.Identity)
+}
+
+// refute announces this node Alive with a higher incarnation
+// when another member suspects it or declared it Dead
+func (membership *membership) refute(update Update) {
+	if update.State == Alive || update.Incarnation < membership.self.Incarnation {
+		return
+	}
+
+	membership.self.Incarnation = update.Incarnation + 1
+	membership.enqueue(membership.self)
+}
+
+// overrides returns true if the update is newer than the member's state
+func overrides(update Update, member Member) bool {
+	switch update.State {
+	case Alive:
+		return update.Incarnation > member.Incarnation
+	case Suspect:
+		if member.State == Alive {
+			return update.Incarnation >= member.Incarnation
+		}
+		return update.Incarnation > member.Incarnation
+	case Dead:
+		return member.State != Dead && update.Incarnation >= member.Incarnation
+	}
+	return false
+}
+
+// enqueue schedules the member's current state to be piggybacked,
+// replacing any older update for the same member
+func (membership *membership) enqueue(member *member) {
+	membership.broadcasts[member.ID] = &broadcast{update: member.update()}
+}
+
+// piggyback returns the updates to send with the next message, and
+// forgets the ones that have been sent often enough
+func (membership *membership) piggyback() []Update {
+	limit := membership.options.Retransmits * log2(len(membership.members)+2)
+
+	var updates []Update
+	for _, id := range sortedKeys(membership.broadcasts) {
+		broadcast := membership.broadcasts[id]
+		updates = append(updates, broadcast.update)
+
+		broadcast.transmits++
+		if broadcast.transmits >= limit {
+			delete(membership.broadcasts, id)
+		}
+	}
+	return updates
+}
+
+// allUpdates returns the current state of every member, including this node
+func (membership *membership) allUpdates() []Update {
+	updates := []Update{membership.self.update()}
+	for _, id := range membership.sortedIDs() {
+		updates = append(updates, membership.members[id].update())
+	}
+	return updates
+}
+
+// emit sends the event without blocking, dropping it if the channel is full
+func (membership *membership) emit(eventType EventType, member *member) {
+	select {
+	case membership.events <- Event{Type: eventType, Member: member.Member}:
+	default:
+	}
+}
+
+func (membership *membership) sortedIDs() []string {
+	ids := make([]string, 0, len(membership.members))
+	for id := range membership.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedKeys(broadcasts map[string]*broadcast) []string {
+	keys := make([]string, 0, len(broadcasts))
+	for key := range broadcasts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// updateID returns the metadata.ID of the update's identity record
+// without verifying it
+func updateID(update Update) (string, bool) {
+	if update.Identity == nil || update.Identity.Metadata == nil {
+		return "", false
+	}
+	return update.Identity.Metadata.Id, true
+}
+
+// log2 returns the number of bits needed to represent n
+func log2(n int) int {
+	bits := 0
+	for ; n > 0; n >>= 1 {
+		bits++
+	}
+	return bits
+}
@@ -0,0 +1,240 @@
+package membership_test
+
+import (
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Membership", func() {
+	var network membership.MemoryNetwork
+	var nodes map[string]membership.Membership
+	var identities map[string]record.Record
+
+	// restart runs a new node with the identity of the address
+	restart := func(address string) {
+		node, err := membership.New(identities[address], network.Transport(address), membership.Options{SuspicionPeriods: 2, DeadPeriods: 10, Retransmits: 1})
+		Expect(err).To(BeNil())
+		nodes[address] = node
+		network.Join(address, node)
+	}
+
+	start := func(address string) {
+		identities[address] = fixtures.GenerateIdentity(address)
+		restart(address)
+	}
+
+	// probeAll runs the given number of protocol periods on every node
+	probeAll := func(periods int, addresses ...string) {
+		for i := 0; i < periods; i++ {
+			for _, address := range addresses {
+				nodes[address].Probe()
+			}
+		}
+	}
+
+	stateOf := func(observer, address string) (membership.State, bool) {
+		for _, member := range nodes[observer].Members() {
+			if member.Address == address {
+				return member.State, true
+			}
+		}
+		return membership.Dead, false
+	}
+
+	drain := func(events <-chan membership.Event) []membership.Event {
+		var drained []membership.Event
+		for {
+			select {
+			case event := <-events:
+				drained = append(drained, event)
+			default:
+				return drained
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		network = membership.NewMemoryNetwork()
+		nodes = make(map[string]membership.Membership)
+		identities = make(map[string]record.Record)
+
+		start("a")
+		start("b")
+		start("c")
+
+		Expect(nodes["b"].Join("a")).To(Succeed())
+		Expect(nodes["c"].Join("a")).To(Succeed())
+		probeAll(3, "a", "b", "c")
+	})
+
+	It("should discover every node through the seed", func() {
+		Expect(nodes["a"].Addresses()).To(Equal([]string{"b", "c"}))
+		Expect(nodes["b"].Addresses()).To(Equal([]string{"a", "c"}))
+		Expect(nodes["c"].Addresses()).To(Equal([]string{"a", "b"}))
+	})
+
+	It("should identify members by their identity record", func() {
+		members := nodes["a"].Members()
+		Expect(members).To(HaveLen(2))
+		for _, member := range members {
+			Expect(member.ID).To(Equal(identities[member.Address].Metadata().ID))
+			Expect(member.State).To(Equal(membership.Alive))
+		}
+	})
+
+	It("should emit a joined event for each member", func() {
+		var joined []string
+		for _, event := range drain(nodes["a"].Events()) {
+			if event.Type == membership.Joined {
+				joined = append(joined, event.Member.Address)
+			}
+		}
+		Expect(joined).To(ConsistOf("b", "c"))
+	})
+
+	Describe("when a node crashes", func() {
+		BeforeEach(func() {
+			drain(nodes["a"].Events())
+			network.Leave("c")
+			probeAll(6, "a", "b")
+		})
+
+		It("should declare it dead", func() {
+			state, ok := stateOf("a", "c")
+			Expect(ok).To(BeTrue())
+			Expect(state).To(Equal(membership.Dead))
+		})
+
+		It("should stop returning its address", func() {
+			Expect(nodes["a"].Addresses()).To(Equal([]string{"b"}))
+			Expect(nodes["b"].Addresses()).To(Equal([]string{"a"}))
+		})
+
+		It("should emit suspected and failed events", func() {
+			var types []membership.EventType
+			for _, event := range drain(nodes["a"].Events()) {
+				if event.Member.Address == "c" {
+					types = append(types, event.Type)
+				}
+			}
+			Expect(types).To(Equal([]membership.EventType{membership.Suspected, membership.Failed}))
+		})
+
+		Describe("when it restarts after its death was disseminated", func() {
+			BeforeEach(func() {
+				probeAll(4, "a", "b")
+				restart("c")
+				Expect(nodes["c"].Join("a")).To(Succeed())
+				probeAll(3, "a", "b", "c")
+			})
+
+			It("should refute its death", func() {
+				for _, observer := range []string{"a", "b"} {
+					state, ok := stateOf(observer, "c")
+					Expect(ok).To(BeTrue())
+					Expect(state).To(Equal(membership.Alive), observer)
+				}
+				Expect(nodes["a"].Addresses()).To(Equal([]string{"b", "c"}))
+			})
+		})
+
+		Describe("when it stays dead", func() {
+			BeforeEach(func() {
+				probeAll(12, "a", "b")
+			})
+
+			It("should forget it", func() {
+				_, ok := stateOf("a", "c")
+				Expect(ok).To(BeFalse())
+				_, ok = stateOf("b", "c")
+				Expect(ok).To(BeFalse())
+			})
+
+			It("should emit a removed event", func() {
+				var types []membership.EventType
+				for _, event := range drain(nodes["a"].Events()) {
+					if event.Member.Address == "c" {
+						types = append(types, event.Type)
+					}
+				}
+				Expect(types).To(Equal([]membership.EventType{membership.Suspected, membership.Failed, membership.Removed}))
+			})
+
+			Describe("when it restarts", func() {
+				BeforeEach(func() {
+					restart("c")
+					Expect(nodes["c"].Join("a")).To(Succeed())
+					probeAll(3, "a", "b", "c")
+				})
+
+				It("should join again", func() {
+					state, ok := stateOf("b", "c")
+					Expect(ok).To(BeTrue())
+					Expect(state).To(Equal(membership.Alive))
+				})
+			})
+		})
+	})
+
+	Describe("when two nodes can't reach each other directly", func() {
+		BeforeEach(func() {
+			network.Partition("a", "b")
+			probeAll(6, "a", "b", "c")
+		})
+
+		It("should keep them alive through indirect probes", func() {
+			state, _ := stateOf("a", "b")
+			Expect(state).To(Equal(membership.Alive))
+			state, _ = stateOf("b", "a")
+			Expect(state).To(Equal(membership.Alive))
+		})
+	})
+
+	Describe("when a node is suspected", func() {
+		var ack membership.Message
+
+		BeforeEach(func() {
+			identityPB, err := identities["b"].Proto()
+			Expect(err).To(BeNil())
+
+			ack, err = nodes["b"].HandlePing(membership.Message{Updates: []membership.Update{
+				{Identity: identityPB, State: membership.Suspect, Incarnation: 0},
+			}})
+			Expect(err).To(BeNil())
+		})
+
+		It("should refute it with a higher incarnation", func() {
+			refuted := false
+			for _, update := range ack.Updates {
+				if update.Identity.Metadata.Id == identities["b"].Metadata().ID {
+					Expect(update.State).To(Equal(membership.Alive))
+					Expect(update.Incarnation).To(Equal(uint64(1)))
+					refuted = true
+				}
+			}
+			Expect(refuted).To(BeTrue())
+		})
+	})
+
+	Describe("when an update has a tampered identity record", func() {
+		BeforeEach(func() {
+			identity := fixtures.GenerateIdentity("d")
+			identityPB, err := identity.Proto()
+			Expect(err).To(BeNil())
+			identityPB.Data = []byte(`{"address":"evil"}`)
+
+			_, err = nodes["a"].HandlePing(membership.Message{Updates: []membership.Update{
+				{Identity: identityPB, State: membership.Alive},
+			}})
+			Expect(err).To(BeNil())
+		})
+
+		It("should ignore it", func() {
+			Expect(nodes["a"].Addresses()).To(Equal([]string{"b", "c"}))
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package membership
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/wire"
+)
+
+// PathPrefix is the prefix of the routes served by PeerHandler
+const PathPrefix = "/membership/"
+
+type peerPingReq struct {
+	Target  string  `json:"target"`
+	Message Message `json:"message"`
+}
+
+// NewPeerTransport constructs a Transport that sends each probe with
+// the client, which should be a peer.NewHTTPClient. A Ping that gets
+// no acknowledgement within the client's Timeout fails. A PingReq
+// gets twice as long, since the peer waits for a Ping of its own
+func NewPeerTransport(client *http.Client) Transport {
+	indirectClient := *client
+	indirectClient.Timeout = 2 * client.Timeout
+	return &peerTransport{client: client, indirectClient: &indirectClient}
+}
+
+type peerTransport struct {
+	client         *http.Client
+	indirectClient *http.Client
+}
+
+func (transport *peerTransport) Ping(peer string, message Message) (Message, error) {
+	response := Message{}
+	err := wire.Call(transport.client, peer, PathPrefix+"ping", &message, &response)
+	return response, err
+}
+
+func (transport *peerTransport) PingReq(peer, target string, message Message) (Message, error) {
+	response := Message{}
+	err := wire.Call(transport.indirectClient, peer, PathPrefix+"ping-req", &peerPingReq{target, message}, &response)
+	return response, err
+}
+
+// PeerHandler answers the probes of peer transports under
+// PathPrefix. It should be served by a peer.NewHTTPServer
+func PeerHandler(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, PathPrefix) {
+		case "ping":
+			request := Message{}
+			if !wire.Read(w, r, &request) {
+				return
+			}
+			response, err := handler.HandlePing(request)
+			wire.Write(w, &response, err)
+		case "ping-req":
+			request := &peerPingReq{}
+			if !wire.Read(w, r, request) {
+				return
+			}
+			response, err := handler.HandlePingReq(request.Target, request.Message)
+			wire.Write(w, &response, err)
+		default:
+			wire.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package membership_test
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/peer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerTransport", func() {
+	var servers map[string]*http.Server
+	var nodes map[string]membership.Membership
+	var addresses []string
+
+	// start runs a node that serves membership on a peer listener
+	start := func() string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		address := listener.Addr().String()
+		config := fixtures.GeneratePeerConfig(address)
+
+		peerListener, err := peer.NewListener(listener, config)
+		Expect(err).To(BeNil())
+
+		transport := membership.NewPeerTransport(peer.NewHTTPClient(config, 500*time.Millisecond))
+		node, err := membership.New(config.Identity, transport, membership.Options{SuspicionPeriods: 2})
+		Expect(err).To(BeNil())
+
+		mux := http.NewServeMux()
+		mux.Handle(membership.PathPrefix, membership.PeerHandler(node))
+		server := peer.NewHTTPServer(mux)
+		go server.Serve(peerListener)
+
+		servers[address], nodes[address] = server, node
+		return address
+	}
+
+	probeAll := func(periods int) {
+		for i := 0; i < periods; i++ {
+			for _, address := range addresses {
+				if _, ok := servers[address]; ok {
+					nodes[address].Probe()
+				}
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		servers = make(map[string]*http.Server)
+		nodes = make(map[string]membership.Membership)
+		addresses = []string{start(), start(), start()}
+
+		Expect(nodes[addresses[1]].Join(addresses[0])).To(Succeed())
+		Expect(nodes[addresses[2]].Join(addresses[0])).To(Succeed())
+		probeAll(3)
+	})
+
+	AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	})
+
+	It("should let every node learn every other member", func() {
+		Expect(nodes[addresses[0]].Addresses()).To(ConsistOf(addresses[1], addresses[2]))
+		Expect(nodes[addresses[1]].Addresses()).To(ConsistOf(addresses[0], addresses[2]))
+		Expect(nodes[addresses[2]].Addresses()).To(ConsistOf(addresses[0], addresses[1]))
+	})
+
+	Describe("when a node stops", func() {
+		BeforeEach(func() {
+			servers[addresses[2]].Close()
+			delete(servers, addresses[2])
+			probeAll(6)
+		})
+
+		It("should be declared dead", func() {
+			Expect(nodes[addresses[0]].Addresses()).To(ConsistOf(addresses[1]))
+			Expect(nodes[addresses[1]].Addresses()).To(ConsistOf(addresses[0]))
+		})
+	})
+})
@@ -0,0 +1,124 @@
+package membership
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// Update is the state of a member as it is
+// disseminated by piggybacking on probes
+type Update struct {
+	Identity    *encoding.Record
+	State       State
+	Incarnation uint64
+}
+
+// Message is sent with every probe and acknowledgement
+type Message struct {
+	Updates []Update
+}
+
+// Handler answers the probes of peers
+type Handler interface {
+	// HandlePing acknowledges a direct probe
+	HandlePing(message Message) (Message, error)
+
+	// HandlePingReq probes the target on behalf of the sender
+	// and relays the target's acknowledgement
+	HandlePingReq(target string, message Message) (Message, error)
+}
+
+// Transport sends probes to peers by address. A probe that gets no
+// acknowledgement in time must return an error
+type Transport interface {
+	Ping(peer string, message Message) (Message, error)
+	PingReq(peer, target string, message Message) (Message, error)
+}
+
+// MemoryNetwork connects handlers within a single process.
+// It is intended for tests and simulations
+type MemoryNetwork interface {
+	// Join registers the handler at the address
+	Join(address string, handler Handler)
+
+	// Leave removes the handler at the address. Probes sent
+	// to it afterwards fail as if the node had crashed
+	Leave(address string)
+
+	// Partition makes probes between the two addresses fail in both directions
+	Partition(a, b string)
+
+	// Transport returns a Transport that sends probes from the address
+	Transport(address string) Transport
+}
+
+// NewMemoryNetwork constructs an empty MemoryNetwork
+func NewMemoryNetwork() MemoryNetwork {
+	return &memoryNetwork{handlers: make(map[string]Handler), partitions: make(map[[2]string]bool)}
+}
+
+type memoryNetwork struct {
+	lock       sync.RWMutex
+	handlers   map[string]Handler
+	partitions map[[2]string]bool
+}
+
+func (network *memoryNetwork) Join(address string, handler Handler) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	network.handlers[address] = handler
+}
+
+func (network *memoryNetwork) Leave(address string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	delete(network.handlers, address)
+}
+
+func (network *memoryNetwork) Partition(a, b string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+
+	network.partitions[[2]string{a, b}] = true
+	network.partitions[[2]string{b, a}] = true
+}
+
+func (network *memoryNetwork) Transport(address string) Transport {
+	return &memoryTransport{network: network, address: address}
+}
+
+func (network *memoryNetwork) handler(from, to string) (Handler, error) {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+
+	handler, ok := network.handlers[to]
+	if !ok || network.partitions[[2]string{from, to}] {
+		return nil, fmt.Errorf("peer '%v' is unreachable", to)
+	}
+	return handler, nil
+}
+
+type memoryTransport struct {
+	network *memoryNetwork
+	address string
+}
+
+func (transport *memoryTransport) Ping(peer string, message Message) (Message, error) {
+	handler, err := transport.network.handler(transport.address, peer)
+	if err != nil {
+		return Message{}, err
+	}
+	return handler.HandlePing(message)
+}
+
+func (transport *memoryTransport) PingReq(peer, target string, message Message) (Message, error) {
+	handler, err := transport.network.handler(transport.address, peer)
+	if err != nil {
+		return Message{}, err
+	}
+	return handler.HandlePingReq(target, message)
+}
@@ -0,0 +1,60 @@
+package peer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// idleTimeout is how long idle peer connections are kept open
+const idleTimeout = 90 * time.Second
+
+// connKey is the context key of the *Conn a request was received on
+type connKey struct{}
+
+// NewHTTPClient returns an http.Client that sends every request over
+// a peer connection to the node at the host of the request's URL.
+// URLs use the http scheme, since the connection is already encrypted.
+// The timeout bounds each request, including the handshake
+func NewHTTPClient(config Config, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: handshakeTimeout}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				conn, err := dialer.DialContext(ctx, network, address)
+				if err != nil {
+					return nil, err
+				}
+				return Client(conn, config)
+			},
+			IdleConnTimeout: idleTimeout,
+		},
+	}
+}
+
+// NewHTTPServer returns an http.Server for the handler. It should
+// serve a Listen listener, so that handlers can find the peer that
+// sent each request with RequestConn
+func NewHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: handshakeTimeout,
+		IdleTimeout:       idleTimeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if peerConn, ok := conn.(*Conn); ok {
+				return context.WithValue(ctx, connKey{}, peerConn)
+			}
+			return ctx
+		},
+	}
+}
+
+// RequestConn returns the peer connection that the request was
+// received on, or false if it wasn't received on a peer connection
+func RequestConn(r *http.Request) (*Conn, bool) {
+	conn, ok := r.Context().Value(connKey{}).(*Conn)
+	return conn, ok
+}
@@ -0,0 +1,71 @@
+package peer_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/peer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP", func() {
+	var serverConfig, clientConfig peer.Config
+	var listener net.Listener
+	var server *http.Server
+
+	BeforeEach(func() {
+		serverConfig = fixtures.GeneratePeerConfig("server")
+		clientConfig = fixtures.GeneratePeerConfig("client")
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		listener, err = peer.Listen("tcp", "127.0.0.1:0", serverConfig)
+		Expect(err).To(BeNil())
+
+		server = peer.NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, ok := peer.RequestConn(r)
+			if !ok {
+				http.Error(w, "not a peer connection", http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(conn.PeerID()))
+		}))
+		go server.Serve(listener)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("when the client is permitted", func() {
+		It("should tell the handler who sent the request", func() {
+			client := peer.NewHTTPClient(clientConfig, time.Second)
+			response, err := client.Get("http://" + listener.Addr().String() + "/")
+			Expect(err).To(BeNil())
+			defer response.Body.Close()
+
+			body, err := ioutil.ReadAll(response.Body)
+			Expect(err).To(BeNil())
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(string(body)).To(Equal(clientConfig.Identity.Metadata().ID))
+		})
+	})
+
+	Describe("when the server denies the client", func() {
+		BeforeEach(func() {
+			serverConfig.Policy = peer.Policy{Deny: []string{clientConfig.Identity.Metadata().ID}}
+		})
+
+		It("should fail the request", func() {
+			client := peer.NewHTTPClient(clientConfig, time.Second)
+			_, err := client.Get("http://" + listener.Addr().String() + "/")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
@@ -0,0 +1,125 @@
+package peer
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// maxPendingHandshakes bounds the handshakes a listener runs at once
+const maxPendingHandshakes = 64
+
+// errListenerClosed is returned by Accept once the listener is closed
+var errListenerClosed = errors.New("peer listener is closed")
+
+// Listen listens on the address and authenticates every accepted connection
+func Listen(network, address string, config Config) (net.Listener, error) {
+	if _, err := config.tlsConfig(); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(listener, config)
+}
+
+// NewListener authenticates every connection accepted by the listener.
+// This allows the listener's address to be put in the identity record
+// before the Config is built
+func NewListener(listener net.Listener, config Config) (net.Listener, error) {
+	if _, err := config.tlsConfig(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	peerListener := &peerListener{
+		Listener:  listener,
+		config:    config,
+		accepted:  make(chan *Conn),
+		errors:    make(chan error),
+		done:      make(chan struct{}),
+		handshake: make(chan struct{}, maxPendingHandshakes),
+	}
+	go peerListener.acceptLoop()
+	return peerListener, nil
+}
+
+// peerListener returns a *Conn from Accept for every connection that
+// completes the handshake. Handshakes run in their own goroutines and
+// are bounded by handshakeTimeout, so that a peer that stays silent
+// can't hold up the connections accepted after it. Connections that
+// fail the handshake are closed and skipped
+type peerListener struct {
+	net.Listener
+	config Config
+
+	accepted  chan *Conn
+	errors    chan error
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// handshake holds a token for every handshake in progress
+	handshake chan struct{}
+}
+
+// Accept returns the next connection that completed the handshake
+func (listener *peerListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.accepted:
+		return conn, nil
+	case err := <-listener.errors:
+		return nil, err
+	case <-listener.done:
+		return nil, errListenerClosed
+	}
+}
+
+// Close stops accepting connections. Handshakes
+// still in progress are closed when they finish
+func (listener *peerListener) Close() error {
+	listener.closeOnce.Do(func() { close(listener.done) })
+	return listener.Listener.Close()
+}
+
+// acceptLoop accepts connections and starts their handshakes until
+// the listener is closed. Errors are handed to Accept as they happen
+func (listener *peerListener) acceptLoop() {
+	for {
+		select {
+		case listener.handshake <- struct{}{}:
+		case <-listener.done:
+			return
+		}
+
+		conn, err := listener.Listener.Accept()
+		if err != nil {
+			<-listener.handshake
+			select {
+			case listener.errors <- err:
+				continue
+			case <-listener.done:
+				return
+			}
+		}
+
+		go listener.serve(conn)
+	}
+}
+
+// serve runs the handshake of the connection
+// and hands it to Accept if it completes
+func (listener *peerListener) serve(conn net.Conn) {
+	peerConn, err := Server(conn, listener.config)
+	<-listener.handshake
+	if err != nil {
+		return
+	}
+
+	select {
+	case listener.accepted <- peerConn:
+	case <-listener.done:
+		peerConn.Close()
+	}
+}
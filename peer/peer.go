@@ -0,0 +1,302 @@
+// Package peer secures connections between nodes.
+//
+// Connections use TLS with self-signed certificates made from each
+// node's private key, so the handshake proves that each side holds
+// the private key of its certificate and the session is encrypted.
+// Once the handshake completes both sides exchange their identity
+// records, see membership.NewIdentity, and each checks that the
+// peer's identity record is valid, lists the public key of the peer's
+// certificate and is permitted by its Policy
+package peer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+const (
+	// handshakeTimeout bounds the TLS handshake and identity exchange
+	handshakeTimeout = 10 * time.Second
+
+	// maxIdentitySize is the largest identity record accepted from a peer
+	maxIdentitySize = 64 << 10
+)
+
+// Policy decides which nodes may connect, by metadata.ID
+// of their identity record. Deny takes precedence over Allow
+type Policy struct {
+	// Allow lists the only nodes that may connect.
+	// If it is empty, every node that isn't denied may connect
+	Allow []string `json:"allow"`
+
+	// Deny lists nodes that may not connect
+	Deny []string `json:"deny"`
+}
+
+// Permits returns an error if the node with the metadata.ID may not connect
+func (policy Policy) Permits(id string) error {
+	for _, denied := range policy.Deny {
+		if denied == id {
+			return fmt.Errorf("node '%v' is denied", id)
+		}
+	}
+
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+	for _, allowed := range policy.Allow {
+		if allowed == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("node '%v' is not allowed", id)
+}
+
+// Config configures both sides of a connection
+type Config struct {
+	// Identity is this node's identity record
+	Identity record.Record
+
+	// PrivateKey is the private key of one of
+	// the Identity's metadata.PublicKeys
+	PrivateKey *rsa.PrivateKey
+
+	Policy Policy
+}
+
+// Conn is an authenticated, encrypted connection to a peer
+type Conn struct {
+	*tls.Conn
+
+	peerIdentity record.Record
+}
+
+// PeerID returns the metadata.ID of the peer's identity record
+func (conn *Conn) PeerID() string {
+	return conn.peerIdentity.Metadata().ID
+}
+
+// PeerIdentity returns the peer's verified identity record
+func (conn *Conn) PeerIdentity() record.Record {
+	return conn.peerIdentity
+}
+
+// Client secures the connection as the side that initiated it. The
+// connection is closed if the handshake fails
+func Client(conn net.Conn, config Config) (*Conn, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return handshake(tls.Client(conn, tlsConfig), config, true)
+}
+
+// Server secures the connection as the side that accepted it. The
+// connection is closed if the handshake fails
+func Server(conn net.Conn, config Config) (*Conn, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return handshake(tls.Server(conn, tlsConfig), config, false)
+}
+
+// Dial connects to the node at the address and authenticates it
+func Dial(network, address string, config Config) (*Conn, error) {
+	conn, err := net.DialTimeout(network, address, handshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return Client(conn, config)
+}
+
+// tlsConfig returns the TLS configuration shared by both sides.
+// Certificates aren't verified against a CA, since they are
+// self-signed. Instead, handshake checks the peer's certificate
+// against its identity record
+func (config Config) tlsConfig() (*tls.Config, error) {
+	if config.Identity == nil || config.PrivateKey == nil {
+		return nil, fmt.Errorf("an Identity and PrivateKey are required")
+	}
+
+	certificate, err := selfSignedCertificate(config.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates:       []tls.Certificate{certificate},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+	}, nil
+}
+
+// handshake runs the TLS handshake, then exchanges identity records.
+// The client sends its identity first so that neither side blocks
+// writing to a connection the other isn't reading
+func handshake(tlsConn *tls.Conn, config Config, isClient bool) (*Conn, error) {
+	tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	peerIdentity, err := exchangeIdentities(tlsConn, config, isClient)
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+
+	tlsConn.SetDeadline(time.Time{})
+	return &Conn{Conn: tlsConn, peerIdentity: peerIdentity}, nil
+}
+
+func exchangeIdentities(tlsConn *tls.Conn, config Config, isClient bool) (record.Record, error) {
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %v", err.Error())
+	}
+
+	var peerIdentityPB *encoding.Record
+	var err error
+	if isClient {
+		if err = writeIdentity(tlsConn, config.Identity); err != nil {
+			return nil, err
+		}
+		peerIdentityPB, err = readIdentity(tlsConn)
+	} else {
+		if peerIdentityPB, err = readIdentity(tlsConn); err != nil {
+			return nil, err
+		}
+		err = writeIdentity(tlsConn, config.Identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	peerIdentity, _, err := membership.VerifyIdentity(peerIdentityPB)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := matchCertificate(tlsConn.ConnectionState(), peerIdentity); err != nil {
+		return nil, err
+	}
+
+	if err := config.Policy.Permits(peerIdentity.Metadata().ID); err != nil {
+		return nil, err
+	}
+	return peerIdentity, nil
+}
+
+// matchCertificate returns an error unless the key of the peer's
+// certificate is one of the publicKeys of its identity record. The
+// TLS handshake has already proven the peer holds its private key
+func matchCertificate(state tls.ConnectionState, identity record.Record) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("peer did not present a certificate")
+	}
+
+	certificateKey, ok := state.PeerCertificates[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("peer certificate must have an rsa key")
+	}
+
+	for _, publicKeyString := range identity.Metadata().PublicKeys {
+		publicKey, err := cryptohelpers.BuildRSAPublicKey(publicKeyString)
+		if err != nil {
+			continue
+		}
+		if publicKey.E == certificateKey.E && publicKey.N.Cmp(certificateKey.N) == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("peer certificate does not match any publicKey of its identity record")
+}
+
+// writeIdentity writes the identity record prefixed by its length
+func writeIdentity(w io.Writer, identity record.Record) error {
+	identityPB, err := identity.Proto()
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(identityPB)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	_, err = w.Write(append(frame, data...))
+	return err
+}
+
+// readIdentity reads an identity record written by writeIdentity
+func readIdentity(r io.Reader) (*encoding.Record, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("Failed to read peer identity: %v", err.Error())
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxIdentitySize {
+		return nil, fmt.Errorf("peer identity is %v bytes, the limit is %v", size, maxIdentitySize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("Failed to read peer identity: %v", err.Error())
+	}
+
+	identityPB := &encoding.Record{}
+	if err := proto.Unmarshal(data, identityPB); err != nil {
+		return nil, fmt.Errorf("Failed to decode peer identity: %v", err.Error())
+	}
+	return identityPB, nil
+}
+
+// selfSignedCertificate creates a certificate for the private key.
+// Only its key matters, so it is valid for as long as the process
+// could reasonably run
+func selfSignedCertificate(privateKey *rsa.PrivateKey) (tls.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "meshchain node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: privateKey}, nil
+}
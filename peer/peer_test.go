@@ -0,0 +1,162 @@
+package peer_test
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/peer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Peer", func() {
+	var serverConfig, clientConfig peer.Config
+	var listener net.Listener
+	var accepted chan net.Conn
+
+	listen := func() {
+		var err error
+		listener, err = peer.Listen("tcp", "127.0.0.1:0", serverConfig)
+		Expect(err).To(BeNil())
+
+		accepted = make(chan net.Conn, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				accepted <- conn
+			}
+		}()
+	}
+
+	BeforeEach(func() {
+		serverConfig = fixtures.GeneratePeerConfig("server")
+		clientConfig = fixtures.GeneratePeerConfig("client")
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	Describe("when both nodes permit each other", func() {
+		var client *peer.Conn
+		var server *peer.Conn
+
+		BeforeEach(func() {
+			listen()
+
+			var err error
+			client, err = peer.Dial("tcp", listener.Addr().String(), clientConfig)
+			Expect(err).To(BeNil())
+
+			var conn net.Conn
+			Eventually(accepted).Should(Receive(&conn))
+			server = conn.(*peer.Conn)
+		})
+
+		AfterEach(func() {
+			client.Close()
+			server.Close()
+		})
+
+		It("should authenticate the server to the client", func() {
+			Expect(client.PeerID()).To(Equal(serverConfig.Identity.Metadata().ID))
+		})
+
+		It("should authenticate the client to the server", func() {
+			Expect(server.PeerID()).To(Equal(clientConfig.Identity.Metadata().ID))
+			Expect(server.PeerIdentity().Data()).To(Equal(clientConfig.Identity.Data()))
+		})
+
+		It("should carry data in both directions", func() {
+			go func() {
+				client.Write([]byte("ping"))
+				client.CloseWrite()
+			}()
+
+			data, err := ioutil.ReadAll(server)
+			Expect(err).To(BeNil())
+			Expect(string(data)).To(Equal("ping"))
+		})
+
+		It("should encrypt the session", func() {
+			Expect(client.ConnectionState().HandshakeComplete).To(BeTrue())
+			Expect(client.ConnectionState().CipherSuite).NotTo(BeZero())
+		})
+	})
+
+	Describe("when a connection stays silent", func() {
+		It("should accept the connections after it", func() {
+			listen()
+
+			silent, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).To(BeNil())
+			defer silent.Close()
+
+			conn, err := peer.Dial("tcp", listener.Addr().String(), clientConfig)
+			Expect(err).To(BeNil())
+			defer conn.Close()
+
+			var serverConn net.Conn
+			Eventually(accepted, "2s").Should(Receive(&serverConn))
+			Expect(serverConn.(*peer.Conn).PeerID()).To(Equal(clientConfig.Identity.Metadata().ID))
+		})
+	})
+
+	Describe("when the server denies the client", func() {
+		BeforeEach(func() {
+			serverConfig.Policy = peer.Policy{Deny: []string{clientConfig.Identity.Metadata().ID}}
+			listen()
+		})
+
+		It("should not accept the connection", func() {
+			conn, err := peer.Dial("tcp", listener.Addr().String(), clientConfig)
+			if err == nil {
+				_, err = conn.Read(make([]byte, 1))
+			}
+			Expect(err).NotTo(BeNil())
+			Consistently(accepted).ShouldNot(Receive())
+		})
+	})
+
+	Describe("when the client only allows another node", func() {
+		BeforeEach(func() {
+			clientConfig.Policy = peer.Policy{Allow: []string{"some-other-node"}}
+			listen()
+		})
+
+		It("should refuse the server", func() {
+			_, err := peer.Dial("tcp", listener.Addr().String(), clientConfig)
+			Expect(err).To(MatchError(ContainSubstring("is not allowed")))
+		})
+	})
+
+	Describe("when a node presents someone else's identity", func() {
+		BeforeEach(func() {
+			impostor := fixtures.GeneratePeerConfig("impostor")
+			clientConfig.Identity = impostor.Identity
+			listen()
+		})
+
+		It("should be refused", func() {
+			conn, err := peer.Dial("tcp", listener.Addr().String(), clientConfig)
+			if err == nil {
+				_, err = conn.Read(make([]byte, 1))
+			}
+			Expect(err).NotTo(BeNil())
+			Consistently(accepted).ShouldNot(Receive())
+		})
+	})
+
+	Describe("Policy", func() {
+		It("should permit everyone by default", func() {
+			Expect(peer.Policy{}.Permits("a")).To(Succeed())
+		})
+
+		It("should let Deny take precedence over Allow", func() {
+			policy := peer.Policy{Allow: []string{"a"}, Deny: []string{"a"}}
+			Expect(policy.Permits("a")).To(MatchError("node 'a' is denied"))
+		})
+	})
+})
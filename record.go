@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/delta"
+	"github.com/royvandewater/meshchain/keyring"
+	"github.com/royvandewater/meshchain/record"
+)
+
+const recordUsage = `usage: meshchain record <subcommand> [arguments]
+
+subcommands:
+  create --local-id X --key K --data @file       sign a new RootRecord
+  update <id> --key K --data @file               sign an update of the head of a chain
+  verify [--parent file | --node URL] <file>     fully validate a record
+  inspect [--parent file | --node URL] <file>    print the contents of a record
+
+--key is the name of a stored key or the path of a pem private key.
+--data is a literal string, @file to read a file, or @- to read stdin.
+--content-type and --schema type the data. JSON data is compacted and
+an update keeps the content type and schema of its parent by default.
+--annotation key=value signs an annotation, an update keeps those of
+its parent unless they are changed, or removed with --annotation key=.
+--not-before and --not-after bound the time the record is valid in,
+as RFC 3339 times or durations from now. An update keeps the window
+of its parent unless it is changed, or cleared with an empty value.
+update --delta json-patch|binary signs a patch that turns the full data
+of the parent into --data, which is smaller for a small change.
+The signed record is printed as JSON, or submitted with --node URL.
+verify and inspect read the JSON or the protobuf encoding of a record,
+and need the parent of an update to check its signature`
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// runRecord creates, updates, verifies and inspects records
+func runRecord(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%v", recordUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return runRecordCreate(args[1:])
+	case "update":
+		return runRecordUpdate(args[1:])
+	case "verify":
+		return runRecordVerify(args[1:])
+	case "inspect":
+		return runRecordInspect(args[1:])
+	}
+	return fmt.Errorf("unknown subcommand '%v'\n%v", args[0], recordUsage)
+}
+
+// signingFlags are the flags shared by record create and record update
+type signingFlags struct {
+	keyDir      *string
+	key         *string
+	data        *string
+	publicKeys  stringList
+	node        *string
+	contentType *string
+	schema      *string
+	annotations stringList
+	notBefore   *string
+	notAfter    *string
+}
+
+func newSigningFlags(flags *flag.FlagSet) *signingFlags {
+	signing := &signingFlags{
+		keyDir: flags.String("key-dir", keyring.DefaultDir(), "directory the keys are stored in"),
+		key:    flags.String("key", "", "name or pem file of the private key to sign with (required)"),
+		data:   flags.String("data", "", "the data of the record, @file to read a file or @- to read stdin"),
+		node:   flags.String("node", "", "URL of a node to submit the record to instead of printing it"),
+
+		contentType: flags.String("content-type", "", "the metadata.ContentType of the data, such as application/json"),
+		schema:      flags.String("schema", "", "the metadata.Schema ref the data conforms to, requires a JSON --content-type"),
+
+		notBefore: flags.String("not-before", "", "the metadata.NotBefore of the record, an RFC 3339 time or a duration from now such as 1h"),
+		notAfter:  flags.String("not-after", "", "the metadata.NotAfter of the record, an RFC 3339 time or a duration from now such as 720h"),
+	}
+	flags.Var(&signing.publicKeys, "public-key", "name or pem file of a key to list in metadata.PublicKeys, may be repeated")
+	flags.Var(&signing.annotations, "annotation", "key=value to set in metadata.Annotations, or key= to remove it, may be repeated")
+	return signing
+}
+
+func runRecordCreate(args []string) error {
+	flags := flag.NewFlagSet("record create", flag.ContinueOnError)
+	localID := flags.String("local-id", "", "the metadata.LocalID of the record")
+	signing := newSigningFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("usage: meshchain record create --local-id X --key K --data @file")
+	}
+
+	privateKey, data, err := signing.load()
+	if err != nil {
+		return err
+	}
+
+	signingPublicKey, err := cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	publicKeys, err := signing.loadPublicKeys([]string{signingPublicKey})
+	if err != nil {
+		return err
+	}
+
+	metadata := record.Metadata{LocalID: *localID, PublicKeys: publicKeys}
+	metadata.ID = metadata.GenerateID()
+	data, err = signing.applyType(flags, &metadata, data)
+	if err != nil {
+		return err
+	}
+	if err := signing.applyAnnotations(&metadata); err != nil {
+		return err
+	}
+	if err := signing.applyWindow(flags, &metadata, time.Now()); err != nil {
+		return err
+	}
+
+	unsigned, err := record.NewUnsignedRootRecord(metadata, data)
+	if err != nil {
+		return err
+	}
+	signature, err := unsigned.GenerateSignature(privateKey)
+	if err != nil {
+		return err
+	}
+	root, err := record.NewRootRecord(metadata, data, signature)
+	if err != nil {
+		return err
+	}
+
+	return signing.emit(root)
+}
+
+func runRecordUpdate(args []string) error {
+	flags := flag.NewFlagSet("record update", flag.ContinueOnError)
+	parentPath := flags.String("parent", "", "JSON file of the record to update, defaults to the head fetched from --node")
+	deltaKind := flags.String("delta", "", "sign the data as a json-patch or binary delta of the parent's full data")
+	signing := newSigningFlags(flags)
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: meshchain record update <id> --key K --data @file")
+	}
+	id := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	parent, err := loadParent(id, *parentPath, *signing.node)
+	if err != nil {
+		return err
+	}
+
+	privateKey, data, err := signing.load()
+	if err != nil {
+		return err
+	}
+	publicKeys, err := signing.loadPublicKeys(parent.Metadata().PublicKeys)
+	if err != nil {
+		return err
+	}
+
+	metadata := parent.Metadata()
+	metadata.PublicKeys = publicKeys
+	metadata.Manifest = nil
+	metadata.Delta = ""
+	data, err = signing.applyType(flags, &metadata, data)
+	if err != nil {
+		return err
+	}
+	if *deltaKind != "" {
+		parentData, err := loadParentData(parent, *signing.node)
+		if err != nil {
+			return err
+		}
+		if data, err = delta.Create(*deltaKind, parentData, data); err != nil {
+			return err
+		}
+		metadata.Delta = *deltaKind
+	}
+	if err := signing.applyAnnotations(&metadata); err != nil {
+		return err
+	}
+	if err := signing.applyWindow(flags, &metadata, time.Now()); err != nil {
+		return err
+	}
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, data)
+	if err != nil {
+		return err
+	}
+	signature, err := unsigned.GenerateSignature(privateKey)
+	if err != nil {
+		return err
+	}
+	update, err := record.NewUpdateRecord(parent, metadata, data, signature)
+	if err != nil {
+		return err
+	}
+
+	return signing.emit(update)
+}
+
+// load reads the private key and the data
+func (signing *signingFlags) load() (*rsa.PrivateKey, []byte, error) {
+	if *signing.key == "" {
+		return nil, nil, fmt.Errorf("--key is required")
+	}
+
+	privateKey, err := loadPrivateKey(*signing.keyDir, *signing.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := readData(*signing.data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privateKey, data, nil
+}
+
+// applyType sets the content type and schema given with --content-type
+// and --schema, keeping the metadata's current values for the flags
+// that weren't given. JSON data is checked and compacted, so that it
+// is shown as JSON rather than base64 when the record is serialized
+func (signing *signingFlags) applyType(flags *flag.FlagSet, metadata *record.Metadata, data []byte) ([]byte, error) {
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "content-type":
+			metadata.ContentType = *signing.contentType
+		case "schema":
+			metadata.Schema = *signing.schema
+		}
+	})
+
+	isJSON := record.IsJSONContentType(metadata.ContentType)
+	if metadata.Schema != "" && !isJSON {
+		return nil, fmt.Errorf("--schema requires a JSON --content-type, such as application/json")
+	}
+	if !isJSON {
+		return data, nil
+	}
+
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, data); err != nil {
+		return nil, fmt.Errorf("data is not valid JSON: %v", err.Error())
+	}
+	return compacted.Bytes(), nil
+}
+
+// applyAnnotations applies the --annotation flags to a copy of the
+// metadata's annotations. A flag without a value removes the key
+func (signing *signingFlags) applyAnnotations(metadata *record.Metadata) error {
+	if len(signing.annotations) == 0 {
+		return nil
+	}
+
+	annotations := make(map[string]string)
+	for key, value := range metadata.Annotations {
+		annotations[key] = value
+	}
+
+	for _, annotation := range signing.annotations {
+		parts := strings.SplitN(annotation, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("--annotation '%v' must be of the form key=value", annotation)
+		}
+		if parts[1] == "" {
+			delete(annotations, parts[0])
+			continue
+		}
+		annotations[parts[0]] = parts[1]
+	}
+
+	metadata.Annotations = annotations
+	return nil
+}
+
+// applyWindow sets the validity window given with --not-before and
+// --not-after, keeping the metadata's current values for the flags
+// that weren't given. An empty value leaves that side of the window
+// open
+func (signing *signingFlags) applyWindow(flags *flag.FlagSet, metadata *record.Metadata, now time.Time) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var err error
+	if given["not-before"] {
+		if metadata.NotBefore, err = parseWindowTime("not-before", *signing.notBefore, now); err != nil {
+			return err
+		}
+	}
+	if given["not-after"] {
+		if metadata.NotAfter, err = parseWindowTime("not-after", *signing.notAfter, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWindowTime parses the value of --not-before or --not-after
+// as an RFC 3339 time or a duration from now
+func parseWindowTime(name, value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration).Truncate(time.Second), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--%v '%v' must be an RFC 3339 time or a duration such as 720h", name, value)
+	}
+	return t, nil
+}
+
+// loadPublicKeys returns the keys given with --public-key,
+// or the defaults if there are none
+func (signing *signingFlags) loadPublicKeys(defaults []string) ([]string, error) {
+	if len(signing.publicKeys) == 0 {
+		return defaults, nil
+	}
+
+	publicKeys := make([]string, 0, len(signing.publicKeys))
+	for _, nameOrPath := range signing.publicKeys {
+		publicKey, err := loadPublicKey(*signing.keyDir, nameOrPath)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
+
+// emit prints the JSON of the record, or submits it to --node
+func (signing *signingFlags) emit(rec record.Record) error {
+	recordJSON, err := rec.JSON()
+	if err != nil {
+		return err
+	}
+
+	if *signing.node == "" {
+		fmt.Println(recordJSON)
+		return nil
+	}
+
+	response, err := http.Post(nodeURL(*signing.node, "/records"), "application/json", strings.NewReader(recordJSON))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := readNodeResponse(response)
+	if err != nil {
+		return fmt.Errorf("node rejected the record: %v", err.Error())
+	}
+	fmt.Println(strings.TrimSpace(string(body)))
+	return nil
+}
+
+// readData returns the literal value, the contents of
+// the file for @file, or stdin for @-
+func readData(value string) ([]byte, error) {
+	if !strings.HasPrefix(value, "@") {
+		return []byte(value), nil
+	}
+	return readFileOrStdin(strings.TrimPrefix(value, "@"))
+}
+
+// loadParent reads the record at path, or fetches the head of the
+// chain for the metadata.ID from the node. The parent is trusted:
+// the node verifies the update's ancestry again when it is submitted
+func loadParent(id, path, node string) (record.Record, error) {
+	var recordJSON []byte
+	var err error
+	switch {
+	case path != "":
+		recordJSON, err = ioutil.ReadFile(path)
+	case node != "":
+		recordJSON, err = fetchHead(node, id)
+	default:
+		return nil, fmt.Errorf("either --parent or --node is required to find the record to update")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recordPB, err := record.ParseJSON(recordJSON)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse parent record: %v", err.Error())
+	}
+
+	parent, err := record.FromTrustedProto(recordPB)
+	if err != nil {
+		return nil, fmt.Errorf("parent record is invalid: %v", err.Error())
+	}
+	if parent.Metadata().ID != id {
+		return nil, fmt.Errorf("parent record has metadata.ID '%v' instead of '%v'", parent.Metadata().ID, id)
+	}
+	return parent, nil
+}
+
+// loadParentData returns the full data of the parent. The data of a
+// parent that is itself a delta is materialized by the node
+func loadParentData(parent record.Record, node string) ([]byte, error) {
+	metadata := parent.Metadata()
+	if metadata.Manifest != nil {
+		return nil, fmt.Errorf("a delta can't be applied to a parent whose data is stored in chunks")
+	}
+	if metadata.Delta == "" {
+		return parent.Data(), nil
+	}
+	if node == "" {
+		return nil, fmt.Errorf("the parent is a %v delta, --node is required to fetch its full data", metadata.Delta)
+	}
+
+	hash, err := parent.Hash()
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetchNode(node, "/records/by-hash/"+hex.EncodeToString(hash)+"/data")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch the data of the parent: %v", err.Error())
+	}
+	return data, nil
+}
+
+// fetchHead returns the JSON of the head of the chain from the node
+func fetchHead(node, id string) ([]byte, error) {
+	body, err := fetchNode(node, "/records/"+id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch the head of '%v': %v", id, err.Error())
+	}
+	return body, nil
+}
+
+// fetchNode returns the body of a GET request to the path on the node
+func fetchNode(node, path string) ([]byte, error) {
+	response, err := http.Get(nodeURL(node, path))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return readNodeResponse(response)
+}
+
+// nodeResponseError is the error body returned by a node
+type nodeResponseError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readNodeResponse returns the body of a successful
+// response, or the error the node responded with
+func readNodeResponse(response *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return body, nil
+	}
+
+	nodeErr := &nodeResponseError{}
+	if err := json.Unmarshal(body, nodeErr); err != nil || nodeErr.Error.Code == "" {
+		return nil, fmt.Errorf("%v", response.Status)
+	}
+	return nil, fmt.Errorf("%v (%v)", nodeErr.Error.Message, nodeErr.Error.Code)
+}
+
+// nodeURL joins the base URL of a node and the path
+func nodeURL(node, path string) string {
+	return strings.TrimRight(node, "/") + path
+}
@@ -0,0 +1,96 @@
+package record_test
+
+import (
+	"encoding/json"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/record/generators"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Annotations", func() {
+	var metadata record.Metadata
+	var sut record.RootRecord
+
+	BeforeEach(func() {
+		publicKey, privateKey := generateKeys()
+		metadata = record.Metadata{
+			ID:         generators.ID("", []string{publicKey}),
+			PublicKeys: []string{publicKey},
+			Annotations: map[string]string{
+				"owner":                       "roy",
+				"environment":                 "production",
+				"x-vendor.example.com/future": "a key no one knows about yet",
+			},
+		}
+		data := []byte(`annotated`)
+
+		var err error
+		sut, err = record.NewRootRecord(metadata, data, generateSignature(metadata, data, privateKey))
+		Expect(err).To(BeNil())
+	})
+
+	It("should be covered by the hash", func() {
+		hash, err := sut.Hash()
+		Expect(err).To(BeNil())
+
+		metadata.Annotations = map[string]string{"owner": "someone else"}
+		changed, err := record.NewUnsignedRootRecord(metadata, sut.Data())
+		Expect(err).To(BeNil())
+		Expect(changed.Hash()).NotTo(Equal(hash))
+	})
+
+	It("should be encoded sorted by key", func() {
+		recordPB, err := sut.Proto()
+		Expect(err).To(BeNil())
+		Expect(recordPB.Metadata.Annotations).To(Equal([]*encoding.Annotation{
+			{Key: "environment", Value: "production"},
+			{Key: "owner", Value: "roy"},
+			{Key: "x-vendor.example.com/future", Value: "a key no one knows about yet"},
+		}))
+	})
+
+	It("should survive a round trip through JSON", func() {
+		recordJSON, err := sut.JSON()
+		Expect(err).To(BeNil())
+
+		recordPB, err := record.ParseJSON([]byte(recordJSON))
+		Expect(err).To(BeNil())
+
+		decoded, err := record.FromProto(recordPB, nil)
+		Expect(err).To(BeNil())
+		Expect(decoded.Metadata().Annotations).To(Equal(metadata.Annotations))
+	})
+
+	It("should be shown as an object in JSON", func() {
+		recordJSON, err := sut.JSON()
+		Expect(err).To(BeNil())
+
+		var parsed struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		Expect(json.Unmarshal([]byte(recordJSON), &parsed)).To(Succeed())
+		Expect(parsed.Metadata.Annotations).To(Equal(metadata.Annotations))
+	})
+
+	It("should reject annotations that are out of order", func() {
+		recordPB, err := sut.Proto()
+		Expect(err).To(BeNil())
+
+		annotations := recordPB.Metadata.Annotations
+		annotations[0], annotations[1] = annotations[1], annotations[0]
+		_, err = record.FromProto(recordPB, nil)
+		Expect(err).To(MatchError("annotations must be sorted by key without duplicates, 'environment' is out of order"))
+	})
+
+	It("should reject empty keys", func() {
+		metadata.Annotations = map[string]string{"": "value"}
+		_, err := record.NewUnsignedRootRecord(metadata, nil)
+		Expect(err).To(MatchError("annotation keys must not be empty"))
+	})
+})
@@ -0,0 +1,102 @@
+package record
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Chain is an ordered list of records sharing a metadata.ID. A
+// complete chain starts at its RootRecord. A pruned chain starts at
+// an anchor instead: the last pruned record, which is trusted as is
+// so that the retained records after it can still be verified.
+type Chain interface {
+	// Complete returns true if the chain starts at its RootRecord
+	Complete() bool
+
+	// Data returns the full data of the record at the version,
+	// applying the deltas of the records up to it. It fails for a
+	// version that can only be reached from a pruned delta without
+	// a snapshot
+	Data(version uint64) ([]byte, error)
+
+	// Head returns the most recent record of the chain
+	Head() Record
+
+	// ID returns the metadata.ID shared by every record of the chain
+	ID() string
+
+	// Records returns every record of the chain, oldest first
+	Records() []Record
+
+	// Verify checks the ancestry of every record in the chain,
+	// starting from the RootRecord or the anchor
+	Verify() error
+}
+
+// NewChain constructs a chain from a list of records, oldest
+// first. The ancestry of the records is verified at construction.
+func NewChain(records []Record) (Chain, error) {
+	return NewChainWithSnapshots(records, nil)
+}
+
+// NewChainWithSnapshots constructs a chain like NewChain, which
+// materializes the data of its deltas from the snapshots when
+// it can. snapshots may be nil
+func NewChainWithSnapshots(records []Record, snapshots Snapshots) (Chain, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("a chain must contain at least one record")
+	}
+
+	chain := &chain{records: records, snapshots: snapshots}
+
+	if err := chain.Verify(); err != nil {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+type chain struct {
+	records   []Record
+	snapshots Snapshots
+}
+
+// Complete returns true if the chain starts at its RootRecord
+func (chain *chain) Complete() bool {
+	return len(chain.records[0].ParentHash()) == 0
+}
+
+// Head returns the most recent record of the chain
+func (chain *chain) Head() Record {
+	return chain.records[len(chain.records)-1]
+}
+
+// ID returns the metadata.ID shared by every record of the chain
+func (chain *chain) ID() string {
+	return chain.records[0].Metadata().ID
+}
+
+// Records returns every record of the chain, oldest first
+func (chain *chain) Records() []Record {
+	return chain.records
+}
+
+// Verify checks the ancestry of every record in the chain,
+// starting from the RootRecord or the anchor
+func (chain *chain) Verify() error {
+	if chain.Complete() {
+		root := chain.records[0]
+		signature := base64.StdEncoding.EncodeToString(root.Signature())
+		if _, err := NewRootRecord(root.Metadata(), root.Data(), signature); err != nil {
+			return fmt.Errorf("record at index '0' is invalid: %v", err.Error())
+		}
+	}
+
+	for i := 1; i < len(chain.records); i++ {
+		if err := validateUpdate(chain.records[i-1], chain.records[i]); err != nil {
+			return fmt.Errorf("record at index '%v' is invalid: %v", i, err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package record_test
+
+import (
+	"github.com/royvandewater/meshchain/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chain", func() {
+	var sut record.Chain
+	var err error
+
+	Describe("NewChain", func() {
+		Describe("when given no records", func() {
+			BeforeEach(func() {
+				sut, err = record.NewChain(nil)
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("a chain must contain at least one record"))
+			})
+		})
+
+		Describe("when given a root record and two updates", func() {
+			var update1, update2 record.Record
+
+			BeforeEach(func() {
+				root, _, privateKey := generateRootRecord()
+				update1, _, privateKey = generateUpdateRecord(root, privateKey)
+				update2, _, _ = generateUpdateRecord(update1, privateKey)
+
+				sut, err = record.NewChain([]record.Record{root, update1, update2})
+			})
+
+			It("should not yield an error", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("should be complete", func() {
+				Expect(sut.Complete()).To(BeTrue())
+			})
+
+			It("should have the last update as the head", func() {
+				Expect(sut.Head()).To(Equal(update2))
+			})
+
+			It("should have the ID of the root record", func() {
+				Expect(sut.ID()).To(Equal(update2.Metadata().ID))
+			})
+		})
+
+		Describe("when the updates are out of order", func() {
+			BeforeEach(func() {
+				root, _, privateKey := generateRootRecord()
+				update1, _, privateKey := generateUpdateRecord(root, privateKey)
+				update2, _, _ := generateUpdateRecord(update1, privateKey)
+
+				sut, err = record.NewChain([]record.Record{root, update2, update1})
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("record at index '1' is invalid: parentHash does not match the hash of the parent"))
+			})
+		})
+
+		Describe("when starting at an anchor", func() {
+			BeforeEach(func() {
+				root, _, privateKey := generateRootRecord()
+				anchor, _, privateKey := generateUpdateRecord(root, privateKey)
+				update, _, _ := generateUpdateRecord(anchor, privateKey)
+
+				sut, err = record.NewChain([]record.Record{anchor, update})
+			})
+
+			It("should not yield an error", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("should not be complete", func() {
+				Expect(sut.Complete()).To(BeFalse())
+			})
+		})
+	})
+})
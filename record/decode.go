@@ -0,0 +1,109 @@
+package record
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// FromProto reconstructs a record from its protobuf version. A record
+// without a parent hash is validated as a RootRecord and must be given
+// a nil parent. Any other record is validated as an UpdateRecord of
+// the given parent.
+func FromProto(recordPB *encoding.Record, parent Record) (Record, error) {
+	if recordPB == nil {
+		return nil, fmt.Errorf("record is required")
+	}
+
+	metadata, err := MetadataFromProto(recordPB.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	signature := base64.StdEncoding.EncodeToString(recordPB.GetSeal().GetSignature())
+
+	var record Record
+	if len(recordPB.Parent) == 0 {
+		if parent != nil {
+			return nil, fmt.Errorf("record has no parent hash, but a parent was given")
+		}
+		record, err = NewRootRecord(metadata, recordPB.Data, signature)
+	} else {
+		record, err = NewUpdateRecord(parent, metadata, recordPB.Data, signature)
+		if err == nil && !bytes.Equal(record.ParentHash(), recordPB.Parent) {
+			err = fmt.Errorf("parent does not match the record's parent hash")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if sequence := recordPB.Metadata.Sequence; sequence != record.Version() {
+		return nil, fmt.Errorf("metadata.sequence '%v' does not match the record's version '%v'", sequence, record.Version())
+	}
+	if err := validateSeal(recordPB, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// FromTrustedProto reconstructs a record from its protobuf version
+// without access to its ancestry, such as when reading back a record
+// that was validated before being stored. RootRecords are still fully
+// validated, but for an UpdateRecord only the seal hash is checked and
+// its version is taken from its metadata.sequence.
+// Only use this on records from a trusted source.
+func FromTrustedProto(recordPB *encoding.Record) (Record, error) {
+	if recordPB == nil {
+		return nil, fmt.Errorf("record is required")
+	}
+	if len(recordPB.Parent) == 0 {
+		return FromProto(recordPB, nil)
+	}
+
+	metadata, err := MetadataFromProto(recordPB.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.PublicKeys) == 0 {
+		return nil, fmt.Errorf("metadata must contain at least one publicKey")
+	}
+	if len(recordPB.GetSeal().GetHash()) == 0 {
+		return nil, fmt.Errorf("seal.hash is required")
+	}
+	if recordPB.Metadata.Sequence == 0 {
+		return nil, fmt.Errorf("metadata.sequence of an update must be at least 1")
+	}
+
+	record := &signedUpdateRecord{
+		metadata:   metadata,
+		data:       recordPB.Data,
+		signature:  recordPB.GetSeal().GetSignature(),
+		parentHash: recordPB.Parent,
+		version:    recordPB.Metadata.Sequence,
+	}
+
+	if err := validateSeal(recordPB, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// validateSeal ensures that the seal.hash, when present,
+// matches the hash of the reconstructed record
+func validateSeal(recordPB *encoding.Record, record Record) error {
+	sealHash := recordPB.GetSeal().GetHash()
+	if len(sealHash) == 0 {
+		return nil
+	}
+
+	hash, err := record.Hash()
+	if err != nil {
+		return fmt.Errorf("Failed to generate Hash: %v", err.Error())
+	}
+	if !bytes.Equal(hash, sealHash) {
+		return fmt.Errorf("seal.hash does not match the record")
+	}
+	return nil
+}
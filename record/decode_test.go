@@ -0,0 +1,108 @@
+package record_test
+
+import (
+	"github.com/royvandewater/meshchain/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Decode", func() {
+	var root, update record.Record
+	var sut record.Record
+	var err error
+
+	BeforeEach(func() {
+		rootRecord, _, privateKey := generateRootRecord()
+		root = rootRecord
+		update, _, _ = generateUpdateRecord(root, privateKey)
+	})
+
+	Describe("FromProto", func() {
+		Describe("with a root record", func() {
+			BeforeEach(func() {
+				recordPB, beforeErr := root.Proto()
+				Expect(beforeErr).To(BeNil())
+
+				sut, err = record.FromProto(recordPB, nil)
+			})
+
+			It("should not yield an error", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("should have the same hash", func() {
+				hash, itErr := root.Hash()
+				Expect(itErr).To(BeNil())
+				Expect(sut.Hash()).To(Equal(hash))
+			})
+		})
+
+		Describe("with an update record and its parent", func() {
+			BeforeEach(func() {
+				recordPB, beforeErr := update.Proto()
+				Expect(beforeErr).To(BeNil())
+
+				sut, err = record.FromProto(recordPB, root)
+			})
+
+			It("should not yield an error", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("should keep the parent hash", func() {
+				Expect(sut.ParentHash()).To(Equal(update.ParentHash()))
+			})
+		})
+
+		Describe("with an update record and no parent", func() {
+			BeforeEach(func() {
+				recordPB, beforeErr := update.Proto()
+				Expect(beforeErr).To(BeNil())
+
+				sut, err = record.FromProto(recordPB, nil)
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("A valid parent record is required"))
+			})
+		})
+
+		Describe("with a tampered seal hash", func() {
+			BeforeEach(func() {
+				recordPB, beforeErr := root.Proto()
+				Expect(beforeErr).To(BeNil())
+				recordPB.Seal.Hash = []byte(`wrong`)
+
+				sut, err = record.FromProto(recordPB, nil)
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("seal.hash does not match the record"))
+			})
+		})
+	})
+
+	Describe("FromTrustedProto", func() {
+		Describe("with an update record", func() {
+			BeforeEach(func() {
+				recordPB, beforeErr := update.Proto()
+				Expect(beforeErr).To(BeNil())
+
+				sut, err = record.FromTrustedProto(recordPB)
+			})
+
+			It("should not yield an error", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("should have the same hash", func() {
+				hash, itErr := update.Hash()
+				Expect(itErr).To(BeNil())
+				Expect(sut.Hash()).To(Equal(hash))
+			})
+		})
+	})
+})
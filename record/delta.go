@@ -0,0 +1,90 @@
+package record
+
+import (
+	"fmt"
+
+	"github.com/royvandewater/meshchain/delta"
+)
+
+// Snapshots holds the full data of records whose data is a delta,
+// so that it doesn't have to be materialized from the start of the
+// chain every time. A store.Store satisfies it. Snapshots are
+// trusted as is, like the anchor of a pruned chain
+type Snapshots interface {
+	// Snapshot returns the full data of the record with the
+	// hash, or false if there is no snapshot of it
+	Snapshot(hash []byte) ([]byte, bool, error)
+}
+
+// FullData returns the full data of the record, given the full data
+// of its parent. It is the record's data unless its metadata.Delta
+// is set, in which case the data is applied to the parent's as a
+// patch of that kind
+func FullData(rec Record, parentData []byte) ([]byte, error) {
+	kind := rec.Metadata().Delta
+	if kind == "" {
+		return rec.Data(), nil
+	}
+
+	data, err := delta.Apply(kind, parentData, rec.Data())
+	if err != nil {
+		return nil, fmt.Errorf("%v delta of version '%v' does not apply to its parent: %v", kind, rec.Version(), err.Error())
+	}
+	return data, nil
+}
+
+// Data returns the full data of the record at the version. Starting
+// from the closest earlier record that has full data or a snapshot,
+// the deltas of every record up to the version are applied in order
+func (chain *chain) Data(version uint64) ([]byte, error) {
+	first := chain.records[0].Version()
+	if version < first || version-first >= uint64(len(chain.records)) {
+		return nil, fmt.Errorf("version '%v' is not in the chain", version)
+	}
+
+	last := int(version - first)
+	start := last
+	var data []byte
+	for {
+		rec := chain.records[start]
+		if rec.Metadata().Delta == "" {
+			data = rec.Data()
+			break
+		}
+
+		snapshot, ok, err := chain.snapshot(rec)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			data = snapshot
+			break
+		}
+
+		if start == 0 {
+			return nil, fmt.Errorf("version '%v' can't be materialized, the chain starts at a delta without a snapshot", version)
+		}
+		start--
+	}
+
+	for _, rec := range chain.records[start+1 : last+1] {
+		var err error
+		if data, err = FullData(rec, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// snapshot looks up the snapshot of the record, if the chain has snapshots
+func (chain *chain) snapshot(rec Record) ([]byte, bool, error) {
+	if chain.snapshots == nil {
+		return nil, false, nil
+	}
+
+	hash, err := rec.Hash()
+	if err != nil {
+		return nil, false, err
+	}
+	return chain.snapshots.Snapshot(hash)
+}
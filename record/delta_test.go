@@ -0,0 +1,145 @@
+package record_test
+
+import (
+	"crypto/rsa"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/delta"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// mapSnapshots holds snapshots keyed by the string of the record's hash
+type mapSnapshots map[string][]byte
+
+func (snapshots mapSnapshots) Snapshot(hash []byte) ([]byte, bool, error) {
+	data, ok := snapshots[string(hash)]
+	return data, ok, nil
+}
+
+var _ = Describe("Delta", func() {
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+
+	// appendUpdate signs an update of the last record
+	// with the data, as a delta of the kind if it is set
+	appendUpdate := func(kind string, data []byte) {
+		parent := records[len(records)-1]
+		metadata := parent.Metadata()
+		metadata.Delta = kind
+
+		unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, data)
+		Expect(err).To(BeNil())
+		signature, err := unsigned.GenerateSignature(privateKey)
+		Expect(err).To(BeNil())
+		update, err := record.NewUpdateRecord(parent, metadata, data, signature)
+		Expect(err).To(BeNil())
+
+		records = append(records, update)
+	}
+
+	BeforeEach(func() {
+		var publicKey string
+		publicKey, privateKey = generateKeys()
+		metadata := record.Metadata{
+			ID:          generators.ID("", []string{publicKey}),
+			PublicKeys:  []string{publicKey},
+			ContentType: "application/json",
+		}
+		data := []byte(`{"name":"device","firmware":"1.0","tags":["a"]}`)
+
+		root, err := record.NewRootRecord(metadata, data, generateSignature(metadata, data, privateKey))
+		Expect(err).To(BeNil())
+		records = []record.Record{root}
+
+		appendUpdate(delta.JSONPatch, []byte(`[{"op":"replace","path":"/firmware","value":"1.1"}]`))
+		appendUpdate(delta.JSONPatch, []byte(`[{"op":"add","path":"/tags/-","value":"b"}]`))
+		appendUpdate("", []byte(`{"name":"device","firmware":"2.0"}`))
+		appendUpdate(delta.Binary, delta.CreateBinary(records[3].Data(), []byte(`{"name":"device","firmware":"2.1"}`)))
+	})
+
+	Describe("Chain.Data", func() {
+		var chain record.Chain
+
+		BeforeEach(func() {
+			var err error
+			chain, err = record.NewChain(records)
+			Expect(err).To(BeNil())
+		})
+
+		It("should materialize the data at every version", func() {
+			Expect(chain.Data(0)).To(MatchJSON(`{"name":"device","firmware":"1.0","tags":["a"]}`))
+			Expect(chain.Data(1)).To(MatchJSON(`{"name":"device","firmware":"1.1","tags":["a"]}`))
+			Expect(chain.Data(2)).To(MatchJSON(`{"name":"device","firmware":"1.1","tags":["a","b"]}`))
+			Expect(chain.Data(3)).To(MatchJSON(`{"name":"device","firmware":"2.0"}`))
+			Expect(chain.Data(4)).To(MatchJSON(`{"name":"device","firmware":"2.1"}`))
+		})
+
+		It("should reject a version that is not in the chain", func() {
+			_, err := chain.Data(5)
+			Expect(err).To(MatchError("version '5' is not in the chain"))
+		})
+	})
+
+	Describe("a pruned chain that starts at a delta", func() {
+		It("should materialize the data from a snapshot", func() {
+			hash, err := records[1].Hash()
+			Expect(err).To(BeNil())
+			snapshots := mapSnapshots{string(hash): []byte(`{"firmware":"1.1","name":"device","tags":["a"]}`)}
+
+			chain, err := record.NewChainWithSnapshots(records[1:], snapshots)
+			Expect(err).To(BeNil())
+			Expect(chain.Data(2)).To(MatchJSON(`{"name":"device","firmware":"1.1","tags":["a","b"]}`))
+		})
+
+		It("should fail without a snapshot", func() {
+			chain, err := record.NewChain(records[1:])
+			Expect(err).To(BeNil())
+
+			_, err = chain.Data(2)
+			Expect(err).To(MatchError("version '2' can't be materialized, the chain starts at a delta without a snapshot"))
+		})
+	})
+
+	Describe("a delta that doesn't apply", func() {
+		It("should fail to materialize", func() {
+			appendUpdate(delta.JSONPatch, []byte(`[{"op":"remove","path":"/missing"}]`))
+			chain, err := record.NewChain(records)
+			Expect(err).To(BeNil())
+
+			_, err = chain.Data(5)
+			Expect(err).To(MatchError("json-patch delta of version '5' does not apply to its parent: operation at index '0' failed: '/missing' does not exist"))
+		})
+	})
+
+	Describe("a RootRecord with a delta", func() {
+		It("should yield an error", func() {
+			metadata := records[0].Metadata()
+			metadata.Delta = delta.JSONPatch
+			_, err := record.NewUnsignedRootRecord(metadata, []byte(`[]`))
+			Expect(err).To(MatchError("a RootRecord can't be a delta, it has no parent to apply it to"))
+		})
+	})
+
+	Describe("an update with an unknown delta", func() {
+		It("should yield an error", func() {
+			metadata := records[0].Metadata()
+			metadata.Delta = "xdelta"
+			_, err := record.NewUpdateRecord(records[0], metadata, nil, "")
+			Expect(err).To(MatchError("unknown delta 'xdelta', must be 'json-patch' or 'binary'"))
+		})
+	})
+
+	Describe("an update with a delta and a manifest", func() {
+		It("should yield an error", func() {
+			metadata := records[0].Metadata()
+			metadata.Delta = delta.Binary
+			metadata.Manifest = &chunks.Manifest{Root: make([]byte, 32), Size: 10, ChunkSize: 10}
+			_, err := record.NewUpdateRecord(records[0], metadata, nil, "")
+			Expect(err).To(MatchError("metadata.Delta can't be set with metadata.Manifest"))
+		})
+	})
+})
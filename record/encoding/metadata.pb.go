@@ -8,12 +8,27 @@ Package encoding is a generated protocol buffer package.
 It is generated from these files:
 	metadata.proto
 	record.proto
+	record_service.proto
 	seal.proto
 	unsigned_record.proto
 
 It has these top-level messages:
 	Metadata
+	Manifest
+	Annotation
 	Record
+	SubmitRequest
+	SubmitResponse
+	GetRequest
+	HistoryRequest
+	HistoryResponse
+	WatchRequest
+	Chunk
+	PutChunkResponse
+	GetChunkRequest
+	Tree
+	PutTreeResponse
+	GetTreeRequest
 	Seal
 	UnsignedRecord
 */
@@ -35,9 +50,17 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Metadata struct {
-	Id         string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
-	LocalId    string   `protobuf:"bytes,2,opt,name=localId" json:"localId,omitempty"`
-	PublicKeys [][]byte `protobuf:"bytes,3,rep,name=publicKeys,proto3" json:"publicKeys,omitempty"`
+	Id          string        `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	LocalId     string        `protobuf:"bytes,2,opt,name=localId" json:"localId,omitempty"`
+	PublicKeys  [][]byte      `protobuf:"bytes,3,rep,name=publicKeys,proto3" json:"publicKeys,omitempty"`
+	ContentType string        `protobuf:"bytes,4,opt,name=contentType" json:"contentType,omitempty"`
+	Schema      string        `protobuf:"bytes,5,opt,name=schema" json:"schema,omitempty"`
+	Manifest    *Manifest     `protobuf:"bytes,6,opt,name=manifest" json:"manifest,omitempty"`
+	Annotations []*Annotation `protobuf:"bytes,7,rep,name=annotations" json:"annotations,omitempty"`
+	NotBefore   int64         `protobuf:"varint,8,opt,name=notBefore" json:"notBefore,omitempty"`
+	NotAfter    int64         `protobuf:"varint,9,opt,name=notAfter" json:"notAfter,omitempty"`
+	Sequence    uint64        `protobuf:"varint,10,opt,name=sequence" json:"sequence,omitempty"`
+	Delta       string        `protobuf:"bytes,11,opt,name=delta" json:"delta,omitempty"`
 }
 
 func (m *Metadata) Reset()                    { *m = Metadata{} }
@@ -66,20 +89,147 @@ func (m *Metadata) GetPublicKeys() [][]byte {
 	return nil
 }
 
+func (m *Metadata) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
+func (m *Metadata) GetSchema() string {
+	if m != nil {
+		return m.Schema
+	}
+	return ""
+}
+
+func (m *Metadata) GetManifest() *Manifest {
+	if m != nil {
+		return m.Manifest
+	}
+	return nil
+}
+
+func (m *Metadata) GetAnnotations() []*Annotation {
+	if m != nil {
+		return m.Annotations
+	}
+	return nil
+}
+
+func (m *Metadata) GetNotBefore() int64 {
+	if m != nil {
+		return m.NotBefore
+	}
+	return 0
+}
+
+func (m *Metadata) GetNotAfter() int64 {
+	if m != nil {
+		return m.NotAfter
+	}
+	return 0
+}
+
+func (m *Metadata) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *Metadata) GetDelta() string {
+	if m != nil {
+		return m.Delta
+	}
+	return ""
+}
+
+type Manifest struct {
+	Root      []byte `protobuf:"bytes,1,opt,name=root,proto3" json:"root,omitempty"`
+	Size      uint64 `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	ChunkSize uint32 `protobuf:"varint,3,opt,name=chunkSize" json:"chunkSize,omitempty"`
+}
+
+func (m *Manifest) Reset()                    { *m = Manifest{} }
+func (m *Manifest) String() string            { return proto.CompactTextString(m) }
+func (*Manifest) ProtoMessage()               {}
+func (*Manifest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Manifest) GetRoot() []byte {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+func (m *Manifest) GetSize() uint64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *Manifest) GetChunkSize() uint32 {
+	if m != nil {
+		return m.ChunkSize
+	}
+	return 0
+}
+
+type Annotation struct {
+	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Annotation) Reset()                    { *m = Annotation{} }
+func (m *Annotation) String() string            { return proto.CompactTextString(m) }
+func (*Annotation) ProtoMessage()               {}
+func (*Annotation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Annotation) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Annotation) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Metadata)(nil), "encoding.Metadata")
+	proto.RegisterType((*Manifest)(nil), "encoding.Manifest")
+	proto.RegisterType((*Annotation)(nil), "encoding.Annotation")
 }
 
 func init() { proto.RegisterFile("metadata.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 118 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0xcb, 0x4d, 0x2d, 0x49,
-	0x4c, 0x49, 0x2c, 0x49, 0xd4, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x48, 0xcd, 0x4b, 0xce,
-	0x4f, 0xc9, 0xcc, 0x4b, 0x57, 0x0a, 0xe1, 0xe2, 0xf0, 0x85, 0xca, 0x09, 0xf1, 0x71, 0x31, 0x65,
-	0xa6, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x31, 0x65, 0xa6, 0x08, 0x49, 0x70, 0xb1, 0xe7,
-	0xe4, 0x27, 0x27, 0xe6, 0x78, 0xa6, 0x48, 0x30, 0x81, 0x05, 0x61, 0x5c, 0x21, 0x39, 0x2e, 0xae,
-	0x82, 0xd2, 0xa4, 0x9c, 0xcc, 0x64, 0xef, 0xd4, 0xca, 0x62, 0x09, 0x66, 0x05, 0x66, 0x0d, 0x9e,
-	0x20, 0x24, 0x91, 0x24, 0x36, 0xb0, 0x35, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x87, 0x9a,
-	0x3d, 0x69, 0x78, 0x00, 0x00, 0x00,
+	// 330 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x4c, 0x91, 0xcf, 0x6a, 0xe3, 0x30,
+	0x10, 0xc6, 0xf1, 0x9f, 0x24, 0xce, 0x38, 0x1b, 0x96, 0x21, 0x2c, 0x62, 0x59, 0x16, 0x91, 0x93,
+	0x4f, 0x3e, 0xa4, 0xa5, 0xf7, 0xf4, 0x56, 0x4a, 0xa0, 0xa8, 0x7d, 0x01, 0x45, 0x9e, 0x34, 0x22,
+	0x8e, 0x94, 0xda, 0x72, 0x21, 0x7d, 0xdc, 0x3e, 0x49, 0xb1, 0xe2, 0xd8, 0xb9, 0xcd, 0xf7, 0xfd,
+	0x66, 0xe0, 0x9b, 0x19, 0x98, 0x1f, 0xc9, 0xc9, 0x42, 0x3a, 0x99, 0x9f, 0x2a, 0xeb, 0x2c, 0x26,
+	0x64, 0x94, 0x2d, 0xb4, 0x79, 0x5f, 0x7e, 0x87, 0x90, 0x6c, 0x3a, 0x88, 0x73, 0x08, 0x75, 0xc1,
+	0x02, 0x1e, 0x64, 0x53, 0x11, 0xea, 0x02, 0x19, 0x4c, 0x4a, 0xab, 0x64, 0xf9, 0x54, 0xb0, 0xd0,
+	0x9b, 0x57, 0x89, 0xff, 0x01, 0x4e, 0xcd, 0xb6, 0xd4, 0xea, 0x99, 0xce, 0x35, 0x8b, 0x78, 0x94,
+	0xcd, 0xc4, 0x8d, 0x83, 0x1c, 0x52, 0x65, 0x8d, 0x23, 0xe3, 0xde, 0xce, 0x27, 0x62, 0xb1, 0x9f,
+	0xbe, 0xb5, 0xf0, 0x0f, 0x8c, 0x6b, 0xb5, 0xa7, 0xa3, 0x64, 0x23, 0x0f, 0x3b, 0x85, 0x39, 0x24,
+	0x47, 0x69, 0xf4, 0x8e, 0x6a, 0xc7, 0xc6, 0x3c, 0xc8, 0xd2, 0x15, 0xe6, 0xd7, 0xb4, 0xf9, 0xa6,
+	0x23, 0xa2, 0xef, 0xc1, 0x07, 0x48, 0xa5, 0x31, 0xd6, 0x49, 0xa7, 0xad, 0xa9, 0xd9, 0x84, 0x47,
+	0x59, 0xba, 0x5a, 0x0c, 0x23, 0xeb, 0x1e, 0x8a, 0xdb, 0x46, 0xfc, 0x07, 0x53, 0x63, 0xdd, 0x23,
+	0xed, 0x6c, 0x45, 0x2c, 0xe1, 0x41, 0x16, 0x89, 0xc1, 0xc0, 0xbf, 0x90, 0x18, 0xeb, 0xd6, 0x3b,
+	0x47, 0x15, 0x9b, 0x7a, 0xd8, 0xeb, 0x96, 0xd5, 0xf4, 0xd1, 0x90, 0x51, 0xc4, 0x80, 0x07, 0x59,
+	0x2c, 0x7a, 0x8d, 0x0b, 0x18, 0x15, 0x54, 0x3a, 0xc9, 0x52, 0xbf, 0xd4, 0x45, 0x2c, 0x5f, 0x20,
+	0xb9, 0x26, 0x47, 0x84, 0xb8, 0xb2, 0xd6, 0xf9, 0x2b, 0xcf, 0x84, 0xaf, 0x5b, 0xaf, 0xd6, 0x5f,
+	0xe4, 0x8f, 0x1c, 0x0b, 0x5f, 0xb7, 0xf9, 0xd4, 0xbe, 0x31, 0x87, 0xd7, 0x16, 0x44, 0x3c, 0xc8,
+	0x7e, 0x89, 0xc1, 0x58, 0xde, 0x03, 0x0c, 0x8b, 0xe1, 0x6f, 0x88, 0x0e, 0x74, 0xee, 0x1e, 0xd7,
+	0x96, 0x6d, 0x8e, 0x4f, 0x59, 0x36, 0xd4, 0xfd, 0xed, 0x22, 0xb6, 0x63, 0xff, 0xfd, 0xbb, 0x9f,
+	0x01, 0x00, 0x71, 0xda, 0xfb, 0x4c, 0x0f, 0x02, 0x00, 0x00,
 }
@@ -17,6 +17,7 @@ type Record struct {
 	Metadata *Metadata `protobuf:"bytes,1,opt,name=metadata" json:"metadata,omitempty"`
 	Data     []byte    `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
 	Seal     *Seal     `protobuf:"bytes,3,opt,name=seal" json:"seal,omitempty"`
+	Parent   []byte    `protobuf:"bytes,4,opt,name=parent,proto3" json:"parent,omitempty"`
 }
 
 func (m *Record) Reset()                    { *m = Record{} }
@@ -45,6 +46,13 @@ func (m *Record) GetSeal() *Seal {
 	return nil
 }
 
+func (m *Record) GetParent() []byte {
+	if m != nil {
+		return m.Parent
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Record)(nil), "encoding.Record")
 }
@@ -52,14 +60,15 @@ func init() {
 func init() { proto.RegisterFile("record.proto", fileDescriptor1) }
 
 var fileDescriptor1 = []byte{
-	// 138 bytes of a gzipped FileDescriptorProto
+	// 151 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x29, 0x4a, 0x4d, 0xce,
 	0x2f, 0x4a, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x48, 0xcd, 0x4b, 0xce, 0x4f, 0xc9,
 	0xcc, 0x4b, 0x97, 0xe2, 0xcb, 0x4d, 0x2d, 0x49, 0x4c, 0x49, 0x2c, 0x49, 0x84, 0xc8, 0x48, 0x71,
-	0x15, 0xa7, 0x26, 0xe6, 0x40, 0xd8, 0x4a, 0x05, 0x5c, 0x6c, 0x41, 0x60, 0x5d, 0x42, 0x7a, 0x5c,
-	0x1c, 0x30, 0x75, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0xdc, 0x46, 0x42, 0x7a, 0x30, 0x23, 0xf4, 0x7c,
-	0xa1, 0x32, 0x41, 0x70, 0x35, 0x42, 0x42, 0x5c, 0x2c, 0x60, 0xb5, 0x4c, 0x0a, 0x8c, 0x1a, 0x3c,
-	0x41, 0x60, 0xb6, 0x90, 0x12, 0x17, 0x0b, 0xc8, 0x6c, 0x09, 0x66, 0xb0, 0x7e, 0x3e, 0x84, 0xfe,
-	0xe0, 0xd4, 0xc4, 0x9c, 0x20, 0xb0, 0x5c, 0x12, 0x1b, 0xd8, 0x62, 0x63, 0x40, 0x00, 0x00, 0x00,
-	0xff, 0xff, 0x1c, 0xe6, 0x43, 0x03, 0xae, 0x00, 0x00, 0x00,
+	0x15, 0xa7, 0x26, 0xe6, 0x40, 0xd8, 0x4a, 0x1d, 0x8c, 0x5c, 0x6c, 0x41, 0x60, 0x6d, 0x42, 0x7a,
+	0x5c, 0x1c, 0x30, 0x85, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0xdc, 0x46, 0x42, 0x7a, 0x30, 0x33, 0xf4,
+	0x7c, 0xa1, 0x32, 0x41, 0x70, 0x35, 0x42, 0x42, 0x5c, 0x2c, 0x60, 0xb5, 0x4c, 0x0a, 0x8c, 0x1a,
+	0x3c, 0x41, 0x60, 0xb6, 0x90, 0x12, 0x17, 0x0b, 0xc8, 0x70, 0x09, 0x66, 0xb0, 0x7e, 0x3e, 0x84,
+	0xfe, 0xe0, 0xd4, 0xc4, 0x9c, 0x20, 0xb0, 0x9c, 0x90, 0x18, 0x17, 0x5b, 0x41, 0x62, 0x51, 0x6a,
+	0x5e, 0x89, 0x04, 0x0b, 0x58, 0x27, 0x94, 0x97, 0xc4, 0x06, 0x76, 0x91, 0x31, 0x60, 0x00, 0x50,
+	0x2d, 0x79, 0xe2, 0xc7, 0x00, 0x00, 0x00,
 }
@@ -0,0 +1,279 @@
+// Code generated by protoc-gen-go.
+// source: record_service.proto
+// DO NOT EDIT!
+
+package encoding
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type SubmitRequest struct {
+	Record *Record `protobuf:"bytes,1,opt,name=record" json:"record,omitempty"`
+}
+
+func (m *SubmitRequest) Reset()                    { *m = SubmitRequest{} }
+func (m *SubmitRequest) String() string            { return proto.CompactTextString(m) }
+func (*SubmitRequest) ProtoMessage()               {}
+func (*SubmitRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{0} }
+
+func (m *SubmitRequest) GetRecord() *Record {
+	if m != nil {
+		return m.Record
+	}
+	return nil
+}
+
+type SubmitResponse struct {
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *SubmitResponse) Reset()                    { *m = SubmitResponse{} }
+func (m *SubmitResponse) String() string            { return proto.CompactTextString(m) }
+func (*SubmitResponse) ProtoMessage()               {}
+func (*SubmitResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{1} }
+
+func (m *SubmitResponse) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+type GetRequest struct {
+	Id   string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Hash []byte `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *GetRequest) Reset()                    { *m = GetRequest{} }
+func (m *GetRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetRequest) ProtoMessage()               {}
+func (*GetRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{2} }
+
+func (m *GetRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *GetRequest) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+type HistoryRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *HistoryRequest) Reset()                    { *m = HistoryRequest{} }
+func (m *HistoryRequest) String() string            { return proto.CompactTextString(m) }
+func (*HistoryRequest) ProtoMessage()               {}
+func (*HistoryRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{3} }
+
+func (m *HistoryRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type HistoryResponse struct {
+	Id       string    `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Complete bool      `protobuf:"varint,2,opt,name=complete" json:"complete,omitempty"`
+	Records  []*Record `protobuf:"bytes,3,rep,name=records" json:"records,omitempty"`
+}
+
+func (m *HistoryResponse) Reset()                    { *m = HistoryResponse{} }
+func (m *HistoryResponse) String() string            { return proto.CompactTextString(m) }
+func (*HistoryResponse) ProtoMessage()               {}
+func (*HistoryResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{4} }
+
+func (m *HistoryResponse) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *HistoryResponse) GetComplete() bool {
+	if m != nil {
+		return m.Complete
+	}
+	return false
+}
+
+func (m *HistoryResponse) GetRecords() []*Record {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+type WatchRequest struct {
+	Ids []string `protobuf:"bytes,1,rep,name=ids" json:"ids,omitempty"`
+}
+
+func (m *WatchRequest) Reset()                    { *m = WatchRequest{} }
+func (m *WatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()               {}
+func (*WatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{5} }
+
+func (m *WatchRequest) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+type Chunk struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *Chunk) Reset()                    { *m = Chunk{} }
+func (m *Chunk) String() string            { return proto.CompactTextString(m) }
+func (*Chunk) ProtoMessage()               {}
+func (*Chunk) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{6} }
+
+func (m *Chunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type PutChunkResponse struct {
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *PutChunkResponse) Reset()                    { *m = PutChunkResponse{} }
+func (m *PutChunkResponse) String() string            { return proto.CompactTextString(m) }
+func (*PutChunkResponse) ProtoMessage()               {}
+func (*PutChunkResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{7} }
+
+func (m *PutChunkResponse) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+type GetChunkRequest struct {
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *GetChunkRequest) Reset()                    { *m = GetChunkRequest{} }
+func (m *GetChunkRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetChunkRequest) ProtoMessage()               {}
+func (*GetChunkRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{8} }
+
+func (m *GetChunkRequest) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+type Tree struct {
+	Leaves [][]byte `protobuf:"bytes,1,rep,name=leaves,proto3" json:"leaves,omitempty"`
+}
+
+func (m *Tree) Reset()                    { *m = Tree{} }
+func (m *Tree) String() string            { return proto.CompactTextString(m) }
+func (*Tree) ProtoMessage()               {}
+func (*Tree) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{9} }
+
+func (m *Tree) GetLeaves() [][]byte {
+	if m != nil {
+		return m.Leaves
+	}
+	return nil
+}
+
+type PutTreeResponse struct {
+	Root []byte `protobuf:"bytes,1,opt,name=root,proto3" json:"root,omitempty"`
+}
+
+func (m *PutTreeResponse) Reset()                    { *m = PutTreeResponse{} }
+func (m *PutTreeResponse) String() string            { return proto.CompactTextString(m) }
+func (*PutTreeResponse) ProtoMessage()               {}
+func (*PutTreeResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{10} }
+
+func (m *PutTreeResponse) GetRoot() []byte {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+type GetTreeRequest struct {
+	Root []byte `protobuf:"bytes,1,opt,name=root,proto3" json:"root,omitempty"`
+}
+
+func (m *GetTreeRequest) Reset()                    { *m = GetTreeRequest{} }
+func (m *GetTreeRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeRequest) ProtoMessage()               {}
+func (*GetTreeRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{11} }
+
+func (m *GetTreeRequest) GetRoot() []byte {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*SubmitRequest)(nil), "encoding.SubmitRequest")
+	proto.RegisterType((*SubmitResponse)(nil), "encoding.SubmitResponse")
+	proto.RegisterType((*GetRequest)(nil), "encoding.GetRequest")
+	proto.RegisterType((*HistoryRequest)(nil), "encoding.HistoryRequest")
+	proto.RegisterType((*HistoryResponse)(nil), "encoding.HistoryResponse")
+	proto.RegisterType((*WatchRequest)(nil), "encoding.WatchRequest")
+	proto.RegisterType((*Chunk)(nil), "encoding.Chunk")
+	proto.RegisterType((*PutChunkResponse)(nil), "encoding.PutChunkResponse")
+	proto.RegisterType((*GetChunkRequest)(nil), "encoding.GetChunkRequest")
+	proto.RegisterType((*Tree)(nil), "encoding.Tree")
+	proto.RegisterType((*PutTreeResponse)(nil), "encoding.PutTreeResponse")
+	proto.RegisterType((*GetTreeRequest)(nil), "encoding.GetTreeRequest")
+}
+
+func init() { proto.RegisterFile("record_service.proto", fileDescriptor2) }
+
+var fileDescriptor2 = []byte{
+	// 442 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x7c, 0x53, 0xdf, 0x8b, 0xd3, 0x40,
+	0x10, 0xa6, 0xcd, 0x5d, 0x9b, 0x1b, 0x7b, 0x6d, 0x19, 0x8e, 0xb3, 0xb7, 0x82, 0x84, 0xa0, 0x52,
+	0x04, 0xcb, 0x71, 0x15, 0x45, 0x04, 0x5f, 0x7c, 0xa8, 0x8f, 0xc7, 0x9e, 0xe0, 0xa3, 0xe4, 0x92,
+	0xc1, 0x2e, 0xde, 0x75, 0x6b, 0x76, 0x53, 0xf0, 0x7f, 0xf4, 0x8f, 0x92, 0xfd, 0x95, 0xa4, 0x69,
+	0xf5, 0x6d, 0x32, 0xdf, 0x37, 0xdf, 0xec, 0xcc, 0x37, 0x81, 0x8b, 0x92, 0x72, 0x59, 0x16, 0xdf,
+	0x15, 0x95, 0x3b, 0x91, 0xd3, 0x62, 0x5b, 0x4a, 0x2d, 0x31, 0xa6, 0x4d, 0x2e, 0x0b, 0xb1, 0xf9,
+	0xc1, 0x46, 0x0e, 0x77, 0xf9, 0xf4, 0x03, 0x9c, 0xdf, 0x55, 0xf7, 0x8f, 0x42, 0x73, 0xfa, 0x55,
+	0x91, 0xd2, 0x38, 0x87, 0x81, 0x23, 0xcc, 0x7a, 0x49, 0x6f, 0xfe, 0xe4, 0x66, 0xba, 0x08, 0x95,
+	0x0b, 0x6e, 0xf3, 0xdc, 0xe3, 0xe9, 0x0b, 0x18, 0x87, 0x52, 0xb5, 0x95, 0x1b, 0x45, 0x88, 0x70,
+	0xb2, 0xce, 0xd4, 0xda, 0x56, 0x8e, 0xb8, 0x8d, 0xd3, 0x6b, 0x80, 0x15, 0xd5, 0xea, 0x63, 0xe8,
+	0x0b, 0xa7, 0x7c, 0xc6, 0xfb, 0xa2, 0xa8, 0x2b, 0xfa, 0xad, 0x8a, 0x04, 0xc6, 0x5f, 0x84, 0xd2,
+	0xb2, 0xfc, 0xfd, 0x8f, 0xaa, 0x54, 0xc0, 0xa4, 0x66, 0xf8, 0xd6, 0x5d, 0x61, 0x06, 0x71, 0x2e,
+	0x1f, 0xb7, 0x0f, 0xa4, 0xc9, 0x8a, 0xc7, 0xbc, 0xfe, 0xc6, 0xd7, 0x30, 0x74, 0x23, 0xa8, 0x59,
+	0x94, 0x44, 0x47, 0x67, 0x0c, 0x84, 0x34, 0x81, 0xd1, 0xb7, 0x4c, 0xe7, 0xeb, 0xf0, 0x94, 0x29,
+	0x44, 0xa2, 0x50, 0xb3, 0x5e, 0x12, 0xcd, 0xcf, 0xb8, 0x09, 0xd3, 0x67, 0x70, 0xfa, 0x79, 0x5d,
+	0x6d, 0x7e, 0x9a, 0x59, 0x8a, 0x4c, 0x67, 0x61, 0x7a, 0x13, 0xa7, 0xaf, 0x60, 0x7a, 0x5b, 0x69,
+	0x8b, 0xff, 0x77, 0x4b, 0x2f, 0x61, 0xb2, 0xa2, 0xc0, 0x73, 0x9d, 0x8e, 0xd1, 0x9e, 0xc3, 0xc9,
+	0xd7, 0x92, 0x08, 0x2f, 0x61, 0xf0, 0x40, 0xd9, 0x8e, 0xdc, 0x43, 0x46, 0xdc, 0x7f, 0x19, 0x99,
+	0xdb, 0x4a, 0x1b, 0x4a, 0xbb, 0x5b, 0x29, 0xa5, 0x0e, 0x32, 0x26, 0x36, 0xce, 0xad, 0xc8, 0xd3,
+	0xea, 0x66, 0x5d, 0xd6, 0xcd, 0x9f, 0x08, 0xce, 0xdd, 0x3a, 0xee, 0xdc, 0x29, 0xe1, 0x47, 0x18,
+	0x38, 0xc7, 0xf1, 0x69, 0xb3, 0xb1, 0xbd, 0xf3, 0x61, 0xb3, 0x43, 0xc0, 0x3f, 0xe4, 0x0d, 0x44,
+	0x2b, 0xd2, 0x78, 0xd1, 0x10, 0x9a, 0xbb, 0x60, 0x07, 0x0e, 0xe0, 0x27, 0x18, 0x7a, 0x8f, 0xb1,
+	0xa5, 0xb9, 0x7f, 0x18, 0xec, 0xea, 0x08, 0xe2, 0xdb, 0x2d, 0xe1, 0xd4, 0x1a, 0x87, 0x97, 0x0d,
+	0xa7, 0xed, 0xe4, 0x61, 0xcb, 0xeb, 0x1e, 0xbe, 0x87, 0x38, 0xd8, 0x85, 0x93, 0x06, 0xb7, 0x09,
+	0xc6, 0x9a, 0xc4, 0x81, 0xa7, 0xef, 0x20, 0x0e, 0xfe, 0xe1, 0xd5, 0xde, 0x84, 0x6d, 0x4f, 0x59,
+	0x57, 0x13, 0xdf, 0xc2, 0xd0, 0x1b, 0x86, 0xe3, 0x06, 0x33, 0xdf, 0xed, 0xd9, 0xba, 0x9e, 0x2e,
+	0x61, 0xe8, 0xfd, 0x6b, 0xef, 0x66, 0xdf, 0x52, 0xd6, 0xd1, 0xbb, 0x1f, 0xd8, 0x1f, 0x7e, 0xf9,
+	0x77, 0x00, 0xf5, 0x0e, 0xca, 0x6a, 0x20, 0x04, 0x00, 0x00,
+}
@@ -21,7 +21,7 @@ type Seal struct {
 func (m *Seal) Reset()                    { *m = Seal{} }
 func (m *Seal) String() string            { return proto.CompactTextString(m) }
 func (*Seal) ProtoMessage()               {}
-func (*Seal) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{0} }
+func (*Seal) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{0} }
 
 func (m *Seal) GetHash() []byte {
 	if m != nil {
@@ -41,9 +41,9 @@ func init() {
 	proto.RegisterType((*Seal)(nil), "encoding.Seal")
 }
 
-func init() { proto.RegisterFile("seal.proto", fileDescriptor2) }
+func init() { proto.RegisterFile("seal.proto", fileDescriptor3) }
 
-var fileDescriptor2 = []byte{
+var fileDescriptor3 = []byte{
 	// 95 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x2a, 0x4e, 0x4d, 0xcc,
 	0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x48, 0xcd, 0x4b, 0xce, 0x4f, 0xc9, 0xcc, 0x4b,
@@ -16,12 +16,13 @@ var _ = math.Inf
 type UnsignedRecord struct {
 	Metadata *Metadata `protobuf:"bytes,1,opt,name=metadata" json:"metadata,omitempty"`
 	Data     []byte    `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Parent   []byte    `protobuf:"bytes,3,opt,name=parent,proto3" json:"parent,omitempty"`
 }
 
 func (m *UnsignedRecord) Reset()                    { *m = UnsignedRecord{} }
 func (m *UnsignedRecord) String() string            { return proto.CompactTextString(m) }
 func (*UnsignedRecord) ProtoMessage()               {}
-func (*UnsignedRecord) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{0} }
+func (*UnsignedRecord) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{0} }
 
 func (m *UnsignedRecord) GetMetadata() *Metadata {
 	if m != nil {
@@ -37,20 +38,28 @@ func (m *UnsignedRecord) GetData() []byte {
 	return nil
 }
 
+func (m *UnsignedRecord) GetParent() []byte {
+	if m != nil {
+		return m.Parent
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*UnsignedRecord)(nil), "encoding.UnsignedRecord")
 }
 
-func init() { proto.RegisterFile("unsigned_record.proto", fileDescriptor3) }
+func init() { proto.RegisterFile("unsigned_record.proto", fileDescriptor4) }
 
-var fileDescriptor3 = []byte{
-	// 122 bytes of a gzipped FileDescriptorProto
+var fileDescriptor4 = []byte{
+	// 134 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0x12, 0x2d, 0xcd, 0x2b, 0xce,
 	0x4c, 0xcf, 0x4b, 0x4d, 0x89, 0x2f, 0x4a, 0x4d, 0xce, 0x2f, 0x4a, 0xd1, 0x2b, 0x28, 0xca, 0x2f,
 	0xc9, 0x17, 0xe2, 0x48, 0xcd, 0x4b, 0xce, 0x4f, 0xc9, 0xcc, 0x4b, 0x97, 0xe2, 0xcb, 0x4d, 0x2d,
-	0x49, 0x4c, 0x49, 0x2c, 0x49, 0x84, 0xc8, 0x28, 0x85, 0x70, 0xf1, 0x85, 0x42, 0xb5, 0x04, 0x81,
+	0x49, 0x4c, 0x49, 0x2c, 0x49, 0x84, 0xc8, 0x28, 0xe5, 0x70, 0xf1, 0x85, 0x42, 0xb5, 0x04, 0x81,
 	0x75, 0x08, 0xe9, 0x71, 0x71, 0xc0, 0xd4, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x1b, 0x09, 0xe9,
 	0xc1, 0xb4, 0xeb, 0xf9, 0x42, 0x65, 0x82, 0xe0, 0x6a, 0x84, 0x84, 0xb8, 0x58, 0xc0, 0x6a, 0x99,
-	0x14, 0x18, 0x35, 0x78, 0x82, 0xc0, 0xec, 0x24, 0x36, 0xb0, 0xe1, 0xc6, 0x80, 0x00, 0x00, 0x00,
-	0xff, 0xff, 0x91, 0xe1, 0xa1, 0x43, 0x8f, 0x00, 0x00, 0x00,
+	0x14, 0x18, 0x35, 0x78, 0x82, 0xc0, 0x6c, 0x21, 0x31, 0x2e, 0xb6, 0x82, 0xc4, 0xa2, 0xd4, 0xbc,
+	0x12, 0x09, 0x66, 0xb0, 0x28, 0x94, 0x97, 0xc4, 0x06, 0xb6, 0xd4, 0x18, 0x30, 0x00, 0x26, 0xb1,
+	0x33, 0xb0, 0xa7, 0x00, 0x00, 0x00,
 }
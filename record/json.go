@@ -0,0 +1,164 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// recordJSON is the JSON representation of a record. Data is
+// either a base64 string or, for JSON payloads, the JSON itself
+type recordJSON struct {
+	Metadata *metadataJSON   `json:"metadata,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Seal     *encoding.Seal  `json:"seal,omitempty"`
+	Parent   []byte          `json:"parent,omitempty"`
+}
+
+// metadataJSON is the JSON representation of metadata, with the
+// annotations as an object and the validity window as RFC 3339 times
+type metadataJSON struct {
+	*encoding.Metadata
+	Annotations map[string]string `json:"annotations,omitempty"`
+	NotBefore   string            `json:"notBefore,omitempty"`
+	NotAfter    string            `json:"notAfter,omitempty"`
+}
+
+// IsJSONContentType returns true if the content type is
+// application/json or a structured syntax such as
+// application/ld+json
+func IsJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// MarshalJSON serializes the protobuf version of a record. When the
+// metadata declares a JSON content type, data that is a JSON object
+// or array is included as is instead of being base64 encoded, as
+// long as ParseJSON can restore it byte for byte
+func MarshalJSON(recordPB *encoding.Record) ([]byte, error) {
+	data, err := json.Marshal(recordPB.Data)
+	if err != nil {
+		return nil, err
+	}
+	if IsJSONContentType(recordPB.GetMetadata().GetContentType()) && inlinable(recordPB.Data) {
+		data = recordPB.Data
+	}
+
+	var metadata *metadataJSON
+	if recordPB.Metadata != nil {
+		metadata = &metadataJSON{Metadata: recordPB.Metadata}
+		for _, annotation := range recordPB.Metadata.Annotations {
+			if metadata.Annotations == nil {
+				metadata.Annotations = make(map[string]string)
+			}
+			metadata.Annotations[annotation.Key] = annotation.Value
+		}
+		metadata.NotBefore = timeJSON(recordPB.Metadata.NotBefore)
+		metadata.NotAfter = timeJSON(recordPB.Metadata.NotAfter)
+	}
+
+	return json.Marshal(&recordJSON{
+		Metadata: metadata,
+		Data:     data,
+		Seal:     recordPB.Seal,
+		Parent:   recordPB.Parent,
+	})
+}
+
+// ParseJSON parses a record serialized by MarshalJSON. Data may
+// be a base64 string, or a JSON object or array which is
+// used in its compact form
+func ParseJSON(recordJSONBytes []byte) (*encoding.Record, error) {
+	parsed := &recordJSON{}
+	if err := json.Unmarshal(recordJSONBytes, parsed); err != nil {
+		return nil, err
+	}
+
+	recordPB := &encoding.Record{Seal: parsed.Seal, Parent: parsed.Parent}
+	if parsed.Metadata != nil {
+		recordPB.Metadata = parsed.Metadata.Metadata
+		if recordPB.Metadata == nil {
+			recordPB.Metadata = &encoding.Metadata{}
+		}
+
+		metadata := &Metadata{Annotations: parsed.Metadata.Annotations}
+		annotations, err := metadata.annotationsProto()
+		if err != nil {
+			return nil, err
+		}
+		recordPB.Metadata.Annotations = annotations
+
+		if recordPB.Metadata.NotBefore, err = timeFromJSON("notBefore", parsed.Metadata.NotBefore); err != nil {
+			return nil, err
+		}
+		if recordPB.Metadata.NotAfter, err = timeFromJSON("notAfter", parsed.Metadata.NotAfter); err != nil {
+			return nil, err
+		}
+	}
+	if len(parsed.Data) == 0 {
+		return recordPB, nil
+	}
+
+	switch parsed.Data[0] {
+	case '{', '[':
+		data := &bytes.Buffer{}
+		if err := json.Compact(data, parsed.Data); err != nil {
+			return nil, err
+		}
+		recordPB.Data = data.Bytes()
+	default:
+		if err := json.Unmarshal(parsed.Data, &recordPB.Data); err != nil {
+			return nil, fmt.Errorf("data must be a base64 string, a JSON object or a JSON array: %v", err.Error())
+		}
+	}
+	return recordPB, nil
+}
+
+// timeJSON formats unix seconds as an RFC 3339 time,
+// 0 is left out
+func timeJSON(seconds int64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+// timeFromJSON parses an RFC 3339 time to unix
+// seconds, an empty string is 0
+func timeFromJSON(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("metadata.%v must be an RFC 3339 time: %v", name, err.Error())
+	}
+	return timeProto(t), nil
+}
+
+// inlinable returns true if data is a JSON object or array that
+// json.Marshal would write unchanged, so that the compact form
+// ParseJSON produces is the data that was signed
+func inlinable(data []byte) bool {
+	if len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		return false
+	}
+	if bytes.ContainsAny(data, "<>&\u2028\u2029") {
+		return false
+	}
+
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, data); err != nil {
+		return false
+	}
+	return bytes.Equal(compacted.Bytes(), data)
+}
@@ -0,0 +1,97 @@
+package record_test
+
+import (
+	"encoding/json"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON", func() {
+	// generateTypedRecord creates a root record with the content type and data
+	generateTypedRecord := func(contentType string, data []byte) record.Record {
+		publicKey, privateKey := generateKeys()
+		metadata := record.Metadata{
+			ID:          generators.ID("", []string{publicKey}),
+			PublicKeys:  []string{publicKey},
+			ContentType: contentType,
+			Schema:      "person/v1",
+		}
+
+		rec, err := record.NewRootRecord(metadata, data, generateSignature(metadata, data, privateKey))
+		Expect(err).To(BeNil())
+		return rec
+	}
+
+	// roundTrip serializes the record, parses it back
+	// and returns the raw JSON of its data
+	roundTrip := func(rec record.Record) json.RawMessage {
+		recordJSON, err := rec.JSON()
+		Expect(err).To(BeNil())
+
+		recordPB, err := record.ParseJSON([]byte(recordJSON))
+		Expect(err).To(BeNil())
+
+		parsed, err := record.FromProto(recordPB, nil)
+		Expect(err).To(BeNil())
+		Expect(parsed.Data()).To(Equal(rec.Data()))
+		Expect(parsed.Metadata().ContentType).To(Equal(rec.Metadata().ContentType))
+		Expect(parsed.Metadata().Schema).To(Equal(rec.Metadata().Schema))
+
+		var raw struct {
+			Data json.RawMessage `json:"data"`
+		}
+		Expect(json.Unmarshal([]byte(recordJSON), &raw)).To(Succeed())
+		return raw.Data
+	}
+
+	Describe("with a JSON content type", func() {
+		It("should include compact JSON objects inline", func() {
+			data := roundTrip(generateTypedRecord("application/json", []byte(`{"name":"roy","tags":["a"]}`)))
+			Expect(string(data)).To(Equal(`{"name":"roy","tags":["a"]}`))
+		})
+
+		It("should include JSON arrays inline", func() {
+			data := roundTrip(generateTypedRecord("application/ld+json", []byte(`[1,2]`)))
+			Expect(string(data)).To(Equal(`[1,2]`))
+		})
+
+		It("should base64 encode JSON that isn't compact", func() {
+			data := roundTrip(generateTypedRecord("application/json", []byte(`{"name": "roy"}`)))
+			Expect(string(data)).To(Equal(`"eyJuYW1lIjogInJveSJ9"`))
+		})
+
+		It("should base64 encode JSON that would be escaped", func() {
+			data := roundTrip(generateTypedRecord("application/json", []byte(`{"html":"<b>"}`)))
+			Expect(string(data)).To(HavePrefix(`"`))
+		})
+
+		It("should base64 encode invalid JSON", func() {
+			data := roundTrip(generateTypedRecord("application/json", []byte(`{"name":`)))
+			Expect(string(data)).To(HavePrefix(`"`))
+		})
+	})
+
+	Describe("without a JSON content type", func() {
+		It("should base64 encode the data", func() {
+			data := roundTrip(generateTypedRecord("text/plain", []byte(`{"name":"roy"}`)))
+			Expect(string(data)).To(Equal(`"eyJuYW1lIjoicm95In0="`))
+		})
+	})
+
+	Describe("ParseJSON", func() {
+		It("should compact inline data", func() {
+			recordPB, err := record.ParseJSON([]byte(`{"data": {"name": "roy"}}`))
+			Expect(err).To(BeNil())
+			Expect(string(recordPB.Data)).To(Equal(`{"name":"roy"}`))
+		})
+
+		It("should reject data that is neither base64 nor an object or array", func() {
+			_, err := record.ParseJSON([]byte(`{"data": 1}`))
+			Expect(err).To(MatchError(ContainSubstring("data must be a base64 string, a JSON object or a JSON array")))
+		})
+	})
+})
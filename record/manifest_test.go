@@ -0,0 +1,73 @@
+package record_test
+
+import (
+	"crypto/sha256"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manifest", func() {
+	var metadata record.Metadata
+	var signature string
+
+	BeforeEach(func() {
+		publicKey, privateKey := generateKeys()
+		root := sha256.Sum256([]byte("tree"))
+
+		metadata = record.Metadata{
+			ID:         generators.ID("", []string{publicKey}),
+			PublicKeys: []string{publicKey},
+			Manifest:   &chunks.Manifest{Root: root[:], Size: 5000, ChunkSize: 1000},
+		}
+		signature = generateSignature(metadata, nil, privateKey)
+	})
+
+	Describe("a RootRecord with a manifest", func() {
+		var sut record.RootRecord
+
+		BeforeEach(func() {
+			var err error
+			sut, err = record.NewRootRecord(metadata, nil, signature)
+			Expect(err).To(BeNil())
+		})
+
+		It("should survive a round trip through its protobuf version", func() {
+			recordPB, err := sut.Proto()
+			Expect(err).To(BeNil())
+
+			decoded, err := record.FromProto(recordPB, nil)
+			Expect(err).To(BeNil())
+			Expect(decoded.Metadata().Manifest).To(Equal(metadata.Manifest))
+		})
+
+		It("should sign the root of the chunks", func() {
+			recordPB, err := sut.Proto()
+			Expect(err).To(BeNil())
+
+			recordPB.Metadata.Manifest.Root = make([]byte, 32)
+			recordPB.Seal.Hash = nil
+			_, err = record.FromProto(recordPB, nil)
+			Expect(err).To(MatchError("None of the PublicKeys matches the signature"))
+		})
+	})
+
+	Describe("a RootRecord with a manifest and data", func() {
+		It("should yield an error", func() {
+			_, err := record.NewRootRecord(metadata, []byte("data"), signature)
+			Expect(err).To(MatchError("data must be empty when metadata.Manifest is set"))
+		})
+	})
+
+	Describe("a RootRecord with an invalid manifest", func() {
+		It("should yield an error", func() {
+			metadata.Manifest.Root = []byte("short")
+			_, err := record.NewRootRecord(metadata, nil, signature)
+			Expect(err).To(MatchError("manifest.Root must be a sha256 hash"))
+		})
+	})
+})
@@ -2,9 +2,15 @@ package record
 
 import (
 	"crypto/x509"
+	"fmt"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/chunks"
 	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/delta"
 	"github.com/royvandewater/meshchain/record/encoding"
 	"github.com/royvandewater/meshchain/record/generators"
 )
@@ -14,6 +20,84 @@ type Metadata struct {
 	ID         string
 	LocalID    string
 	PublicKeys []string
+
+	// ContentType is the media type of the data, such as
+	// "application/json". It is optional and signed with the record
+	ContentType string
+
+	// Schema references the schema the data conforms to, such as
+	// one registered with the schema package. It is optional
+	// and signed with the record
+	Schema string
+
+	// Manifest describes data that is stored in chunks rather than
+	// in the record, which then has no data of its own. The record
+	// signs the root of the chunks' Merkle tree, see the chunks package
+	Manifest *chunks.Manifest
+
+	// Annotations are signed key/value pairs, such as an owner,
+	// environment or device type. Any key may be used, they
+	// are encoded sorted by key so that the hash is stable
+	Annotations map[string]string
+
+	// NotBefore and NotAfter bound the time the record is valid
+	// in, see Validity. They are signed to the second and either
+	// may be zero to leave that side of the window open
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// Delta, when set, is the kind of patch the data of an update
+	// is, such as delta.JSONPatch. The patch is applied to the full
+	// data of the parent, see Chain.Data. ContentType and Schema
+	// describe the full data rather than the patch
+	Delta string
+}
+
+// MetadataFromProto builds Metadata from its protobuf version,
+// converting the raw public keys back to pem format
+func MetadataFromProto(metadataPB *encoding.Metadata) (Metadata, error) {
+	if metadataPB == nil {
+		return Metadata{}, fmt.Errorf("metadata is required")
+	}
+
+	publicKeys := make([]string, len(metadataPB.PublicKeys))
+	for i, publicKeyDer := range metadataPB.PublicKeys {
+		publicKey, err := cryptohelpers.RSAPublicKeyDERToPEM(publicKeyDer)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("PublicKey at index '%v' is invalid: %v", i, err.Error())
+		}
+		publicKeys[i] = publicKey
+	}
+
+	var manifest *chunks.Manifest
+	if manifestPB := metadataPB.Manifest; manifestPB != nil {
+		if manifestPB.Size > math.MaxInt64 {
+			return Metadata{}, fmt.Errorf("manifest.Size '%v' is out of range", manifestPB.Size)
+		}
+		manifest = &chunks.Manifest{
+			Root:      manifestPB.Root,
+			Size:      int64(manifestPB.Size),
+			ChunkSize: int(manifestPB.ChunkSize),
+		}
+	}
+
+	annotations, err := annotationsFromProto(metadataPB.Annotations)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return Metadata{
+		ID:          metadataPB.Id,
+		LocalID:     metadataPB.LocalId,
+		PublicKeys:  publicKeys,
+		ContentType: metadataPB.ContentType,
+		Schema:      metadataPB.Schema,
+		Manifest:    manifest,
+		Annotations: annotations,
+		NotBefore:   timeFromProto(metadataPB.NotBefore),
+		NotAfter:    timeFromProto(metadataPB.NotAfter),
+		Delta:       metadataPB.Delta,
+	}, nil
 }
 
 // GenerateID returns a deterministic ID that is
@@ -39,13 +123,123 @@ func (metadata *Metadata) Proto() (*encoding.Metadata, error) {
 		return nil, err
 	}
 
+	var manifest *encoding.Manifest
+	if metadata.Manifest != nil {
+		if err := metadata.Manifest.Validate(); err != nil {
+			return nil, err
+		}
+		manifest = &encoding.Manifest{
+			Root:      metadata.Manifest.Root,
+			Size:      uint64(metadata.Manifest.Size),
+			ChunkSize: uint32(metadata.Manifest.ChunkSize),
+		}
+	}
+
+	annotations, err := metadata.annotationsProto()
+	if err != nil {
+		return nil, err
+	}
+
 	return &encoding.Metadata{
-		Id:         metadata.ID,
-		LocalId:    metadata.LocalID,
-		PublicKeys: PublicKeys,
+		Id:          metadata.ID,
+		LocalId:     metadata.LocalID,
+		PublicKeys:  PublicKeys,
+		ContentType: metadata.ContentType,
+		Schema:      metadata.Schema,
+		Manifest:    manifest,
+		Annotations: annotations,
+		NotBefore:   timeProto(metadata.NotBefore),
+		NotAfter:    timeProto(metadata.NotAfter),
+		Delta:       metadata.Delta,
 	}, nil
 }
 
+// timeFromProto converts unix seconds to a time,
+// 0 is the zero time
+func timeFromProto(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// timeProto converts a time to unix seconds,
+// the zero time is 0
+func timeProto(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// annotationsFromProto builds the annotations map. The annotations
+// must be sorted by key without duplicates, as they are signed in
+// that order and encoding them again must produce the same hash
+func annotationsFromProto(annotationsPB []*encoding.Annotation) (map[string]string, error) {
+	if len(annotationsPB) == 0 {
+		return nil, nil
+	}
+
+	annotations := make(map[string]string, len(annotationsPB))
+	for i, annotation := range annotationsPB {
+		if annotation.GetKey() == "" {
+			return nil, fmt.Errorf("annotation at index '%v' has an empty key", i)
+		}
+		if i > 0 && annotation.GetKey() <= annotationsPB[i-1].GetKey() {
+			return nil, fmt.Errorf("annotations must be sorted by key without duplicates, '%v' is out of order", annotation.GetKey())
+		}
+		annotations[annotation.GetKey()] = annotation.GetValue()
+	}
+	return annotations, nil
+}
+
+// annotationsProto returns the annotations sorted by key
+func (metadata *Metadata) annotationsProto() ([]*encoding.Annotation, error) {
+	keys := make([]string, 0, len(metadata.Annotations))
+	for key := range metadata.Annotations {
+		if key == "" {
+			return nil, fmt.Errorf("annotation keys must not be empty")
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var annotations []*encoding.Annotation
+	for _, key := range keys {
+		annotations = append(annotations, &encoding.Annotation{Key: key, Value: metadata.Annotations[key]})
+	}
+	return annotations, nil
+}
+
+// validateContent ensures that annotation keys are not empty, that
+// the validity window is not empty, that a delta is of a known kind
+// and that a record whose data is stored in chunks does not also
+// have data of its own
+func validateContent(metadata Metadata, data []byte) error {
+	if _, err := metadata.annotationsProto(); err != nil {
+		return err
+	}
+	if err := metadata.validateWindow(); err != nil {
+		return err
+	}
+	if metadata.Delta != "" {
+		if err := delta.Validate(metadata.Delta); err != nil {
+			return err
+		}
+		if metadata.Manifest != nil {
+			return fmt.Errorf("metadata.Delta can't be set with metadata.Manifest")
+		}
+	}
+
+	if metadata.Manifest == nil {
+		return nil
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("data must be empty when metadata.Manifest is set")
+	}
+	return metadata.Manifest.Validate()
+}
+
 // publicKeysAsBytes converts the public keys to their raw bytes
 func (metadata *Metadata) publicKeysAsBytes() ([][]byte, error) {
 	var publicKeyDers [][]byte
@@ -1,5 +1,35 @@
 package record
 
+import "github.com/royvandewater/meshchain/record/encoding"
+
 // Record defines a common interface between an UpdateRecord
 // and a RootRecord
-type Record interface{}
+type Record interface {
+	// Data returns the data of the record
+	Data() []byte
+
+	// Hash returns the sha256 hash of the record, minus the signature
+	Hash() ([]byte, error)
+
+	// JSON serializes the record and return JSON output
+	JSON() (string, error)
+
+	// Metadata returns the metadata of the record
+	Metadata() Metadata
+
+	// ParentHash returns the hash of the record this one updates.
+	// It is nil for a RootRecord
+	ParentHash() []byte
+
+	// Proto returns the protobuf version of the record,
+	// including the seal
+	Proto() (*encoding.Record, error)
+
+	// Signature returns the raw signature of the record
+	Signature() []byte
+
+	// Version returns the signed sequence number of the record
+	// in its chain: 0 for a RootRecord, and one more than its
+	// parent's for an UpdateRecord
+	Version() uint64
+}
@@ -5,13 +5,10 @@ import (
 	"fmt"
 )
 
-// RootRecord represents a single stored record
+// RootRecord represents the first record of a chain. Its
+// metadata.ID is derived from its own publicKeys and localID
 type RootRecord interface {
-	// Hash returns the sha256 hash of the record, minus the signature
-	Hash() ([]byte, error)
-
-	// JSON serializes the record and return JSON output
-	JSON() (string, error)
+	Record
 }
 
 // NewRootRecord instantiates a new record. Records must be valid at time of creation.
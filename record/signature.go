@@ -0,0 +1,61 @@
+package record
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+)
+
+// SigningKey returns the publicKey, in pem format, whose private key
+// produced the record's signature. A root record is signed by one of
+// its own publicKeys and an update record by one of its parent's
+func SigningKey(rec Record, parent Record) (string, error) {
+	publicKeys := rec.Metadata().PublicKeys
+	if parent != nil {
+		publicKeys = parent.Metadata().PublicKeys
+	}
+
+	hashed, err := rec.Hash()
+	if err != nil {
+		return "", err
+	}
+
+	index, err := signingKeyIndex(publicKeys, hashed, rec.Signature())
+	if err != nil {
+		return "", err
+	}
+	if index == -1 {
+		return "", fmt.Errorf("None of the PublicKeys matches the signature")
+	}
+	return publicKeys[index], nil
+}
+
+// verifySignature returns true if the signature of the hash was
+// produced by the private key of any of the given publicKeys
+func verifySignature(publicKeyStrings []string, hashed, signature []byte) (bool, error) {
+	index, err := signingKeyIndex(publicKeyStrings, hashed, signature)
+	if err != nil {
+		return false, err
+	}
+
+	return index != -1, nil
+}
+
+// signingKeyIndex returns the index of the publicKey whose private
+// key produced the signature of the hash, or -1 if there is none
+func signingKeyIndex(publicKeyStrings []string, hashed, signature []byte) (int, error) {
+	publicKeys, err := cryptohelpers.BuildRSAPublicKeys(publicKeyStrings)
+	if err != nil {
+		return -1, err
+	}
+
+	for i, publicKey := range publicKeys {
+		if nil == rsa.VerifyPSS(publicKey, crypto.SHA256, hashed, signature, nil) {
+			return i, nil
+		}
+	}
+
+	return -1, nil
+}
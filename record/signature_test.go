@@ -0,0 +1,41 @@
+package record_test
+
+import (
+	"github.com/royvandewater/meshchain/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SigningKey", func() {
+	Describe("for a root record", func() {
+		It("should return its own publicKey", func() {
+			root, publicKey, _ := generateRootRecord()
+
+			signingKey, err := record.SigningKey(root, nil)
+			Expect(err).To(BeNil())
+			Expect(signingKey).To(Equal(publicKey))
+		})
+	})
+
+	Describe("for an update record that rotates keys", func() {
+		It("should return the parent's publicKey", func() {
+			root, publicKey, privateKey := generateRootRecord()
+			update, _, _ := generateUpdateRecord(root, privateKey)
+
+			signingKey, err := record.SigningKey(update, root)
+			Expect(err).To(BeNil())
+			Expect(signingKey).To(Equal(publicKey))
+		})
+	})
+
+	Describe("when none of the keys produced the signature", func() {
+		It("should return an error", func() {
+			root, _, privateKey := generateRootRecord()
+			update, _, _ := generateUpdateRecord(root, privateKey)
+
+			_, err := record.SigningKey(update, update)
+			Expect(err).To(MatchError("None of the PublicKeys matches the signature"))
+		})
+	})
+})
@@ -1,12 +1,8 @@
 package record
 
 import (
-	"crypto"
-	"crypto/rsa"
-	"encoding/json"
 	"fmt"
 
-	"github.com/royvandewater/meshchain/cryptohelpers"
 	"github.com/royvandewater/meshchain/record/encoding"
 )
 
@@ -19,6 +15,11 @@ type signedRootRecord struct {
 	signature []byte
 }
 
+// Data returns the data of the record
+func (record *signedRootRecord) Data() []byte {
+	return record.data
+}
+
 // Hash returns the sha256 hash of the record. This incorporates
 // only the Data and Metadata properties, not the signature. This
 // is the portion of the record that must be signed
@@ -33,47 +34,74 @@ func (record *signedRootRecord) Hash() ([]byte, error) {
 
 // JSON serializes the record and return JSON output
 func (record *signedRootRecord) JSON() (string, error) {
-	hash, err := record.Hash()
+	recordPB, err := record.Proto()
 	if err != nil {
 		return "", err
 	}
 
-	metadata, err := record.metadata.Proto()
+	jsonBytes, err := MarshalJSON(recordPB)
 	if err != nil {
 		return "", err
 	}
+	return string(jsonBytes), nil
+}
+
+// Metadata returns the metadata of the record
+func (record *signedRootRecord) Metadata() Metadata {
+	return record.metadata
+}
+
+// ParentHash returns nil, a root record has no parent
+func (record *signedRootRecord) ParentHash() []byte {
+	return nil
+}
+
+// Proto returns the protobuf version of the record
+func (record *signedRootRecord) Proto() (*encoding.Record, error) {
+	hash, err := record.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := record.metadata.Proto()
+	if err != nil {
+		return nil, err
+	}
 
-	jsonBytes, err := json.Marshal(&encoding.Record{
+	return &encoding.Record{
 		Metadata: metadata,
 		Data:     record.data,
 		Seal: &encoding.Seal{
 			Hash:      hash,
 			Signature: record.signature,
 		},
-	})
-	if err != nil {
-		return "", nil
-	}
-	return string(jsonBytes), nil
+	}, nil
+}
+
+// Signature returns the raw signature of the record
+func (record *signedRootRecord) Signature() []byte {
+	return record.signature
+}
+
+// Version returns 0, a root record starts its chain
+func (record *signedRootRecord) Version() uint64 {
+	return 0
 }
 
 // validateSignature validates the signature for this version of the record
 func (record *signedRootRecord) validateSignature() error {
-	publicKeys, err := cryptohelpers.BuildRSAPublicKeys(record.metadata.PublicKeys)
-	if err != nil {
-		return err
-	}
-
 	hashed, err := record.Hash()
 	if err != nil {
 		return fmt.Errorf("Failed to generate Hash: %v", err.Error())
 	}
 
-	for _, publicKey := range publicKeys {
-		if nil == rsa.VerifyPSS(publicKey, crypto.SHA256, hashed, record.signature, nil) {
-			return nil
-		}
+	ok, err := verifySignature(record.metadata.PublicKeys, hashed, record.signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("None of the PublicKeys matches the signature")
 	}
 
-	return fmt.Errorf("None of the PublicKeys matches the signature")
+	return nil
 }
@@ -0,0 +1,142 @@
+package record
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// signedUpdateRecord is an update record that is verified
+// against its parent at construction time, provided it's
+// constructed using NewUpdateRecord.
+type signedUpdateRecord struct {
+	metadata   Metadata
+	data       []byte
+	signature  []byte
+	parentHash []byte
+	version    uint64
+}
+
+// Data returns the data of the record
+func (record *signedUpdateRecord) Data() []byte {
+	return record.data
+}
+
+// Hash returns the sha256 hash of the record. This incorporates
+// the Data and Metadata properties and the hash of the parent, not
+// the signature. This is the portion of the record that must be signed
+func (record *signedUpdateRecord) Hash() ([]byte, error) {
+	return record.unsigned().Hash()
+}
+
+// JSON serializes the record and return JSON output
+func (record *signedUpdateRecord) JSON() (string, error) {
+	recordPB, err := record.Proto()
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := MarshalJSON(recordPB)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// Metadata returns the metadata of the record
+func (record *signedUpdateRecord) Metadata() Metadata {
+	return record.metadata
+}
+
+// ParentHash returns the hash of the record this one updates
+func (record *signedUpdateRecord) ParentHash() []byte {
+	return record.parentHash
+}
+
+// Proto returns the protobuf version of the record
+func (record *signedUpdateRecord) Proto() (*encoding.Record, error) {
+	hash, err := record.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := record.unsigned().proto()
+	if err != nil {
+		return nil, err
+	}
+
+	return &encoding.Record{
+		Metadata: metadata,
+		Data:     record.data,
+		Seal: &encoding.Seal{
+			Hash:      hash,
+			Signature: record.signature,
+		},
+		Parent: record.parentHash,
+	}, nil
+}
+
+// Signature returns the raw signature of the record
+func (record *signedUpdateRecord) Signature() []byte {
+	return record.signature
+}
+
+// Version returns the signed sequence number of the record,
+// one more than its parent's
+func (record *signedUpdateRecord) Version() uint64 {
+	return record.version
+}
+
+// unsigned returns the record without its signature
+func (record *signedUpdateRecord) unsigned() *unsignedUpdateRecord {
+	return &unsignedUpdateRecord{metadata: record.metadata, data: record.data, parentHash: record.parentHash, version: record.version}
+}
+
+// validateUpdate verifies that the update is a valid successor
+// of the parent. The update must reference the parent's hash, be
+// the version after the parent's, keep the parent's metadata.ID,
+// have at least one publicKey, and be signed by one of the
+// parent's metadata.PublicKeys. The parent's hash is part of the
+// signed hash, so a signature only holds for this parent
+func validateUpdate(parent, update Record) error {
+	parentHash, err := parent.Hash()
+	if err != nil {
+		return fmt.Errorf("Failed to generate parent Hash: %v", err.Error())
+	}
+	if !bytes.Equal(parentHash, update.ParentHash()) {
+		return fmt.Errorf("parentHash does not match the hash of the parent")
+	}
+	if update.Version() != parent.Version()+1 {
+		return fmt.Errorf("metadata.sequence '%v' must be one more than the parent's '%v'", update.Version(), parent.Version())
+	}
+
+	metadata := update.Metadata()
+	if len(metadata.PublicKeys) == 0 {
+		return fmt.Errorf("metadata must contain at least one publicKey")
+	}
+	if metadata.ID != parent.Metadata().ID {
+		return fmt.Errorf("metadata.ID does not match the parent's metadata.ID")
+	}
+	if err := validateContent(metadata, update.Data()); err != nil {
+		return err
+	}
+	if metadata.Delta != "" && parent.Metadata().Manifest != nil {
+		return fmt.Errorf("a delta can't be applied to a parent whose data is stored in chunks")
+	}
+
+	hashed, err := update.Hash()
+	if err != nil {
+		return fmt.Errorf("Failed to generate Hash: %v", err.Error())
+	}
+
+	ok, err := verifySignature(parent.Metadata().PublicKeys, hashed, update.Signature())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("None of the parent's PublicKeys matches the signature")
+	}
+
+	return nil
+}
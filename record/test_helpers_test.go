@@ -52,18 +52,43 @@ func generateSignature(metadata record.Metadata, data []byte, privateKey *rsa.Pr
 	metadataProto, err := metadata.Proto()
 	Expect(err).To(BeNil())
 
+	return signUnsignedRecord(metadataProto, data, nil, privateKey)
+}
+
+// generateUpdateSignature signs the metadata and data as an update
+// of the parent, with the version after the parent's as the
+// metadata.sequence
+func generateUpdateSignature(parent record.Record, metadata record.Metadata, data []byte, privateKey *rsa.PrivateKey) string {
+	metadataProto, err := metadata.Proto()
+	Expect(err).To(BeNil())
+	metadataProto.Sequence = parent.Version() + 1
+
+	parentHash, err := parent.Hash()
+	Expect(err).To(BeNil())
+	return signUnsignedRecord(metadataProto, data, parentHash, privateKey)
+}
+
+// signUnsignedRecord signs the hash of the UnsignedRecord
+// of the metadata, data and parent hash
+func signUnsignedRecord(metadataProto *encoding.Metadata, data, parentHash []byte, privateKey *rsa.PrivateKey) string {
+	signatureBytes, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, hashUnsignedRecord(metadataProto, data, parentHash), nil)
+	Expect(err).To(BeNil())
+
+	return base64.StdEncoding.EncodeToString(signatureBytes)
+}
+
+// hashUnsignedRecord returns the sha256 hash of the
+// UnsignedRecord of the metadata, data and parent hash
+func hashUnsignedRecord(metadataProto *encoding.Metadata, data, parentHash []byte) []byte {
 	bytes, err := proto.Marshal(&encoding.UnsignedRecord{
 		Metadata: metadataProto,
 		Data:     data,
+		Parent:   parentHash,
 	})
 	Expect(err).To(BeNil())
 
 	hash := sha256.Sum256(bytes)
-
-	signatureBytes, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, hash[:], nil)
-	Expect(err).To(BeNil())
-
-	return base64.StdEncoding.EncodeToString(signatureBytes)
+	return hash[:]
 }
 
 // generateRootRecord creates a new record with public/private key pair.
@@ -89,3 +114,24 @@ func generateRootRecord() (record.RootRecord, string, *rsa.PrivateKey) {
 
 	return rec, publicKey, privateKey
 }
+
+// generateUpdateRecord creates an update of the parent, signed with
+// the parent's privateKey, that rotates to a new public/private key
+// pair. It has assertions on all error cases, so it throws if anything
+// goes wrong.
+func generateUpdateRecord(parent record.Record, privateKey *rsa.PrivateKey) (record.UpdateRecord, string, *rsa.PrivateKey) {
+	publicKey, newPrivateKey := generateKeys()
+
+	metadata := record.Metadata{
+		ID:         parent.Metadata().ID,
+		PublicKeys: []string{publicKey},
+	}
+	data := []byte(`updated data`)
+
+	signature := generateUpdateSignature(parent, metadata, data, privateKey)
+
+	rec, err := record.NewUpdateRecord(parent, metadata, data, signature)
+	Expect(err).To(BeNil())
+
+	return rec, publicKey, newPrivateKey
+}
@@ -93,5 +93,8 @@ func (record *unsignedRootRecord) validateMetadata() error {
 	if record.metadata.ID != record.metadata.GenerateID() {
 		return fmt.Errorf("metadata.ID does not match publicKeys + localName")
 	}
-	return nil
+	if record.metadata.Delta != "" {
+		return fmt.Errorf("a RootRecord can't be a delta, it has no parent to apply it to")
+	}
+	return validateContent(record.metadata, record.data)
 }
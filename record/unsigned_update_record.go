@@ -18,29 +18,39 @@ import (
 // a valid parent record (with verifiably correct ancestry)
 type UnsignedUpdateRecord interface {
 	// GenerateSignature generates a base64 encoded signature that
-	// incorporates the metadata and data of the record, and validates
-	// that the private key matches one of the public keys in the parent
+	// incorporates the metadata, data and parent of the record, and
+	// validates that the private key matches one of the public keys
+	// in the parent
 	GenerateSignature(privateKey *rsa.PrivateKey) (string, error)
 
 	// Hash returns the sha256 hash of the record. This incorporates
-	// only the Data and Metadata properties, not the signature. This
-	// is the portion of the record that must be signed
+	// the Data and Metadata properties and the hash of the parent,
+	// not the signature. This is the portion of the record that
+	// must be signed
 	Hash() ([]byte, error)
 }
 
 // NewUnsignedUpdateRecord constructs a new unsigned update record
 // with a reference to the given parent record. The parent
-// record's ancestry is verified
+// record's ancestry is verified. The record's version is
+// one more than the parent's
 func NewUnsignedUpdateRecord(parent Record, metadata Metadata, data []byte) (UnsignedUpdateRecord, error) {
 	if parent == nil {
 		return nil, fmt.Errorf("A valid parent record is required")
 	}
-	return &unsignedUpdateRecord{metadata: metadata, data: data}, nil
+
+	parentHash, err := parent.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate parent Hash: %v", err.Error())
+	}
+	return &unsignedUpdateRecord{metadata: metadata, data: data, parentHash: parentHash, version: parent.Version() + 1}, nil
 }
 
 type unsignedUpdateRecord struct {
-	metadata Metadata
-	data     []byte
+	metadata   Metadata
+	data       []byte
+	parentHash []byte
+	version    uint64
 }
 
 func (record *unsignedUpdateRecord) GenerateSignature(privateKey *rsa.PrivateKey) (string, error) {
@@ -58,10 +68,12 @@ func (record *unsignedUpdateRecord) GenerateSignature(privateKey *rsa.PrivateKey
 }
 
 // Hash returns the sha256 hash of the record. This incorporates
-// only the Data and Metadata properties, not the signature. This
-// is the portion of the record that must be signed
+// the Data and Metadata properties, including the version as
+// metadata.sequence, and the hash of the parent, not the signature.
+// This is the portion of the record that must be signed, so that
+// the update can't be replayed onto any other parent
 func (record *unsignedUpdateRecord) Hash() ([]byte, error) {
-	metadata, err := record.metadata.Proto()
+	metadata, err := record.proto()
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +81,7 @@ func (record *unsignedUpdateRecord) Hash() ([]byte, error) {
 	bytes, err := proto.Marshal(&encoding.UnsignedRecord{
 		Metadata: metadata,
 		Data:     record.data,
+		Parent:   record.parentHash,
 	})
 	if err != nil {
 		return nil, err
@@ -77,3 +90,14 @@ func (record *unsignedUpdateRecord) Hash() ([]byte, error) {
 	hashed := sha256.Sum256(bytes)
 	return hashed[:], nil // [32]byte -> []byte
 }
+
+// proto returns the protobuf version of the metadata
+// with the version as its sequence
+func (record *unsignedUpdateRecord) proto() (*encoding.Metadata, error) {
+	metadata, err := record.metadata.Proto()
+	if err != nil {
+		return nil, err
+	}
+	metadata.Sequence = record.version
+	return metadata, nil
+}
@@ -1,5 +1,10 @@
 package record
 
+import (
+	"encoding/base64"
+	"fmt"
+)
+
 // UpdateRecord is a signed update record. In order to be
 // constructed, it must have valid metadata. This means
 // that there must be at least one publicKey and a valid
@@ -7,16 +12,38 @@ package record
 // that the record is signed using a privateKey that matches
 // on of the parents' publicKey
 type UpdateRecord interface {
+	Record
 }
 
 // NewUpdateRecord instantiates a new update record. Records must
 // be valid at time of creation. This means they must have:
 //    * At least one publicKey
 //    * A parent record
+//    * A metadata.ID that matches the parent's metadata.ID
+//    * A version one more than the parent's, signed as metadata.sequence
 //    * A signature from one of the parents' metadata.PublicKeys
-//      that signs a combination of both the metadata and data properties
+//      that signs a combination of the metadata and data properties
+//      and the hash of the parent
 func NewUpdateRecord(parent Record, metadata Metadata, data []byte, signatureBase64 string) (UpdateRecord, error) {
-	return &signedUpdateRecord{}, nil
-}
+	if parent == nil {
+		return nil, fmt.Errorf("A valid parent record is required")
+	}
+
+	parentHash, err := parent.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate parent Hash: %v", err.Error())
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to base64 decode metadata.signature: %v", err.Error())
+	}
 
-type signedUpdateRecord struct{}
+	record := &signedUpdateRecord{metadata, data, signature, parentHash, parent.Version() + 1}
+
+	if err := validateUpdate(parent, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
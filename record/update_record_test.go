@@ -1,6 +1,8 @@
 package record_test
 
 import (
+	"encoding/base64"
+
 	"github.com/royvandewater/meshchain/record"
 	"github.com/royvandewater/meshchain/record/generators"
 
@@ -24,7 +26,7 @@ var _ = Describe("UpdateRecord", func() {
 				}
 				data := []byte(`data`)
 
-				signature := generateSignature(metadata, data, privateKey)
+				signature := generateUpdateSignature(parent, metadata, data, privateKey)
 
 				sut, err = record.NewUpdateRecord(parent, metadata, data, signature)
 			})
@@ -37,5 +39,93 @@ var _ = Describe("UpdateRecord", func() {
 				Expect(sut).NotTo(BeNil())
 			})
 		})
+
+		Describe("When called without a parent", func() {
+			BeforeEach(func() {
+				sut, err = record.NewUpdateRecord(nil, record.Metadata{}, []byte(`data`), "")
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("A valid parent record is required"))
+			})
+		})
+
+		Describe("When the metadata.ID does not match the parent", func() {
+			BeforeEach(func() {
+				parent, _, privateKey := generateRootRecord()
+				publicKey2, _ := generateKeys()
+
+				metadata := record.Metadata{
+					ID:         generators.ID("", []string{publicKey2}),
+					PublicKeys: []string{publicKey2},
+				}
+				data := []byte(`data`)
+
+				signature := generateUpdateSignature(parent, metadata, data, privateKey)
+
+				sut, err = record.NewUpdateRecord(parent, metadata, data, signature)
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("metadata.ID does not match the parent's metadata.ID"))
+			})
+		})
+
+		Describe("When signed with a key that is not in the parent", func() {
+			BeforeEach(func() {
+				parent, publicKey, _ := generateRootRecord()
+				publicKey2, privateKey2 := generateKeys()
+
+				metadata := record.Metadata{
+					ID:         generators.ID("", []string{publicKey}),
+					PublicKeys: []string{publicKey2},
+				}
+				data := []byte(`data`)
+
+				signature := generateUpdateSignature(parent, metadata, data, privateKey2)
+
+				sut, err = record.NewUpdateRecord(parent, metadata, data, signature)
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("None of the parent's PublicKeys matches the signature"))
+			})
+		})
+	})
+	Describe("replaying an update onto another parent", func() {
+		var parent, sibling, update record.Record
+
+		BeforeEach(func() {
+			root, _, privateKey := generateRootRecord()
+			metadata := root.Metadata()
+
+			parent, err = record.NewUpdateRecord(root, metadata, []byte(`a`), generateUpdateSignature(root, metadata, []byte(`a`), privateKey))
+			Expect(err).To(BeNil())
+			sibling, err = record.NewUpdateRecord(root, metadata, []byte(`b`), generateUpdateSignature(root, metadata, []byte(`b`), privateKey))
+			Expect(err).To(BeNil())
+			update, err = record.NewUpdateRecord(parent, metadata, []byte(`c`), generateUpdateSignature(parent, metadata, []byte(`c`), privateKey))
+			Expect(err).To(BeNil())
+		})
+
+		It("should not verify, since the parent's hash is signed", func() {
+			signature := base64.StdEncoding.EncodeToString(update.Signature())
+			_, err := record.NewUpdateRecord(sibling, update.Metadata(), update.Data(), signature)
+			Expect(err).To(MatchError("None of the parent's PublicKeys matches the signature"))
+		})
+
+		It("should hash differently for each parent", func() {
+			metadata := update.Metadata()
+			unsignedOfParent, err := record.NewUnsignedUpdateRecord(parent, metadata, []byte(`c`))
+			Expect(err).To(BeNil())
+			unsignedOfSibling, err := record.NewUnsignedUpdateRecord(sibling, metadata, []byte(`c`))
+			Expect(err).To(BeNil())
+
+			hashOfSibling, err := unsignedOfSibling.Hash()
+			Expect(err).To(BeNil())
+			Expect(unsignedOfParent.Hash()).NotTo(Equal(hashOfSibling))
+		})
 	})
 })
@@ -0,0 +1,61 @@
+package record
+
+import (
+	"fmt"
+	"time"
+)
+
+// Validity checks records against their metadata.NotBefore and
+// metadata.NotAfter. The zero value uses time.Now without any skew
+type Validity struct {
+	// Now returns the current time, defaults to time.Now
+	Now func() time.Time
+
+	// Skew is how far the clock of the signer may be off from
+	// Now. The window of every record is widened by Skew
+	// on both sides
+	Skew time.Duration
+}
+
+// Check returns an error if the record is not yet valid or has
+// expired. Only the record itself is checked: an update is valid
+// in its own window, whatever the window of its parent was
+func (validity Validity) Check(rec Record) error {
+	now := time.Now
+	if validity.Now != nil {
+		now = validity.Now
+	}
+
+	metadata := rec.Metadata()
+	return metadata.ValidAt(now(), validity.Skew)
+}
+
+// ValidAt returns an error if the time is outside of the
+// validity window, widened by skew on both sides
+func (metadata *Metadata) ValidAt(t time.Time, skew time.Duration) error {
+	if !metadata.NotBefore.IsZero() && t.Add(skew).Before(metadata.NotBefore) {
+		return fmt.Errorf("record is not valid before '%v'", metadata.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if metadata.Expired(t.Add(-skew)) {
+		return fmt.Errorf("record expired at '%v'", metadata.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Expired returns true if the metadata.NotAfter is set
+// and the time is after it
+func (metadata *Metadata) Expired(t time.Time) bool {
+	return !metadata.NotAfter.IsZero() && t.After(metadata.NotAfter)
+}
+
+// validateWindow ensures that NotAfter, when both are
+// set, is after NotBefore
+func (metadata *Metadata) validateWindow() error {
+	if metadata.NotBefore.IsZero() || metadata.NotAfter.IsZero() {
+		return nil
+	}
+	if !metadata.NotAfter.After(metadata.NotBefore) {
+		return fmt.Errorf("metadata.NotAfter must be after metadata.NotBefore")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package record_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validity", func() {
+	var notBefore, notAfter time.Time
+	var metadata record.Metadata
+	var sut record.RootRecord
+
+	// at returns a Validity whose clock is stopped at t
+	at := func(t time.Time, skew time.Duration) record.Validity {
+		return record.Validity{Now: func() time.Time { return t }, Skew: skew}
+	}
+
+	BeforeEach(func() {
+		notBefore = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		notAfter = time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+		publicKey, privateKey := generateKeys()
+		metadata = record.Metadata{
+			ID:         generators.ID("", []string{publicKey}),
+			PublicKeys: []string{publicKey},
+			NotBefore:  notBefore,
+			NotAfter:   notAfter,
+		}
+
+		var err error
+		sut, err = record.NewRootRecord(metadata, nil, generateSignature(metadata, nil, privateKey))
+		Expect(err).To(BeNil())
+	})
+
+	It("should be covered by the hash", func() {
+		hash, err := sut.Hash()
+		Expect(err).To(BeNil())
+
+		metadata.NotAfter = notAfter.Add(365 * 24 * time.Hour)
+		changed, err := record.NewUnsignedRootRecord(metadata, nil)
+		Expect(err).To(BeNil())
+		Expect(changed.Hash()).NotTo(Equal(hash))
+	})
+
+	It("should survive a round trip through JSON", func() {
+		recordJSON, err := sut.JSON()
+		Expect(err).To(BeNil())
+
+		var parsed struct {
+			Metadata struct {
+				NotBefore string `json:"notBefore"`
+				NotAfter  string `json:"notAfter"`
+			} `json:"metadata"`
+		}
+		Expect(json.Unmarshal([]byte(recordJSON), &parsed)).To(Succeed())
+		Expect(parsed.Metadata.NotBefore).To(Equal("2026-01-01T00:00:00Z"))
+		Expect(parsed.Metadata.NotAfter).To(Equal("2026-07-01T00:00:00Z"))
+
+		recordPB, err := record.ParseJSON([]byte(recordJSON))
+		Expect(err).To(BeNil())
+		decoded, err := record.FromProto(recordPB, nil)
+		Expect(err).To(BeNil())
+		Expect(decoded.Metadata().NotBefore).To(Equal(notBefore))
+		Expect(decoded.Metadata().NotAfter).To(Equal(notAfter))
+	})
+
+	It("should accept a time inside the window", func() {
+		Expect(at(notBefore.Add(time.Hour), 0).Check(sut)).To(Succeed())
+	})
+
+	It("should reject a time before the window", func() {
+		err := at(notBefore.Add(-time.Minute), 0).Check(sut)
+		Expect(err).To(MatchError("record is not valid before '2026-01-01T00:00:00Z'"))
+	})
+
+	It("should reject a time after the window", func() {
+		err := at(notAfter.Add(time.Minute), 0).Check(sut)
+		Expect(err).To(MatchError("record expired at '2026-07-01T00:00:00Z'"))
+	})
+
+	It("should tolerate the skew on both sides", func() {
+		Expect(at(notBefore.Add(-time.Minute), 2*time.Minute).Check(sut)).To(Succeed())
+		Expect(at(notAfter.Add(time.Minute), 2*time.Minute).Check(sut)).To(Succeed())
+		Expect(at(notAfter.Add(3*time.Minute), 2*time.Minute).Check(sut)).NotTo(Succeed())
+	})
+
+	It("should accept any time without a window", func() {
+		metadata.NotBefore = time.Time{}
+		metadata.NotAfter = time.Time{}
+		Expect(metadata.ValidAt(time.Unix(0, 0), 0)).To(Succeed())
+		Expect(metadata.Expired(time.Now().Add(100 * 365 * 24 * time.Hour))).To(BeFalse())
+	})
+
+	It("should reject an empty window", func() {
+		metadata.NotAfter = notBefore
+		_, err := record.NewUnsignedRootRecord(metadata, nil)
+		Expect(err).To(MatchError("metadata.NotAfter must be after metadata.NotBefore"))
+	})
+})
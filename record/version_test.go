@@ -0,0 +1,107 @@
+package record_test
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	var root record.RootRecord
+	var first, second record.UpdateRecord
+	var firstKey *rsa.PrivateKey
+
+	BeforeEach(func() {
+		var rootKey *rsa.PrivateKey
+		root, _, rootKey = generateRootRecord()
+		first, _, firstKey = generateUpdateRecord(root, rootKey)
+		second, _, _ = generateUpdateRecord(first, firstKey)
+	})
+
+	It("should increase by one per update, starting at 0", func() {
+		Expect(root.Version()).To(Equal(uint64(0)))
+		Expect(first.Version()).To(Equal(uint64(1)))
+		Expect(second.Version()).To(Equal(uint64(2)))
+	})
+
+	It("should be encoded as the metadata.sequence", func() {
+		recordPB, err := second.Proto()
+		Expect(err).To(BeNil())
+		Expect(recordPB.Metadata.Sequence).To(Equal(uint64(2)))
+
+		recordJSON, err := second.JSON()
+		Expect(err).To(BeNil())
+		var parsed struct {
+			Metadata struct {
+				Sequence uint64 `json:"sequence"`
+			} `json:"metadata"`
+		}
+		Expect(json.Unmarshal([]byte(recordJSON), &parsed)).To(Succeed())
+		Expect(parsed.Metadata.Sequence).To(Equal(uint64(2)))
+	})
+
+	It("should be covered by the signature", func() {
+		recordPB, err := second.Proto()
+		Expect(err).To(BeNil())
+
+		recordPB.Metadata.Sequence = 5
+		recordPB.Seal.Hash = nil
+		_, err = record.FromProto(recordPB, first)
+		Expect(err).To(MatchError("metadata.sequence '5' does not match the record's version '2'"))
+	})
+
+	It("should survive a round trip through FromTrustedProto", func() {
+		recordPB, err := second.Proto()
+		Expect(err).To(BeNil())
+
+		decoded, err := record.FromTrustedProto(recordPB)
+		Expect(err).To(BeNil())
+		Expect(decoded.Version()).To(Equal(uint64(2)))
+	})
+
+	Describe("an update that skips a version", func() {
+		var skipping record.Record
+
+		BeforeEach(func() {
+			metadata := first.Metadata()
+			metadataPB, err := metadata.Proto()
+			Expect(err).To(BeNil())
+			metadataPB.Sequence = 3
+
+			parentHash, err := first.Hash()
+			Expect(err).To(BeNil())
+			signature, err := base64.StdEncoding.DecodeString(signUnsignedRecord(metadataPB, []byte(`skipped`), parentHash, firstKey))
+			Expect(err).To(BeNil())
+
+			skipping, err = record.FromTrustedProto(&encoding.Record{
+				Metadata: metadataPB,
+				Data:     []byte(`skipped`),
+				Seal:     &encoding.Seal{Hash: hashUnsignedRecord(metadataPB, []byte(`skipped`), parentHash), Signature: signature},
+				Parent:   parentHash,
+			})
+			Expect(err).To(BeNil())
+		})
+
+		It("should not be accepted in a chain", func() {
+			_, err := record.NewChain([]record.Record{root, first, skipping})
+			Expect(err).To(MatchError("record at index '2' is invalid: metadata.sequence '3' must be one more than the parent's '1'"))
+		})
+	})
+
+	Describe("an update with a sequence of 0", func() {
+		It("should be rejected by FromTrustedProto", func() {
+			recordPB, err := first.Proto()
+			Expect(err).To(BeNil())
+
+			recordPB.Metadata.Sequence = 0
+			_, err = record.FromTrustedProto(recordPB)
+			Expect(err).To(MatchError("metadata.sequence of an update must be at least 1"))
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// runReencrypt rewrites the values of an encrypted store that were
+// encrypted with a previous master key using the active one. Once it
+// succeeds the previous key files can be dropped from --keys
+func runReencrypt(args []string) error {
+	flags := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	dir, keys := storeFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *keys == "" {
+		return fmt.Errorf("--keys is required")
+	}
+
+	s, lock, err := openStore(*dir, *keys)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	count, err := s.Reencrypt()
+	if err != nil {
+		return err
+	}
+
+	return printJSON(map[string]int{"reencrypted": count})
+}
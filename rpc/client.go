@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// Client calls the RecordService of a server, such
+// as a NewGRPCServer, with the gRPC protocol
+type Client interface {
+	Submit(ctx context.Context, request *encoding.SubmitRequest) (*encoding.SubmitResponse, error)
+	Get(ctx context.Context, request *encoding.GetRequest) (*encoding.Record, error)
+	History(ctx context.Context, request *encoding.HistoryRequest) (*encoding.HistoryResponse, error)
+
+	// Watch starts a Watch call, which ends when ctx is done
+	Watch(ctx context.Context, request *encoding.WatchRequest) (WatchClient, error)
+
+	PutChunk(ctx context.Context, request *encoding.Chunk) (*encoding.PutChunkResponse, error)
+	GetChunk(ctx context.Context, request *encoding.GetChunkRequest) (*encoding.Chunk, error)
+	PutTree(ctx context.Context, request *encoding.Tree) (*encoding.PutTreeResponse, error)
+	GetTree(ctx context.Context, request *encoding.GetTreeRequest) (*encoding.Tree, error)
+}
+
+// WatchClient is the client side of a Watch call
+type WatchClient interface {
+	// Recv returns the next record. It returns io.EOF
+	// once the server has ended the call without an error
+	Recv() (*encoding.Record, error)
+}
+
+// NewClient constructs a Client for the server at the address,
+// which it connects to over HTTP/2 without TLS. Failed calls
+// return an *Error
+func NewClient(address string) Client {
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	return &client{address: address, http: &http.Client{Transport: &http.Transport{Protocols: protocols}}}
+}
+
+type client struct {
+	address string
+	http    *http.Client
+}
+
+func (client *client) Submit(ctx context.Context, request *encoding.SubmitRequest) (*encoding.SubmitResponse, error) {
+	response := &encoding.SubmitResponse{}
+	if err := client.unary(ctx, "Submit", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) Get(ctx context.Context, request *encoding.GetRequest) (*encoding.Record, error) {
+	response := &encoding.Record{}
+	if err := client.unary(ctx, "Get", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) History(ctx context.Context, request *encoding.HistoryRequest) (*encoding.HistoryResponse, error) {
+	response := &encoding.HistoryResponse{}
+	if err := client.unary(ctx, "History", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) PutChunk(ctx context.Context, request *encoding.Chunk) (*encoding.PutChunkResponse, error) {
+	response := &encoding.PutChunkResponse{}
+	if err := client.unary(ctx, "PutChunk", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) GetChunk(ctx context.Context, request *encoding.GetChunkRequest) (*encoding.Chunk, error) {
+	response := &encoding.Chunk{}
+	if err := client.unary(ctx, "GetChunk", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) PutTree(ctx context.Context, request *encoding.Tree) (*encoding.PutTreeResponse, error) {
+	response := &encoding.PutTreeResponse{}
+	if err := client.unary(ctx, "PutTree", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) GetTree(ctx context.Context, request *encoding.GetTreeRequest) (*encoding.Tree, error) {
+	response := &encoding.Tree{}
+	if err := client.unary(ctx, "GetTree", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *client) Watch(ctx context.Context, request *encoding.WatchRequest) (WatchClient, error) {
+	response, err := client.call(ctx, "Watch", request)
+	if err != nil {
+		return nil, err
+	}
+	return &watchClient{response: response}, nil
+}
+
+// unary calls the method and reads its single message
+func (client *client) unary(ctx context.Context, method string, request, response proto.Message) error {
+	httpResponse, err := client.call(ctx, method, request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	err = readMessage(httpResponse.Body, response)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	io.Copy(io.Discard, httpResponse.Body)
+
+	if statusErr := responseStatus(httpResponse); statusErr != nil {
+		return statusErr
+	}
+	if err == io.EOF {
+		return errorf(Internal, "server did not send a response")
+	}
+	return nil
+}
+
+// call sends the request message to the method
+func (client *client) call(ctx context.Context, method string, request proto.Message) (*http.Response, error) {
+	body := &bytes.Buffer{}
+	if err := writeMessage(body, request); err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, "POST", "http://"+client.address+"/"+ServiceName+"/"+method, body)
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+	httpRequest.Header.Set("Content-Type", "application/grpc")
+	httpRequest.Header.Set("Te", "trailers")
+
+	response, err := client.http.Do(httpRequest)
+	if err != nil {
+		return nil, errorf(Unavailable, "%v", err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, errorf(Internal, "server responded with HTTP status %v", response.StatusCode)
+	}
+	return response, nil
+}
+
+type watchClient struct {
+	response *http.Response
+}
+
+func (watch *watchClient) Recv() (*encoding.Record, error) {
+	recordPB := &encoding.Record{}
+	err := readMessage(watch.response.Body, recordPB)
+	if err == nil {
+		return recordPB, nil
+	}
+	watch.response.Body.Close()
+
+	if err != io.EOF {
+		return nil, err
+	}
+	if statusErr := responseStatus(watch.response); statusErr != nil {
+		return nil, statusErr
+	}
+	return nil, io.EOF
+}
+
+// responseStatus returns the *Error in the grpc-status trailer, or in
+// the headers of a response without messages, or nil if it is OK
+func responseStatus(response *http.Response) error {
+	status, message := response.Trailer.Get("Grpc-Status"), response.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = response.Header.Get("Grpc-Status"), response.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return errorf(Internal, "server did not send a grpc-status")
+	}
+
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		return errorf(Internal, "server sent an invalid grpc-status '%v'", status)
+	}
+	if Code(code) == OK {
+		return nil
+	}
+	return &Error{Code: Code(code), Message: decodeStatusMessage(message)}
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// Code is the status of a failed call. The values
+// are the same as the canonical gRPC status codes
+type Code uint32
+
+const (
+	// OK means the call succeeded
+	OK Code = 0
+
+	// InvalidArgument means the request or the record in it is invalid
+	InvalidArgument Code = 3
+
+	// NotFound means the requested record or chain does not exist
+	NotFound Code = 5
+
+	// ResourceExhausted means a rate limit or quota was exceeded
+	ResourceExhausted Code = 8
+
+	// FailedPrecondition means the parent of the record is not in
+	// the store, or that the chunks of its data are not
+	FailedPrecondition Code = 9
+
+	// Aborted means the record conflicts with the chain in the store,
+	// usually because another update was accepted first
+	Aborted Code = 10
+
+	// Unimplemented means the method or the
+	// message compression is not supported
+	Unimplemented Code = 12
+
+	// Internal means the store failed
+	Internal Code = 13
+
+	// Unavailable means the server could not be reached
+	Unavailable Code = 14
+)
+
+// Error is returned by every RecordService method that fails
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %v desc = %v", err.Code, err.Message)
+}
+
+func errorf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// admitError converts an error from the admitter to an *Error. A
+// record outside of its validity window is a FailedPrecondition,
+// since it may become valid later
+func admitError(err error) *Error {
+	switch err := err.(type) {
+	case *admission.Error:
+		if err.Kind == admission.KindValidity {
+			return errorf(FailedPrecondition, "%v", err.Message)
+		}
+		return errorf(InvalidArgument, "%v", err.Message)
+	case *limits.Error:
+		return errorf(ResourceExhausted, "%v", err.Message)
+	case *store.ConflictError:
+		return errorf(Aborted, "%v", err.Message)
+	case *store.DeltaError:
+		return errorf(InvalidArgument, "%v", err.Message)
+	case *store.ChunksError:
+		return errorf(FailedPrecondition, "%v", err.Message)
+	default:
+		return errorf(Internal, "%v", err.Error())
+	}
+}
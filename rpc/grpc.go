@@ -0,0 +1,250 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// ServiceName is the full name of the RecordService in
+// record_service.proto. Its methods are served at
+// /ServiceName/Method
+const ServiceName = "encoding.RecordService"
+
+// maxMessageSize bounds every message, the default of gRPC servers
+const maxMessageSize = 4 << 20
+
+// NewGRPCServer returns an http.Server that serves the service with
+// the gRPC protocol, over HTTP/2 without TLS, so that any gRPC
+// client can call it. Messages must not be compressed. Every Submit,
+// PutChunk and PutTree call takes a token for the client's address
+// from the limiter, unless it is nil
+func NewGRPCServer(service RecordService, limiter limits.Limiter) *http.Server {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	return &http.Server{Handler: &grpcHandler{service: service, limiter: limiter}, Protocols: protocols}
+}
+
+type grpcHandler struct {
+	service RecordService
+	limiter limits.Limiter
+}
+
+// ServeHTTP calls the method and writes its
+// status in the grpc-status and grpc-message trailers
+func (handler *grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC calls must be POSTed with the content type application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	err := handler.call(w, r)
+	writeStatus(w, err)
+}
+
+func (handler *grpcHandler) call(w http.ResponseWriter, r *http.Request) error {
+	if compression := r.Header.Get("Grpc-Encoding"); compression != "" && compression != "identity" {
+		return errorf(Unimplemented, "grpc-encoding '%v' is not supported", compression)
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/"+ServiceName+"/")
+	ctx := r.Context()
+
+	if method == "Submit" || method == "PutChunk" || method == "PutTree" {
+		if err := handler.allowPeer(r); err != nil {
+			return err
+		}
+	}
+
+	switch method {
+	case "Submit":
+		request := &encoding.SubmitRequest{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.Submit(ctx, request) })
+	case "Get":
+		request := &encoding.GetRequest{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.Get(ctx, request) })
+	case "History":
+		request := &encoding.HistoryRequest{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.History(ctx, request) })
+	case "PutChunk":
+		request := &encoding.Chunk{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.PutChunk(ctx, request) })
+	case "GetChunk":
+		request := &encoding.GetChunkRequest{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.GetChunk(ctx, request) })
+	case "PutTree":
+		request := &encoding.Tree{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.PutTree(ctx, request) })
+	case "GetTree":
+		request := &encoding.GetTreeRequest{}
+		return unary(w, r, request, func() (proto.Message, error) { return handler.service.GetTree(ctx, request) })
+	case "Watch":
+		request := &encoding.WatchRequest{}
+		if err := readRequest(r, request); err != nil {
+			return err
+		}
+		return handler.service.Watch(request, &grpcWatchStream{ctx: ctx, w: w})
+	default:
+		return errorf(Unimplemented, "unknown method '%v'", r.URL.Path)
+	}
+}
+
+// allowPeer takes a token for the address of the client,
+// before its message is read
+func (handler *grpcHandler) allowPeer(r *http.Request) error {
+	if handler.limiter == nil {
+		return nil
+	}
+
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if err := handler.limiter.AllowPeer(peer); err != nil {
+		return admitError(err)
+	}
+	return nil
+}
+
+// grpcWatchStream sends each record of a Watch call as a message
+type grpcWatchStream struct {
+	ctx context.Context
+	w   http.ResponseWriter
+}
+
+func (stream *grpcWatchStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *grpcWatchStream) Send(recordPB *encoding.Record) error {
+	return writeMessage(stream.w, recordPB)
+}
+
+// unary reads the single message of the request, calls the
+// method and writes the message it responds with
+func unary(w http.ResponseWriter, r *http.Request, request proto.Message, method func() (proto.Message, error)) error {
+	if err := readRequest(r, request); err != nil {
+		return err
+	}
+
+	response, err := method()
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, response)
+}
+
+// readRequest reads the single message of the request
+func readRequest(r *http.Request, request proto.Message) error {
+	err := readMessage(r.Body, request)
+	if err == io.EOF {
+		return errorf(InvalidArgument, "request has no message")
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// readMessage reads a length-prefixed message. It returns io.EOF
+// if the stream ends before the message starts
+func readMessage(r io.Reader, message proto.Message) error {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return errorf(InvalidArgument, "Failed to read message: %v", err.Error())
+	}
+
+	if prefix[0] != 0 {
+		return errorf(Unimplemented, "compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxMessageSize {
+		return errorf(ResourceExhausted, "message of %v bytes is larger than the limit of %v", length, maxMessageSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return errorf(InvalidArgument, "Failed to read message: %v", err.Error())
+	}
+	if err := proto.Unmarshal(data, message); err != nil {
+		return errorf(InvalidArgument, "Failed to parse message: %v", err.Error())
+	}
+	return nil
+}
+
+// writeMessage writes the message with its length prefix
+// and flushes it, so that streamed messages are sent at once
+func writeMessage(w io.Writer, message proto.Message) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return errorf(Internal, "%v", err.Error())
+	}
+
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+	if _, err := w.Write(append(prefix, data...)); err != nil {
+		return err
+	}
+
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writeStatus sets the grpc-status and grpc-message trailers
+// for the error returned by a call, which is OK if it is nil
+func writeStatus(w http.ResponseWriter, err error) {
+	code, message := OK, ""
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = errorf(Internal, "%v", err.Error())
+		}
+		code, message = rpcErr.Code, rpcErr.Message
+	}
+
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeStatusMessage(message))
+	}
+}
+
+// encodeStatusMessage percent-encodes the bytes of the
+// message that may not appear in a grpc-message header
+func encodeStatusMessage(message string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+			continue
+		}
+		encoded.WriteByte(c)
+	}
+	return encoded.String()
+}
+
+func decodeStatusMessage(message string) string {
+	decoded, err := url.PathUnescape(message)
+	if err != nil {
+		return message
+	}
+	return decoded
+}
@@ -0,0 +1,219 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/rpc"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("gRPC", func() {
+	var s store.Store
+	var server *http.Server
+	var client rpc.Client
+	var address string
+	var records []record.Record
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		s = store.New(store.NewMemoryBackend())
+		records, _ = fixtures.GenerateChain(2)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		server = rpc.NewGRPCServer(rpc.New(s, rpc.Options{}), nil)
+		go server.Serve(listener)
+
+		address = listener.Addr().String()
+		client = rpc.NewClient(address)
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+	})
+
+	Describe("Submit", func() {
+		It("should store the record and respond with its hash", func() {
+			response, err := client.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[0])})
+			Expect(err).To(BeNil())
+			Expect(response.Hash).To(Equal(fixtures.MustHash(records[0])))
+
+			_, err = s.Get(response.Hash)
+			Expect(err).To(BeNil())
+		})
+
+		Describe("with an update whose parent is unknown", func() {
+			It("should return the status", func() {
+				_, err := client.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[1])})
+				Expect(err).To(BeAssignableToTypeOf(&rpc.Error{}))
+				Expect(err.(*rpc.Error).Code).To(Equal(rpc.FailedPrecondition))
+				Expect(err.(*rpc.Error).Message).To(ContainSubstring("is not in the store"))
+			})
+		})
+	})
+
+	Describe("with a stored chain", func() {
+		var id string
+
+		BeforeEach(func() {
+			id = records[0].Metadata().ID
+			for _, rec := range records[:2] {
+				Expect(s.Put(rec)).To(Succeed())
+			}
+		})
+
+		It("should Get the head", func() {
+			head, err := client.Get(ctx, &encoding.GetRequest{Id: id})
+			Expect(err).To(BeNil())
+			Expect(head).To(Equal(mustProto(records[1])))
+		})
+
+		It("should return NotFound for an unknown ID", func() {
+			_, err := client.Get(ctx, &encoding.GetRequest{Id: "unknown"})
+			Expect(err).To(Equal(&rpc.Error{Code: rpc.NotFound, Message: "record not found"}))
+		})
+
+		It("should return the History", func() {
+			history, err := client.History(ctx, &encoding.HistoryRequest{Id: id})
+			Expect(err).To(BeNil())
+			Expect(history.Records).To(HaveLen(2))
+			Expect(history.Complete).To(BeTrue())
+		})
+
+		It("should stream the records of a Watch", func() {
+			watch, err := client.Watch(ctx, &encoding.WatchRequest{Ids: []string{id}})
+			Expect(err).To(BeNil())
+
+			head, err := watch.Recv()
+			Expect(err).To(BeNil())
+			Expect(head).To(Equal(mustProto(records[1])))
+
+			Expect(s.Put(records[2])).To(Succeed())
+			update, err := watch.Recv()
+			Expect(err).To(BeNil())
+			Expect(update).To(Equal(mustProto(records[2])))
+		})
+	})
+
+	Describe("with a record whose data is stored in chunks", func() {
+		var root, chunked record.Record
+		var manifest *chunks.Manifest
+		var leaves [][]byte
+
+		BeforeEach(func() {
+			source := store.New(store.NewMemoryBackend())
+			var privateKey *rsa.PrivateKey
+			root, privateKey = fixtures.GenerateRootRecord(record.Metadata{})
+
+			var err error
+			manifest, err = chunks.Write(source, bytes.NewReader([]byte("chunked data")), 4)
+			Expect(err).To(BeNil())
+			leaves, err = source.Tree(manifest.Root)
+			Expect(err).To(BeNil())
+
+			metadata := root.Metadata()
+			metadata.Manifest = manifest
+			chunked = fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+			Expect(s.Put(root)).To(Succeed())
+		})
+
+		It("should refuse the record before its chunks are put", func() {
+			_, err := client.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(chunked)})
+			Expect(err).To(BeAssignableToTypeOf(&rpc.Error{}))
+			Expect(err.(*rpc.Error).Code).To(Equal(rpc.FailedPrecondition))
+		})
+
+		It("should accept the record once its chunks and tree are put", func() {
+			for _, chunk := range [][]byte{[]byte("chun"), []byte("ked "), []byte("data")} {
+				response, err := client.PutChunk(ctx, &encoding.Chunk{Data: chunk})
+				Expect(err).To(BeNil())
+				Expect(response.Hash).To(Equal(chunks.LeafHash(chunk)))
+			}
+			tree, err := client.PutTree(ctx, &encoding.Tree{Leaves: leaves})
+			Expect(err).To(BeNil())
+			Expect(tree.Root).To(Equal(manifest.Root))
+
+			_, err = client.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(chunked)})
+			Expect(err).To(BeNil())
+
+			stored, err := client.GetTree(ctx, &encoding.GetTreeRequest{Root: manifest.Root})
+			Expect(err).To(BeNil())
+			Expect(stored.Leaves).To(Equal(leaves))
+
+			chunk, err := client.GetChunk(ctx, &encoding.GetChunkRequest{Hash: leaves[1]})
+			Expect(err).To(BeNil())
+			Expect(chunk.Data).To(Equal([]byte("ked ")))
+		})
+	})
+
+	Describe("with a per-peer limit", func() {
+		BeforeEach(func() {
+			server.Close()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			limiter := limits.New(s, limits.Config{PerPeer: limits.Rate{PerSecond: 0.001, Burst: 1}})
+			server = rpc.NewGRPCServer(rpc.New(s, rpc.Options{}), limiter)
+			go server.Serve(listener)
+
+			address = listener.Addr().String()
+			client = rpc.NewClient(address)
+		})
+
+		It("should refuse calls past the limit of the client's address", func() {
+			_, err := client.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[0])})
+			Expect(err).To(BeNil())
+
+			_, err = client.PutChunk(ctx, &encoding.Chunk{Data: []byte("chunk")})
+			Expect(err).To(BeAssignableToTypeOf(&rpc.Error{}))
+			Expect(err.(*rpc.Error).Code).To(Equal(rpc.ResourceExhausted))
+		})
+
+		It("should not limit reads", func() {
+			_, err := client.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[0])})
+			Expect(err).To(BeNil())
+
+			_, err = client.Get(ctx, &encoding.GetRequest{Id: records[0].Metadata().ID})
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("with an unknown method", func() {
+		It("should return Unimplemented", func() {
+			response, err := http.Post("http://"+address+"/"+rpc.ServiceName+"/Delete", "application/grpc", nil)
+			Expect(err).To(BeNil())
+			_, err = ioutil.ReadAll(response.Body)
+			Expect(err).To(BeNil())
+			response.Body.Close()
+
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(response.Trailer.Get("Grpc-Status")).To(Equal("12"))
+		})
+	})
+
+	Describe("with a request that isn't gRPC", func() {
+		It("should be refused", func() {
+			response, err := http.Get("http://" + address + "/" + rpc.ServiceName + "/Get")
+			Expect(err).To(BeNil())
+			response.Body.Close()
+			Expect(response.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+		})
+	})
+})
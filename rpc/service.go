@@ -0,0 +1,312 @@
+// Package rpc implements the RecordService defined in
+// record/encoding/record_service.proto on top of a store.
+//
+// NewGRPCServer serves a RecordService with the gRPC protocol, so
+// that it can be called by any gRPC client, and NewClient calls it.
+// Both speak the protocol over net/http's HTTP/2 support, so the
+// package does not depend on a gRPC library. An *Error returned by a
+// method is sent as the status with the same Code
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// RecordService is the server side of the RecordService
+// defined in record_service.proto
+type RecordService interface {
+	// Submit verifies the record and stores it. An update
+	// record's parent must already be in the store
+	Submit(ctx context.Context, request *encoding.SubmitRequest) (*encoding.SubmitResponse, error)
+
+	// Get returns the record with the given hash if one is
+	// set, otherwise the head of the chain for the ID
+	Get(ctx context.Context, request *encoding.GetRequest) (*encoding.Record, error)
+
+	// History returns every stored record of the chain, oldest first
+	History(ctx context.Context, request *encoding.HistoryRequest) (*encoding.HistoryResponse, error)
+
+	// Watch sends the current head of each ID, followed by every
+	// record added to their chains, until the stream's context is
+	// done. Without IDs, every record added to any chain is sent
+	Watch(request *encoding.WatchRequest, stream WatchStream) error
+
+	// PutChunk stores a chunk of data and returns its hash. The
+	// chunks and the tree described by a record's metadata.Manifest
+	// must be put before the record is submitted
+	PutChunk(ctx context.Context, request *encoding.Chunk) (*encoding.PutChunkResponse, error)
+
+	// GetChunk returns the chunk with the hash
+	GetChunk(ctx context.Context, request *encoding.GetChunkRequest) (*encoding.Chunk, error)
+
+	// PutTree stores the leaves of a tree and returns its root
+	PutTree(ctx context.Context, request *encoding.Tree) (*encoding.PutTreeResponse, error)
+
+	// GetTree returns the leaves of the tree with the root
+	GetTree(ctx context.Context, request *encoding.GetTreeRequest) (*encoding.Tree, error)
+}
+
+// WatchStream is the server side of a Watch call
+type WatchStream interface {
+	Context() context.Context
+	Send(*encoding.Record) error
+}
+
+// New constructs a RecordService backed by the store
+func New(s store.Store, options Options) RecordService {
+	admitter := options.Admitter
+	if admitter == nil {
+		admitter = admission.New(s, admission.Options{
+			Limiter:   options.Limiter,
+			Validator: options.Validator,
+			Validity:  options.Validity,
+		})
+	}
+	return &service{store: s, admitter: admitter}
+}
+
+// Validator checks the full data of a record against its content
+// type and schema. A schema.Registry satisfies it
+type Validator interface {
+	Validate(rec record.Record, data io.Reader) error
+}
+
+// Options configures a RecordService
+type Options struct {
+	// Limiter limits submitted records by signing key, metadata.ID
+	// and quota. Limiting by peer is left to the transport, which
+	// knows the peer's address, see NewGRPCServer. Submissions are
+	// unlimited if it is nil
+	Limiter limits.Limiter
+
+	// Validator rejects submitted records whose data doesn't
+	// match their content type or schema. The data of
+	// records is not checked if it is nil
+	Validator Validator
+
+	// Validity rejects submitted records that are not yet valid
+	// or have expired. The zero value checks them against
+	// time.Now without any skew
+	Validity record.Validity
+
+	// Admitter, if set, checks and stores submitted records
+	// in place of Limiter, Validator and Validity
+	Admitter admission.Admitter
+}
+
+type service struct {
+	store    store.Store
+	admitter admission.Admitter
+}
+
+// Submit verifies the record and stores it
+func (service *service) Submit(ctx context.Context, request *encoding.SubmitRequest) (*encoding.SubmitResponse, error) {
+	recordPB := request.GetRecord()
+	if recordPB == nil {
+		return nil, errorf(InvalidArgument, "record is required")
+	}
+
+	var parent record.Record
+	if len(recordPB.Parent) != 0 {
+		var err error
+		parent, err = service.store.Get(recordPB.Parent)
+		if err == store.ErrNotFound {
+			return nil, errorf(FailedPrecondition, "parent '%v' is not in the store", hex.EncodeToString(recordPB.Parent))
+		}
+		if err != nil {
+			return nil, errorf(Internal, "%v", err.Error())
+		}
+	}
+
+	rec, err := record.FromProto(recordPB, parent)
+	if err != nil {
+		return nil, errorf(InvalidArgument, "%v", err.Error())
+	}
+
+	if err := service.admitter.Admit(rec, parent); err != nil {
+		return nil, admitError(err)
+	}
+
+	hash, err := rec.Hash()
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+	return &encoding.SubmitResponse{Hash: hash}, nil
+}
+
+// Get returns the record with the hash, or the head of the chain for the ID
+func (service *service) Get(ctx context.Context, request *encoding.GetRequest) (*encoding.Record, error) {
+	var rec record.Record
+	var err error
+
+	switch {
+	case len(request.GetHash()) != 0:
+		rec, err = service.store.Get(request.Hash)
+	case request.GetId() != "":
+		rec, err = service.store.Head(request.Id)
+	default:
+		return nil, errorf(InvalidArgument, "either id or hash is required")
+	}
+
+	if err == store.ErrNotFound {
+		return nil, errorf(NotFound, "record not found")
+	}
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+
+	return recordProto(rec)
+}
+
+// History returns every stored record of the chain, oldest first
+func (service *service) History(ctx context.Context, request *encoding.HistoryRequest) (*encoding.HistoryResponse, error) {
+	chain, err := service.store.Chain(request.GetId())
+	if err == store.ErrNotFound {
+		return nil, errorf(NotFound, "no chain exists for metadata.ID '%v'", request.GetId())
+	}
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+
+	response := &encoding.HistoryResponse{Id: chain.ID(), Complete: chain.Complete()}
+	for _, rec := range chain.Records() {
+		recordPB, err := recordProto(rec)
+		if err != nil {
+			return nil, err
+		}
+		response.Records = append(response.Records, recordPB)
+	}
+	return response, nil
+}
+
+// Watch sends the heads of the IDs, then subscribes to the store
+func (service *service) Watch(request *encoding.WatchRequest, stream WatchStream) error {
+	cursor, err := service.store.Cursor()
+	if err != nil {
+		return errorf(Internal, "%v", err.Error())
+	}
+
+	// sent holds the hash of the head that was sent for each ID, so
+	// that a head that was stored after the cursor isn't sent twice
+	sent := make(map[string][]byte)
+
+	for _, id := range request.GetIds() {
+		head, err := service.store.Head(id)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return errorf(Internal, "%v", err.Error())
+		}
+
+		if err := sendRecord(stream, head); err != nil {
+			return err
+		}
+		if sent[id], err = head.Hash(); err != nil {
+			return errorf(Internal, "%v", err.Error())
+		}
+	}
+
+	subscription := service.store.Subscribe(request.GetIds(), cursor)
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change, ok := <-subscription.Changes():
+			if !ok {
+				return errorf(Internal, "%v", subscription.Err())
+			}
+
+			if head, ok := sent[change.ID]; ok {
+				delete(sent, change.ID)
+
+				hash, err := change.Record.Hash()
+				if err != nil {
+					return errorf(Internal, "%v", err.Error())
+				}
+				if bytes.Equal(hash, head) {
+					continue
+				}
+			}
+
+			if err := sendRecord(stream, change.Record); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PutChunk stores the chunk under its hash
+func (service *service) PutChunk(ctx context.Context, request *encoding.Chunk) (*encoding.PutChunkResponse, error) {
+	hash, err := service.store.PutChunk(request.GetData())
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+	return &encoding.PutChunkResponse{Hash: hash}, nil
+}
+
+// GetChunk returns the chunk with the hash
+func (service *service) GetChunk(ctx context.Context, request *encoding.GetChunkRequest) (*encoding.Chunk, error) {
+	chunk, err := service.store.Chunk(request.GetHash())
+	if err == store.ErrNotFound {
+		return nil, errorf(NotFound, "chunk not found")
+	}
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+	return &encoding.Chunk{Data: chunk}, nil
+}
+
+// PutTree stores the leaves under the root they hash to
+func (service *service) PutTree(ctx context.Context, request *encoding.Tree) (*encoding.PutTreeResponse, error) {
+	leaves := request.GetLeaves()
+	if len(leaves) == 0 {
+		return nil, errorf(InvalidArgument, "leaves are required")
+	}
+
+	root := chunks.Root(leaves)
+	if err := service.store.PutTree(root, leaves); err != nil {
+		return nil, errorf(InvalidArgument, "%v", err.Error())
+	}
+	return &encoding.PutTreeResponse{Root: root}, nil
+}
+
+// GetTree returns the leaves of the tree with the root
+func (service *service) GetTree(ctx context.Context, request *encoding.GetTreeRequest) (*encoding.Tree, error) {
+	leaves, err := service.store.Tree(request.GetRoot())
+	if err == store.ErrNotFound {
+		return nil, errorf(NotFound, "tree not found")
+	}
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+	return &encoding.Tree{Leaves: leaves}, nil
+}
+
+func sendRecord(stream WatchStream, rec record.Record) error {
+	recordPB, err := recordProto(rec)
+	if err != nil {
+		return err
+	}
+	return stream.Send(recordPB)
+}
+
+func recordProto(rec record.Record) (*encoding.Record, error) {
+	recordPB, err := rec.Proto()
+	if err != nil {
+		return nil, errorf(Internal, "%v", err.Error())
+	}
+	return recordPB, nil
+}
@@ -0,0 +1,321 @@
+package rpc_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/delta"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+	"github.com/royvandewater/meshchain/rpc"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeWatchStream struct {
+	ctx     context.Context
+	records chan *encoding.Record
+}
+
+func (stream *fakeWatchStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *fakeWatchStream) Send(recordPB *encoding.Record) error {
+	stream.records <- recordPB
+	return nil
+}
+
+func mustProto(rec record.Record) *encoding.Record {
+	recordPB, err := rec.Proto()
+	Expect(err).To(BeNil())
+	return recordPB
+}
+
+func errorCode(err error) rpc.Code {
+	Expect(err).To(BeAssignableToTypeOf(&rpc.Error{}))
+	return err.(*rpc.Error).Code
+}
+
+// rejectingValidator rejects the data of every record
+type rejectingValidator struct{}
+
+func (validator *rejectingValidator) Validate(rec record.Record, data io.Reader) error {
+	return fmt.Errorf("data at '/' must be of type 'object'")
+}
+
+// rejectingAdmitter rejects every record
+type rejectingAdmitter struct{}
+
+func (rejectingAdmitter) Admit(rec, parent record.Record) error {
+	return &admission.Error{Kind: admission.KindData, Message: "rejected"}
+}
+
+func (rejectingAdmitter) AdmitFrom(rec, parent record.Record, src chunks.Source) error {
+	return &admission.Error{Kind: admission.KindData, Message: "rejected"}
+}
+
+func (rejectingAdmitter) AdmitAncestor(rec, parent record.Record, src chunks.Source) error {
+	return &admission.Error{Kind: admission.KindData, Message: "rejected"}
+}
+
+var _ = Describe("RecordService", func() {
+	var sut rpc.RecordService
+	var s store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		s = store.New(store.NewMemoryBackend())
+		sut = rpc.New(s, rpc.Options{})
+		records, privateKey = fixtures.GenerateChain(2)
+	})
+
+	Describe("Submit", func() {
+		Describe("with a root record followed by its updates", func() {
+			var response *encoding.SubmitResponse
+
+			BeforeEach(func() {
+				var err error
+				for _, rec := range records {
+					response, err = sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(rec)})
+					Expect(err).To(BeNil())
+				}
+			})
+
+			It("should respond with the hash of the record", func() {
+				hash, err := records[2].Hash()
+				Expect(err).To(BeNil())
+				Expect(response.Hash).To(Equal(hash))
+			})
+
+			It("should store the records", func() {
+				head, err := s.Head(records[0].Metadata().ID)
+				Expect(err).To(BeNil())
+				Expect(head.Data()).To(Equal(records[2].Data()))
+			})
+		})
+
+		Describe("without a record", func() {
+			It("should return InvalidArgument", func() {
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{})
+				Expect(errorCode(err)).To(Equal(rpc.InvalidArgument))
+			})
+		})
+
+		Describe("with a tampered record", func() {
+			It("should return InvalidArgument", func() {
+				recordPB := mustProto(records[0])
+				recordPB.Data = []byte(`tampered`)
+
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: recordPB})
+				Expect(errorCode(err)).To(Equal(rpc.InvalidArgument))
+			})
+		})
+
+		Describe("with an Admitter", func() {
+			BeforeEach(func() {
+				sut = rpc.New(s, rpc.Options{Admitter: rejectingAdmitter{}})
+			})
+
+			It("should submit the record through it", func() {
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[0])})
+				Expect(err).To(Equal(&rpc.Error{Code: rpc.InvalidArgument, Message: "rejected"}))
+				Expect(s.IDs()).To(BeEmpty())
+			})
+		})
+
+		Describe("with data rejected by the validator", func() {
+			BeforeEach(func() {
+				sut = rpc.New(s, rpc.Options{Validator: &rejectingValidator{}})
+			})
+
+			It("should return InvalidArgument without storing the record", func() {
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[0])})
+				Expect(errorCode(err)).To(Equal(rpc.InvalidArgument))
+				Expect(err.(*rpc.Error).Message).To(Equal("data at '/' must be of type 'object'"))
+
+				_, err = s.Head(records[0].Metadata().ID)
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+
+		Describe("with a record that is not valid yet", func() {
+			It("should return FailedPrecondition without storing the record", func() {
+				now := time.Now()
+				early := fixtures.GenerateRootRecordWithin(now.Add(time.Hour), now.Add(2*time.Hour))
+
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(early)})
+				Expect(errorCode(err)).To(Equal(rpc.FailedPrecondition))
+				Expect(err.(*rpc.Error).Message).To(HavePrefix("record is not valid before"))
+
+				_, err = s.Head(early.Metadata().ID)
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+
+		Describe("with an update whose parent is unknown", func() {
+			It("should return FailedPrecondition", func() {
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(records[1])})
+				Expect(errorCode(err)).To(Equal(rpc.FailedPrecondition))
+			})
+		})
+
+		Describe("with an update whose parent is not the head", func() {
+			It("should return Aborted", func() {
+				Expect(s.Put(records[0])).To(Succeed())
+				Expect(s.Put(records[1])).To(Succeed())
+
+				fork := fixtures.GenerateUpdateRecord(records[0], privateKey, "fork")
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(fork)})
+				Expect(errorCode(err)).To(Equal(rpc.Aborted))
+			})
+		})
+
+		Describe("with a delta that does not apply to the parent", func() {
+			It("should return InvalidArgument without storing the record", func() {
+				Expect(s.Put(records[0])).To(Succeed())
+				Expect(s.Put(records[1])).To(Succeed())
+
+				update := fixtures.GenerateDeltaUpdate(records[1], privateKey, delta.JSONPatch, []byte(`[]`))
+				_, err := sut.Submit(ctx, &encoding.SubmitRequest{Record: mustProto(update)})
+				Expect(errorCode(err)).To(Equal(rpc.InvalidArgument))
+				Expect(err.(*rpc.Error).Message).To(HavePrefix("json-patch delta of version '2' does not apply to its parent"))
+
+				Expect(s.Head(records[0].Metadata().ID)).To(Equal(records[1]))
+			})
+		})
+	})
+
+	Describe("with a stored chain", func() {
+		var id string
+
+		BeforeEach(func() {
+			id = records[0].Metadata().ID
+			for _, rec := range records {
+				Expect(s.Put(rec)).To(Succeed())
+			}
+		})
+
+		Describe("Get", func() {
+			It("should return the head for an ID", func() {
+				recordPB, err := sut.Get(ctx, &encoding.GetRequest{Id: id})
+				Expect(err).To(BeNil())
+				Expect(recordPB).To(Equal(mustProto(records[2])))
+			})
+
+			It("should return the record for a hash", func() {
+				hash, err := records[1].Hash()
+				Expect(err).To(BeNil())
+
+				recordPB, err := sut.Get(ctx, &encoding.GetRequest{Hash: hash})
+				Expect(err).To(BeNil())
+				Expect(recordPB).To(Equal(mustProto(records[1])))
+			})
+
+			It("should return NotFound for an unknown ID", func() {
+				_, err := sut.Get(ctx, &encoding.GetRequest{Id: "unknown"})
+				Expect(errorCode(err)).To(Equal(rpc.NotFound))
+			})
+
+			It("should return InvalidArgument for an empty request", func() {
+				_, err := sut.Get(ctx, &encoding.GetRequest{})
+				Expect(errorCode(err)).To(Equal(rpc.InvalidArgument))
+			})
+		})
+
+		Describe("History", func() {
+			It("should return every record", func() {
+				response, err := sut.History(ctx, &encoding.HistoryRequest{Id: id})
+				Expect(err).To(BeNil())
+				Expect(response.Id).To(Equal(id))
+				Expect(response.Complete).To(BeTrue())
+				Expect(response.Records).To(Equal([]*encoding.Record{
+					mustProto(records[0]),
+					mustProto(records[1]),
+					mustProto(records[2]),
+				}))
+			})
+
+			It("should return NotFound for an unknown ID", func() {
+				_, err := sut.History(ctx, &encoding.HistoryRequest{Id: "unknown"})
+				Expect(errorCode(err)).To(Equal(rpc.NotFound))
+			})
+		})
+
+		Describe("Watch", func() {
+			var stream *fakeWatchStream
+			var cancel context.CancelFunc
+			var done chan error
+
+			BeforeEach(func() {
+				var streamCtx context.Context
+				streamCtx, cancel = context.WithCancel(ctx)
+				stream = &fakeWatchStream{ctx: streamCtx, records: make(chan *encoding.Record, 10)}
+				done = make(chan error, 1)
+
+				go func() {
+					done <- sut.Watch(&encoding.WatchRequest{Ids: []string{id}}, stream)
+				}()
+			})
+
+			AfterEach(func() {
+				cancel()
+				Eventually(done).Should(Receive(BeNil()))
+			})
+
+			It("should send the current head", func() {
+				Eventually(stream.records).Should(Receive(Equal(mustProto(records[2]))))
+			})
+
+			It("should send every update that is added", func() {
+				Eventually(stream.records).Should(Receive(Equal(mustProto(records[2]))))
+
+				update1 := fixtures.GenerateUpdateRecord(records[2], privateKey, "update-1")
+				update2 := fixtures.GenerateUpdateRecord(update1, privateKey, "update-2")
+				Expect(s.Put(update1)).To(Succeed())
+				Expect(s.Put(update2)).To(Succeed())
+
+				Eventually(stream.records).Should(Receive(Equal(mustProto(update1))))
+				Eventually(stream.records).Should(Receive(Equal(mustProto(update2))))
+				Consistently(stream.records, 50*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+
+		Describe("Watch without IDs", func() {
+			var stream *fakeWatchStream
+			var cancel context.CancelFunc
+
+			BeforeEach(func() {
+				var streamCtx context.Context
+				streamCtx, cancel = context.WithCancel(ctx)
+				stream = &fakeWatchStream{ctx: streamCtx, records: make(chan *encoding.Record, 10)}
+				go sut.Watch(&encoding.WatchRequest{}, stream)
+			})
+
+			AfterEach(func() {
+				cancel()
+			})
+
+			It("should send records added to any chain", func() {
+				// records are only sent once the watch has subscribed,
+				// so keep adding chains until one comes through
+				Eventually(func() int {
+					other, _ := fixtures.GenerateChain(0)
+					Expect(s.Put(other[0])).To(Succeed())
+					return len(stream.records)
+				}).ShouldNot(BeZero())
+			})
+		})
+	})
+})
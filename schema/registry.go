@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record"
+)
+
+// Registry holds the schemas a node validates records against
+type Registry interface {
+	// Register compiles the schema and makes it available to
+	// records whose metadata.Schema is ref. It replaces any
+	// schema previously registered under ref
+	Register(ref string, schemaJSON []byte) error
+
+	// Validate checks the full data of the record against its
+	// content type and schema. It is passed separately since the
+	// record's own data may be a delta or stored in chunks. Data with
+	// a JSON content type must be valid JSON, and a record with a
+	// schema must have a JSON content type and data that conforms to
+	// the schema, which must be registered. Data of other content
+	// types isn't read
+	Validate(rec record.Record, data io.Reader) error
+}
+
+// NewRegistry constructs an empty Registry
+func NewRegistry() Registry {
+	return &registry{schemas: make(map[string]*schema)}
+}
+
+// Load constructs a Registry with the schema files,
+// which are keyed by the ref to register them under
+func Load(files map[string]string) (Registry, error) {
+	registry := NewRegistry()
+	for ref, path := range files {
+		schemaJSON, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read schema '%v': %v", ref, err.Error())
+		}
+		if err := registry.Register(ref, schemaJSON); err != nil {
+			return nil, fmt.Errorf("schema '%v' in '%v' is invalid: %v", ref, path, err.Error())
+		}
+	}
+	return registry, nil
+}
+
+type registry struct {
+	lock    sync.RWMutex
+	schemas map[string]*schema
+}
+
+func (registry *registry) Register(ref string, schemaJSON []byte) error {
+	if ref == "" {
+		return fmt.Errorf("ref is required")
+	}
+
+	compiled, err := compile(schemaJSON)
+	if err != nil {
+		return err
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.schemas[ref] = compiled
+	return nil
+}
+
+func (registry *registry) Validate(rec record.Record, data io.Reader) error {
+	metadata := rec.Metadata()
+	isJSON := record.IsJSONContentType(metadata.ContentType)
+
+	if metadata.Schema == "" {
+		if isJSON {
+			if _, err := decode(data); err != nil {
+				return fmt.Errorf("data is not valid JSON: %v", err.Error())
+			}
+		}
+		return nil
+	}
+
+	if !isJSON {
+		return fmt.Errorf("metadata.Schema requires a JSON metadata.ContentType, not '%v'", metadata.ContentType)
+	}
+
+	registry.lock.RLock()
+	compiled, ok := registry.schemas[metadata.Schema]
+	registry.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("schema '%v' is not registered", metadata.Schema)
+	}
+	return compiled.validateReader(data)
+}
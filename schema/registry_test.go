@@ -0,0 +1,103 @@
+package schema_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/schema"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var sut schema.Registry
+
+	BeforeEach(func() {
+		sut = schema.NewRegistry()
+		Expect(sut.Register("person/v1", []byte(`{"type": "object", "required": ["name"]}`))).To(Succeed())
+	})
+
+	It("should reject invalid schemas", func() {
+		Expect(sut.Register("broken", []byte(`{"type": 1}`))).To(MatchError("'#/type' contains unknown type '1'"))
+	})
+
+	Describe("Validate", func() {
+		// validate validates the record with its own data
+		validate := func(rec record.Record) error {
+			return sut.Validate(rec, bytes.NewReader(rec.Data()))
+		}
+
+		It("should accept records without a content type", func() {
+			Expect(validate(generateRecord("", "", "not json"))).To(Succeed())
+		})
+
+		It("should accept records with other content types", func() {
+			Expect(validate(generateRecord("text/plain", "", "not json"))).To(Succeed())
+		})
+
+		It("should reject invalid JSON with a JSON content type", func() {
+			err := validate(generateRecord("application/json; charset=utf-8", "", "not json"))
+			Expect(err).To(MatchError(ContainSubstring("data is not valid JSON")))
+		})
+
+		It("should accept data that conforms to the schema", func() {
+			Expect(validate(generateRecord("application/json", "person/v1", `{"name": "roy"}`))).To(Succeed())
+		})
+
+		It("should accept structured syntax suffixes", func() {
+			Expect(validate(generateRecord("application/person+json", "person/v1", `{"name": "roy"}`))).To(Succeed())
+		})
+
+		It("should reject data that doesn't conform to the schema", func() {
+			err := validate(generateRecord("application/json", "person/v1", `{}`))
+			Expect(err).To(MatchError("data at '/' is missing required property 'name'"))
+		})
+
+		It("should reject a schema without a JSON content type", func() {
+			err := validate(generateRecord("text/plain", "person/v1", `{"name": "roy"}`))
+			Expect(err).To(MatchError("metadata.Schema requires a JSON metadata.ContentType, not 'text/plain'"))
+		})
+
+		It("should reject unregistered schemas", func() {
+			err := validate(generateRecord("application/json", "person/v2", `{"name": "roy"}`))
+			Expect(err).To(MatchError("schema 'person/v2' is not registered"))
+		})
+
+		It("should validate the data it is given rather than the record's", func() {
+			rec := generateRecord("application/json", "person/v1", `{"name": "roy"}`)
+			Expect(sut.Validate(rec, strings.NewReader(`{}`))).To(MatchError("data at '/' is missing required property 'name'"))
+		})
+	})
+
+	Describe("Load", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "schema-test")
+			Expect(err).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "person.json"), []byte(`{"required": ["name"]}`), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should register each file", func() {
+			registry, err := schema.Load(map[string]string{"person/v1": filepath.Join(dir, "person.json")})
+			Expect(err).To(BeNil())
+			rec := generateRecord("application/json", "person/v1", `{}`)
+			Expect(registry.Validate(rec, bytes.NewReader(rec.Data()))).To(HaveOccurred())
+		})
+
+		It("should fail on missing files", func() {
+			_, err := schema.Load(map[string]string{"person/v1": filepath.Join(dir, "missing.json")})
+			Expect(err).To(MatchError(ContainSubstring("Failed to read schema 'person/v1'")))
+		})
+	})
+})
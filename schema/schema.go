@@ -0,0 +1,593 @@
+// Package schema validates the data of records against JSON Schemas.
+// A record opts in by setting metadata.Schema to the reference a
+// schema was registered under, and metadata.ContentType to a JSON
+// content type. Nodes validate the records they accept from clients,
+// so every record of a chain with a schema conforms to it.
+//
+// Only the validation keywords are supported: type, enum, const,
+// properties, required, additionalProperties, patternProperties,
+// items, minItems, maxItems, uniqueItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, minProperties, maxProperties, allOf, anyOf, oneOf,
+// not and $ref to definitions within the same schema. Other
+// keywords, such as format, are ignored
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema
+type Schema interface {
+	// Validate returns an error describing the first
+	// place where the JSON document does not conform
+	Validate(document []byte) error
+}
+
+// Compile parses and checks a JSON Schema
+func Compile(schemaJSON []byte) (Schema, error) {
+	return compile(schemaJSON)
+}
+
+func compile(schemaJSON []byte) (*schema, error) {
+	root, err := decode(bytes.NewReader(schemaJSON))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse schema: %v", err.Error())
+	}
+
+	compiled := &schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := compiled.check(root, "#"); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+type schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+func (compiled *schema) Validate(document []byte) error {
+	return compiled.validateReader(bytes.NewReader(document))
+}
+
+// validateReader validates the JSON document read from r
+func (compiled *schema) validateReader(r io.Reader) error {
+	value, err := decode(r)
+	if err != nil {
+		return fmt.Errorf("data is not valid JSON: %v", err.Error())
+	}
+	return compiled.validate(compiled.root, value, "")
+}
+
+// decode parses JSON keeping numbers as json.Number,
+// so that large integers don't lose precision
+func decode(r io.Reader) (interface{}, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// check ensures that every keyword of the schema at path has a
+// value of the right type, and compiles the patterns it uses
+func (compiled *schema) check(node interface{}, path string) error {
+	if _, ok := node.(bool); ok {
+		return nil
+	}
+	keywords, ok := node.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("schema at '%v' must be an object or a boolean", path)
+	}
+
+	for _, keyword := range sortedKeys(keywords) {
+		value := keywords[keyword]
+		keywordPath := path + "/" + keyword
+
+		var err error
+		switch keyword {
+		case "type":
+			err = checkTypes(value, keywordPath)
+		case "enum":
+			if _, ok := value.([]interface{}); !ok {
+				err = fmt.Errorf("'%v' must be an array", keywordPath)
+			}
+		case "required":
+			err = checkStrings(value, keywordPath)
+		case "properties", "patternProperties", "definitions", "$defs":
+			err = compiled.checkSchemaMap(keyword, value, keywordPath)
+		case "additionalProperties", "not":
+			err = compiled.check(value, keywordPath)
+		case "items":
+			if items, ok := value.([]interface{}); ok {
+				err = compiled.checkSchemaList(items, keywordPath)
+			} else {
+				err = compiled.check(value, keywordPath)
+			}
+		case "allOf", "anyOf", "oneOf":
+			items, ok := value.([]interface{})
+			if !ok || len(items) == 0 {
+				err = fmt.Errorf("'%v' must be a non-empty array", keywordPath)
+			} else {
+				err = compiled.checkSchemaList(items, keywordPath)
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := value.(json.Number); !ok {
+				err = fmt.Errorf("'%v' must be a number", keywordPath)
+			}
+		case "multipleOf":
+			if number, ok := value.(json.Number); !ok || toFloat(number) <= 0 {
+				err = fmt.Errorf("'%v' must be a number greater than 0", keywordPath)
+			}
+		case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			if number, ok := value.(json.Number); !ok || !isInteger(number) || toFloat(number) < 0 {
+				err = fmt.Errorf("'%v' must be a non-negative integer", keywordPath)
+			}
+		case "uniqueItems":
+			if _, ok := value.(bool); !ok {
+				err = fmt.Errorf("'%v' must be a boolean", keywordPath)
+			}
+		case "pattern":
+			err = compiled.compilePattern(value, keywordPath)
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("'%v' must be a string", keywordPath)
+			} else if _, refErr := compiled.resolve(ref); refErr != nil {
+				err = fmt.Errorf("'%v' is invalid: %v", keywordPath, refErr.Error())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (compiled *schema) checkSchemaMap(keyword string, value interface{}, path string) error {
+	schemas, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("'%v' must be an object", path)
+	}
+	for _, key := range sortedKeys(schemas) {
+		if keyword == "patternProperties" {
+			if err := compiled.compilePattern(key, path); err != nil {
+				return err
+			}
+		}
+		if err := compiled.check(schemas[key], path+"/"+escapePointer(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (compiled *schema) checkSchemaList(schemas []interface{}, path string) error {
+	for i, item := range schemas {
+		if err := compiled.check(item, fmt.Sprintf("%v/%v", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (compiled *schema) compilePattern(value interface{}, path string) error {
+	pattern, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("'%v' must be a string", path)
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("pattern '%v' at '%v' is invalid: %v", pattern, path, err.Error())
+	}
+	compiled.patterns[pattern] = expression
+	return nil
+}
+
+func checkTypes(value interface{}, path string) error {
+	types, ok := value.([]interface{})
+	if !ok {
+		types = []interface{}{value}
+	}
+	for _, typeName := range types {
+		switch typeName {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return fmt.Errorf("'%v' contains unknown type '%v'", path, typeName)
+		}
+	}
+	return nil
+}
+
+func checkStrings(value interface{}, path string) error {
+	items, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("'%v' must be an array of strings", path)
+	}
+	for _, item := range items {
+		if _, ok := item.(string); !ok {
+			return fmt.Errorf("'%v' must be an array of strings", path)
+		}
+	}
+	return nil
+}
+
+// resolve finds the schema a $ref points to. Only references
+// to the root or to a JSON pointer within it are supported
+func (compiled *schema) resolve(ref string) (interface{}, error) {
+	if ref == "#" {
+		return compiled.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only references within the schema, such as '#/definitions/name', are supported")
+	}
+
+	node := compiled.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch current := node.(type) {
+		case map[string]interface{}:
+			next, ok := current[token]
+			if !ok {
+				return nil, fmt.Errorf("'%v' does not exist", ref)
+			}
+			node = next
+		case []interface{}:
+			index, err := json.Number(token).Int64()
+			if err != nil || index < 0 || int(index) >= len(current) {
+				return nil, fmt.Errorf("'%v' does not exist", ref)
+			}
+			node = current[index]
+		default:
+			return nil, fmt.Errorf("'%v' does not exist", ref)
+		}
+	}
+	return node, nil
+}
+
+// validate validates the value at path, a JSON pointer
+// into the document, against the schema node
+func (compiled *schema) validate(node, value interface{}, path string) error {
+	if allowed, ok := node.(bool); ok {
+		if !allowed {
+			return invalid(path, "is not allowed")
+		}
+		return nil
+	}
+	keywords := node.(map[string]interface{})
+
+	if ref, ok := keywords["$ref"].(string); ok {
+		target, err := compiled.resolve(ref)
+		if err != nil {
+			return err
+		}
+		if err := compiled.validate(target, value, path); err != nil {
+			return err
+		}
+	}
+
+	if types, ok := keywords["type"]; ok && !matchesType(types, value) {
+		return invalid(path, "must be of type %v", describeTypes(types))
+	}
+	if enum, ok := keywords["enum"].([]interface{}); ok && !containsEqual(enum, value) {
+		return invalid(path, "must be one of %v", encode(enum))
+	}
+	if constant, ok := keywords["const"]; ok && !equal(constant, value) {
+		return invalid(path, "must be %v", encode(constant))
+	}
+
+	var err error
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		err = compiled.validateObject(keywords, typed, path)
+	case []interface{}:
+		err = compiled.validateArray(keywords, typed, path)
+	case string:
+		err = compiled.validateString(keywords, typed, path)
+	case json.Number:
+		err = validateNumber(keywords, typed, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return compiled.validateCombinators(keywords, value, path)
+}
+
+func (compiled *schema) validateObject(keywords map[string]interface{}, object map[string]interface{}, path string) error {
+	if required, ok := keywords["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return invalid(path, "is missing required property '%v'", name)
+			}
+		}
+	}
+	if minimum, ok := keywords["minProperties"].(json.Number); ok && float64(len(object)) < toFloat(minimum) {
+		return invalid(path, "must have at least %v properties", minimum)
+	}
+	if maximum, ok := keywords["maxProperties"].(json.Number); ok && float64(len(object)) > toFloat(maximum) {
+		return invalid(path, "must have at most %v properties", maximum)
+	}
+
+	properties, _ := keywords["properties"].(map[string]interface{})
+	patternProperties, _ := keywords["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := keywords["additionalProperties"]
+
+	for _, name := range sortedKeys(object) {
+		propertyPath := path + "/" + escapePointer(name)
+		matched := false
+
+		if propertySchema, ok := properties[name]; ok {
+			matched = true
+			if err := compiled.validate(propertySchema, object[name], propertyPath); err != nil {
+				return err
+			}
+		}
+		for _, pattern := range sortedKeys(patternProperties) {
+			if !compiled.patterns[pattern].MatchString(name) {
+				continue
+			}
+			matched = true
+			if err := compiled.validate(patternProperties[pattern], object[name], propertyPath); err != nil {
+				return err
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				return invalid(path, "must not have property '%v'", name)
+			}
+			if err := compiled.validate(additional, object[name], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (compiled *schema) validateArray(keywords map[string]interface{}, array []interface{}, path string) error {
+	if minimum, ok := keywords["minItems"].(json.Number); ok && float64(len(array)) < toFloat(minimum) {
+		return invalid(path, "must have at least %v items", minimum)
+	}
+	if maximum, ok := keywords["maxItems"].(json.Number); ok && float64(len(array)) > toFloat(maximum) {
+		return invalid(path, "must have at most %v items", maximum)
+	}
+	if unique, _ := keywords["uniqueItems"].(bool); unique {
+		for i := range array {
+			if containsEqual(array[:i], array[i]) {
+				return invalid(fmt.Sprintf("%v/%v", path, i), "must be unique")
+			}
+		}
+	}
+
+	items, ok := keywords["items"]
+	if !ok {
+		return nil
+	}
+	for i, item := range array {
+		itemSchema := items
+		if tuple, ok := items.([]interface{}); ok {
+			if i >= len(tuple) {
+				break
+			}
+			itemSchema = tuple[i]
+		}
+		if err := compiled.validate(itemSchema, item, fmt.Sprintf("%v/%v", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (compiled *schema) validateString(keywords map[string]interface{}, value string, path string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if minimum, ok := keywords["minLength"].(json.Number); ok && length < toFloat(minimum) {
+		return invalid(path, "must be at least %v characters long", minimum)
+	}
+	if maximum, ok := keywords["maxLength"].(json.Number); ok && length > toFloat(maximum) {
+		return invalid(path, "must be at most %v characters long", maximum)
+	}
+	if pattern, ok := keywords["pattern"].(string); ok && !compiled.patterns[pattern].MatchString(value) {
+		return invalid(path, "must match the pattern '%v'", pattern)
+	}
+	return nil
+}
+
+func validateNumber(keywords map[string]interface{}, number json.Number, path string) error {
+	value := toFloat(number)
+	if minimum, ok := keywords["minimum"].(json.Number); ok && value < toFloat(minimum) {
+		return invalid(path, "must be at least %v", minimum)
+	}
+	if maximum, ok := keywords["maximum"].(json.Number); ok && value > toFloat(maximum) {
+		return invalid(path, "must be at most %v", maximum)
+	}
+	if minimum, ok := keywords["exclusiveMinimum"].(json.Number); ok && value <= toFloat(minimum) {
+		return invalid(path, "must be greater than %v", minimum)
+	}
+	if maximum, ok := keywords["exclusiveMaximum"].(json.Number); ok && value >= toFloat(maximum) {
+		return invalid(path, "must be less than %v", maximum)
+	}
+	if divisor, ok := keywords["multipleOf"].(json.Number); ok {
+		quotient := value / toFloat(divisor)
+		if math.Abs(quotient-math.Floor(quotient+0.5)) > 1e-9 {
+			return invalid(path, "must be a multiple of %v", divisor)
+		}
+	}
+	return nil
+}
+
+func (compiled *schema) validateCombinators(keywords map[string]interface{}, value interface{}, path string) error {
+	if schemas, ok := keywords["allOf"].([]interface{}); ok {
+		for _, item := range schemas {
+			if err := compiled.validate(item, value, path); err != nil {
+				return err
+			}
+		}
+	}
+	if schemas, ok := keywords["anyOf"].([]interface{}); ok && compiled.countValid(schemas, value, path) == 0 {
+		return invalid(path, "must match at least one schema in anyOf")
+	}
+	if schemas, ok := keywords["oneOf"].([]interface{}); ok {
+		if count := compiled.countValid(schemas, value, path); count != 1 {
+			return invalid(path, "must match exactly one schema in oneOf, but matches %v", count)
+		}
+	}
+	if not, ok := keywords["not"]; ok && compiled.validate(not, value, path) == nil {
+		return invalid(path, "must not match the schema in not")
+	}
+	return nil
+}
+
+func (compiled *schema) countValid(schemas []interface{}, value interface{}, path string) int {
+	count := 0
+	for _, item := range schemas {
+		if compiled.validate(item, value, path) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func matchesType(types interface{}, value interface{}) bool {
+	names, ok := types.([]interface{})
+	if !ok {
+		names = []interface{}{types}
+	}
+
+	for _, name := range names {
+		switch value := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case json.Number:
+			if name == "number" || (name == "integer" && isInteger(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeTypes(types interface{}) string {
+	names, ok := types.([]interface{})
+	if !ok {
+		return fmt.Sprintf("'%v'", types)
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("'%v'", name)
+	}
+	return strings.Join(quoted, " or ")
+}
+
+// equal compares two decoded JSON values. Numbers
+// are equal if they have the same value, so 1 equals 1.0
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		return ok && toFloat(a) == toFloat(b)
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func containsEqual(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equal(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInteger(number json.Number) bool {
+	value := toFloat(number)
+	return value == math.Trunc(value)
+}
+
+func toFloat(number json.Number) float64 {
+	value, _ := number.Float64()
+	return value
+}
+
+func encode(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes a property name for use in a JSON pointer
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+func invalid(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Errorf("data at '%v' %v", path, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,138 @@
+package schema_test
+
+import (
+	"github.com/royvandewater/meshchain/schema"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schema", func() {
+	compile := func(schemaJSON string) schema.Schema {
+		compiled, err := schema.Compile([]byte(schemaJSON))
+		Expect(err).To(BeNil())
+		return compiled
+	}
+
+	Describe("Compile", func() {
+		It("should reject invalid JSON", func() {
+			_, err := schema.Compile([]byte(`{`))
+			Expect(err).To(MatchError(ContainSubstring("Failed to parse schema")))
+		})
+
+		It("should reject unknown types", func() {
+			_, err := schema.Compile([]byte(`{"properties": {"a": {"type": "float"}}}`))
+			Expect(err).To(MatchError("'#/properties/a/type' contains unknown type 'float'"))
+		})
+
+		It("should reject invalid patterns", func() {
+			_, err := schema.Compile([]byte(`{"pattern": "("}`))
+			Expect(err).To(MatchError(ContainSubstring("pattern '(' at '#/pattern' is invalid")))
+		})
+
+		It("should reject references outside the schema", func() {
+			_, err := schema.Compile([]byte(`{"$ref": "http://example.com/schema.json"}`))
+			Expect(err).To(MatchError(ContainSubstring("only references within the schema")))
+		})
+
+		It("should reject references to missing definitions", func() {
+			_, err := schema.Compile([]byte(`{"$ref": "#/definitions/missing"}`))
+			Expect(err).To(MatchError("'#/$ref' is invalid: '#/definitions/missing' does not exist"))
+		})
+	})
+
+	Describe("Validate", func() {
+		var sut schema.Schema
+
+		BeforeEach(func() {
+			sut = compile(`{
+				"type": "object",
+				"required": ["name", "tags"],
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string", "minLength": 1, "maxLength": 8, "pattern": "^[a-z]+$"},
+					"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+					"tags": {"type": "array", "items": {"$ref": "#/definitions/tag"}, "uniqueItems": true},
+					"role": {"enum": ["admin", "user"]},
+					"contact": {"oneOf": [
+						{"type": "object", "required": ["email"]},
+						{"type": "object", "required": ["phone"]}
+					]}
+				},
+				"definitions": {
+					"tag": {"type": "string", "not": {"const": "forbidden"}}
+				}
+			}`)
+		})
+
+		It("should accept a conforming document", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "age": 30, "tags": ["a", "b"], "role": "admin", "contact": {"email": "roy@example.com"}}`))).To(Succeed())
+		})
+
+		It("should reject invalid JSON", func() {
+			Expect(sut.Validate([]byte(`{"name":`))).To(MatchError(ContainSubstring("data is not valid JSON")))
+		})
+
+		It("should reject the wrong type", func() {
+			Expect(sut.Validate([]byte(`[]`))).To(MatchError("data at '/' must be of type 'object'"))
+		})
+
+		It("should reject missing required properties", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy"}`))).To(MatchError("data at '/' is missing required property 'tags'"))
+		})
+
+		It("should reject additional properties", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": [], "extra": 1}`))).To(MatchError("data at '/' must not have property 'extra'"))
+		})
+
+		It("should reject strings that don't match the pattern", func() {
+			Expect(sut.Validate([]byte(`{"name": "Roy", "tags": []}`))).To(MatchError("data at '/name' must match the pattern '^[a-z]+$'"))
+		})
+
+		It("should reject strings that are too long", func() {
+			Expect(sut.Validate([]byte(`{"name": "abcdefghi", "tags": []}`))).To(MatchError("data at '/name' must be at most 8 characters long"))
+		})
+
+		It("should reject numbers that aren't integers", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": [], "age": 1.5}`))).To(MatchError("data at '/age' must be of type 'integer'"))
+		})
+
+		It("should reject numbers out of range", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": [], "age": 150}`))).To(MatchError("data at '/age' must be less than 150"))
+		})
+
+		It("should validate items through references", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": ["a", "forbidden"]}`))).To(MatchError("data at '/tags/1' must not match the schema in not"))
+		})
+
+		It("should reject duplicate items", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": ["a", "a"]}`))).To(MatchError("data at '/tags/1' must be unique"))
+		})
+
+		It("should reject values outside the enum", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": [], "role": "root"}`))).To(MatchError(`data at '/role' must be one of ["admin","user"]`))
+		})
+
+		It("should require exactly one oneOf schema to match", func() {
+			Expect(sut.Validate([]byte(`{"name": "roy", "tags": [], "contact": {"email": "a", "phone": "b"}}`))).To(MatchError("data at '/contact' must match exactly one schema in oneOf, but matches 2"))
+		})
+	})
+
+	Describe("Validate with numbers", func() {
+		It("should compare numbers by value", func() {
+			sut := compile(`{"const": 1, "multipleOf": 0.5}`)
+			Expect(sut.Validate([]byte(`1.0`))).To(Succeed())
+			Expect(sut.Validate([]byte(`2`))).To(MatchError("data at '/' must be 1"))
+		})
+	})
+
+	Describe("Validate with a boolean schema", func() {
+		It("should accept everything for true", func() {
+			Expect(compile(`true`).Validate([]byte(`{"anything": [1, 2]}`))).To(Succeed())
+		})
+
+		It("should reject everything for false", func() {
+			Expect(compile(`false`).Validate([]byte(`null`))).To(MatchError("data at '/' is not allowed"))
+		})
+	})
+})
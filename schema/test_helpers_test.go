@@ -0,0 +1,38 @@
+package schema_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+
+	. "github.com/onsi/gomega"
+)
+
+// generateRecord creates a signed root record with the
+// content type and schema. It fails the test on errors
+func generateRecord(contentType, schemaRef, data string) record.Record {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 512)
+	Expect(err).To(BeNil())
+
+	publicKey, err := cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+	Expect(err).To(BeNil())
+
+	metadata := record.Metadata{
+		ID:          generators.ID("", []string{publicKey}),
+		PublicKeys:  []string{publicKey},
+		ContentType: contentType,
+		Schema:      schemaRef,
+	}
+
+	unsigned, err := record.NewUnsignedRootRecord(metadata, []byte(data))
+	Expect(err).To(BeNil())
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewRootRecord(metadata, []byte(data), signature)
+	Expect(err).To(BeNil())
+	return rec
+}
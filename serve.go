@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/antientropy"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/config"
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/dht"
+	"github.com/royvandewater/meshchain/gossip"
+	"github.com/royvandewater/meshchain/keyring"
+	"github.com/royvandewater/meshchain/light"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/membership"
+	"github.com/royvandewater/meshchain/peer"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/rpc"
+	"github.com/royvandewater/meshchain/schema"
+	"github.com/royvandewater/meshchain/server"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// shutdownTimeout is how long in-flight requests
+// may take to finish after SIGTERM
+const shutdownTimeout = 10 * time.Second
+
+// expireInterval is how often chains whose head expired, and
+// chunks that no record references, are removed from the store
+const expireInterval = time.Minute
+
+// uploadTTL is how long chunks that no record references are kept
+// after they were uploaded, to give the record time to be submitted
+const uploadTTL = time.Hour
+
+// peerTimeout bounds each request to another node
+const peerTimeout = 30 * time.Second
+
+// runServe runs a node: the HTTP API over a store and, if configured,
+// the gRPC RecordService and peer networking with other nodes over
+// authenticated peer connections. It reloads its config on SIGHUP
+// and shuts down gracefully on SIGTERM or SIGINT
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("MESHCHAIN_CONFIG"), "path of the TOML config file, defaults to $MESHCHAIN_CONFIG")
+	dir := flags.String("store", "", "path to the store directory, created if missing. Shorthand for $MESHCHAIN_STORE_PATH")
+	listen := flags.String("listen", "", "address to serve HTTP on. Shorthand for $MESHCHAIN_HTTP_LISTEN")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// the flags take precedence over both the
+	// environment and the config file
+	if *dir != "" {
+		os.Setenv("MESHCHAIN_STORE_PATH", *dir)
+	}
+	if *listen != "" {
+		os.Setenv("MESHCHAIN_HTTP_LISTEN", *listen)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+
+	backend, lock, err := openBackend(cfg.Store.Path, cfg.Store.Keys)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	node := &daemon{
+		store:     store.New(backend),
+		handler:   &currentHandler{},
+		admitter:  &currentAdmitter{},
+		submitter: &currentAdmitter{},
+		limiter:   &currentLimiter{},
+	}
+	if err := node.apply(cfg); err != nil {
+		return err
+	}
+
+	stopExpiring := make(chan struct{})
+	defer close(stopExpiring)
+	go expire(node.store, expireInterval, stopExpiring)
+
+	httpListener, err := net.Listen("tcp", cfg.HTTP.Listen)
+	if err != nil {
+		node.stopPeers()
+		return err
+	}
+	serveErr := make(chan error, 2)
+	httpServer := cancelOnShutdown(&http.Server{Handler: node.handler})
+	go func() {
+		serveErr <- httpServer.Serve(httpListener)
+	}()
+	log.Printf("meshchain %v listening on %v", VERSION, cfg.HTTP.Listen)
+
+	var rpcServer *http.Server
+	if cfg.RPC.Listen != "" {
+		rpcListener, err := net.Listen("tcp", cfg.RPC.Listen)
+		if err != nil {
+			httpServer.Close()
+			node.stopPeers()
+			return err
+		}
+		rpcServer = cancelOnShutdown(rpc.NewGRPCServer(rpc.New(node.store, rpc.Options{Admitter: node.submitter}), node.limiter))
+		go func() {
+			serveErr <- rpcServer.Serve(rpcListener)
+		}()
+		log.Printf("serving the RecordService over gRPC on %v", cfg.RPC.Listen)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case err := <-serveErr:
+			node.stopPeers()
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				node.reload(*configPath)
+				continue
+			}
+
+			log.Printf("received %v, shutting down", sig)
+			servers := []*http.Server{httpServer}
+			if rpcServer != nil {
+				servers = append(servers, rpcServer)
+			}
+			shutdown(servers...)
+			node.stopPeers()
+			return nil
+		}
+	}
+}
+
+// daemon holds the running parts of a node that a reload can replace
+type daemon struct {
+	store   store.Store
+	handler *currentHandler
+
+	// admitter admits the records received from peers and submitter
+	// those submitted over RPC, which are then gossiped
+	admitter  *currentAdmitter
+	submitter *currentAdmitter
+
+	config  *config.Config
+	limiter *currentLimiter
+	peers   *peerNetwork
+}
+
+// apply restarts peer networking if its config changed and admits
+// records from peers and the APIs with the new limits, schemas and
+// skew. The limiter, and so its token buckets, is kept unless the
+// limits changed. If peer networking fails to restart, the running
+// one is kept and the error returned. It is called at startup and
+// on every reload
+func (daemon *daemon) apply(cfg *config.Config) error {
+	schemas, err := schema.Load(cfg.Schemas)
+	if err != nil {
+		return err
+	}
+
+	if daemon.config == nil || !reflect.DeepEqual(daemon.config.Limits, cfg.Limits) {
+		daemon.limiter.set(limits.New(daemon.store, cfg.Limits))
+	}
+	validity := record.Validity{Skew: cfg.Validity.Skew.Duration}
+	daemon.admitter.set(admission.New(daemon.store, admission.Options{
+		Limiter:   daemon.limiter,
+		Validator: schemas,
+		Validity:  validity,
+	}))
+
+	// if peer networking fails to restart, the running one is kept and
+	// the submitter and handler below still publish to it
+	var peersErr error
+	peersChanged := daemon.config == nil || !reflect.DeepEqual(peerSettings(daemon.config), peerSettings(cfg))
+	if peersChanged {
+		peersErr = daemon.restartPeers(cfg)
+	} else if daemon.peers != nil {
+		daemon.peers.setPeers(cfg.Peer.Peers)
+	}
+
+	submissions := admission.Options{
+		Limiter:   daemon.limiter,
+		Validator: schemas,
+		Validity:  validity,
+	}
+	options := server.Options{
+		Limiter:   daemon.limiter,
+		Validator: schemas,
+		Validity:  validity,
+	}
+	if daemon.peers != nil {
+		submissions.Publisher = daemon.peers.publisher()
+		options.Publisher = daemon.peers.publisher()
+		if daemon.peers.dht != nil {
+			options.Lookup = daemon.peers.dht
+		}
+	}
+	daemon.submitter.set(admission.New(daemon.store, submissions))
+
+	mux := http.NewServeMux()
+	mux.Handle(light.PathPrefix, light.PeerHandler(light.NewServer(daemon.store)))
+	mux.Handle("/", server.New(daemon.store, options))
+	daemon.handler.set(mux)
+
+	if peersErr != nil {
+		return peersErr
+	}
+	daemon.config = cfg
+	return nil
+}
+
+// reload reads the config again and applies it. Changes to the HTTP
+// and RPC listen addresses or the store path and keys require a
+// restart and are ignored. An invalid config is logged and ignored
+func (daemon *daemon) reload(configPath string) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Printf("not reloading, config is invalid: %v", err.Error())
+		return
+	}
+
+	if cfg.HTTP != daemon.config.HTTP || cfg.RPC != daemon.config.RPC || !reflect.DeepEqual(cfg.Store, daemon.config.Store) {
+		log.Printf("http.listen, rpc.listen and the store can't be changed without a restart, keeping the current values")
+		cfg.HTTP, cfg.RPC, cfg.Store = daemon.config.HTTP, daemon.config.RPC, daemon.config.Store
+	}
+
+	if err := daemon.apply(cfg); err != nil {
+		log.Printf("Failed to apply the reloaded config: %v", err.Error())
+		return
+	}
+	log.Printf("reloaded config")
+}
+
+// expire removes the chains whose head expired, and then the
+// chunks that no record references and that were uploaded more
+// than uploadTTL ago, from the store every interval, until stop
+// is closed
+func expire(s store.Store, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			report, err := s.Expire(time.Now())
+			if err != nil {
+				log.Printf("Failed to expire records: %v", err.Error())
+			}
+			if report != nil {
+				for _, chain := range report.Chains {
+					log.Printf("removed chain '%v', it expired at %v", chain.ID, chain.NotAfter.Format(time.RFC3339))
+				}
+			}
+
+			garbage, err := s.CollectGarbage(time.Now().Add(-uploadTTL))
+			if err != nil {
+				log.Printf("Failed to collect unreferenced chunks: %v", err.Error())
+			}
+			if garbage != nil && len(garbage.Chunks)+len(garbage.Trees) > 0 {
+				log.Printf("removed %v unreferenced chunks and %v trees", len(garbage.Chunks), len(garbage.Trees))
+			}
+		}
+	}
+}
+
+// peerNetwork is the running peer networking of a node. The
+// membership and DHT are nil when they are disabled
+type peerNetwork struct {
+	address    string
+	config     peer.Config
+	server     *http.Server
+	gossip     gossip.Node
+	membership membership.Membership
+	syncer     antientropy.Syncer
+	dht        dht.Node
+	stop       chan struct{}
+}
+
+// publisher returns what submitted records are published with: the
+// DHT if it is enabled, which stores them on the nodes responsible
+// for them, otherwise gossip, which spreads them to every node
+func (network *peerNetwork) publisher() admission.Publisher {
+	if network.dht != nil {
+		return dhtPublisher{network.dht}
+	}
+	return network.gossip
+}
+
+// dhtPublisher publishes records by putting them in the DHT
+type dhtPublisher struct {
+	node dht.Node
+}
+
+func (publisher dhtPublisher) Publish(rec record.Record) error {
+	return publisher.node.Put(rec)
+}
+
+// setPeers replaces the configured peers that gossip and anti-entropy
+// pick from. They are ignored when membership is enabled
+func (network *peerNetwork) setPeers(peers []string) {
+	network.gossip.SetPeers(peers)
+	network.syncer.SetPeers(peers)
+}
+
+// restartPeers replaces the running peer networking with one started
+// with cfg, or stops it if peer.listen is empty. The new one is started
+// before the running one is stopped, so that the running one is kept
+// if it fails to start. When both listen on the same address, the
+// running one has to stop listening first, so it is started again
+// with its previous config if the new one fails to start
+func (daemon *daemon) restartPeers(cfg *config.Config) error {
+	if cfg.Peer.Listen == "" {
+		daemon.stopPeers()
+		return nil
+	}
+
+	peerConfig, err := peerConfig(cfg.Peer)
+	if err != nil {
+		return err
+	}
+
+	previous := daemon.peers
+	if previous == nil || previous.address != cfg.Peer.Listen {
+		network, err := daemon.startPeers(cfg, peerConfig)
+		if err != nil {
+			return err
+		}
+		daemon.stopPeers()
+		daemon.peers = network
+		return nil
+	}
+
+	daemon.stopPeers()
+	network, err := daemon.startPeers(cfg, peerConfig)
+	if err != nil {
+		restored, restoreErr := daemon.startPeers(daemon.config, previous.config)
+		if restoreErr != nil {
+			log.Printf("Failed to restart peer networking with the previous config: %v", restoreErr.Error())
+		}
+		daemon.peers = restored
+		return err
+	}
+	daemon.peers = network
+	return nil
+}
+
+// startPeers listens for peer connections on peer.listen and gossips
+// with the configured peers, or with the live members if membership
+// is enabled. It serves chunks, anti-entropy and light client proofs
+// to peers and runs anti-entropy and the DHT if they are enabled. With
+// the DHT, submissions are put in it rather than gossiped, and only
+// the chains the node is responsible for are kept
+func (daemon *daemon) startPeers(cfg *config.Config, peerConfig peer.Config) (*peerNetwork, error) {
+	listener, err := peer.Listen("tcp", cfg.Peer.Listen, peerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client := peer.NewHTTPClient(peerConfig, peerTimeout)
+	network := &peerNetwork{address: cfg.Peer.Listen, config: peerConfig, stop: make(chan struct{})}
+	mux := http.NewServeMux()
+
+	chunkTransport := chunks.NewPeerTransport(client)
+	mux.Handle(chunks.PathPrefix, chunks.PeerHandler(daemon.store))
+
+	gossipOptions := gossip.Options{
+		OnError:  func(err error) { log.Printf("gossip: %v", err.Error()) },
+		Admitter: daemon.admitter,
+		Chunks:   chunkTransport,
+	}
+	syncerOptions := antientropy.Options{Admitter: daemon.admitter, Chunks: chunkTransport}
+
+	if interval := cfg.Membership.Interval.Duration; interval > 0 {
+		probeClient := peer.NewHTTPClient(peerConfig, interval/2)
+		network.membership, err = membership.New(peerConfig.Identity, membership.NewPeerTransport(probeClient), membership.Options{})
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		mux.Handle(membership.PathPrefix, membership.PeerHandler(network.membership))
+		gossipOptions.Members, syncerOptions.Members = network.membership, network.membership
+		go runMembership(network.membership, cfg.Peer.Peers, interval, network.stop)
+	}
+
+	// with the DHT, a node only keeps the chains it is responsible
+	// for, so gossip and anti-entropy skip the others
+	if interval := cfg.DHT.Interval.Duration; interval > 0 {
+		network.dht = dht.New(cfg.Peer.Address, daemon.store, dht.NewPeerTransport(client), dht.Options{Admitter: daemon.admitter, Chunks: chunkTransport})
+		mux.Handle(dht.PathPrefix, dht.PeerHandler(network.dht, daemon.limiter))
+		gossipOptions.Range, syncerOptions.Range = network.dht, network.dht
+		go runDHT(network.dht, cfg.Peer.Peers, interval, network.stop)
+	}
+
+	network.gossip = gossip.New(daemon.store, gossip.NewPeerTransport(client), gossipOptions)
+	mux.Handle(gossip.PathPrefix, gossip.PeerHandler(network.gossip, daemon.limiter))
+
+	network.syncer = antientropy.New(daemon.store, antientropy.NewPeerTransport(client), syncerOptions)
+	mux.Handle(antientropy.PathPrefix, antientropy.PeerHandler(network.syncer))
+	if interval := cfg.AntiEntropy.Interval.Duration; interval > 0 {
+		go network.syncer.Run(interval, network.stop)
+	}
+
+	mux.Handle(light.PathPrefix, light.PeerHandler(light.NewServer(daemon.store)))
+	network.setPeers(cfg.Peer.Peers)
+
+	network.server = cancelOnShutdown(peer.NewHTTPServer(mux))
+	go network.server.Serve(listener)
+
+	log.Printf("node '%v' gossiping on %v with %v peer(s)", peerConfig.Identity.Metadata().ID, cfg.Peer.Listen, len(cfg.Peer.Peers))
+	return network, nil
+}
+
+// stopPeers stops accepting peer connections, waits for the
+// requests of peers in flight and stops every peer protocol
+func (daemon *daemon) stopPeers() {
+	if daemon.peers == nil {
+		return
+	}
+
+	shutdown(daemon.peers.server)
+	close(daemon.peers.stop)
+	daemon.peers.gossip.Close()
+	daemon.peers = nil
+}
+
+// runMembership joins the mesh through the peers, then runs the
+// membership protocol every interval until stop is closed
+func runMembership(members membership.Membership, peers []string, interval time.Duration, stop <-chan struct{}) {
+	for _, address := range peers {
+		if err := members.Join(address); err != nil {
+			log.Printf("membership: Failed to join through '%v': %v", address, err.Error())
+		}
+	}
+	members.Run(interval, stop)
+}
+
+// runDHT bootstraps the routing table from the peers, then refreshes
+// it and republishes every interval until stop is closed
+func runDHT(node dht.Node, peers []string, interval time.Duration, stop <-chan struct{}) {
+	if len(peers) != 0 {
+		if err := node.Bootstrap(peers); err != nil {
+			log.Printf("dht: Failed to bootstrap: %v", err.Error())
+		}
+	}
+	node.Run(interval, stop)
+}
+
+// peerConfig builds the identity of the node from its key
+func peerConfig(cfg config.Peer) (peer.Config, error) {
+	privateKey, err := loadPrivateKey(keyring.DefaultDir(), cfg.Key)
+	if err != nil {
+		return peer.Config{}, err
+	}
+
+	publicKey, err := cryptohelpers.RSAPublicKeyToPEM(&privateKey.PublicKey)
+	if err != nil {
+		return peer.Config{}, err
+	}
+
+	identity, err := membership.NewIdentity(cfg.Address, publicKey, privateKey)
+	if err != nil {
+		return peer.Config{}, err
+	}
+
+	return peer.Config{
+		Identity:   identity,
+		PrivateKey: privateKey,
+		Policy:     peer.Policy{Allow: cfg.Allow, Deny: cfg.Deny},
+	}, nil
+}
+
+// peerSettings returns the config that peer networking is started
+// with, without the list of peers, which can be changed without
+// restarting peer networking
+func peerSettings(cfg *config.Config) config.Config {
+	settings := config.Config{
+		Peer:        cfg.Peer,
+		Membership:  cfg.Membership,
+		AntiEntropy: cfg.AntiEntropy,
+		DHT:         cfg.DHT,
+	}
+	settings.Peer.Peers = nil
+	return settings
+}
+
+// currentAdmitter admits records with the admitter
+// of the most recently applied config
+type currentAdmitter struct {
+	lock     sync.RWMutex
+	admitter admission.Admitter
+}
+
+func (current *currentAdmitter) Admit(rec, parent record.Record) error {
+	current.lock.RLock()
+	admitter := current.admitter
+	current.lock.RUnlock()
+
+	return admitter.Admit(rec, parent)
+}
+
+func (current *currentAdmitter) AdmitFrom(rec, parent record.Record, src chunks.Source) error {
+	current.lock.RLock()
+	admitter := current.admitter
+	current.lock.RUnlock()
+
+	return admitter.AdmitFrom(rec, parent, src)
+}
+
+func (current *currentAdmitter) AdmitAncestor(rec, parent record.Record, src chunks.Source) error {
+	current.lock.RLock()
+	admitter := current.admitter
+	current.lock.RUnlock()
+
+	return admitter.AdmitAncestor(rec, parent, src)
+}
+
+func (current *currentAdmitter) set(admitter admission.Admitter) {
+	current.lock.Lock()
+	defer current.lock.Unlock()
+
+	current.admitter = admitter
+}
+
+// currentLimiter limits submissions with the limiter
+// of the most recently applied config
+type currentLimiter struct {
+	lock    sync.RWMutex
+	limiter limits.Limiter
+}
+
+func (current *currentLimiter) AllowPeer(peer string) error {
+	current.lock.RLock()
+	limiter := current.limiter
+	current.lock.RUnlock()
+
+	return limiter.AllowPeer(peer)
+}
+
+func (current *currentLimiter) AllowRecord(rec, parent record.Record) error {
+	current.lock.RLock()
+	limiter := current.limiter
+	current.lock.RUnlock()
+
+	return limiter.AllowRecord(rec, parent)
+}
+
+func (current *currentLimiter) set(limiter limits.Limiter) {
+	current.lock.Lock()
+	defer current.lock.Unlock()
+
+	current.limiter = limiter
+}
+
+// currentHandler serves requests with the handler
+// of the most recently applied config
+type currentHandler struct {
+	lock    sync.RWMutex
+	handler http.Handler
+}
+
+func (current *currentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current.lock.RLock()
+	handler := current.handler
+	current.lock.RUnlock()
+
+	handler.ServeHTTP(w, r)
+}
+
+func (current *currentHandler) set(handler http.Handler) {
+	current.lock.Lock()
+	defer current.lock.Unlock()
+
+	current.handler = handler
+}
+
+// cancelOnShutdown cancels the contexts of the server's requests as
+// soon as it starts shutting down. This ends long lived responses,
+// such as GET /watch and Watch calls, so that Shutdown doesn't wait
+// for them
+func cancelOnShutdown(server *http.Server) *http.Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	server.BaseContext = func(net.Listener) context.Context { return ctx }
+	server.RegisterOnShutdown(cancel)
+	return server
+}
+
+// shutdown stops the servers from accepting connections and waits up
+// to shutdownTimeout for their requests in flight to finish. The
+// connections that are still open after that are closed
+func shutdown(servers ...*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var wait sync.WaitGroup
+	for _, server := range servers {
+		wait.Add(1)
+		go func(server *http.Server) {
+			defer wait.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("gave up waiting for in-flight requests after %v", shutdownTimeout)
+				server.Close()
+			}
+		}(server)
+	}
+	wait.Wait()
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// maxChunkSize is the largest request body accepted by POST /chunks
+const maxChunkSize = 16 << 20
+
+// chunkResponse is the body of POST /chunks
+type chunkResponse struct {
+	Hash string `json:"hash"`
+}
+
+// treeBody is the body of POST /trees and GET /trees/{root},
+// whose root is ignored in requests
+type treeBody struct {
+	Root   string   `json:"root"`
+	Leaves []string `json:"leaves"`
+}
+
+// putChunk stores the request body as a chunk and responds with
+// its hex encoded hash. Uploads are limited like submissions
+func (server *server) putChunk(w http.ResponseWriter, r *http.Request) {
+	if server.limiter != nil {
+		if err := server.limiter.AllowPeer(peerAddress(r)); err != nil {
+			writeLimitError(w, err)
+			return
+		}
+	}
+
+	chunk, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxChunkSize))
+	if err != nil {
+		writeError(w, &apiError{http.StatusRequestEntityTooLarge, "too_large", err.Error()})
+		return
+	}
+
+	hash, err := server.store.PutChunk(chunk)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Location", "/chunks/"+hex.EncodeToString(hash))
+	writeJSON(w, http.StatusCreated, &chunkResponse{Hash: hex.EncodeToString(hash)})
+}
+
+// chunk responds with the chunk with the hex encoded hash
+func (server *server) chunk(w http.ResponseWriter, r *http.Request, hashHex string) {
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		writeError(w, badRequest("hash must be hex encoded"))
+		return
+	}
+
+	chunk, err := server.store.Chunk(hash)
+	if err == store.ErrNotFound {
+		writeError(w, notFound("no chunk exists with hash '"+hashHex+"'"))
+		return
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chunk)
+}
+
+// putTree stores the hex encoded leaves in the request body
+// under the root they hash to, and responds with the root
+func (server *server) putTree(w http.ResponseWriter, r *http.Request) {
+	request := &treeBody{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordSize)).Decode(request); err != nil {
+		writeError(w, badRequest("Failed to parse tree: "+err.Error()))
+		return
+	}
+	if len(request.Leaves) == 0 {
+		writeError(w, badRequest("leaves are required"))
+		return
+	}
+
+	leaves := make([][]byte, len(request.Leaves))
+	for i, leafHex := range request.Leaves {
+		leaf, err := hex.DecodeString(leafHex)
+		if err != nil {
+			writeError(w, badRequest("leaves must be hex encoded"))
+			return
+		}
+		leaves[i] = leaf
+	}
+
+	root := chunks.Root(leaves)
+	if err := server.store.PutTree(root, leaves); err != nil {
+		writeError(w, badRequest(err.Error()))
+		return
+	}
+
+	request.Root = hex.EncodeToString(root)
+	w.Header().Set("Location", "/trees/"+request.Root)
+	writeJSON(w, http.StatusCreated, request)
+}
+
+// tree responds with the leaves of the tree with the hex encoded root
+func (server *server) tree(w http.ResponseWriter, r *http.Request, rootHex string) {
+	root, err := hex.DecodeString(rootHex)
+	if err != nil {
+		writeError(w, badRequest("root must be hex encoded"))
+		return
+	}
+
+	leaves, err := server.store.Tree(root)
+	if err == store.ErrNotFound {
+		writeError(w, notFound("no tree exists with root '"+rootHex+"'"))
+		return
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	response := &treeBody{Root: rootHex}
+	for _, leaf := range leaves {
+		response.Leaves = append(response.Leaves, hex.EncodeToString(leaf))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/server"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chunks", func() {
+	var sut http.Handler
+	var s store.Store
+	var backend store.Backend
+	var root, chunked record.Record
+	var manifest *chunks.Manifest
+	var leaves [][]byte
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		sut.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	submit := func(rec record.Record) *httptest.ResponseRecorder {
+		recordJSON, err := rec.JSON()
+		Expect(err).To(BeNil())
+		return request("POST", "/records", recordJSON)
+	}
+
+	BeforeEach(func() {
+		backend = store.NewMemoryBackend()
+		s = store.New(backend)
+		sut = server.New(s, server.Options{})
+
+		source := store.New(store.NewMemoryBackend())
+		var err error
+		manifest, err = chunks.Write(source, bytes.NewReader([]byte("chunked data")), 4)
+		Expect(err).To(BeNil())
+		leaves, err = source.Tree(manifest.Root)
+		Expect(err).To(BeNil())
+
+		var privateKey *rsa.PrivateKey
+		root, privateKey = fixtures.GenerateRootRecord(record.Metadata{})
+		metadata := root.Metadata()
+		metadata.Manifest = manifest
+		chunked = fixtures.GenerateUpdate(root, privateKey, metadata, nil)
+		Expect(s.Put(root)).To(Succeed())
+	})
+
+	Describe("POST /records with a manifest whose chunks aren't stored", func() {
+		It("should respond with a 409", func() {
+			response := submit(chunked)
+			Expect(response.Code).To(Equal(http.StatusConflict))
+			Expect(response.Body.String()).To(ContainSubstring("missing_chunks"))
+		})
+	})
+
+	Describe("when the chunks and the tree are posted first", func() {
+		BeforeEach(func() {
+			for i, chunk := range []string{"chun", "ked ", "data"} {
+				response := request("POST", "/chunks", chunk)
+				Expect(response.Code).To(Equal(http.StatusCreated))
+				Expect(response.Body.String()).To(ContainSubstring(hex.EncodeToString(leaves[i])))
+			}
+
+			tree := map[string][]string{"leaves": nil}
+			for _, leaf := range leaves {
+				tree["leaves"] = append(tree["leaves"], hex.EncodeToString(leaf))
+			}
+			treeJSON, err := json.Marshal(tree)
+			Expect(err).To(BeNil())
+
+			response := request("POST", "/trees", string(treeJSON))
+			Expect(response.Code).To(Equal(http.StatusCreated))
+			Expect(response.Header().Get("Location")).To(Equal("/trees/" + hex.EncodeToString(manifest.Root)))
+		})
+
+		It("should accept the record", func() {
+			Expect(submit(chunked).Code).To(Equal(http.StatusCreated))
+		})
+
+		It("should stream the data of the record from the chunks", func() {
+			Expect(submit(chunked).Code).To(Equal(http.StatusCreated))
+
+			response := request("GET", "/records/by-hash/"+hex.EncodeToString(fixtures.MustHash(chunked))+"/data", "")
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get("Content-Length")).To(Equal("12"))
+			Expect(response.Body.String()).To(Equal("chunked data"))
+		})
+
+		Describe("when the first chunk of the record is lost", func() {
+			It("should respond with a 500 instead of partial data", func() {
+				Expect(submit(chunked).Code).To(Equal(http.StatusCreated))
+				Expect(backend.Delete("chunks/" + hex.EncodeToString(leaves[0]))).To(Succeed())
+
+				response := request("GET", "/records/by-hash/"+hex.EncodeToString(fixtures.MustHash(chunked))+"/data", "")
+				Expect(response.Code).To(Equal(http.StatusInternalServerError))
+			})
+		})
+
+		It("should serve the chunks and the tree", func() {
+			response := request("GET", "/chunks/"+hex.EncodeToString(leaves[2]), "")
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(Equal("data"))
+
+			response = request("GET", "/trees/"+hex.EncodeToString(manifest.Root), "")
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(ContainSubstring(hex.EncodeToString(leaves[1])))
+		})
+	})
+
+	Describe("POST /trees without leaves", func() {
+		It("should respond with a 400", func() {
+			Expect(request("POST", "/trees", `{"leaves": []}`).Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("GET /chunks/{hash} for an unknown hash", func() {
+		It("should respond with a 404", func() {
+			Expect(request("GET", "/chunks/"+hex.EncodeToString(make([]byte, 32)), "").Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// admissionCodes maps the kinds of admission.Error to error codes
+var admissionCodes = map[string]string{
+	admission.KindValidity: "outside_validity",
+	admission.KindDelta:    "invalid_delta",
+	admission.KindData:     "invalid_data",
+}
+
+// apiError is an error with the HTTP status and
+// machine-readable code to respond with
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (err *apiError) Error() string {
+	return err.message
+}
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    string     `json:"code"`
+	Message string     `json:"message"`
+	Limit   *limitBody `json:"limit,omitempty"`
+}
+
+// limitBody describes the limit that was exceeded
+type limitBody struct {
+	Kind              string  `json:"kind"`
+	Key               string  `json:"key"`
+	RetryAfterSeconds float64 `json:"retryAfterSeconds,omitempty"`
+}
+
+func badRequest(message string) *apiError {
+	return &apiError{http.StatusBadRequest, "bad_request", message}
+}
+
+func internalError(err error) *apiError {
+	return &apiError{http.StatusInternalServerError, "internal", err.Error()}
+}
+
+func invalidRecord(err error) *apiError {
+	return &apiError{http.StatusUnprocessableEntity, "invalid_record", err.Error()}
+}
+
+func methodNotAllowed(method string) *apiError {
+	return &apiError{http.StatusMethodNotAllowed, "method_not_allowed", "method '" + method + "' is not allowed"}
+}
+
+func notFound(message string) *apiError {
+	return &apiError{http.StatusNotFound, "not_found", message}
+}
+
+// writeError writes the error as a structured JSON response
+func writeError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, err.status, &errorResponse{Error: errorBody{Code: err.code, Message: err.message}})
+}
+
+// writeAdmitError writes an error from the admitter. Rejected records
+// are a 422, conflicts with the chain and missing chunks a 409 and
+// exceeded limits are written by writeLimitError
+func writeAdmitError(w http.ResponseWriter, err error) {
+	switch err := err.(type) {
+	case *admission.Error:
+		writeError(w, &apiError{http.StatusUnprocessableEntity, admissionCodes[err.Kind], err.Message})
+	case *store.ConflictError:
+		writeError(w, &apiError{http.StatusConflict, "conflict", err.Message})
+	case *store.DeltaError:
+		writeError(w, &apiError{http.StatusUnprocessableEntity, "invalid_delta", err.Message})
+	case *store.ChunksError:
+		writeError(w, &apiError{http.StatusConflict, "missing_chunks", err.Message})
+	default:
+		writeLimitError(w, err)
+	}
+}
+
+// writeLimitError writes an error from the limiter, responding with a
+// 429 when a rate limit is exceeded and a 403 when a quota is exceeded
+func writeLimitError(w http.ResponseWriter, err error) {
+	limitErr, ok := err.(*limits.Error)
+	if !ok {
+		writeError(w, internalError(err))
+		return
+	}
+
+	status, code := http.StatusTooManyRequests, "rate_limited"
+	if limitErr.Kind == limits.KindQuota {
+		status, code = http.StatusForbidden, "quota_exceeded"
+	}
+
+	limit := &limitBody{Kind: limitErr.Kind, Key: limitErr.Key, RetryAfterSeconds: limitErr.RetryAfter.Seconds()}
+	if limitErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfterSeconds))))
+	}
+	writeJSON(w, status, &errorResponse{Error: errorBody{Code: code, Message: limitErr.Message, Limit: limit}})
+}
+
+// writeJSON writes the value as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// historyResponse is the body of GET /records/{id}/history
+type historyResponse struct {
+	ID       string            `json:"id"`
+	Complete bool              `json:"complete"`
+	Records  []json.RawMessage `json:"records"`
+}
+
+// submit verifies the record in the request body and stores it.
+// An update record's parent must already be in the store
+func (server *server) submit(w http.ResponseWriter, r *http.Request) {
+	if server.limiter != nil {
+		if err := server.limiter.AllowPeer(peerAddress(r)); err != nil {
+			writeLimitError(w, err)
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRecordSize))
+	if err != nil {
+		writeError(w, &apiError{http.StatusRequestEntityTooLarge, "too_large", err.Error()})
+		return
+	}
+
+	recordPB, err := record.ParseJSON(body)
+	if err != nil {
+		writeError(w, badRequest("Failed to parse record: "+err.Error()))
+		return
+	}
+
+	var parent record.Record
+	if len(recordPB.Parent) != 0 {
+		parent, err = server.store.Get(recordPB.Parent)
+		if err == store.ErrNotFound {
+			writeError(w, &apiError{http.StatusConflict, "unknown_parent", "parent '" + hex.EncodeToString(recordPB.Parent) + "' is not in the store"})
+			return
+		}
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+	}
+
+	rec, err := record.FromProto(recordPB, parent)
+	if err != nil {
+		writeError(w, invalidRecord(err))
+		return
+	}
+
+	if err := server.admitter.Admit(rec, parent); err != nil {
+		writeAdmitError(w, err)
+		return
+	}
+
+	hash, err := rec.Hash()
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Location", "/records/by-hash/"+hex.EncodeToString(hash))
+	writeRecord(w, http.StatusCreated, rec)
+}
+
+// peerAddress returns the host of the client that sent the request
+func peerAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// head responds with the most recent record for the metadata.ID,
+// from the Lookup if there is one
+func (server *server) head(w http.ResponseWriter, r *http.Request, id string) {
+	head := server.store.Head
+	if server.lookup != nil {
+		head = server.lookup.Get
+	}
+
+	rec, err := head(id)
+	if err == store.ErrNotFound {
+		writeError(w, notFound("no chain exists for metadata.ID '"+id+"'"))
+		return
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	writeRecord(w, http.StatusOK, rec)
+}
+
+// history responds with every stored record for the metadata.ID,
+// oldest first. complete is false if the chain was pruned
+func (server *server) history(w http.ResponseWriter, r *http.Request, id string) {
+	chain, err := server.store.Chain(id)
+	if err == store.ErrNotFound {
+		writeError(w, notFound("no chain exists for metadata.ID '"+id+"'"))
+		return
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	response := &historyResponse{ID: chain.ID(), Complete: chain.Complete()}
+	for _, rec := range chain.Records() {
+		recordJSON, err := rec.JSON()
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		response.Records = append(response.Records, json.RawMessage(recordJSON))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// byHash responds with the record with the hex encoded hash
+func (server *server) byHash(w http.ResponseWriter, r *http.Request, hashHex string) {
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		writeError(w, badRequest("hash must be hex encoded"))
+		return
+	}
+
+	rec, err := server.store.Get(hash)
+	if err == store.ErrNotFound {
+		writeError(w, notFound("no record exists with hash '"+hashHex+"'"))
+		return
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	writeRecord(w, http.StatusOK, rec)
+}
+
+// data responds with the full data of the record with the hex
+// encoded hash, materialized if the record's data is a delta
+func (server *server) data(w http.ResponseWriter, r *http.Request, hashHex string) {
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		writeError(w, badRequest("hash must be hex encoded"))
+		return
+	}
+
+	rec, err := server.store.Get(hash)
+	if err == store.ErrNotFound {
+		writeError(w, notFound("no record exists with hash '"+hashHex+"'"))
+		return
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	reader, err := server.store.DataReader(hash)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	// Peek so that data that can't be read at all, such as chunks
+	// that are missing, is reported before the status is written
+	data := bufio.NewReader(reader)
+	if _, err := data.Peek(1); err != nil && err != io.EOF {
+		writeError(w, internalError(err))
+		return
+	}
+
+	contentType := rec.Metadata().ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !inlineContentType(contentType) {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	if manifest := rec.Metadata().Manifest; manifest != nil && rec.Metadata().Delta == "" {
+		w.Header().Set("Content-Length", strconv.FormatInt(manifest.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, data)
+}
+
+// inlineContentTypes are the media types that the data of a record
+// is displayed inline as. Anyone can choose the content type of a
+// record, so the data of any other type, such as text/html or
+// image/svg+xml, is served as an attachment so that it can't run
+// scripts on the node's origin
+var inlineContentTypes = map[string]bool{
+	"application/json":         true,
+	"application/octet-stream": true,
+	"application/pdf":          true,
+	"image/gif":                true,
+	"image/jpeg":               true,
+	"image/png":                true,
+	"image/webp":               true,
+	"text/plain":               true,
+}
+
+// inlineContentType returns true if data of the
+// content type is safe to display inline
+func inlineContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return inlineContentTypes[mediaType]
+}
+
+// writeRecord writes the JSON of the record as the response body
+func writeRecord(w http.ResponseWriter, status int, rec record.Record) {
+	recordJSON, err := rec.JSON()
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(recordJSON))
+}
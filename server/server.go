@@ -0,0 +1,176 @@
+// Package server exposes a store over HTTP. Records are submitted
+// and returned using the JSON produced by Record.JSON(), and every
+// error is returned as a JSON object of the form
+//
+//     {"error": {"code": "not_found", "message": "..."}}
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/royvandewater/meshchain/admission"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+)
+
+// maxRecordSize is the largest request body accepted by POST /records
+const maxRecordSize = 4 << 20
+
+// New constructs an http.Handler serving these routes:
+//
+//     POST /records                 verify and store a record
+//     GET  /records/{id}            the head of the chain for the ID
+//     GET  /records/{id}/history    every stored record of the chain
+//     GET  /records/by-hash/{hash}  the record with the hex encoded hash
+//     GET  /records/by-hash/{hash}/data
+//                                   the full data of the record, with any delta applied,
+//                                   as an attachment unless its content type is safe inline
+//     POST /chunks                  store the body as a chunk, before the record it belongs to
+//     GET  /chunks/{hash}           the chunk with the hex encoded hash
+//     POST /trees                   store the leaves of a tree of chunks
+//     GET  /trees/{root}            the leaves of the tree with the hex encoded root
+//     GET  /watch                   a Server-Sent Events stream of new records
+//     GET  /healthz                 whether the process is up
+//     GET  /readyz                  whether the store can be read
+func New(s store.Store, options Options) http.Handler {
+	admitter := admission.New(s, admission.Options{
+		Limiter:   options.Limiter,
+		Publisher: options.Publisher,
+		Validator: options.Validator,
+		Validity:  options.Validity,
+	})
+	return &server{store: s, limiter: options.Limiter, admitter: admitter, lookup: options.Lookup}
+}
+
+// Lookup finds the head of a chain that may be stored on
+// other nodes. A dht.Node satisfies it
+type Lookup interface {
+	Get(id string) (record.Record, error)
+}
+
+// Publisher stores a record and shares it with other nodes.
+// A gossip.Node satisfies it
+type Publisher interface {
+	Publish(rec record.Record) error
+}
+
+// Validator checks the full data of a record against its content
+// type and schema. A schema.Registry satisfies it
+type Validator interface {
+	Validate(rec record.Record, data io.Reader) error
+}
+
+// Options configures the server
+type Options struct {
+	// Limiter limits record submissions. Submissions
+	// are unlimited if it is nil
+	Limiter limits.Limiter
+
+	// Publisher stores submitted records in place of the
+	// store. Records are only stored locally if it is nil
+	Publisher Publisher
+
+	// Validator rejects submitted records whose data doesn't
+	// match their content type or schema. The data of
+	// records is not checked if it is nil
+	Validator Validator
+
+	// Validity rejects submitted records that are not yet valid
+	// or have expired. The zero value checks them against
+	// time.Now without any skew
+	Validity record.Validity
+
+	// Lookup, if set, finds the heads for GET /records/{id} in
+	// place of the store, so that chains stored on other
+	// nodes are found too
+	Lookup Lookup
+}
+
+type server struct {
+	store    store.Store
+	limiter  limits.Limiter
+	admitter admission.Admitter
+	lookup   Lookup
+}
+
+// ServeHTTP routes the request to its handler
+func (server *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "healthz":
+		server.onlyGet(w, r, server.health)
+	case path == "readyz":
+		server.onlyGet(w, r, server.ready)
+	case path == "records":
+		if r.Method != "POST" {
+			writeError(w, methodNotAllowed(r.Method))
+			return
+		}
+		server.submit(w, r)
+	case len(parts) == 3 && parts[0] == "records" && parts[1] == "by-hash":
+		server.onlyGet(w, r, func(w http.ResponseWriter, r *http.Request) {
+			server.byHash(w, r, parts[2])
+		})
+	case len(parts) == 4 && parts[0] == "records" && parts[1] == "by-hash" && parts[3] == "data":
+		server.onlyGet(w, r, func(w http.ResponseWriter, r *http.Request) {
+			server.data(w, r, parts[2])
+		})
+	case len(parts) == 2 && parts[0] == "records":
+		server.onlyGet(w, r, func(w http.ResponseWriter, r *http.Request) {
+			server.head(w, r, parts[1])
+		})
+	case path == "chunks" || path == "trees":
+		if r.Method != "POST" {
+			writeError(w, methodNotAllowed(r.Method))
+			return
+		}
+		if path == "chunks" {
+			server.putChunk(w, r)
+		} else {
+			server.putTree(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "chunks":
+		server.onlyGet(w, r, func(w http.ResponseWriter, r *http.Request) {
+			server.chunk(w, r, parts[1])
+		})
+	case len(parts) == 2 && parts[0] == "trees":
+		server.onlyGet(w, r, func(w http.ResponseWriter, r *http.Request) {
+			server.tree(w, r, parts[1])
+		})
+	case path == "watch":
+		server.onlyGet(w, r, server.watch)
+	case len(parts) == 3 && parts[0] == "records" && parts[2] == "history":
+		server.onlyGet(w, r, func(w http.ResponseWriter, r *http.Request) {
+			server.history(w, r, parts[1])
+		})
+	default:
+		writeError(w, &apiError{http.StatusNotFound, "not_found", "no route for '" + r.URL.Path + "'"})
+	}
+}
+
+// health reports that the process is up
+func (server *server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ready reports whether the store can be read
+func (server *server) ready(w http.ResponseWriter, r *http.Request) {
+	if _, err := server.store.Head("readiness-probe"); err != nil && err != store.ErrNotFound {
+		writeError(w, &apiError{http.StatusServiceUnavailable, "not_ready", err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (server *server) onlyGet(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeError(w, methodNotAllowed(r.Method))
+		return
+	}
+	handler(w, r)
+}
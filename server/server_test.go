@@ -0,0 +1,494 @@
+package server_test
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/royvandewater/meshchain/delta"
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/limits"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/server"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// recordingPublisher stores the records it publishes and remembers them
+type recordingPublisher struct {
+	store     store.Store
+	published []record.Record
+}
+
+func (publisher *recordingPublisher) Publish(rec record.Record) error {
+	publisher.published = append(publisher.published, rec)
+	return publisher.store.Put(rec)
+}
+
+// storeLookup finds heads in another store
+type storeLookup struct {
+	store store.Store
+}
+
+func (lookup *storeLookup) Get(id string) (record.Record, error) {
+	return lookup.store.Head(id)
+}
+
+// rejectingValidator rejects the data of every record
+type rejectingValidator struct{}
+
+func (validator *rejectingValidator) Validate(rec record.Record, data io.Reader) error {
+	return fmt.Errorf("data at '/' must be of type 'object'")
+}
+
+var _ = Describe("Server", func() {
+	var sut http.Handler
+	var s store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+	var response *httptest.ResponseRecorder
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		sut.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	submit := func(rec record.Record) *httptest.ResponseRecorder {
+		recordJSON, err := rec.JSON()
+		Expect(err).To(BeNil())
+		return request("POST", "/records", recordJSON)
+	}
+
+	parseError := func(response *httptest.ResponseRecorder) errorResponse {
+		var parsed errorResponse
+		Expect(json.Unmarshal(response.Body.Bytes(), &parsed)).To(Succeed())
+		return parsed
+	}
+
+	BeforeEach(func() {
+		s = store.New(store.NewMemoryBackend())
+		sut = server.New(s, server.Options{})
+		records, privateKey = fixtures.GenerateChain(2)
+	})
+
+	Describe("POST /records", func() {
+		Describe("with a root record", func() {
+			BeforeEach(func() {
+				response = submit(records[0])
+			})
+
+			It("should respond with a 201", func() {
+				Expect(response.Code).To(Equal(http.StatusCreated))
+			})
+
+			It("should store the record", func() {
+				head, err := s.Head(records[0].Metadata().ID)
+				Expect(err).To(BeNil())
+				Expect(head.Data()).To(Equal(records[0].Data()))
+			})
+
+			It("should set the location of the record", func() {
+				hash, err := records[0].Hash()
+				Expect(err).To(BeNil())
+				Expect(response.Header().Get("Location")).To(Equal("/records/by-hash/" + hex.EncodeToString(hash)))
+			})
+
+			Describe("followed by its updates", func() {
+				BeforeEach(func() {
+					Expect(submit(records[1]).Code).To(Equal(http.StatusCreated))
+					response = submit(records[2])
+				})
+
+				It("should respond with a 201", func() {
+					Expect(response.Code).To(Equal(http.StatusCreated))
+				})
+			})
+		})
+
+		Describe("with an update whose parent is unknown", func() {
+			BeforeEach(func() {
+				response = submit(records[1])
+			})
+
+			It("should respond with a 409", func() {
+				Expect(response.Code).To(Equal(http.StatusConflict))
+				Expect(parseError(response).Error.Code).To(Equal("unknown_parent"))
+			})
+		})
+
+		Describe("with an update whose parent is not the head", func() {
+			BeforeEach(func() {
+				Expect(submit(records[0]).Code).To(Equal(http.StatusCreated))
+				Expect(submit(records[1]).Code).To(Equal(http.StatusCreated))
+
+				fork := fixtures.GenerateUpdateRecord(records[0], privateKey, "fork")
+				response = submit(fork)
+			})
+
+			It("should respond with a 409", func() {
+				Expect(response.Code).To(Equal(http.StatusConflict))
+				Expect(parseError(response).Error.Code).To(Equal("conflict"))
+			})
+		})
+
+		Describe("with a tampered record", func() {
+			BeforeEach(func() {
+				recordJSON, err := records[0].JSON()
+				Expect(err).To(BeNil())
+
+				var parsed map[string]interface{}
+				Expect(json.Unmarshal([]byte(recordJSON), &parsed)).To(Succeed())
+				parsed["data"] = "dGFtcGVyZWQ="
+				tampered, err := json.Marshal(parsed)
+				Expect(err).To(BeNil())
+
+				response = request("POST", "/records", string(tampered))
+			})
+
+			It("should respond with a 422", func() {
+				Expect(response.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(parseError(response).Error.Code).To(Equal("invalid_record"))
+			})
+		})
+
+		Describe("with invalid JSON", func() {
+			BeforeEach(func() {
+				response = request("POST", "/records", "{")
+			})
+
+			It("should respond with a 400", func() {
+				Expect(response.Code).To(Equal(http.StatusBadRequest))
+				Expect(parseError(response).Error.Code).To(Equal("bad_request"))
+			})
+		})
+	})
+
+	Describe("with a stored chain", func() {
+		var id string
+
+		BeforeEach(func() {
+			id = records[0].Metadata().ID
+			for _, rec := range records {
+				Expect(s.Put(rec)).To(Succeed())
+			}
+		})
+
+		Describe("GET /records/{id}", func() {
+			BeforeEach(func() {
+				response = request("GET", "/records/"+id, "")
+			})
+
+			It("should respond with the head", func() {
+				Expect(response.Code).To(Equal(http.StatusOK))
+
+				headJSON, err := records[2].JSON()
+				Expect(err).To(BeNil())
+				Expect(response.Body.String()).To(MatchJSON(headJSON))
+			})
+		})
+
+		Describe("GET /records/{id}/history", func() {
+			var parsed struct {
+				ID       string            `json:"id"`
+				Complete bool              `json:"complete"`
+				Records  []json.RawMessage `json:"records"`
+			}
+
+			BeforeEach(func() {
+				response = request("GET", "/records/"+id+"/history", "")
+				Expect(json.Unmarshal(response.Body.Bytes(), &parsed)).To(Succeed())
+			})
+
+			It("should respond with every record", func() {
+				Expect(response.Code).To(Equal(http.StatusOK))
+				Expect(parsed.ID).To(Equal(id))
+				Expect(parsed.Complete).To(BeTrue())
+				Expect(parsed.Records).To(HaveLen(3))
+			})
+		})
+
+		Describe("GET /records/by-hash/{hash}", func() {
+			BeforeEach(func() {
+				hash, err := records[1].Hash()
+				Expect(err).To(BeNil())
+				response = request("GET", "/records/by-hash/"+hex.EncodeToString(hash), "")
+			})
+
+			It("should respond with the record", func() {
+				Expect(response.Code).To(Equal(http.StatusOK))
+
+				recordJSON, err := records[1].JSON()
+				Expect(err).To(BeNil())
+				Expect(response.Body.String()).To(MatchJSON(recordJSON))
+			})
+		})
+	})
+
+	Describe("GET /records/{id} for an unknown ID", func() {
+		BeforeEach(func() {
+			response = request("GET", "/records/unknown", "")
+		})
+
+		It("should respond with a structured 404", func() {
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+			Expect(parseError(response).Error.Code).To(Equal("not_found"))
+		})
+	})
+
+	Describe("GET /records/{id} with a Lookup", func() {
+		BeforeEach(func() {
+			remote := store.New(store.NewMemoryBackend())
+			Expect(remote.Put(records[0])).To(Succeed())
+			sut = server.New(s, server.Options{Lookup: &storeLookup{store: remote}})
+		})
+
+		It("should respond with the head found by the Lookup", func() {
+			response = request("GET", "/records/"+records[0].Metadata().ID, "")
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(ContainSubstring(records[0].Metadata().ID))
+		})
+
+		It("should respond with a 404 if the Lookup finds nothing", func() {
+			response = request("GET", "/records/unknown", "")
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("DELETE /records/{id}", func() {
+		BeforeEach(func() {
+			response = request("DELETE", "/records/whatever", "")
+		})
+
+		It("should respond with a 405", func() {
+			Expect(response.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(parseError(response).Error.Code).To(Equal("method_not_allowed"))
+		})
+	})
+
+	Describe("with a limiter", func() {
+		BeforeEach(func() {
+			sut = server.New(s, server.Options{
+				Limiter: limits.New(s, limits.Config{PerID: limits.Rate{PerSecond: 0.5, Burst: 1}}),
+			})
+			Expect(submit(records[0]).Code).To(Equal(http.StatusCreated))
+			response = submit(records[1])
+		})
+
+		It("should respond with a structured 429", func() {
+			Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(response.Header().Get("Retry-After")).To(Equal("2"))
+
+			var parsed struct {
+				Error struct {
+					Code  string `json:"code"`
+					Limit struct {
+						Kind              string  `json:"kind"`
+						Key               string  `json:"key"`
+						RetryAfterSeconds float64 `json:"retryAfterSeconds"`
+					} `json:"limit"`
+				} `json:"error"`
+			}
+			Expect(json.Unmarshal(response.Body.Bytes(), &parsed)).To(Succeed())
+			Expect(parsed.Error.Code).To(Equal("rate_limited"))
+			Expect(parsed.Error.Limit.Kind).To(Equal(limits.KindID))
+			Expect(parsed.Error.Limit.Key).To(Equal(records[0].Metadata().ID))
+			Expect(parsed.Error.Limit.RetryAfterSeconds).To(BeNumerically(">", 0))
+		})
+
+		It("should not store the record", func() {
+			head, err := s.Head(records[0].Metadata().ID)
+			Expect(err).To(BeNil())
+			Expect(head.Data()).To(Equal(records[0].Data()))
+		})
+	})
+
+	Describe("with a publisher", func() {
+		var publisher *recordingPublisher
+
+		BeforeEach(func() {
+			publisher = &recordingPublisher{store: s}
+			sut = server.New(s, server.Options{Publisher: publisher})
+			response = submit(records[0])
+		})
+
+		It("should publish the record", func() {
+			Expect(response.Code).To(Equal(http.StatusCreated))
+			Expect(publisher.published).To(HaveLen(1))
+			Expect(publisher.published[0].Data()).To(Equal(records[0].Data()))
+		})
+	})
+
+	Describe("with a validator", func() {
+		BeforeEach(func() {
+			sut = server.New(s, server.Options{Validator: &rejectingValidator{}})
+			response = submit(records[0])
+		})
+
+		It("should respond with a 422", func() {
+			Expect(response.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(parseError(response).Error.Code).To(Equal("invalid_data"))
+			Expect(parseError(response).Error.Message).To(Equal("data at '/' must be of type 'object'"))
+		})
+
+		It("should not store the record", func() {
+			_, err := s.Head(records[0].Metadata().ID)
+			Expect(err).To(Equal(store.ErrNotFound))
+		})
+	})
+
+	Describe("with a record that has expired", func() {
+		var expired record.Record
+
+		BeforeEach(func() {
+			now := time.Now()
+			expired = fixtures.GenerateRootRecordWithin(now.Add(-2*time.Hour), now.Add(-time.Hour))
+			response = submit(expired)
+		})
+
+		It("should respond with a 422", func() {
+			Expect(response.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(parseError(response).Error.Code).To(Equal("outside_validity"))
+		})
+
+		It("should not store the record", func() {
+			_, err := s.Head(expired.Metadata().ID)
+			Expect(err).To(Equal(store.ErrNotFound))
+		})
+	})
+
+	Describe("with a delta of the head", func() {
+		var update record.Record
+
+		BeforeEach(func() {
+			Expect(s.Put(records[0])).To(Succeed())
+			Expect(s.Put(records[1])).To(Succeed())
+		})
+
+		Describe("that applies to the parent", func() {
+			BeforeEach(func() {
+				update = fixtures.GenerateDeltaUpdate(records[1], privateKey, delta.Binary, delta.CreateBinary([]byte(`a`), []byte(`abc`)))
+				response = submit(update)
+			})
+
+			It("should respond with a 201", func() {
+				Expect(response.Code).To(Equal(http.StatusCreated))
+			})
+
+			It("should serve the full data at GET /records/by-hash/{hash}/data", func() {
+				hash, err := update.Hash()
+				Expect(err).To(BeNil())
+
+				response = request("GET", "/records/by-hash/"+hex.EncodeToString(hash)+"/data", "")
+				Expect(response.Code).To(Equal(http.StatusOK))
+				Expect(response.Header().Get("Content-Type")).To(Equal("application/octet-stream"))
+				Expect(response.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+				Expect(response.Header().Get("Content-Disposition")).To(BeEmpty())
+				Expect(response.Body.String()).To(Equal("abc"))
+			})
+		})
+
+		Describe("that does not apply to the parent", func() {
+			BeforeEach(func() {
+				update = fixtures.GenerateDeltaUpdate(records[1], privateKey, delta.JSONPatch, []byte(`[]`))
+				response = submit(update)
+			})
+
+			It("should respond with a 422", func() {
+				Expect(response.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(parseError(response).Error.Code).To(Equal("invalid_delta"))
+			})
+
+			It("should not store the record", func() {
+				Expect(s.Head(records[0].Metadata().ID)).To(Equal(records[1]))
+			})
+		})
+	})
+
+	Describe("GET /records/by-hash/{hash}/data", func() {
+		dataOf := func(contentType string) *httptest.ResponseRecorder {
+			rec, _ := fixtures.GenerateRootRecord(record.Metadata{ContentType: contentType})
+			Expect(s.Put(rec)).To(Succeed())
+			return request("GET", "/records/by-hash/"+hex.EncodeToString(fixtures.MustHash(rec))+"/data", "")
+		}
+
+		Describe("for a content type that is safe inline", func() {
+			BeforeEach(func() {
+				response = dataOf("text/plain; charset=utf-8")
+			})
+
+			It("should serve the data inline without sniffing", func() {
+				Expect(response.Code).To(Equal(http.StatusOK))
+				Expect(response.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+				Expect(response.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+				Expect(response.Header().Get("Content-Disposition")).To(BeEmpty())
+			})
+		})
+
+		Describe("for a content type that could run scripts", func() {
+			BeforeEach(func() {
+				response = dataOf("text/html")
+			})
+
+			It("should serve the data as an attachment", func() {
+				Expect(response.Code).To(Equal(http.StatusOK))
+				Expect(response.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+				Expect(response.Header().Get("Content-Disposition")).To(Equal("attachment"))
+			})
+		})
+
+		Describe("for an invalid content type", func() {
+			BeforeEach(func() {
+				response = dataOf("text/html; =")
+			})
+
+			It("should serve the data as an attachment", func() {
+				Expect(response.Header().Get("Content-Disposition")).To(Equal("attachment"))
+			})
+		})
+	})
+
+	Describe("GET /records/by-hash/{hash}/data for an unknown hash", func() {
+		It("should respond with a 404", func() {
+			response = request("GET", "/records/by-hash/abcd/data", "")
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+			Expect(parseError(response).Error.Code).To(Equal("not_found"))
+		})
+	})
+
+	Describe("with a record that is valid within the skew", func() {
+		It("should store the record", func() {
+			now := time.Now()
+			sut = server.New(s, server.Options{Validity: record.Validity{Skew: time.Hour}})
+			response = submit(fixtures.GenerateRootRecordWithin(now.Add(time.Minute), now.Add(2*time.Hour)))
+			Expect(response.Code).To(Equal(http.StatusCreated))
+		})
+	})
+
+	Describe("GET /healthz", func() {
+		It("should respond with a 200", func() {
+			Expect(request("GET", "/healthz", "").Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("GET /readyz", func() {
+		It("should respond with a 200", func() {
+			Expect(request("GET", "/readyz", "").Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// watch streams every record accepted by the store as Server-Sent
+// Events. Each event's id is the record's cursor in the change log.
+// Clients resume after reconnecting by sending it back as either the
+// Last-Event-ID header, which EventSource does automatically, or the
+// cursor query parameter. Without a cursor only new records are sent.
+// The id query parameter, which may be repeated, limits the stream to
+// the chains for those IDs
+func (server *server) watch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, internalError(fmt.Errorf("streaming is not supported")))
+		return
+	}
+
+	cursor, err := server.watchCursor(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	subscription := server.store.Subscribe(r.URL.Query()["id"], cursor)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case change, ok := <-subscription.Changes():
+			if !ok {
+				return
+			}
+
+			recordJSON, err := change.Record.JSON()
+			if err != nil {
+				return
+			}
+
+			fmt.Fprintf(w, "id: %v\nevent: record\ndata: %v\n\n", change.Cursor, recordJSON)
+			flusher.Flush()
+		}
+	}
+}
+
+// watchCursor returns the cursor to resume from, defaulting to
+// the current cursor of the store so that only new records are sent
+func (server *server) watchCursor(r *http.Request) (uint64, *apiError) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("cursor")
+	}
+
+	if value == "" {
+		cursor, err := server.store.Cursor()
+		if err != nil {
+			return 0, internalError(err)
+		}
+		return cursor, nil
+	}
+
+	cursor, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, badRequest("cursor must be a non-negative integer")
+	}
+	return cursor, nil
+}
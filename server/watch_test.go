@@ -0,0 +1,159 @@
+package server_test
+
+import (
+	"bufio"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/royvandewater/meshchain/internal/fixtures"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/server"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type event struct {
+	id   string
+	name string
+	data string
+}
+
+// readEvents parses Server-Sent Events from the reader onto the channel
+func readEvents(reader *bufio.Reader, events chan<- event) {
+	defer GinkgoRecover()
+	defer close(events)
+
+	current := event{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			events <- current
+			current = event{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+var _ = Describe("Watch", func() {
+	var httpServer *httptest.Server
+	var s store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+	var response *http.Response
+	var events chan event
+
+	watch := func(query string, lastEventID string) {
+		request, err := http.NewRequest("GET", httpServer.URL+"/watch"+query, nil)
+		Expect(err).To(BeNil())
+		if lastEventID != "" {
+			request.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		response, err = http.DefaultClient.Do(request)
+		Expect(err).To(BeNil())
+
+		events = make(chan event, 10)
+		go readEvents(bufio.NewReader(response.Body), events)
+	}
+
+	BeforeEach(func() {
+		s = store.New(store.NewMemoryBackend())
+		httpServer = httptest.NewServer(server.New(s, server.Options{}))
+
+		records, privateKey = fixtures.GenerateChain(1)
+		for _, rec := range records {
+			Expect(s.Put(rec)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		response.Body.Close()
+		httpServer.Close()
+	})
+
+	Describe("from the beginning of the change log", func() {
+		BeforeEach(func() {
+			watch("?cursor=0", "")
+		})
+
+		It("should respond with an event stream", func() {
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(response.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+		})
+
+		It("should send the existing records followed by new ones", func() {
+			var received event
+
+			Eventually(events).Should(Receive(&received))
+			Expect(received.id).To(Equal("1"))
+			Expect(received.name).To(Equal("record"))
+			rootJSON, err := records[0].JSON()
+			Expect(err).To(BeNil())
+			Expect(received.data).To(MatchJSON(rootJSON))
+
+			Eventually(events).Should(Receive(&received))
+			Expect(received.id).To(Equal("2"))
+
+			update := fixtures.GenerateUpdateRecord(records[1], privateKey, "update")
+			Expect(s.Put(update)).To(Succeed())
+
+			Eventually(events).Should(Receive(&received))
+			Expect(received.id).To(Equal("3"))
+			updateJSON, err := update.JSON()
+			Expect(err).To(BeNil())
+			Expect(received.data).To(MatchJSON(updateJSON))
+		})
+	})
+
+	Describe("when resuming with Last-Event-ID", func() {
+		BeforeEach(func() {
+			watch("", "1")
+		})
+
+		It("should send the records after it", func() {
+			var received event
+			Eventually(events).Should(Receive(&received))
+			Expect(received.id).To(Equal("2"))
+		})
+	})
+
+	Describe("when filtering by ID", func() {
+		BeforeEach(func() {
+			other, _ := fixtures.GenerateChain(0)
+			Expect(s.Put(other[0])).To(Succeed())
+
+			watch("?cursor=0&id="+other[0].Metadata().ID, "")
+		})
+
+		It("should only send records for that ID", func() {
+			var received event
+			Eventually(events).Should(Receive(&received))
+			Expect(received.id).To(Equal("3"))
+		})
+	})
+
+	Describe("with an invalid cursor", func() {
+		BeforeEach(func() {
+			watch("?cursor=nope", "")
+		})
+
+		It("should respond with a 400", func() {
+			Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,18 @@
+package store
+
+// Backend is the raw key/value storage underneath a Store. Keys
+// are slash separated paths such as "records/<hash>"
+type Backend interface {
+	// Delete removes the value stored at key. Deleting
+	// a key that does not exist is not an error
+	Delete(key string) error
+
+	// Get returns the value stored at key, or ErrNotFound
+	Get(key string) ([]byte, error)
+
+	// Keys returns every key starting with prefix, sorted
+	Keys(prefix string) ([]string, error)
+
+	// Put stores the value at key, replacing any previous value
+	Put(key string, value []byte) error
+}
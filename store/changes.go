@@ -0,0 +1,320 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/royvandewater/meshchain/record"
+)
+
+// The change log lists every accepted record in the order it was
+// stored. Each entry is stored at "changes/<cursor>", with the cursor
+// zero padded so that the keys sort in order. The change of a record
+// is removed when the record is pruned or expires, so the log only
+// grows with the records that are retained
+const changesPrefix = "changes/"
+
+// Change is a record that was accepted by the store
+type Change struct {
+	// Cursor is the position of the change in the change log.
+	// Subscribing with it resumes after this change
+	Cursor uint64
+
+	// ID is the metadata.ID of the record
+	ID string
+
+	Record record.Record
+}
+
+// Subscription delivers the changes to the chains it was
+// subscribed to, oldest first, until it is closed
+type Subscription interface {
+	// Changes returns the channel the changes are delivered on. It
+	// is closed when the subscription is closed or fails
+	Changes() <-chan Change
+
+	// Close stops the subscription and closes the Changes channel
+	Close()
+
+	// Err returns the error that stopped the subscription, if any
+	Err() error
+}
+
+type changeEntry struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// Changes returns up to limit changes after the cursor, oldest
+// first. Changes whose record has since been pruned are skipped
+func (store *store) Changes(cursor uint64, limit int) ([]Change, error) {
+	store.mutex.Lock()
+	first, last, err := store.cursors()
+	store.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if cursor < first {
+		cursor = first - 1
+	}
+
+	var changes []Change
+	for keyCursor := cursor + 1; keyCursor <= last && len(changes) != limit; keyCursor++ {
+		data, err := store.backend.Get(changeKey(keyCursor))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &changeEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return nil, fmt.Errorf("Failed to decode change '%v': %v", keyCursor, err.Error())
+		}
+
+		rec, err := store.getHex(entry.Hash)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, Change{Cursor: keyCursor, ID: entry.ID, Record: rec})
+	}
+	return changes, nil
+}
+
+// Cursor returns the cursor of the most recent change
+func (store *store) Cursor() (uint64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	_, last, err := store.cursors()
+	return last, err
+}
+
+// Subscribe delivers every change after the cursor to the chains for
+// the IDs, or to every chain if no IDs are given
+func (store *store) Subscribe(ids []string, cursor uint64) Subscription {
+	subscription := &subscription{
+		store:   store,
+		ids:     make(map[string]bool),
+		cursor:  cursor,
+		changes: make(chan Change),
+		notify:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+	for _, id := range ids {
+		subscription.ids[id] = true
+	}
+
+	store.subscribers.add(subscription.notify)
+	go subscription.run()
+	return subscription
+}
+
+// appendChange adds the record to the change log at the cursor, which
+// must follow the most recent change. It must be called with the
+// store's mutex held
+func (store *store) appendChange(cursor uint64, id, hashHex string) error {
+	data, err := json.Marshal(&changeEntry{ID: id, Hash: hashHex})
+	if err != nil {
+		return err
+	}
+
+	if err := store.backend.Put(changeKey(cursor), data); err != nil {
+		return err
+	}
+
+	store.cursor = cursor
+	store.subscribers.notifyAll()
+	return nil
+}
+
+// removeChanges removes the changes of the records of the index
+// entries from the change log, then moves the first cursor past
+// any changes that are missing from the start of the log. The most
+// recent change is kept, even if its record is gone, so that its
+// cursor is read back and never reused. It must be called with the
+// store's mutex held
+func (store *store) removeChanges(entries []indexEntry) error {
+	first, last, err := store.cursors()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Cursor == 0 || entry.Cursor == last {
+			continue
+		}
+		if err := store.backend.Delete(changeKey(entry.Cursor)); err != nil {
+			return err
+		}
+	}
+
+	for ; first <= last; first++ {
+		_, err := store.backend.Get(changeKey(first))
+		if err == nil {
+			break
+		}
+		if err != ErrNotFound {
+			return err
+		}
+	}
+	store.firstCursor = first
+	return nil
+}
+
+// cursors returns the cursors of the oldest and the most recent
+// change, reading them from the backend the first time. The log is
+// empty when first is past last. It must be called with the store's
+// mutex held
+func (store *store) cursors() (first, last uint64, err error) {
+	if store.cursorLoaded {
+		return store.firstCursor, store.cursor, nil
+	}
+
+	keys, err := store.backend.Keys(changesPrefix)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	store.firstCursor, store.cursor = 1, 0
+	if len(keys) != 0 {
+		store.firstCursor, err = parseChangeKey(keys[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		store.cursor, err = parseChangeKey(keys[len(keys)-1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	store.cursorLoaded = true
+	return store.firstCursor, store.cursor, nil
+}
+
+func changeKey(cursor uint64) string {
+	return fmt.Sprintf("%v%020d", changesPrefix, cursor)
+}
+
+func parseChangeKey(key string) (uint64, error) {
+	cursor, err := strconv.ParseUint(strings.TrimPrefix(key, changesPrefix), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid change log key '%v'", key)
+	}
+	return cursor, nil
+}
+
+// subscribers wakes up subscriptions when a change is appended
+type subscribers struct {
+	lock     sync.Mutex
+	channels map[chan struct{}]bool
+}
+
+func (subscribers *subscribers) add(notify chan struct{}) {
+	subscribers.lock.Lock()
+	defer subscribers.lock.Unlock()
+
+	if subscribers.channels == nil {
+		subscribers.channels = make(map[chan struct{}]bool)
+	}
+	subscribers.channels[notify] = true
+}
+
+func (subscribers *subscribers) remove(notify chan struct{}) {
+	subscribers.lock.Lock()
+	defer subscribers.lock.Unlock()
+
+	delete(subscribers.channels, notify)
+}
+
+// notifyAll wakes up every subscription without blocking. A
+// subscription that already has a pending wake up doesn't need another
+func (subscribers *subscribers) notifyAll() {
+	subscribers.lock.Lock()
+	defer subscribers.lock.Unlock()
+
+	for notify := range subscribers.channels {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscriptionBatchSize is how many changes a
+// subscription reads from the change log at a time
+const subscriptionBatchSize = 100
+
+type subscription struct {
+	store   *store
+	ids     map[string]bool
+	cursor  uint64
+	changes chan Change
+	notify  chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error
+}
+
+func (subscription *subscription) Changes() <-chan Change {
+	return subscription.changes
+}
+
+func (subscription *subscription) Close() {
+	subscription.closeOnce.Do(func() {
+		close(subscription.closed)
+	})
+}
+
+// Err must only be called once the Changes channel is closed
+func (subscription *subscription) Err() error {
+	return subscription.err
+}
+
+// run reads the change log from the cursor until it is caught up,
+// then waits to be notified of new changes
+func (subscription *subscription) run() {
+	defer close(subscription.changes)
+	defer subscription.store.subscribers.remove(subscription.notify)
+
+	for {
+		changes, err := subscription.store.Changes(subscription.cursor, subscriptionBatchSize)
+		if err != nil {
+			subscription.err = err
+			return
+		}
+
+		for _, change := range changes {
+			subscription.cursor = change.Cursor
+			if len(subscription.ids) != 0 && !subscription.ids[change.ID] {
+				continue
+			}
+
+			select {
+			case subscription.changes <- change:
+			case <-subscription.closed:
+				return
+			}
+		}
+
+		if len(changes) != 0 {
+			continue
+		}
+
+		select {
+		case <-subscription.notify:
+		case <-subscription.closed:
+			return
+		}
+	}
+}
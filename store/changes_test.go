@@ -0,0 +1,201 @@
+package store_test
+
+import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Changes", func() {
+	var sut store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+	var other []record.Record
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+		records, privateKey = generateChain(1)
+		other, _ = generateChain(0)
+
+		Expect(sut.Put(records[0])).To(Succeed())
+		Expect(sut.Put(other[0])).To(Succeed())
+		Expect(sut.Put(records[1])).To(Succeed())
+	})
+
+	Describe("Cursor", func() {
+		It("should return the cursor of the last change", func() {
+			Expect(sut.Cursor()).To(Equal(uint64(3)))
+		})
+
+		It("should not count records that were already stored", func() {
+			Expect(sut.Put(records[1])).To(Succeed())
+			Expect(sut.Cursor()).To(Equal(uint64(3)))
+		})
+
+		It("should be read back from the backend", func() {
+			backend := store.NewMemoryBackend()
+			first := store.New(backend)
+			Expect(first.Put(records[0])).To(Succeed())
+
+			Expect(store.New(backend).Cursor()).To(Equal(uint64(1)))
+		})
+	})
+
+	Describe("Changes", func() {
+		It("should return every change in order", func() {
+			changes, err := sut.Changes(0, 10)
+			Expect(err).To(BeNil())
+			Expect(changes).To(HaveLen(3))
+			Expect(changes[0].Cursor).To(Equal(uint64(1)))
+			Expect(changes[0].Record.Hash()).To(Equal(mustHash(records[0])))
+			Expect(changes[1].ID).To(Equal(other[0].Metadata().ID))
+			Expect(changes[2].Record.Hash()).To(Equal(mustHash(records[1])))
+		})
+
+		It("should return the changes after the cursor, up to the limit", func() {
+			changes, err := sut.Changes(1, 1)
+			Expect(err).To(BeNil())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Cursor).To(Equal(uint64(2)))
+		})
+
+		It("should not list the change log keys once the cursors are known", func() {
+			backend := &countingBackend{Backend: store.NewMemoryBackend()}
+			counted := store.New(backend)
+			Expect(counted.Put(records[0])).To(Succeed())
+			Expect(counted.Put(records[1])).To(Succeed())
+
+			for i := 0; i < 3; i++ {
+				Expect(counted.Changes(0, 10)).To(HaveLen(2))
+			}
+			Expect(backend.keys).To(Equal(1))
+		})
+	})
+
+	Describe("when the chain is pruned", func() {
+		var update record.Record
+
+		BeforeEach(func() {
+			update = generateUpdateRecord(records[1], privateKey, "update")
+			Expect(sut.Put(update)).To(Succeed())
+
+			_, err := sut.Prune(store.RetentionPolicies{Default: store.RetentionPolicy{KeepLast: 1}}, time.Now())
+			Expect(err).To(BeNil())
+		})
+
+		It("should remove the changes of the pruned records", func() {
+			changes, err := sut.Changes(0, 10)
+			Expect(err).To(BeNil())
+			Expect(changes).To(HaveLen(3))
+			Expect(changes[0].Cursor).To(Equal(uint64(2)))
+			Expect(changes[1].Record.Hash()).To(Equal(mustHash(records[1])))
+			Expect(changes[2].Record.Hash()).To(Equal(mustHash(update)))
+		})
+
+		It("should read the first cursor back from the backend", func() {
+			backend := store.NewMemoryBackend()
+			first := store.New(backend)
+			Expect(first.Put(records[0])).To(Succeed())
+			Expect(first.Put(records[1])).To(Succeed())
+			Expect(first.Put(update)).To(Succeed())
+			_, err := first.Prune(store.RetentionPolicies{Default: store.RetentionPolicy{KeepLast: 1}}, time.Now())
+			Expect(err).To(BeNil())
+
+			changes, err := store.New(backend).Changes(0, 10)
+			Expect(err).To(BeNil())
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Cursor).To(Equal(uint64(2)))
+		})
+	})
+
+	Describe("when every chain expires", func() {
+		var backend store.Backend
+
+		BeforeEach(func() {
+			backend = store.NewMemoryBackend()
+			expiring := store.New(backend)
+			Expect(expiring.Put(records[0])).To(Succeed())
+			Expect(expiring.Put(generateExpiringUpdate(records[0], privateKey, time.Now().Add(-time.Minute)))).To(Succeed())
+
+			_, err := expiring.Expire(time.Now())
+			Expect(err).To(BeNil())
+		})
+
+		It("should not return the changes of the removed records", func() {
+			Expect(store.New(backend).Changes(0, 10)).To(BeEmpty())
+		})
+
+		It("should not reuse their cursors", func() {
+			reopened := store.New(backend)
+			Expect(reopened.Cursor()).To(Equal(uint64(2)))
+
+			Expect(reopened.Put(other[0])).To(Succeed())
+			Expect(reopened.Cursor()).To(Equal(uint64(3)))
+		})
+
+		It("should only keep the most recent change", func() {
+			Expect(backend.Keys("changes/")).To(HaveLen(1))
+		})
+	})
+
+	Describe("Subscribe", func() {
+		var subscription store.Subscription
+
+		AfterEach(func() {
+			subscription.Close()
+			Eventually(subscription.Changes()).Should(BeClosed())
+		})
+
+		Describe("to every chain from the beginning", func() {
+			BeforeEach(func() {
+				subscription = sut.Subscribe(nil, 0)
+			})
+
+			It("should deliver the existing changes followed by new ones", func() {
+				for _, cursor := range []uint64{1, 2, 3} {
+					var change store.Change
+					Eventually(subscription.Changes()).Should(Receive(&change))
+					Expect(change.Cursor).To(Equal(cursor))
+				}
+
+				update := generateUpdateRecord(records[1], privateKey, "update")
+				Expect(sut.Put(update)).To(Succeed())
+
+				var change store.Change
+				Eventually(subscription.Changes()).Should(Receive(&change))
+				Expect(change.Cursor).To(Equal(uint64(4)))
+				Expect(change.Record.Data()).To(Equal([]byte(`update`)))
+			})
+		})
+
+		Describe("to a single chain from a cursor", func() {
+			BeforeEach(func() {
+				subscription = sut.Subscribe([]string{records[0].Metadata().ID}, 1)
+			})
+
+			It("should only deliver the changes to that chain after the cursor", func() {
+				var change store.Change
+				Eventually(subscription.Changes()).Should(Receive(&change))
+				Expect(change.Cursor).To(Equal(uint64(3)))
+
+				Consistently(subscription.Changes(), 50*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+	})
+})
+
+// countingBackend counts how often the keys of the backend are listed
+type countingBackend struct {
+	store.Backend
+	keys int
+}
+
+func (backend *countingBackend) Keys(prefix string) ([]string, error) {
+	backend.keys++
+	return backend.Backend.Keys(prefix)
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+)
+
+// Chunks are stored at "chunks/<leaf hash>", so a chunk shared by
+// several versions or chains is only stored once. The leaves of a
+// tree are stored at "trees/<root>", concatenated. Prune and Expire
+// leave both in place, since other records may share them, and
+// CollectGarbage removes the ones no stored record references.
+// Every put of a chunk or tree writes the time to an upload marker
+// at "uploads/<key>", so that uploads for a record that hasn't been
+// put yet are only collected once they are old
+const (
+	chunksPrefix  = "chunks/"
+	treesPrefix   = "trees/"
+	uploadsPrefix = "uploads/"
+)
+
+// hashSize is the size of a leaf hash
+const hashSize = 32
+
+// ChunksError is returned by Put for a record whose
+// metadata.Manifest describes chunks that aren't stored,
+// which must be put before the record
+type ChunksError struct {
+	Message string
+}
+
+func (err *ChunksError) Error() string {
+	return err.Message
+}
+
+// Chunk returns the chunk with the leaf hash
+func (store *store) Chunk(hash []byte) ([]byte, error) {
+	return store.backend.Get(chunksPrefix + hex.EncodeToString(hash))
+}
+
+// PutChunk stores the chunk under its leaf hash,
+// unless a chunk with the same hash is stored
+func (store *store) PutChunk(chunk []byte) ([]byte, error) {
+	hash := chunks.LeafHash(chunk)
+	key := chunksPrefix + hex.EncodeToString(hash)
+
+	_, err := store.backend.Get(key)
+	if err == ErrNotFound {
+		err = store.backend.Put(key, chunk)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.markUpload(key); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// PutTree stores the leaves of the tree with the
+// root, unless they are not the leaves of that root
+func (store *store) PutTree(root []byte, leaves [][]byte) error {
+	value := make([]byte, 0, len(leaves)*hashSize)
+	for i, leaf := range leaves {
+		if len(leaf) != hashSize {
+			return fmt.Errorf("leaf at index '%v' is not a sha256 hash", i)
+		}
+		value = append(value, leaf...)
+	}
+	if !bytes.Equal(chunks.Root(leaves), root) {
+		return fmt.Errorf("leaves do not match the root '%v'", hex.EncodeToString(root))
+	}
+
+	key := treesPrefix + hex.EncodeToString(root)
+	if err := store.backend.Put(key, value); err != nil {
+		return err
+	}
+	return store.markUpload(key)
+}
+
+// Tree returns the leaves of the tree with the root
+func (store *store) Tree(root []byte) ([][]byte, error) {
+	value, err := store.backend.Get(treesPrefix + hex.EncodeToString(root))
+	if err != nil {
+		return nil, err
+	}
+	if len(value)%hashSize != 0 {
+		return nil, fmt.Errorf("Failed to decode tree '%v'", hex.EncodeToString(root))
+	}
+
+	leaves := make([][]byte, len(value)/hashSize)
+	for i := range leaves {
+		leaves[i] = value[i*hashSize : (i+1)*hashSize]
+	}
+	return leaves, nil
+}
+
+// markUpload writes the current time to the upload
+// marker of the chunk or tree stored at key
+func (store *store) markUpload(key string) error {
+	now, err := time.Now().MarshalText()
+	if err != nil {
+		return err
+	}
+	return store.backend.Put(uploadsPrefix+key, now)
+}
+
+// checkChunks returns a *ChunksError unless the tree and every
+// chunk of the data described by the manifest are stored
+func (store *store) checkChunks(manifest *chunks.Manifest) error {
+	leaves, err := chunks.VerifiedLeaves(store, manifest)
+	if err != nil {
+		return &ChunksError{fmt.Sprintf("the chunks of manifest.Root '%v' are not stored: %v", hex.EncodeToString(manifest.Root), err.Error())}
+	}
+
+	for i, leaf := range leaves {
+		_, err := store.backend.Get(chunksPrefix + hex.EncodeToString(leaf))
+		if err == ErrNotFound {
+			return &ChunksError{fmt.Sprintf("chunk '%v' of manifest.Root '%v' is not stored", i, hex.EncodeToString(manifest.Root))}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package store_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"io/ioutil"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chunks", func() {
+	var backend store.Backend
+	var sut store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+	var manifest *chunks.Manifest
+
+	BeforeEach(func() {
+		backend = store.NewMemoryBackend()
+		sut = store.New(backend)
+
+		records, privateKey = generateChain(0)
+		Expect(sut.Put(records[0])).To(Succeed())
+	})
+
+	Describe("PutTree", func() {
+		var leaves [][]byte
+
+		BeforeEach(func() {
+			var err error
+			manifest, err = chunks.Write(sut, bytes.NewReader(make([]byte, 3000)), 1000)
+			Expect(err).To(BeNil())
+			leaves, err = sut.Tree(manifest.Root)
+			Expect(err).To(BeNil())
+		})
+
+		It("should refuse leaves that aren't the tree of the root", func() {
+			err := sut.PutTree(manifest.Root, leaves[:2])
+			Expect(err).To(MatchError("leaves do not match the root '" + hex.EncodeToString(manifest.Root) + "'"))
+		})
+	})
+
+	Describe("Put with a metadata.Manifest", func() {
+		Describe("when the chunks are stored", func() {
+			It("should store the record", func() {
+				var err error
+				manifest, err = chunks.Write(sut, bytes.NewReader([]byte("chunked data")), 4)
+				Expect(err).To(BeNil())
+
+				update := generateChunkedUpdate(records[0], privateKey, manifest)
+				Expect(sut.Put(update)).To(Succeed())
+				Expect(sut.Data(mustHash(update))).To(Equal([]byte("chunked data")))
+			})
+
+			It("should stream the data from the chunks", func() {
+				var err error
+				manifest, err = chunks.Write(sut, bytes.NewReader([]byte("chunked data")), 4)
+				Expect(err).To(BeNil())
+
+				update := generateChunkedUpdate(records[0], privateKey, manifest)
+				Expect(sut.Put(update)).To(Succeed())
+
+				reader, err := sut.DataReader(mustHash(update))
+				Expect(err).To(BeNil())
+				Expect(ioutil.ReadAll(reader)).To(Equal([]byte("chunked data")))
+			})
+		})
+
+		Describe("when the chunks are stored elsewhere", func() {
+			var update record.Record
+
+			BeforeEach(func() {
+				var err error
+				manifest, err = chunks.Write(store.New(store.NewMemoryBackend()), bytes.NewReader([]byte("chunked data")), 4)
+				Expect(err).To(BeNil())
+				update = generateChunkedUpdate(records[0], privateKey, manifest)
+			})
+
+			It("should return a *ChunksError", func() {
+				err := sut.Put(update)
+				Expect(err).To(BeAssignableToTypeOf(&store.ChunksError{}))
+				Expect(sut.Hashes(records[0].Metadata().ID)).To(HaveLen(1))
+			})
+
+			Describe("when only the tree is stored", func() {
+				It("should return a *ChunksError", func() {
+					leaves := [][]byte{chunks.LeafHash([]byte("chun")), chunks.LeafHash([]byte("ked ")), chunks.LeafHash([]byte("data"))}
+					Expect(sut.PutTree(manifest.Root, leaves)).To(Succeed())
+
+					err := sut.Put(update)
+					Expect(err).To(MatchError("chunk '0' of manifest.Root '" + hex.EncodeToString(manifest.Root) + "' is not stored"))
+				})
+			})
+		})
+	})
+})
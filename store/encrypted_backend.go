@@ -0,0 +1,255 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// encryptedVersion is the first byte of every encrypted value
+const encryptedVersion byte = 1
+
+// encryptedHeaderSize is the size of the version byte
+// and the master key ID that precede the nonce
+const encryptedHeaderSize = 5
+
+// MasterKey is a secret from which the keys that encrypt each
+// value are derived. The ID is stored alongside every value so
+// that values can still be decrypted after the key is rotated
+type MasterKey struct {
+	ID  uint32
+	Key []byte
+}
+
+// EncryptedBackend is a Backend that encrypts every value with
+// AES-256-GCM before handing it to the backend it wraps. Keys are
+// stored in the clear. Each value is encrypted with a key derived from
+// the active master key and the value's key, which is also used as
+// additional data so that values cannot be swapped between keys
+type EncryptedBackend interface {
+	Backend
+
+	// Reencrypt rewrites every value that was encrypted with a previous
+	// master key using the active one, returning how many were rewritten.
+	// Once it completes, previous master keys are no longer needed.
+	// A value written while it runs may be overwritten with its old
+	// contents, so the backend of a Store is rotated with Store.Reencrypt,
+	// by the only process that has the store's directory locked with Lock
+	Reencrypt() (int, error)
+}
+
+// NewEncryptedBackend wraps the backend so that values are encrypted at
+// rest. New values are encrypted with the active master key. Previous
+// master keys are only used to decrypt values written before a rotation.
+// Master keys must be 32 bytes long and have unique IDs
+func NewEncryptedBackend(backend Backend, active MasterKey, previous ...MasterKey) (EncryptedBackend, error) {
+	masterKeys := make(map[uint32][]byte)
+
+	for _, masterKey := range append([]MasterKey{active}, previous...) {
+		if len(masterKey.Key) != 32 {
+			return nil, fmt.Errorf("master key '%v' must be 32 bytes long", masterKey.ID)
+		}
+		if _, ok := masterKeys[masterKey.ID]; ok {
+			return nil, fmt.Errorf("master key ID '%v' is used more than once", masterKey.ID)
+		}
+		masterKeys[masterKey.ID] = masterKey.Key
+	}
+
+	return &encryptedBackend{backend: backend, activeID: active.ID, masterKeys: masterKeys}, nil
+}
+
+// ReadMasterKey reads the master key in the file at path, which holds
+// the 32 byte key hex encoded, such as the output of `openssl rand -hex
+// 32`. The ID is derived from the key, so it stays the same when
+// the key is rotated out and becomes a previous master key
+func ReadMasterKey(path string) (MasterKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return MasterKey{}, fmt.Errorf("Failed to read master key '%v': %v", path, err.Error())
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return MasterKey{}, fmt.Errorf("Failed to decode master key '%v': %v", path, err.Error())
+	}
+	if len(key) != 32 {
+		return MasterKey{}, fmt.Errorf("master key '%v' must be 32 bytes long", path)
+	}
+
+	hash := sha256.Sum256(key)
+	return MasterKey{ID: binary.BigEndian.Uint32(hash[:4]), Key: key}, nil
+}
+
+type encryptedBackend struct {
+	backend    Backend
+	activeID   uint32
+	masterKeys map[uint32][]byte
+}
+
+// Delete removes the value stored at key
+func (backend *encryptedBackend) Delete(key string) error {
+	return backend.backend.Delete(key)
+}
+
+// Get returns the decrypted value stored at key, or ErrNotFound
+func (backend *encryptedBackend) Get(key string) ([]byte, error) {
+	ciphertext, err := backend.backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.decrypt(key, ciphertext)
+}
+
+// Keys returns every key starting with prefix, sorted
+func (backend *encryptedBackend) Keys(prefix string) ([]string, error) {
+	return backend.backend.Keys(prefix)
+}
+
+// Put encrypts the value with the active master key and stores it at key
+func (backend *encryptedBackend) Put(key string, value []byte) error {
+	ciphertext, err := backend.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return backend.backend.Put(key, ciphertext)
+}
+
+// Reencrypt rewrites every value that was encrypted with
+// a previous master key using the active one
+func (backend *encryptedBackend) Reencrypt() (int, error) {
+	keys, err := backend.backend.Keys("")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, key := range keys {
+		ciphertext, err := backend.backend.Get(key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+
+		masterKeyID, err := encryptedMasterKeyID(ciphertext)
+		if err != nil {
+			return count, fmt.Errorf("Failed to reencrypt '%v': %v", key, err.Error())
+		}
+		if masterKeyID == backend.activeID {
+			continue
+		}
+
+		value, err := backend.decrypt(key, ciphertext)
+		if err != nil {
+			return count, fmt.Errorf("Failed to reencrypt '%v': %v", key, err.Error())
+		}
+		if err := backend.Put(key, value); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Reencrypt rewrites the values of the store's EncryptedBackend that
+// were encrypted with a previous master key, holding the store's mutex
+// so that no record is written meanwhile. Chunks and trees are written
+// without the mutex, but they are stored at their hash, so rewriting
+// one never changes its contents
+func (store *store) Reencrypt() (int, error) {
+	backend, ok := store.backend.(EncryptedBackend)
+	if !ok {
+		return 0, fmt.Errorf("the store's backend is not encrypted")
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return backend.Reencrypt()
+}
+
+// aead returns the cipher for the value stored at key, using
+// a key derived from the master key with the given ID
+func (backend *encryptedBackend) aead(masterKeyID uint32, key string) (cipher.AEAD, error) {
+	masterKey, ok := backend.masterKeys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key '%v'", masterKeyID)
+	}
+
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte("meshchain store value:"))
+	mac.Write([]byte(key))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decrypt reverses encrypt, verifying that the
+// value has not been tampered with
+func (backend *encryptedBackend) decrypt(key string, ciphertext []byte) ([]byte, error) {
+	masterKeyID, err := encryptedMasterKeyID(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := backend.aead(masterKeyID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < encryptedHeaderSize+aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+	nonce := ciphertext[encryptedHeaderSize : encryptedHeaderSize+aead.NonceSize()]
+	sealed := ciphertext[encryptedHeaderSize+aead.NonceSize():]
+
+	value, err := aead.Open(nil, nonce, sealed, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt value: %v", err.Error())
+	}
+	return value, nil
+}
+
+// encrypt seals the value as
+// [version][master key ID][nonce][ciphertext + tag]
+func (backend *encryptedBackend) encrypt(key string, value []byte) ([]byte, error) {
+	aead, err := backend.aead(backend.activeID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, encryptedHeaderSize, encryptedHeaderSize+aead.NonceSize()+len(value)+aead.Overhead())
+	header[0] = encryptedVersion
+	binary.BigEndian.PutUint32(header[1:], backend.activeID)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(append(header, nonce...), nonce, value, []byte(key)), nil
+}
+
+// encryptedMasterKeyID returns the ID of the master
+// key that was used to encrypt the value
+func encryptedMasterKeyID(ciphertext []byte) (uint32, error) {
+	if len(ciphertext) < encryptedHeaderSize || ciphertext[0] != encryptedVersion {
+		return 0, fmt.Errorf("value is not encrypted")
+	}
+	return binary.BigEndian.Uint32(ciphertext[1:encryptedHeaderSize]), nil
+}
@@ -0,0 +1,253 @@
+package store_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EncryptedBackend", func() {
+	var sut store.EncryptedBackend
+	var raw store.Backend
+	var key1, key2 store.MasterKey
+	var err error
+
+	BeforeEach(func() {
+		raw = store.NewMemoryBackend()
+		key1 = store.MasterKey{ID: 1, Key: bytes.Repeat([]byte{1}, 32)}
+		key2 = store.MasterKey{ID: 2, Key: bytes.Repeat([]byte{2}, 32)}
+
+		sut, err = store.NewEncryptedBackend(raw, key1)
+		Expect(err).To(BeNil())
+	})
+
+	Describe("NewEncryptedBackend", func() {
+		Describe("with a master key of the wrong size", func() {
+			BeforeEach(func() {
+				_, err = store.NewEncryptedBackend(raw, store.MasterKey{ID: 3, Key: []byte("short")})
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("master key '3' must be 32 bytes long"))
+			})
+		})
+	})
+
+	Describe("Put", func() {
+		BeforeEach(func() {
+			Expect(sut.Put("records/abc", []byte("secret value"))).To(Succeed())
+		})
+
+		It("should make the value available to Get", func() {
+			Expect(sut.Get("records/abc")).To(Equal([]byte("secret value")))
+		})
+
+		It("should not store the value in the clear", func() {
+			ciphertext, itErr := raw.Get("records/abc")
+			Expect(itErr).To(BeNil())
+			Expect(bytes.Contains(ciphertext, []byte("secret"))).To(BeFalse())
+		})
+
+		Describe("when the ciphertext is tampered with", func() {
+			BeforeEach(func() {
+				ciphertext, beforeErr := raw.Get("records/abc")
+				Expect(beforeErr).To(BeNil())
+				ciphertext[len(ciphertext)-1] ^= 0xff
+				Expect(raw.Put("records/abc", ciphertext)).To(Succeed())
+			})
+
+			It("should yield an error", func() {
+				_, itErr := sut.Get("records/abc")
+				Expect(itErr).NotTo(BeNil())
+			})
+		})
+
+		Describe("when the ciphertext is moved to another key", func() {
+			BeforeEach(func() {
+				ciphertext, beforeErr := raw.Get("records/abc")
+				Expect(beforeErr).To(BeNil())
+				Expect(raw.Put("records/def", ciphertext)).To(Succeed())
+			})
+
+			It("should yield an error", func() {
+				_, itErr := sut.Get("records/def")
+				Expect(itErr).NotTo(BeNil())
+			})
+		})
+
+		Describe("when the master key is rotated", func() {
+			var rotated store.EncryptedBackend
+
+			BeforeEach(func() {
+				rotated, err = store.NewEncryptedBackend(raw, key2, key1)
+				Expect(err).To(BeNil())
+			})
+
+			It("should still decrypt the value", func() {
+				Expect(rotated.Get("records/abc")).To(Equal([]byte("secret value")))
+			})
+
+			It("should not decrypt without the previous master key", func() {
+				withoutKey1, itErr := store.NewEncryptedBackend(raw, key2)
+				Expect(itErr).To(BeNil())
+
+				_, itErr = withoutKey1.Get("records/abc")
+				Expect(itErr).NotTo(BeNil())
+				Expect(itErr.Error()).To(Equal("unknown master key '1'"))
+			})
+
+			Describe("when reencrypted", func() {
+				var count int
+
+				BeforeEach(func() {
+					count, err = rotated.Reencrypt()
+					Expect(err).To(BeNil())
+				})
+
+				It("should rewrite the value", func() {
+					Expect(count).To(Equal(1))
+				})
+
+				It("should no longer need the previous master key", func() {
+					withoutKey1, itErr := store.NewEncryptedBackend(raw, key2)
+					Expect(itErr).To(BeNil())
+					Expect(withoutKey1.Get("records/abc")).To(Equal([]byte("secret value")))
+				})
+
+				It("should not rewrite anything the second time", func() {
+					Expect(rotated.Reencrypt()).To(Equal(0))
+				})
+			})
+		})
+	})
+
+	Describe("as the backend of a store", func() {
+		var root record.RootRecord
+
+		BeforeEach(func() {
+			s := store.New(sut)
+			root, _ = generateRootRecord()
+			Expect(s.Put(root)).To(Succeed())
+		})
+
+		It("should return the decrypted record from a new store", func() {
+			rec, itErr := store.New(sut).Head(root.Metadata().ID)
+			Expect(itErr).To(BeNil())
+			Expect(rec.Data()).To(Equal(root.Data()))
+		})
+
+		Describe("when the store is reencrypted with a rotated master key", func() {
+			var count int
+
+			BeforeEach(func() {
+				rotated, itErr := store.NewEncryptedBackend(raw, key2, key1)
+				Expect(itErr).To(BeNil())
+
+				count, err = store.New(rotated).Reencrypt()
+			})
+
+			It("should rewrite the record and its chain index", func() {
+				Expect(err).To(BeNil())
+				Expect(count).To(BeNumerically(">=", 2))
+			})
+
+			It("should no longer need the previous master key", func() {
+				withoutKey1, itErr := store.NewEncryptedBackend(raw, key2)
+				Expect(itErr).To(BeNil())
+
+				rec, itErr := store.New(withoutKey1).Head(root.Metadata().ID)
+				Expect(itErr).To(BeNil())
+				Expect(rec.Data()).To(Equal(root.Data()))
+			})
+		})
+	})
+
+	Describe("ReadMasterKey", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir, err = ioutil.TempDir("", "meshchain-master-key")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		writeKey := func(name, contents string) string {
+			path := filepath.Join(dir, name)
+			Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+			return path
+		}
+
+		Describe("with a hex encoded key", func() {
+			var masterKey store.MasterKey
+
+			BeforeEach(func() {
+				masterKey, err = store.ReadMasterKey(writeKey("key", strings.Repeat("01", 32)+"\n"))
+			})
+
+			It("should read the key", func() {
+				Expect(err).To(BeNil())
+				Expect(masterKey.Key).To(Equal(bytes.Repeat([]byte{1}, 32)))
+			})
+
+			It("should derive the same ID from the same key", func() {
+				again, itErr := store.ReadMasterKey(writeKey("copy", strings.Repeat("01", 32)))
+				Expect(itErr).To(BeNil())
+				Expect(again.ID).To(Equal(masterKey.ID))
+			})
+
+			It("should derive another ID from another key", func() {
+				other, itErr := store.ReadMasterKey(writeKey("other", strings.Repeat("02", 32)))
+				Expect(itErr).To(BeNil())
+				Expect(other.ID).NotTo(Equal(masterKey.ID))
+			})
+		})
+
+		Describe("with a key of the wrong size", func() {
+			var path string
+
+			BeforeEach(func() {
+				path = writeKey("key", "0102")
+				_, err = store.ReadMasterKey(path)
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("master key '" + path + "' must be 32 bytes long"))
+			})
+		})
+
+		Describe("with a key that isn't hex encoded", func() {
+			BeforeEach(func() {
+				_, err = store.ReadMasterKey(writeKey("key", "not hex"))
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(ContainSubstring("Failed to decode master key"))
+			})
+		})
+	})
+
+	Describe("Store.Reencrypt with a backend that isn't encrypted", func() {
+		BeforeEach(func() {
+			_, err = store.New(raw).Reencrypt()
+		})
+
+		It("should yield an error", func() {
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(Equal("the store's backend is not encrypted"))
+		})
+	})
+})
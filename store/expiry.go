@@ -0,0 +1,160 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+)
+
+// A chain whose head expired is removed, leaving a tombstone at
+// "expired/<id>" so that replaying its RootRecord can't start
+// the chain again
+const expiredPrefix = "expired/"
+
+// ExpiryReport describes what was removed by a call to Expire
+type ExpiryReport struct {
+	Chains []ExpiredChain `json:"chains"`
+}
+
+// ExpiredChain describes a chain that was removed because its
+// head expired. Hashes are hex encoded
+type ExpiredChain struct {
+	// ID is the metadata.ID of the chain
+	ID string `json:"id"`
+
+	// NotAfter is the metadata.NotAfter of the head of the chain
+	NotAfter time.Time `json:"notAfter"`
+
+	// Removed lists the hashes of the removed records, oldest first
+	Removed []string `json:"removed"`
+}
+
+// Expire removes every chain whose head has expired at now, so
+// that it is no longer served, and reports what was removed. A
+// chain with an expired head can't be updated any more, since
+// its head is all that a newer record could be checked against
+func (store *store) Expire(now time.Time) (*ExpiryReport, error) {
+	ids, err := store.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	report := &ExpiryReport{Chains: []ExpiredChain{}}
+	for _, id := range ids {
+		index, err := store.readIndex(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		head, err := store.getHex(index.Entries[len(index.Entries)-1].Hash)
+		if err != nil {
+			return report, err
+		}
+		metadata := head.Metadata()
+		if !metadata.Expired(now) {
+			continue
+		}
+
+		expired := ExpiredChain{ID: id, NotAfter: metadata.NotAfter}
+		for _, entry := range index.Entries {
+			expired.Removed = append(expired.Removed, entry.Hash)
+		}
+
+		// Write the tombstone first so that a failure part way
+		// through can't leave a chain that can be started again
+		notAfter, err := metadata.NotAfter.MarshalText()
+		if err != nil {
+			return report, err
+		}
+		if err := store.backend.Put(expiredPrefix+id, notAfter); err != nil {
+			return report, err
+		}
+		if err := store.removeChain(id, index, head); err != nil {
+			return report, err
+		}
+
+		report.Chains = append(report.Chains, expired)
+	}
+
+	return report, nil
+}
+
+// Evict removes the chain for the metadata.ID, so that it is no
+// longer served. Unlike Expire, it leaves no tombstone, so the
+// chain can be put again
+func (store *store) Evict(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	index, err := store.readIndex(id)
+	if err != nil {
+		return err
+	}
+
+	head, err := store.getHex(index.Entries[len(index.Entries)-1].Hash)
+	if err != nil {
+		return err
+	}
+	return store.removeChain(id, index, head)
+}
+
+// removeChain removes the chain index, the secondary indexes, the
+// changes, the records and the snapshots of the chain. The index is
+// removed first so that a failure part way through leaves orphaned
+// records rather than a chain that can still be read
+func (store *store) removeChain(id string, index *chainIndex, head record.Record) error {
+	if err := store.backend.Delete(chainsPrefix + id); err != nil {
+		return err
+	}
+	if err := store.removeSecondaryIndexes(head); err != nil {
+		return err
+	}
+	if err := store.removeChanges(index.Entries); err != nil {
+		return err
+	}
+	for _, entry := range index.Entries {
+		if err := store.backend.Delete(recordsPrefix + entry.Hash); err != nil {
+			return err
+		}
+		if err := store.backend.Delete(snapshotsPrefix + entry.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkExpired returns a *ConflictError if the chain for
+// the metadata.ID was removed by Expire
+func (store *store) checkExpired(id string) error {
+	notAfter, err := store.backend.Get(expiredPrefix + id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &ConflictError{fmt.Sprintf("the chain for metadata.ID '%v' expired at '%v'", id, string(notAfter))}
+}
+
+// removeSecondaryIndexes removes the secondary
+// index entries for the head of a chain
+func (store *store) removeSecondaryIndexes(head record.Record) error {
+	keys, err := secondaryIndexKeys(head)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := store.backend.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
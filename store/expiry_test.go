@@ -0,0 +1,135 @@
+package store_test
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expiry", func() {
+	var sut store.Store
+	var root record.RootRecord
+	var update record.UpdateRecord
+	var privateKey *rsa.PrivateKey
+	var id string
+	var notAfter time.Time
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+		notAfter = time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+		root, privateKey = generateRootRecord()
+		update = generateExpiringUpdate(root, privateKey, notAfter)
+		id = root.Metadata().ID
+
+		Expect(sut.Put(root)).To(Succeed())
+		Expect(sut.Put(update)).To(Succeed())
+	})
+
+	Describe("Expire before the head expires", func() {
+		var report *store.ExpiryReport
+
+		BeforeEach(func() {
+			var err error
+			report, err = sut.Expire(notAfter.Add(-time.Second))
+			Expect(err).To(BeNil())
+		})
+
+		It("should not remove anything", func() {
+			Expect(report.Chains).To(BeEmpty())
+
+			head, err := sut.Head(id)
+			Expect(err).To(BeNil())
+			Expect(mustHash(head)).To(Equal(mustHash(update)))
+		})
+	})
+
+	Describe("Expire after the head expires", func() {
+		var report *store.ExpiryReport
+
+		BeforeEach(func() {
+			var err error
+			report, err = sut.Expire(notAfter.Add(time.Second))
+			Expect(err).To(BeNil())
+		})
+
+		It("should report the removed chain", func() {
+			Expect(report.Chains).To(Equal([]store.ExpiredChain{{
+				ID:       id,
+				NotAfter: notAfter,
+				Removed: []string{
+					hex.EncodeToString(mustHash(root)),
+					hex.EncodeToString(mustHash(update)),
+				},
+			}}))
+		})
+
+		It("should remove the chain and its records", func() {
+			_, err := sut.Head(id)
+			Expect(err).To(Equal(store.ErrNotFound))
+
+			_, err = sut.Get(mustHash(root))
+			Expect(err).To(Equal(store.ErrNotFound))
+
+			Expect(sut.IDs()).To(BeEmpty())
+		})
+
+		It("should remove the chain from the secondary indexes", func() {
+			Expect(sut.FindByPublicKey(root.Metadata().PublicKeys[0])).To(BeEmpty())
+			Expect(sut.FindByLocalID("")).To(BeEmpty())
+		})
+
+		It("should leave a store that passes fsck", func() {
+			report, err := sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+			Expect(report.Problems).To(BeEmpty())
+		})
+
+		It("should refuse to start the chain again", func() {
+			err := sut.Put(root)
+			Expect(err).To(BeAssignableToTypeOf(&store.ConflictError{}))
+			Expect(err).To(MatchError("the chain for metadata.ID '" + id + "' expired at '2026-07-01T00:00:00Z'"))
+		})
+	})
+
+	Describe("Expire with a chain that never expires", func() {
+		It("should not remove it", func() {
+			records, _ := generateChain(1)
+			Expect(sut.Put(records[0])).To(Succeed())
+			Expect(sut.Put(records[1])).To(Succeed())
+
+			report, err := sut.Expire(notAfter.Add(100 * 365 * 24 * time.Hour))
+			Expect(err).To(BeNil())
+			Expect(report.Chains).To(HaveLen(1))
+			Expect(sut.IDs()).To(Equal([]string{records[0].Metadata().ID}))
+		})
+	})
+
+	Describe("Evict", func() {
+		BeforeEach(func() {
+			Expect(sut.Evict(id)).To(Succeed())
+		})
+
+		It("should remove the chain and its records", func() {
+			_, err := sut.Head(id)
+			Expect(err).To(Equal(store.ErrNotFound))
+
+			_, err = sut.Get(mustHash(update))
+			Expect(err).To(Equal(store.ErrNotFound))
+
+			Expect(sut.FindByLocalID("")).To(BeEmpty())
+		})
+
+		It("should allow the chain to be put again", func() {
+			Expect(sut.Put(root)).To(Succeed())
+			Expect(sut.Put(update)).To(Succeed())
+			Expect(sut.Hashes(id)).To(HaveLen(2))
+		})
+	})
+})
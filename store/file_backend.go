@@ -0,0 +1,119 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NewFileBackend constructs a Backend that stores every
+// value as a file under dir, creating dir if needed
+func NewFileBackend(dir string) (Backend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileBackend{dir: dir}, nil
+}
+
+type fileBackend struct {
+	dir string
+}
+
+// Delete removes the file stored at key
+func (backend *fileBackend) Delete(key string) error {
+	path, err := backend.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Get returns the contents of the file stored at key, or ErrNotFound
+func (backend *fileBackend) Get(key string) ([]byte, error) {
+	path, err := backend.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// Keys returns every key starting with prefix, sorted
+func (backend *fileBackend) Keys(prefix string) ([]string, error) {
+	var keys []string
+
+	err := filepath.Walk(backend.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(backend.dir, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if key == lockFile {
+			return nil
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Put writes the value to the file for key. The value is written to
+// a temporary file first, so a crash never leaves a partial value
+func (backend *fileBackend) Put(key string, value []byte) error {
+	path, err := backend.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, value, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// path returns the file path for key, refusing
+// keys that would escape the backend's dir
+func (backend *fileBackend) path(key string) (string, error) {
+	if key == "" || strings.HasSuffix(key, ".tmp") {
+		return "", fmt.Errorf("invalid key '%v'", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid key '%v'", key)
+		}
+	}
+
+	return filepath.Join(backend.dir, filepath.FromSlash(key)), nil
+}
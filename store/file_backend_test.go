@@ -0,0 +1,72 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileBackend", func() {
+	var sut store.Backend
+	var dir string
+	var err error
+
+	BeforeEach(func() {
+		dir, err = ioutil.TempDir("", "meshchain-file-backend")
+		Expect(err).To(BeNil())
+
+		sut, err = store.NewFileBackend(dir)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Put", func() {
+		BeforeEach(func() {
+			Expect(sut.Put("records/abc", []byte("value"))).To(Succeed())
+			Expect(sut.Put("chains/def", []byte("other"))).To(Succeed())
+		})
+
+		It("should make the value available to Get", func() {
+			Expect(sut.Get("records/abc")).To(Equal([]byte("value")))
+		})
+
+		It("should list the key by prefix", func() {
+			Expect(sut.Keys("records/")).To(Equal([]string{"records/abc"}))
+		})
+
+		It("should be readable by a new backend on the same dir", func() {
+			other, itErr := store.NewFileBackend(dir)
+			Expect(itErr).To(BeNil())
+			Expect(other.Get("chains/def")).To(Equal([]byte("other")))
+		})
+
+		Describe("when deleted", func() {
+			BeforeEach(func() {
+				Expect(sut.Delete("records/abc")).To(Succeed())
+			})
+
+			It("should yield ErrNotFound", func() {
+				_, itErr := sut.Get("records/abc")
+				Expect(itErr).To(Equal(store.ErrNotFound))
+			})
+		})
+	})
+
+	Describe("when given a key that escapes the dir", func() {
+		BeforeEach(func() {
+			err = sut.Put("../escape", []byte("nope"))
+		})
+
+		It("should yield an error", func() {
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(Equal("invalid key '../escape'"))
+		})
+	})
+})
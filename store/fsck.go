@@ -0,0 +1,460 @@
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// Kinds of problems reported by Fsck
+const (
+	// ProblemCorruptRecord is a raw record that cannot be decoded
+	ProblemCorruptRecord = "corrupt-record"
+
+	// ProblemHashMismatch is a raw record stored under the wrong hash
+	ProblemHashMismatch = "hash-mismatch"
+
+	// ProblemCorruptIndex is a chain index that cannot be decoded
+	ProblemCorruptIndex = "corrupt-index"
+
+	// ProblemMissingRecord is a chain index entry without a raw record
+	ProblemMissingRecord = "missing-record"
+
+	// ProblemDanglingHead is a chain index whose head has no raw record
+	ProblemDanglingHead = "dangling-head"
+
+	// ProblemDuplicateEntry is a record listed more than once in the indexes
+	ProblemDuplicateEntry = "duplicate-entry"
+
+	// ProblemWrongChain is a record listed in the index of another metadata.ID
+	ProblemWrongChain = "wrong-chain"
+
+	// ProblemBrokenLink is a record that is not a valid update of the
+	// record before it in its chain index
+	ProblemBrokenLink = "broken-link"
+
+	// ProblemOrphanedRecord is a raw record not listed in any chain index
+	ProblemOrphanedRecord = "orphaned-record"
+
+	// ProblemStaleIndex is a secondary index entry for a
+	// record that is not the head of its chain
+	ProblemStaleIndex = "stale-index"
+
+	// ProblemMissingIndex is a secondary index entry
+	// missing for the head of a chain
+	ProblemMissingIndex = "missing-index"
+
+	// ProblemMissingChunks is a record whose metadata.Manifest
+	// describes a tree or chunks that aren't stored
+	ProblemMissingChunks = "missing-chunks"
+
+	// ProblemUnreferencedChunk is a stored chunk or tree that
+	// no metadata.Manifest of a valid record references
+	ProblemUnreferencedChunk = "unreferenced-chunk"
+)
+
+// FsckOptions controls what Fsck does besides checking
+type FsckOptions struct {
+	// Repair rebuilds every chain index and secondary index from
+	// the raw records, and removes unreferenced chunks and trees
+	Repair bool
+}
+
+// FsckReport is the machine-readable result of a call to Fsck
+type FsckReport struct {
+	// Records is the number of raw records checked
+	Records int `json:"records"`
+
+	// Chains is the number of chain indexes checked
+	Chains int `json:"chains"`
+
+	// Problems lists everything found to be wrong
+	Problems []FsckProblem `json:"problems"`
+
+	// Repaired is true if the chain indexes were rebuilt
+	Repaired bool `json:"repaired"`
+}
+
+// FsckProblem describes a single problem found by Fsck.
+// Hashes are hex encoded
+type FsckProblem struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Message string `json:"message"`
+}
+
+// Fsck walks every raw record and chain index in the store,
+// re-verifying hashes, signatures and parent links
+func (store *store) Fsck(options FsckOptions) (*FsckReport, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	report := &FsckReport{Problems: []FsckProblem{}}
+
+	records, err := store.fsckRecords(report)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := store.fsckIndexes(report, records)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.fsckSecondaryIndexes(report, records, indexes, false); err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := store.fsckChunks(report, records)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byKindIDHash(report.Problems))
+
+	if options.Repair {
+		rebuilt, err := store.rebuildIndexes(records, indexes)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.fsckSecondaryIndexes(nil, records, rebuilt, true); err != nil {
+			return nil, err
+		}
+		for _, key := range unreferenced {
+			if err := store.removeChunk(key); err != nil {
+				return nil, err
+			}
+		}
+		report.Repaired = true
+	}
+
+	return report, nil
+}
+
+// fsckRecords decodes every raw record, returning
+// the valid ones keyed by hex encoded hash
+func (store *store) fsckRecords(report *FsckReport) (map[string]record.Record, error) {
+	keys, err := store.backend.Keys(recordsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]record.Record)
+	for _, key := range keys {
+		hashHex := strings.TrimPrefix(key, recordsPrefix)
+		report.Records++
+
+		data, err := store.backend.Get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		recordPB := &encoding.Record{}
+		if err := proto.Unmarshal(data, recordPB); err != nil {
+			report.add(ProblemCorruptRecord, "", hashHex, err.Error())
+			continue
+		}
+
+		rec, err := record.FromTrustedProto(recordPB)
+		if err != nil {
+			report.add(ProblemCorruptRecord, recordPB.GetMetadata().GetId(), hashHex, err.Error())
+			continue
+		}
+
+		hash, err := rec.Hash()
+		if err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(hash) != hashHex {
+			report.add(ProblemHashMismatch, rec.Metadata().ID, hashHex, "record is stored under the wrong hash")
+			continue
+		}
+
+		records[hashHex] = rec
+	}
+
+	return records, nil
+}
+
+// fsckIndexes checks every chain index against the valid raw
+// records, returning the decodable indexes keyed by metadata.ID
+func (store *store) fsckIndexes(report *FsckReport, records map[string]record.Record) (map[string]*chainIndex, error) {
+	ids, err := store.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]*chainIndex)
+	seen := make(map[string]string)
+
+	for _, id := range ids {
+		report.Chains++
+
+		data, err := store.backend.Get(chainsPrefix + id)
+		if err != nil {
+			return nil, err
+		}
+
+		index := &chainIndex{}
+		if err := json.Unmarshal(data, index); err != nil {
+			report.add(ProblemCorruptIndex, id, "", err.Error())
+			continue
+		}
+		indexes[id] = index
+
+		var previous record.Record
+		for i, entry := range index.Entries {
+			if seenID, ok := seen[entry.Hash]; ok {
+				report.add(ProblemDuplicateEntry, id, entry.Hash, "record is also listed in the chain for '"+seenID+"'")
+			}
+			seen[entry.Hash] = id
+
+			rec, ok := records[entry.Hash]
+			if !ok {
+				kind := ProblemMissingRecord
+				if i == len(index.Entries)-1 {
+					kind = ProblemDanglingHead
+				}
+				report.add(kind, id, entry.Hash, "chain index references a record that is missing or invalid")
+				previous = nil
+				continue
+			}
+
+			if rec.Metadata().ID != id {
+				report.add(ProblemWrongChain, id, entry.Hash, "record belongs to the chain for '"+rec.Metadata().ID+"'")
+			} else if previous != nil {
+				if _, err := record.NewChain([]record.Record{previous, rec}); err != nil {
+					report.add(ProblemBrokenLink, id, entry.Hash, err.Error())
+				}
+			} else if i > 0 {
+				report.add(ProblemBrokenLink, id, entry.Hash, "the record before it in the chain index is missing or invalid")
+			}
+			previous = rec
+		}
+	}
+
+	for hashHex, rec := range records {
+		if _, ok := seen[hashHex]; !ok {
+			report.add(ProblemOrphanedRecord, rec.Metadata().ID, hashHex, "record is not listed in any chain index")
+		}
+	}
+
+	return indexes, nil
+}
+
+// fsckSecondaryIndexes compares the secondary index entries with the
+// heads of the chain indexes. When repair is true, entries are added
+// and removed to match instead of being reported
+func (store *store) fsckSecondaryIndexes(report *FsckReport, records map[string]record.Record, indexes map[string]*chainIndex, repair bool) error {
+	expected := make(map[string]string)
+	for id, index := range indexes {
+		if len(index.Entries) == 0 {
+			continue
+		}
+		head, ok := records[index.Entries[len(index.Entries)-1].Hash]
+		if !ok || head.Metadata().ID != id {
+			continue
+		}
+
+		keys, err := secondaryIndexKeys(head)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			expected[key] = id
+		}
+	}
+
+	actual, err := store.backend.Keys(secondaryIndexPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range actual {
+		if _, ok := expected[key]; ok {
+			delete(expected, key)
+			continue
+		}
+		if repair {
+			if err := store.backend.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		report.add(ProblemStaleIndex, key[strings.LastIndex(key, "/")+1:], "", "secondary index entry '"+key+"' does not match the head of a chain")
+	}
+
+	for key, id := range expected {
+		if repair {
+			if err := store.backend.Put(key, []byte{}); err != nil {
+				return err
+			}
+			continue
+		}
+		report.add(ProblemMissingIndex, id, "", "secondary index entry '"+key+"' is missing")
+	}
+
+	return nil
+}
+
+// fsckChunks checks that the tree and chunks described by the
+// metadata.Manifest of every valid record are stored, and returns
+// the keys of the stored trees and chunks that none of them reference
+func (store *store) fsckChunks(report *FsckReport, records map[string]record.Record) ([]string, error) {
+	list := make([]record.Record, 0, len(records))
+	for hashHex, rec := range records {
+		list = append(list, rec)
+
+		manifest := rec.Metadata().Manifest
+		if manifest == nil {
+			continue
+		}
+		err := store.checkChunks(manifest)
+		if chunksErr, ok := err.(*ChunksError); ok {
+			report.add(ProblemMissingChunks, rec.Metadata().ID, hashHex, chunksErr.Message)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	referenced, err := store.referencedChunks(list)
+	if err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := store.unreferencedChunks(referenced)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range unreferenced {
+		kind, hashHex := "chunk", strings.TrimPrefix(key, chunksPrefix)
+		if strings.HasPrefix(key, treesPrefix) {
+			kind, hashHex = "tree", strings.TrimPrefix(key, treesPrefix)
+		}
+		report.add(ProblemUnreferencedChunk, "", hashHex, kind+" is not referenced by the manifest of any record")
+	}
+	return unreferenced, nil
+}
+
+// rebuildIndexes replaces every chain index with one rebuilt from the
+// valid raw records. Each chain starts at its RootRecord or, if that
+// was pruned, at the record whose parent is missing. When a record has
+// several valid children, the one from the old index is preferred
+func (store *store) rebuildIndexes(records map[string]record.Record, indexes map[string]*chainIndex) (map[string]*chainIndex, error) {
+	oldEntries := make(map[string]indexEntry)
+	inOldIndex := make(map[string]bool)
+	for _, index := range indexes {
+		for _, entry := range index.Entries {
+			oldEntries[entry.Hash] = entry
+			inOldIndex[entry.Hash] = true
+		}
+	}
+
+	children := make(map[string][]string)
+	starts := make(map[string][]string)
+	for hashHex, rec := range records {
+		parentHex := hex.EncodeToString(rec.ParentHash())
+		if _, ok := records[parentHex]; ok && parentHex != "" {
+			children[parentHex] = append(children[parentHex], hashHex)
+			continue
+		}
+		id := rec.Metadata().ID
+		starts[id] = append(starts[id], hashHex)
+	}
+
+	rebuilt := make(map[string]*chainIndex)
+	for id, candidates := range starts {
+		sort.Strings(candidates)
+		start := pickHash(candidates, records, inOldIndex)
+
+		index := &chainIndex{}
+		for hashHex := start; hashHex != ""; {
+			entry, ok := oldEntries[hashHex]
+			if !ok {
+				entry = indexEntry{Hash: hashHex, StoredAt: time.Now(), Size: sizeOf(records[hashHex])}
+			}
+			index.Entries = append(index.Entries, entry)
+
+			var valid []string
+			for _, childHex := range children[hashHex] {
+				if _, err := record.NewChain([]record.Record{records[hashHex], records[childHex]}); err == nil {
+					valid = append(valid, childHex)
+				}
+			}
+			sort.Strings(valid)
+			hashHex = pickHash(valid, records, inOldIndex)
+		}
+		rebuilt[id] = index
+	}
+
+	for id := range indexes {
+		if _, ok := rebuilt[id]; !ok {
+			if err := store.backend.Delete(chainsPrefix + id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(rebuilt))
+	for id := range rebuilt {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := store.writeIndex(id, rebuilt[id]); err != nil {
+			return nil, err
+		}
+	}
+
+	return rebuilt, nil
+}
+
+// pickHash chooses among candidate hashes, preferring a root
+// record, then one from an old index, then the lowest hash
+func pickHash(candidates []string, records map[string]record.Record, inOldIndex map[string]bool) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	for _, hashHex := range candidates {
+		if len(records[hashHex].ParentHash()) == 0 {
+			return hashHex
+		}
+	}
+	for _, hashHex := range candidates {
+		if inOldIndex[hashHex] {
+			return hashHex
+		}
+	}
+	return candidates[0]
+}
+
+func (report *FsckReport) add(kind, id, hashHex, message string) {
+	report.Problems = append(report.Problems, FsckProblem{
+		Kind:    kind,
+		ID:      id,
+		Hash:    hashHex,
+		Message: message,
+	})
+}
+
+type byKindIDHash []FsckProblem
+
+func (problems byKindIDHash) Len() int      { return len(problems) }
+func (problems byKindIDHash) Swap(i, j int) { problems[i], problems[j] = problems[j], problems[i] }
+func (problems byKindIDHash) Less(i, j int) bool {
+	if problems[i].Kind != problems[j].Kind {
+		return problems[i].Kind < problems[j].Kind
+	}
+	if problems[i].ID != problems[j].ID {
+		return problems[i].ID < problems[j].ID
+	}
+	return problems[i].Hash < problems[j].Hash
+}
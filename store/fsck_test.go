@@ -0,0 +1,256 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fsck", func() {
+	var sut store.Store
+	var backend store.Backend
+	var records []record.Record
+	var id string
+	var report *store.FsckReport
+	var err error
+
+	hashHex := func(rec record.Record) string {
+		return hex.EncodeToString(mustHash(rec))
+	}
+
+	problemKinds := func(report *store.FsckReport) map[string]int {
+		kinds := map[string]int{}
+		for _, problem := range report.Problems {
+			kinds[problem.Kind]++
+		}
+		return kinds
+	}
+
+	BeforeEach(func() {
+		backend = store.NewMemoryBackend()
+		sut = store.New(backend)
+		records, _ = generateChain(2)
+		id = records[0].Metadata().ID
+
+		for _, rec := range records {
+			Expect(sut.Put(rec)).To(Succeed())
+		}
+	})
+
+	Describe("with a healthy store", func() {
+		BeforeEach(func() {
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should check every record and chain", func() {
+			Expect(report.Records).To(Equal(3))
+			Expect(report.Chains).To(Equal(1))
+		})
+
+		It("should not report any problems", func() {
+			Expect(report.Problems).To(BeEmpty())
+		})
+	})
+
+	Describe("when the head record is missing", func() {
+		BeforeEach(func() {
+			Expect(backend.Delete("records/" + hashHex(records[2]))).To(Succeed())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report a dangling head and its stale secondary index entries", func() {
+			Expect(problemKinds(report)).To(Equal(map[string]int{
+				store.ProblemDanglingHead: 1,
+				store.ProblemStaleIndex:   2,
+			}))
+			Expect(report.Problems[0].Hash).To(Equal(hashHex(records[2])))
+		})
+
+		Describe("when repaired", func() {
+			BeforeEach(func() {
+				report, err = sut.Fsck(store.FsckOptions{Repair: true})
+				Expect(err).To(BeNil())
+			})
+
+			It("should rebuild the chain from the remaining records", func() {
+				Expect(report.Repaired).To(BeTrue())
+
+				head, itErr := sut.Head(id)
+				Expect(itErr).To(BeNil())
+				Expect(head.Hash()).To(Equal(mustHash(records[1])))
+			})
+
+			It("should leave a healthy store", func() {
+				report, err = sut.Fsck(store.FsckOptions{})
+				Expect(err).To(BeNil())
+				Expect(report.Problems).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("when a record is corrupted", func() {
+		BeforeEach(func() {
+			Expect(backend.Put("records/"+hashHex(records[1]), []byte("garbage"))).To(Succeed())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report the corrupt record and the link it breaks", func() {
+			Expect(problemKinds(report)).To(Equal(map[string]int{
+				store.ProblemBrokenLink:    1,
+				store.ProblemCorruptRecord: 1,
+				store.ProblemMissingRecord: 1,
+			}))
+		})
+	})
+
+	Describe("when the chain index is lost", func() {
+		BeforeEach(func() {
+			Expect(backend.Delete("chains/" + id)).To(Succeed())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report every record as orphaned", func() {
+			Expect(problemKinds(report)).To(Equal(map[string]int{
+				store.ProblemOrphanedRecord: 3,
+				store.ProblemStaleIndex:     2,
+			}))
+		})
+
+		Describe("when repaired", func() {
+			BeforeEach(func() {
+				report, err = sut.Fsck(store.FsckOptions{Repair: true})
+				Expect(err).To(BeNil())
+			})
+
+			It("should rebuild the complete chain", func() {
+				chain, itErr := sut.Chain(id)
+				Expect(itErr).To(BeNil())
+				Expect(chain.Complete()).To(BeTrue())
+				Expect(chain.Records()).To(HaveLen(3))
+			})
+		})
+	})
+
+	Describe("when a record is listed in two chain indexes", func() {
+		BeforeEach(func() {
+			other, _ := generateChain(0)
+			Expect(sut.Put(other[0])).To(Succeed())
+
+			chainIndex, beforeErr := backend.Get("chains/" + id)
+			Expect(beforeErr).To(BeNil())
+			Expect(backend.Put("chains/"+other[0].Metadata().ID, chainIndex)).To(Succeed())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report the duplicates, the wrong chain and the orphan", func() {
+			Expect(problemKinds(report)).To(Equal(map[string]int{
+				store.ProblemDuplicateEntry: 3,
+				store.ProblemWrongChain:     3,
+				store.ProblemOrphanedRecord: 1,
+				store.ProblemStaleIndex:     2,
+			}))
+		})
+	})
+
+	Describe("when a secondary index entry is lost", func() {
+		BeforeEach(func() {
+			keys, beforeErr := backend.Keys("indexes/localId/")
+			Expect(beforeErr).To(BeNil())
+			Expect(keys).To(HaveLen(1))
+			Expect(backend.Delete(keys[0])).To(Succeed())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report the missing entry", func() {
+			Expect(problemKinds(report)).To(Equal(map[string]int{
+				store.ProblemMissingIndex: 1,
+			}))
+		})
+
+		Describe("when repaired", func() {
+			BeforeEach(func() {
+				_, err = sut.Fsck(store.FsckOptions{Repair: true})
+				Expect(err).To(BeNil())
+			})
+
+			It("should restore the entry", func() {
+				Expect(sut.FindByLocalID("")).To(Equal([]string{id}))
+			})
+		})
+	})
+
+	Describe("when a chunk of a record is missing", func() {
+		var chunked record.Record
+
+		BeforeEach(func() {
+			root, privateKey := generateRootRecord()
+			Expect(sut.Put(root)).To(Succeed())
+
+			manifest, beforeErr := chunks.Write(sut, bytes.NewReader([]byte("chunked data")), 4)
+			Expect(beforeErr).To(BeNil())
+			chunked = generateChunkedUpdate(root, privateKey, manifest)
+			Expect(sut.Put(chunked)).To(Succeed())
+
+			leaves, beforeErr := sut.Tree(manifest.Root)
+			Expect(beforeErr).To(BeNil())
+			Expect(backend.Delete("chunks/" + hex.EncodeToString(leaves[1]))).To(Succeed())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report the record with missing chunks", func() {
+			Expect(report.Problems).To(HaveLen(1))
+			Expect(report.Problems[0].Kind).To(Equal(store.ProblemMissingChunks))
+			Expect(report.Problems[0].Hash).To(Equal(hashHex(chunked)))
+		})
+	})
+
+	Describe("when a chunk isn't referenced by any record", func() {
+		var strayHash []byte
+
+		BeforeEach(func() {
+			var beforeErr error
+			strayHash, beforeErr = sut.PutChunk([]byte("stray"))
+			Expect(beforeErr).To(BeNil())
+
+			report, err = sut.Fsck(store.FsckOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should report the unreferenced chunk", func() {
+			Expect(report.Problems).To(HaveLen(1))
+			Expect(report.Problems[0].Kind).To(Equal(store.ProblemUnreferencedChunk))
+			Expect(report.Problems[0].Hash).To(Equal(hex.EncodeToString(strayHash)))
+		})
+
+		Describe("when repaired", func() {
+			BeforeEach(func() {
+				_, err = sut.Fsck(store.FsckOptions{Repair: true})
+				Expect(err).To(BeNil())
+			})
+
+			It("should remove the chunk", func() {
+				_, itErr := sut.Chunk(strayHash)
+				Expect(itErr).To(Equal(store.ErrNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+)
+
+// GarbageReport describes what was removed by a call
+// to CollectGarbage. Hashes are hex encoded
+type GarbageReport struct {
+	// Chunks lists the leaf hashes of the removed chunks
+	Chunks []string `json:"chunks"`
+
+	// Trees lists the roots of the removed trees
+	Trees []string `json:"trees"`
+}
+
+// CollectGarbage removes every chunk and tree that isn't referenced
+// by the metadata.Manifest of a stored record, unless it was uploaded
+// after uploadedBefore, and reports what was removed. The upload
+// markers of referenced chunks and trees are removed, so they are
+// collected as soon as the records referencing them are removed
+func (store *store) CollectGarbage(uploadedBefore time.Time) (*GarbageReport, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	keys, err := store.backend.Keys(recordsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]record.Record, 0, len(keys))
+	for _, key := range keys {
+		rec, err := store.getHex(strings.TrimPrefix(key, recordsPrefix))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	referenced, err := store.referencedChunks(records)
+	if err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := store.unreferencedChunks(referenced)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GarbageReport{Chunks: []string{}, Trees: []string{}}
+	for _, key := range unreferenced {
+		uploadedAt, ok, err := store.uploadedAt(key)
+		if err != nil {
+			return report, err
+		}
+		if ok && uploadedAt.After(uploadedBefore) {
+			continue
+		}
+
+		if err := store.removeChunk(key); err != nil {
+			return report, err
+		}
+		if strings.HasPrefix(key, treesPrefix) {
+			report.Trees = append(report.Trees, strings.TrimPrefix(key, treesPrefix))
+		} else {
+			report.Chunks = append(report.Chunks, strings.TrimPrefix(key, chunksPrefix))
+		}
+	}
+
+	markers, err := store.backend.Keys(uploadsPrefix)
+	if err != nil {
+		return report, err
+	}
+	for _, marker := range markers {
+		key := strings.TrimPrefix(marker, uploadsPrefix)
+		_, err := store.backend.Get(key)
+		if err != nil && err != ErrNotFound {
+			return report, err
+		}
+		if err == ErrNotFound || referenced[key] {
+			if err := store.backend.Delete(marker); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// referencedChunks returns the keys of the trees and chunks that the
+// metadata.Manifest of the records reference. Chunks of a tree that
+// is missing can't be known, so they aren't included
+func (store *store) referencedChunks(records []record.Record) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, rec := range records {
+		manifest := rec.Metadata().Manifest
+		if manifest == nil {
+			continue
+		}
+
+		treeKey := treesPrefix + hex.EncodeToString(manifest.Root)
+		if referenced[treeKey] {
+			continue
+		}
+		referenced[treeKey] = true
+
+		leaves, err := store.Tree(manifest.Root)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, leaf := range leaves {
+			referenced[chunksPrefix+hex.EncodeToString(leaf)] = true
+		}
+	}
+	return referenced, nil
+}
+
+// unreferencedChunks returns the keys of the stored
+// trees and chunks that aren't in referenced, sorted
+func (store *store) unreferencedChunks(referenced map[string]bool) ([]string, error) {
+	var unreferenced []string
+	for _, prefix := range []string{chunksPrefix, treesPrefix} {
+		keys, err := store.backend.Keys(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if !referenced[key] {
+				unreferenced = append(unreferenced, key)
+			}
+		}
+	}
+	return unreferenced, nil
+}
+
+// uploadedAt returns when the chunk or tree stored at key was last
+// put, or false if it has no upload marker
+func (store *store) uploadedAt(key string) (time.Time, bool, error) {
+	value, err := store.backend.Get(uploadsPrefix + key)
+	if err == ErrNotFound {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var uploadedAt time.Time
+	if err := uploadedAt.UnmarshalText(value); err != nil {
+		return time.Time{}, false, nil
+	}
+	return uploadedAt, true, nil
+}
+
+// removeChunk removes the chunk or tree
+// stored at key and its upload marker
+func (store *store) removeChunk(key string) error {
+	if err := store.backend.Delete(key); err != nil {
+		return err
+	}
+	return store.backend.Delete(uploadsPrefix + key)
+}
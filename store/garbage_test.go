@@ -0,0 +1,91 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"time"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CollectGarbage", func() {
+	var sut store.Store
+	var chunked record.UpdateRecord
+	var manifest *chunks.Manifest
+	var strayHash []byte
+	var notAfter time.Time
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+		notAfter = time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+		root, privateKey := generateRootRecord()
+		expiring := generateExpiringUpdate(root, privateKey, notAfter)
+		Expect(sut.Put(root)).To(Succeed())
+		Expect(sut.Put(expiring)).To(Succeed())
+
+		var err error
+		manifest, err = chunks.Write(sut, bytes.NewReader([]byte("chunked data")), 4)
+		Expect(err).To(BeNil())
+		chunked = generateChunkedUpdate(expiring, privateKey, manifest)
+		Expect(sut.Put(chunked)).To(Succeed())
+
+		strayHash, err = sut.PutChunk([]byte("stray"))
+		Expect(err).To(BeNil())
+	})
+
+	Describe("with uploads that are newer than uploadedBefore", func() {
+		It("should not remove anything", func() {
+			report, err := sut.CollectGarbage(time.Now().Add(-time.Hour))
+			Expect(err).To(BeNil())
+			Expect(report.Chunks).To(BeEmpty())
+			Expect(report.Trees).To(BeEmpty())
+			Expect(sut.Chunk(strayHash)).To(Equal([]byte("stray")))
+		})
+	})
+
+	Describe("with uploads that are older than uploadedBefore", func() {
+		var report *store.GarbageReport
+
+		BeforeEach(func() {
+			var err error
+			report, err = sut.CollectGarbage(time.Now().Add(time.Minute))
+			Expect(err).To(BeNil())
+		})
+
+		It("should remove the chunks that no record references", func() {
+			Expect(report.Chunks).To(Equal([]string{hex.EncodeToString(strayHash)}))
+			Expect(report.Trees).To(BeEmpty())
+
+			_, err := sut.Chunk(strayHash)
+			Expect(err).To(Equal(store.ErrNotFound))
+		})
+
+		It("should keep the chunks of stored records", func() {
+			Expect(sut.Data(mustHash(chunked))).To(Equal([]byte("chunked data")))
+		})
+
+		Describe("when the records referencing the chunks expire", func() {
+			BeforeEach(func() {
+				_, err := sut.Expire(notAfter.Add(time.Second))
+				Expect(err).To(BeNil())
+
+				report, err = sut.CollectGarbage(time.Now().Add(-time.Hour))
+				Expect(err).To(BeNil())
+			})
+
+			It("should remove their chunks and tree", func() {
+				Expect(report.Chunks).To(HaveLen(3))
+				Expect(report.Trees).To(Equal([]string{hex.EncodeToString(manifest.Root)}))
+
+				_, err := sut.Tree(manifest.Root)
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+	})
+})
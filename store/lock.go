@@ -0,0 +1,38 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockFile is the name of the file in a store directory
+// that Lock takes its lock on. A FileBackend skips it
+const lockFile = "LOCK"
+
+// Lock takes an exclusive lock on the store directory dir, so that only
+// one process at a time opens the store in it. The mutex of a Store only
+// serializes the writers within one process. The lock is held until the
+// returned Closer is closed or the process exits. If another process
+// holds it, Lock fails instead of waiting
+func Lock(dir string) (io.Closer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("the store in '%v' is in use by another process", dir)
+		}
+		return nil, fmt.Errorf("Failed to lock the store in '%v': %v", dir, err.Error())
+	}
+	return file, nil
+}
@@ -0,0 +1,52 @@
+package store_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lock", func() {
+	var dir string
+	var lock io.Closer
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "meshchain-lock")
+		Expect(err).To(BeNil())
+
+		lock, err = store.Lock(dir)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		lock.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should fail while the store is locked", func() {
+		_, err := store.Lock(dir)
+		Expect(err).To(MatchError("the store in '" + dir + "' is in use by another process"))
+	})
+
+	It("should succeed once the lock is closed", func() {
+		Expect(lock.Close()).To(Succeed())
+
+		lock, err := store.Lock(dir)
+		Expect(err).To(BeNil())
+		Expect(lock.Close()).To(Succeed())
+	})
+
+	It("should not list the lock file as a key of the FileBackend", func() {
+		backend, err := store.NewFileBackend(dir)
+		Expect(err).To(BeNil())
+		Expect(backend.Put("records/abc", []byte("value"))).To(Succeed())
+
+		Expect(backend.Keys("")).To(Equal([]string{"records/abc"}))
+	})
+})
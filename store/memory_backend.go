@@ -0,0 +1,63 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NewMemoryBackend constructs a Backend that keeps
+// everything in memory. Useful for tests and light nodes
+func NewMemoryBackend() Backend {
+	return &memoryBackend{values: make(map[string][]byte)}
+}
+
+type memoryBackend struct {
+	mutex  sync.RWMutex
+	values map[string][]byte
+}
+
+// Delete removes the value stored at key
+func (backend *memoryBackend) Delete(key string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	delete(backend.values, key)
+	return nil
+}
+
+// Get returns the value stored at key, or ErrNotFound
+func (backend *memoryBackend) Get(key string) ([]byte, error) {
+	backend.mutex.RLock()
+	defer backend.mutex.RUnlock()
+
+	value, ok := backend.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Keys returns every key starting with prefix, sorted
+func (backend *memoryBackend) Keys(prefix string) ([]string, error) {
+	backend.mutex.RLock()
+	defer backend.mutex.RUnlock()
+
+	var keys []string
+	for key := range backend.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Put stores the value at key, replacing any previous value
+func (backend *memoryBackend) Put(key string, value []byte) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	backend.values[key] = append([]byte(nil), value...)
+	return nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import "time"
+
+// RetentionPolicy describes which versions of a chain are kept
+// when pruning. The head of a chain is always kept, and so is the
+// anchor: the version just before the oldest kept version, which
+// is needed to verify it. The zero value keeps every version
+type RetentionPolicy struct {
+	// KeepLast keeps at most the last N versions. 0 means no limit
+	KeepLast int
+
+	// MaxAge keeps only versions stored less than MaxAge
+	// ago. 0 means no limit
+	MaxAge time.Duration
+}
+
+// RetentionPolicies holds the policy applied to every chain,
+// along with overrides for specific metadata.IDs
+type RetentionPolicies struct {
+	// Default applies to chains without an override
+	Default RetentionPolicy
+
+	// ByID maps a metadata.ID to the policy for its chain
+	ByID map[string]RetentionPolicy
+}
+
+// For returns the policy that applies to the chain for the metadata.ID
+func (policies RetentionPolicies) For(id string) RetentionPolicy {
+	if policy, ok := policies.ByID[id]; ok {
+		return policy
+	}
+	return policies.Default
+}
+
+// PruneReport describes what was removed by a call to Prune
+type PruneReport struct {
+	Chains []ChainPruneReport `json:"chains"`
+}
+
+// ChainPruneReport describes what was removed from a single chain.
+// Hashes are hex encoded
+type ChainPruneReport struct {
+	// ID is the metadata.ID of the chain
+	ID string `json:"id"`
+
+	// Anchor is the hash of the record now at the start of the chain
+	Anchor string `json:"anchor"`
+
+	// Pruned lists the hashes of the removed records, oldest first
+	Pruned []string `json:"pruned"`
+
+	// Retained is the number of versions kept after the anchor
+	Retained int `json:"retained"`
+}
+
+// Prune removes old versions of every chain according to the
+// retention policies, relative to now, and reports what was removed
+func (store *store) Prune(policies RetentionPolicies, now time.Time) (*PruneReport, error) {
+	ids, err := store.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	report := &PruneReport{Chains: []ChainPruneReport{}}
+	for _, id := range ids {
+		index, err := store.readIndex(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		anchor := policies.For(id).anchor(index.Entries, now)
+		if anchor <= 0 {
+			continue
+		}
+
+		chainReport := ChainPruneReport{
+			ID:       id,
+			Anchor:   index.Entries[anchor].Hash,
+			Retained: len(index.Entries) - anchor - 1,
+		}
+		for _, entry := range index.Entries[:anchor] {
+			chainReport.Pruned = append(chainReport.Pruned, entry.Hash)
+		}
+
+		anchorRecord, err := store.getHex(chainReport.Anchor)
+		if err != nil {
+			return report, err
+		}
+		if err := store.snapshotAnchor(anchorRecord); err != nil {
+			return report, err
+		}
+
+		// Write the index first so that a failure part way
+		// through leaves orphaned records rather than a broken chain
+		pruned := index.Entries[:anchor]
+		index.Entries = index.Entries[anchor:]
+		if err := store.writeIndex(id, index); err != nil {
+			return report, err
+		}
+		if err := store.removeChanges(pruned); err != nil {
+			return report, err
+		}
+		for _, hashHex := range chainReport.Pruned {
+			if err := store.backend.Delete(recordsPrefix + hashHex); err != nil {
+				return report, err
+			}
+			if err := store.backend.Delete(snapshotsPrefix + hashHex); err != nil {
+				return report, err
+			}
+		}
+
+		report.Chains = append(report.Chains, chainReport)
+	}
+
+	return report, nil
+}
+
+// anchor returns the index of the entry that the chain should start
+// at after pruning. Every entry before it may be removed
+func (policy RetentionPolicy) anchor(entries []indexEntry, now time.Time) int {
+	keepFrom := 0
+
+	if policy.KeepLast > 0 && len(entries)-policy.KeepLast > keepFrom {
+		keepFrom = len(entries) - policy.KeepLast
+	}
+
+	if policy.MaxAge > 0 {
+		for keepFrom < len(entries)-1 && now.Sub(entries[keepFrom].StoredAt) > policy.MaxAge {
+			keepFrom++
+		}
+	}
+
+	return keepFrom - 1
+}
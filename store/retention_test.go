@@ -0,0 +1,162 @@
+package store_test
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"time"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retention", func() {
+	var sut store.Store
+	var records []record.Record
+	var privateKey *rsa.PrivateKey
+	var id string
+	var report *store.PruneReport
+	var err error
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+		records, privateKey = generateChain(4)
+		id = records[0].Metadata().ID
+
+		for _, rec := range records {
+			Expect(sut.Put(rec)).To(Succeed())
+		}
+	})
+
+	Describe("Prune", func() {
+		Describe("with a zero policy", func() {
+			BeforeEach(func() {
+				report, err = sut.Prune(store.RetentionPolicies{}, time.Now())
+				Expect(err).To(BeNil())
+			})
+
+			It("should not prune anything", func() {
+				Expect(report.Chains).To(BeEmpty())
+			})
+
+			It("should keep the complete chain", func() {
+				chain, itErr := sut.Chain(id)
+				Expect(itErr).To(BeNil())
+				Expect(chain.Complete()).To(BeTrue())
+				Expect(chain.Records()).To(HaveLen(5))
+			})
+		})
+
+		Describe("with a default policy keeping the last 2 versions", func() {
+			BeforeEach(func() {
+				policies := store.RetentionPolicies{
+					Default: store.RetentionPolicy{KeepLast: 2},
+				}
+				report, err = sut.Prune(policies, time.Now())
+				Expect(err).To(BeNil())
+			})
+
+			It("should report the pruned records", func() {
+				Expect(report.Chains).To(HaveLen(1))
+				Expect(report.Chains[0].ID).To(Equal(id))
+				Expect(report.Chains[0].Pruned).To(Equal([]string{
+					hex.EncodeToString(mustHash(records[0])),
+					hex.EncodeToString(mustHash(records[1])),
+				}))
+				Expect(report.Chains[0].Retained).To(Equal(2))
+			})
+
+			It("should report the anchor", func() {
+				Expect(report.Chains[0].Anchor).To(Equal(hex.EncodeToString(mustHash(records[2]))))
+			})
+
+			It("should leave a verifiable chain starting at the anchor", func() {
+				chain, itErr := sut.Chain(id)
+				Expect(itErr).To(BeNil())
+				Expect(chain.Complete()).To(BeFalse())
+				Expect(chain.Records()).To(HaveLen(3))
+				Expect(chain.Verify()).To(Succeed())
+			})
+
+			It("should remove the pruned records", func() {
+				_, itErr := sut.Get(mustHash(records[0]))
+				Expect(itErr).To(Equal(store.ErrNotFound))
+			})
+
+			It("should still accept updates", func() {
+				update := generateUpdateRecord(records[4], privateKey, "new")
+				Expect(sut.Put(update)).To(Succeed())
+
+				head, itErr := sut.Head(id)
+				Expect(itErr).To(BeNil())
+				Expect(head.Hash()).To(Equal(mustHash(update)))
+			})
+
+			Describe("when pruned again", func() {
+				BeforeEach(func() {
+					policies := store.RetentionPolicies{
+						Default: store.RetentionPolicy{KeepLast: 2},
+					}
+					report, err = sut.Prune(policies, time.Now())
+					Expect(err).To(BeNil())
+				})
+
+				It("should not prune anything", func() {
+					Expect(report.Chains).To(BeEmpty())
+				})
+			})
+		})
+
+		Describe("with an override for the ID", func() {
+			BeforeEach(func() {
+				policies := store.RetentionPolicies{
+					Default: store.RetentionPolicy{KeepLast: 1},
+					ByID: map[string]store.RetentionPolicy{
+						id: store.RetentionPolicy{KeepLast: 3},
+					},
+				}
+				report, err = sut.Prune(policies, time.Now())
+				Expect(err).To(BeNil())
+			})
+
+			It("should apply the override", func() {
+				Expect(report.Chains).To(HaveLen(1))
+				Expect(report.Chains[0].Pruned).To(HaveLen(1))
+				Expect(report.Chains[0].Retained).To(Equal(3))
+			})
+		})
+
+		Describe("with a MaxAge that every version exceeds", func() {
+			BeforeEach(func() {
+				policies := store.RetentionPolicies{
+					Default: store.RetentionPolicy{MaxAge: time.Minute},
+				}
+				report, err = sut.Prune(policies, time.Now().Add(time.Hour))
+				Expect(err).To(BeNil())
+			})
+
+			It("should keep the head and its anchor", func() {
+				chain, itErr := sut.Chain(id)
+				Expect(itErr).To(BeNil())
+				Expect(chain.Records()).To(HaveLen(2))
+				Expect(chain.Head().Hash()).To(Equal(mustHash(records[4])))
+			})
+		})
+
+		Describe("with a MaxAge that no version exceeds", func() {
+			BeforeEach(func() {
+				policies := store.RetentionPolicies{
+					Default: store.RetentionPolicy{MaxAge: time.Hour},
+				}
+				report, err = sut.Prune(policies, time.Now())
+				Expect(err).To(BeNil())
+			})
+
+			It("should not prune anything", func() {
+				Expect(report.Chains).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/royvandewater/meshchain/cryptohelpers"
+	"github.com/royvandewater/meshchain/record"
+)
+
+// Secondary indexes map a property of the head of each chain to the
+// chain's metadata.ID. Each entry is an empty value stored at
+// "<prefix><property>/<id>"
+const (
+	secondaryIndexPrefix  = "indexes/"
+	localIDIndexPrefix    = secondaryIndexPrefix + "localId/"
+	publicKeyIndexPrefix  = secondaryIndexPrefix + "publicKey/"
+	annotationIndexPrefix = secondaryIndexPrefix + "annotation/"
+)
+
+// FindByAnnotation returns the metadata.ID of every chain whose
+// head has the annotation key set to value, sorted
+func (store *store) FindByAnnotation(key, value string) ([]string, error) {
+	return store.findByPrefix(annotationIndexPrefix + annotationKey(key, value) + "/")
+}
+
+// FindByLocalID returns the metadata.ID of every chain whose
+// head has the given metadata.LocalID, sorted
+func (store *store) FindByLocalID(localID string) ([]string, error) {
+	return store.findByPrefix(localIDIndexPrefix + localIDKey(localID) + "/")
+}
+
+// FindByPublicKey returns the metadata.ID of every chain whose head
+// lists the given publicKey, in pem format. These are the chains the
+// matching private key can currently update. The result is sorted
+func (store *store) FindByPublicKey(publicKey string) ([]string, error) {
+	fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.findByPrefix(publicKeyIndexPrefix + fingerprint + "/")
+}
+
+func (store *store) findByPrefix(prefix string) ([]string, error) {
+	keys, err := store.backend.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, prefix)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// updateSecondaryIndexes moves the secondary index entries for a
+// chain from its previous head, which may be nil, to its new head
+func (store *store) updateSecondaryIndexes(previous, head record.Record) error {
+	var previousKeys []string
+	if previous != nil {
+		var err error
+		if previousKeys, err = secondaryIndexKeys(previous); err != nil {
+			return err
+		}
+	}
+
+	keys, err := secondaryIndexKeys(head)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool)
+	for _, key := range keys {
+		current[key] = true
+		if err := store.backend.Put(key, []byte{}); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range previousKeys {
+		if current[key] {
+			continue
+		}
+		if err := store.backend.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// secondaryIndexKeys returns the keys of every secondary
+// index entry for a record at the head of its chain
+func secondaryIndexKeys(head record.Record) ([]string, error) {
+	metadata := head.Metadata()
+
+	keys := []string{localIDIndexPrefix + localIDKey(metadata.LocalID) + "/" + metadata.ID}
+	for _, publicKey := range metadata.PublicKeys {
+		fingerprint, err := cryptohelpers.RSAPublicKeyFingerprint(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, publicKeyIndexPrefix+fingerprint+"/"+metadata.ID)
+	}
+	for key, value := range metadata.Annotations {
+		keys = append(keys, annotationIndexPrefix+annotationKey(key, value)+"/"+metadata.ID)
+	}
+
+	return keys, nil
+}
+
+// localIDKey hashes the localID, which may contain
+// any character, to make it safe to use in a key
+func localIDKey(localID string) string {
+	hash := sha256.Sum256([]byte(localID))
+	return hex.EncodeToString(hash[:])
+}
+
+// annotationKey hashes the annotation's key and value
+// separately, to make them safe to use in a key
+func annotationKey(key, value string) string {
+	keyHash := sha256.Sum256([]byte(key))
+	valueHash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(keyHash[:]) + "/" + hex.EncodeToString(valueHash[:])
+}
@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"crypto/rsa"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Secondary indexes", func() {
+	var sut store.Store
+	var root record.RootRecord
+	var privateKey *rsa.PrivateKey
+	var publicKey string
+	var id string
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+		root, privateKey = generateRootRecord()
+		publicKey = root.Metadata().PublicKeys[0]
+		id = root.Metadata().ID
+
+		Expect(sut.Put(root)).To(Succeed())
+	})
+
+	Describe("with a root record", func() {
+		It("should find the chain by the root's publicKey", func() {
+			Expect(sut.FindByPublicKey(publicKey)).To(Equal([]string{id}))
+		})
+
+		It("should find the chain by the root's localID", func() {
+			Expect(sut.FindByLocalID("")).To(Equal([]string{id}))
+		})
+
+		It("should not find the chain by another publicKey", func() {
+			otherPublicKey, _ := generateKeys()
+			Expect(sut.FindByPublicKey(otherPublicKey)).To(BeEmpty())
+		})
+	})
+
+	Describe("when the keys are rotated and the localID is changed", func() {
+		var newPublicKey string
+
+		BeforeEach(func() {
+			var update record.UpdateRecord
+			update, newPublicKey, _ = generateRotation(root, privateKey, "thermostat")
+			Expect(sut.Put(update)).To(Succeed())
+		})
+
+		It("should find the chain by the new publicKey", func() {
+			Expect(sut.FindByPublicKey(newPublicKey)).To(Equal([]string{id}))
+		})
+
+		It("should no longer find the chain by the old publicKey", func() {
+			Expect(sut.FindByPublicKey(publicKey)).To(BeEmpty())
+		})
+
+		It("should find the chain by the new localID", func() {
+			Expect(sut.FindByLocalID("thermostat")).To(Equal([]string{id}))
+		})
+
+		It("should no longer find the chain by the old localID", func() {
+			Expect(sut.FindByLocalID("")).To(BeEmpty())
+		})
+	})
+
+	Describe("when the chain is annotated", func() {
+		var update record.UpdateRecord
+
+		BeforeEach(func() {
+			update = generateAnnotatedUpdate(root, privateKey, map[string]string{"owner": "roy", "environment": "production"})
+			Expect(sut.Put(update)).To(Succeed())
+		})
+
+		It("should find the chain by each annotation", func() {
+			Expect(sut.FindByAnnotation("owner", "roy")).To(Equal([]string{id}))
+			Expect(sut.FindByAnnotation("environment", "production")).To(Equal([]string{id}))
+		})
+
+		It("should not find the chain by another value", func() {
+			Expect(sut.FindByAnnotation("owner", "someone else")).To(BeEmpty())
+		})
+
+		Describe("when an annotation is changed", func() {
+			BeforeEach(func() {
+				Expect(sut.Put(generateAnnotatedUpdate(update, privateKey, map[string]string{"owner": "roy", "environment": "staging"}))).To(Succeed())
+			})
+
+			It("should find the chain by the new value", func() {
+				Expect(sut.FindByAnnotation("environment", "staging")).To(Equal([]string{id}))
+				Expect(sut.FindByAnnotation("owner", "roy")).To(Equal([]string{id}))
+			})
+
+			It("should no longer find the chain by the old value", func() {
+				Expect(sut.FindByAnnotation("environment", "production")).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("with an invalid publicKey", func() {
+		It("should yield an error", func() {
+			_, err := sut.FindByPublicKey("not a key")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
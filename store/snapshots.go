@@ -0,0 +1,172 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+)
+
+// The full data of a record whose data is a delta is stored at
+// "snapshots/<hash>" for every snapshotInterval versions, so that
+// materializing it doesn't need every delta since the last full
+// data. Prune also snapshots an anchor that is a delta, since the
+// records needed to materialize it are removed
+const snapshotsPrefix = "snapshots/"
+
+// snapshotInterval is how many versions apart deltas are snapshotted
+const snapshotInterval = 16
+
+// DeltaError is returned by Put when the data of an update
+// is a delta that does not apply to the full data of its parent
+type DeltaError struct {
+	Message string
+}
+
+func (err *DeltaError) Error() string {
+	return err.Message
+}
+
+// Data returns the full data of the record with the given hash,
+// materializing its delta from the closest earlier record that has
+// full data or a snapshot. Data that is stored in chunks is read
+// from them into memory, use DataReader to stream it instead
+func (store *store) Data(hash []byte) ([]byte, error) {
+	rec, err := store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return store.data(rec)
+}
+
+// DataReader returns a reader of the full data of the record with
+// the given hash. The data of a record that is stored in chunks is
+// streamed from them, and only materialized deltas are read into memory
+func (store *store) DataReader(hash []byte) (io.Reader, error) {
+	rec, err := store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := rec.Metadata()
+	if metadata.Delta == "" && metadata.Manifest != nil {
+		return chunks.NewReader(store, metadata.Manifest), nil
+	}
+
+	data, err := store.data(rec)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// Snapshot returns the full data of the record with the
+// hash, or false if there is no snapshot of it
+func (store *store) Snapshot(hash []byte) ([]byte, bool, error) {
+	data, err := store.backend.Get(snapshotsPrefix + hex.EncodeToString(hash))
+	if err == ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// data materializes the full data of the record
+func (store *store) data(rec record.Record) ([]byte, error) {
+	deltas := []record.Record{}
+	var data []byte
+	for {
+		metadata := rec.Metadata()
+		if metadata.Delta == "" {
+			if metadata.Manifest == nil {
+				data = rec.Data()
+				break
+			}
+			chunked, err := ioutil.ReadAll(chunks.NewReader(store, metadata.Manifest))
+			if err != nil {
+				return nil, err
+			}
+			data = chunked
+			break
+		}
+
+		hash, err := rec.Hash()
+		if err != nil {
+			return nil, err
+		}
+		snapshot, ok, err := store.Snapshot(hash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			data = snapshot
+			break
+		}
+
+		deltas = append(deltas, rec)
+		parent, err := store.Get(rec.ParentHash())
+		if err == ErrNotFound {
+			return nil, fmt.Errorf("version '%v' can't be materialized, its parent was pruned without a snapshot", rec.Version())
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec = parent
+	}
+
+	for i := len(deltas) - 1; i >= 0; i-- {
+		var err error
+		if data, err = record.FullData(deltas[i], data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// applyDelta materializes the full data of an update whose data is a
+// delta of the parent, returning a *DeltaError if it does not apply,
+// and snapshots it every snapshotInterval versions
+func (store *store) applyDelta(parent, rec record.Record) error {
+	parentData, err := store.data(parent)
+	if err != nil {
+		return err
+	}
+
+	data, err := record.FullData(rec, parentData)
+	if err != nil {
+		return &DeltaError{err.Error()}
+	}
+
+	if rec.Version()%snapshotInterval != 0 {
+		return nil
+	}
+	return store.writeSnapshot(rec, data)
+}
+
+// snapshotAnchor snapshots the record that a pruned chain will start
+// at if it is a delta, since its ancestors are about to be removed
+func (store *store) snapshotAnchor(anchor record.Record) error {
+	if anchor.Metadata().Delta == "" {
+		return nil
+	}
+
+	data, err := store.data(anchor)
+	if err != nil {
+		return err
+	}
+	return store.writeSnapshot(anchor, data)
+}
+
+func (store *store) writeSnapshot(rec record.Record, data []byte) error {
+	hash, err := rec.Hash()
+	if err != nil {
+		return err
+	}
+	return store.backend.Put(snapshotsPrefix+hex.EncodeToString(hash), data)
+}
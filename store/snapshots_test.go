@@ -0,0 +1,136 @@
+package store_test
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	"github.com/royvandewater/meshchain/delta"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshots", func() {
+	var sut store.Store
+	var records []record.Record
+	var fullData [][]byte
+	var privateKey *rsa.PrivateKey
+	var id string
+
+	// appendDelta puts a binary delta that turns the
+	// full data of the head into the data
+	appendDelta := func(data []byte) {
+		parent := records[len(records)-1]
+		patch := delta.CreateBinary(fullData[len(fullData)-1], data)
+		update := generateDeltaUpdate(parent, privateKey, delta.Binary, patch)
+		Expect(sut.Put(update)).To(Succeed())
+
+		records = append(records, update)
+		fullData = append(fullData, data)
+	}
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+
+		var root record.RootRecord
+		root, privateKey = generateRootRecord()
+		Expect(sut.Put(root)).To(Succeed())
+		id = root.Metadata().ID
+
+		records = []record.Record{root}
+		fullData = [][]byte{root.Data()}
+		for i := 1; i <= 17; i++ {
+			appendDelta([]byte(fmt.Sprintf("root data, version %v", i)))
+		}
+	})
+
+	Describe("Data", func() {
+		It("should materialize the full data of every version", func() {
+			for i, rec := range records {
+				Expect(sut.Data(mustHash(rec))).To(Equal(fullData[i]))
+			}
+		})
+	})
+
+	Describe("Chain", func() {
+		It("should materialize the full data of every version", func() {
+			chain, err := sut.Chain(id)
+			Expect(err).To(BeNil())
+			Expect(chain.Data(17)).To(Equal(fullData[17]))
+		})
+	})
+
+	Describe("Snapshot", func() {
+		It("should snapshot every 16th version", func() {
+			data, ok, err := sut.Snapshot(mustHash(records[16]))
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeTrue())
+			Expect(data).To(Equal(fullData[16]))
+		})
+
+		It("should not snapshot the versions in between", func() {
+			_, ok, err := sut.Snapshot(mustHash(records[15]))
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("Prune", func() {
+		BeforeEach(func() {
+			policies := store.RetentionPolicies{
+				Default: store.RetentionPolicy{KeepLast: 2},
+			}
+			_, err := sut.Prune(policies, time.Now())
+			Expect(err).To(BeNil())
+		})
+
+		It("should snapshot the anchor", func() {
+			data, ok, err := sut.Snapshot(mustHash(records[15]))
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeTrue())
+			Expect(data).To(Equal(fullData[15]))
+		})
+
+		It("should remove the snapshots of pruned records", func() {
+			_, ok, err := sut.Snapshot(mustHash(records[14]))
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should still materialize the full data of the kept versions", func() {
+			chain, err := sut.Chain(id)
+			Expect(err).To(BeNil())
+			Expect(chain.Complete()).To(BeFalse())
+			Expect(chain.Data(17)).To(Equal(fullData[17]))
+			Expect(sut.Data(mustHash(records[17]))).To(Equal(fullData[17]))
+		})
+
+		It("should accept another delta", func() {
+			appendDelta([]byte("root data, version 18"))
+			Expect(sut.Data(mustHash(records[18]))).To(Equal(fullData[18]))
+		})
+	})
+
+	Describe("Put", func() {
+		Describe("with a delta that does not apply to the parent", func() {
+			var err error
+
+			BeforeEach(func() {
+				update := generateDeltaUpdate(records[17], privateKey, delta.JSONPatch, []byte(`[]`))
+				err = sut.Put(update)
+			})
+
+			It("should yield a DeltaError", func() {
+				Expect(err).To(BeAssignableToTypeOf(&store.DeltaError{}))
+				Expect(err.Error()).To(HavePrefix("json-patch delta of version '18' does not apply to its parent: document is not valid JSON"))
+			})
+
+			It("should not change the head", func() {
+				Expect(sut.Head(id)).To(Equal(records[17]))
+			})
+		})
+	})
+})
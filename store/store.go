@@ -0,0 +1,437 @@
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/encoding"
+)
+
+// ErrNotFound is returned when a record or chain is not in the store
+var ErrNotFound = errors.New("not found")
+
+// ConflictError is returned by Put when a record is valid, but does
+// not fit the current state of the chain for its metadata.ID
+type ConflictError struct {
+	Message string
+}
+
+func (err *ConflictError) Error() string {
+	return err.Message
+}
+
+const (
+	chainsPrefix  = "chains/"
+	recordsPrefix = "records/"
+)
+
+// Store persists verified records, keeping a single
+// linear chain of records for every metadata.ID. It also
+// keeps the chunks of data described by a metadata.Manifest
+type Store interface {
+	chunks.Store
+
+	// Chain returns the stored chain for the metadata.ID
+	Chain(id string) (record.Chain, error)
+
+	// Changes returns up to limit accepted records that were
+	// stored after the cursor, oldest first
+	Changes(cursor uint64, limit int) ([]Change, error)
+
+	// CollectGarbage removes every chunk and tree that no stored
+	// record references, unless it was uploaded after uploadedBefore,
+	// and reports what was removed
+	CollectGarbage(uploadedBefore time.Time) (*GarbageReport, error)
+
+	// Cursor returns the cursor of the most recently accepted
+	// record, or 0 if the store is empty
+	Cursor() (uint64, error)
+
+	// Data returns the full data of the record with the given hash,
+	// materializing it if the record's data is a delta
+	Data(hash []byte) ([]byte, error)
+
+	// DataReader returns a reader of the full data of the record with
+	// the given hash. Data that is stored in chunks is streamed from
+	// them instead of being read into memory
+	DataReader(hash []byte) (io.Reader, error)
+
+	// Evict removes the chain for the metadata.ID, so that it is
+	// no longer served, and allows it to be put again later
+	Evict(id string) error
+
+	// Expire removes every chain whose head has expired at now,
+	// so that it is no longer served, and reports what was removed.
+	// The RootRecord of a removed chain can't be put again
+	Expire(now time.Time) (*ExpiryReport, error)
+
+	// FindByAnnotation returns the metadata.ID of every chain whose
+	// head has the annotation key set to value, sorted
+	FindByAnnotation(key, value string) ([]string, error)
+
+	// FindByLocalID returns the metadata.ID of every chain whose
+	// head has the given metadata.LocalID, sorted
+	FindByLocalID(localID string) ([]string, error)
+
+	// FindByPublicKey returns the metadata.ID of every chain whose
+	// head lists the given publicKey, in pem format, sorted
+	FindByPublicKey(publicKey string) ([]string, error)
+
+	// Fsck re-verifies every stored record and chain index, optionally
+	// rebuilding the chain indexes from the raw records
+	Fsck(options FsckOptions) (*FsckReport, error)
+
+	// Get returns the record with the given hash
+	Get(hash []byte) (record.Record, error)
+
+	// Hashes returns the hashes of the stored records of the
+	// chain for the metadata.ID, oldest first, without reading
+	// the records themselves
+	Hashes(id string) ([][]byte, error)
+
+	// Head returns the most recent record for the metadata.ID
+	Head(id string) (record.Record, error)
+
+	// IDs returns the metadata.ID of every stored chain, sorted
+	IDs() ([]string, error)
+
+	// Prune removes old versions of every chain according to the
+	// retention policies, relative to now, and reports what was removed
+	Prune(policies RetentionPolicies, now time.Time) (*PruneReport, error)
+
+	// Put appends a record to the chain for its metadata.ID. A
+	// RootRecord starts a new chain and an UpdateRecord must have the
+	// current head as its parent, otherwise a *ConflictError is
+	// returned. An UpdateRecord whose data is a delta that does not
+	// apply to its parent yields a *DeltaError, and a record whose
+	// metadata.Manifest describes chunks that aren't stored yields a
+	// *ChunksError. Putting a record that is already stored is a no-op
+	Put(rec record.Record) error
+
+	// Reencrypt rewrites every value that was encrypted with a previous
+	// master key using the active one, while no records are written,
+	// and returns how many were rewritten. It fails unless the store's
+	// backend is an EncryptedBackend
+	Reencrypt() (int, error)
+
+	// Snapshot returns the full data of the record with the
+	// hash, or false if there is no snapshot of it
+	Snapshot(hash []byte) ([]byte, bool, error)
+
+	// Subscribe delivers every record accepted after the cursor
+	// to the chains for the IDs, or to every chain if no IDs are
+	// given. Subscribing with the cursor of the last change that
+	// was received resumes where a previous subscription left off
+	Subscribe(ids []string, cursor uint64) Subscription
+
+	// Usage returns how many records are stored in the chain for
+	// the metadata.ID and the size of their data, without
+	// verifying the records
+	Usage(id string) (*Usage, error)
+}
+
+// New constructs a Store that keeps its records and
+// chain indexes in the given backend
+func New(backend Backend) Store {
+	return &store{backend: backend}
+}
+
+type store struct {
+	backend Backend
+	mutex   sync.Mutex
+
+	// firstCursor and cursor cache the cursors of the oldest and
+	// the most recent change in the change log, they are read
+	// from the backend when cursorLoaded is false
+	firstCursor  uint64
+	cursor       uint64
+	cursorLoaded bool
+	subscribers  subscribers
+}
+
+// chainIndex lists the hashes of the records in a
+// chain, oldest first
+type chainIndex struct {
+	Entries []indexEntry `json:"entries"`
+}
+
+type indexEntry struct {
+	Hash     string    `json:"hash"`
+	StoredAt time.Time `json:"storedAt"`
+
+	// Cursor is the cursor of the record's change, so that the change
+	// is removed along with the record. It is 0 in indexes written
+	// before the change log was truncated
+	Cursor uint64 `json:"cursor,omitempty"`
+
+	// Size is the DataSize of the record, so that the Usage of a
+	// chain doesn't need its records. It is nil in indexes written
+	// before sizes were kept
+	Size *int64 `json:"size,omitempty"`
+}
+
+// Usage is what is stored in the chain for a metadata.ID
+type Usage struct {
+	// Records is the number of stored records
+	Records int
+
+	// Bytes is the total DataSize of the stored records
+	Bytes int64
+}
+
+// DataSize returns the size of the record's data, which is the
+// size declared by its metadata.Manifest if it is stored in chunks
+func DataSize(rec record.Record) int64 {
+	if manifest := rec.Metadata().Manifest; manifest != nil {
+		return manifest.Size
+	}
+	return int64(len(rec.Data()))
+}
+
+// Chain returns the stored chain for the metadata.ID
+func (store *store) Chain(id string) (record.Chain, error) {
+	index, err := store.readIndex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]record.Record, len(index.Entries))
+	for i, entry := range index.Entries {
+		records[i], err = store.getHex(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return record.NewChainWithSnapshots(records, store)
+}
+
+// Get returns the record with the given hash
+func (store *store) Get(hash []byte) (record.Record, error) {
+	return store.getHex(hex.EncodeToString(hash))
+}
+
+// Hashes returns the hashes of the stored records of the chain
+func (store *store) Hashes(id string) ([][]byte, error) {
+	index, err := store.readIndex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, len(index.Entries))
+	for i, entry := range index.Entries {
+		hashes[i], err = hex.DecodeString(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode chain index '%v': %v", id, err.Error())
+		}
+	}
+	return hashes, nil
+}
+
+// Usage returns what is stored in the chain for the metadata.ID
+// from its chain index, reading only the records whose index entry
+// has no size
+func (store *store) Usage(id string) (*Usage, error) {
+	index, err := store.readIndex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{Records: len(index.Entries)}
+	for _, entry := range index.Entries {
+		if entry.Size != nil {
+			usage.Bytes += *entry.Size
+			continue
+		}
+
+		rec, err := store.getHex(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		usage.Bytes += DataSize(rec)
+	}
+	return usage, nil
+}
+
+// Head returns the most recent record for the metadata.ID
+func (store *store) Head(id string) (record.Record, error) {
+	index, err := store.readIndex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.getHex(index.Entries[len(index.Entries)-1].Hash)
+}
+
+// IDs returns the metadata.ID of every stored chain, sorted
+func (store *store) IDs() ([]string, error) {
+	keys, err := store.backend.Keys(chainsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, chainsPrefix)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Put appends a record to the chain for its metadata.ID
+func (store *store) Put(rec record.Record) error {
+	hash, err := rec.Hash()
+	if err != nil {
+		return err
+	}
+	hashHex := hex.EncodeToString(hash)
+	id := rec.Metadata().ID
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	index, err := store.readIndex(id)
+	if err == ErrNotFound {
+		index = &chainIndex{}
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range index.Entries {
+		if entry.Hash == hashHex {
+			return nil
+		}
+	}
+
+	var head record.Record
+	if len(rec.ParentHash()) == 0 {
+		if len(index.Entries) != 0 {
+			return &ConflictError{fmt.Sprintf("a chain already exists for metadata.ID '%v'", id)}
+		}
+		if err := store.checkExpired(id); err != nil {
+			return err
+		}
+	} else {
+		if len(index.Entries) == 0 {
+			return &ConflictError{fmt.Sprintf("no chain exists for metadata.ID '%v'", id)}
+		}
+
+		headEntry := index.Entries[len(index.Entries)-1]
+		if headEntry.Hash != hex.EncodeToString(rec.ParentHash()) {
+			return &ConflictError{"parent of the record is not the head of the chain"}
+		}
+
+		head, err = store.getHex(headEntry.Hash)
+		if err != nil {
+			return err
+		}
+		if _, err := record.NewChain([]record.Record{head, rec}); err != nil {
+			return err
+		}
+		if rec.Metadata().Delta != "" {
+			if err := store.applyDelta(head, rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	if manifest := rec.Metadata().Manifest; manifest != nil {
+		if err := store.checkChunks(manifest); err != nil {
+			return err
+		}
+	}
+
+	if err := store.writeRecord(hashHex, rec); err != nil {
+		return err
+	}
+
+	_, last, err := store.cursors()
+	if err != nil {
+		return err
+	}
+
+	index.Entries = append(index.Entries, indexEntry{Hash: hashHex, StoredAt: time.Now(), Cursor: last + 1, Size: sizeOf(rec)})
+	if err := store.writeIndex(id, index); err != nil {
+		return err
+	}
+
+	if err := store.updateSecondaryIndexes(head, rec); err != nil {
+		return err
+	}
+
+	return store.appendChange(last+1, id, hashHex)
+}
+
+// getHex reads the record stored under the hex encoded hash
+func (store *store) getHex(hashHex string) (record.Record, error) {
+	data, err := store.backend.Get(recordsPrefix + hashHex)
+	if err != nil {
+		return nil, err
+	}
+
+	recordPB := &encoding.Record{}
+	if err := proto.Unmarshal(data, recordPB); err != nil {
+		return nil, fmt.Errorf("Failed to decode record '%v': %v", hashHex, err.Error())
+	}
+
+	return record.FromTrustedProto(recordPB)
+}
+
+// readIndex reads the chain index for the metadata.ID
+func (store *store) readIndex(id string) (*chainIndex, error) {
+	data, err := store.backend.Get(chainsPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &chainIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("Failed to decode chain index '%v': %v", id, err.Error())
+	}
+	if len(index.Entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return index, nil
+}
+
+// writeIndex replaces the chain index for the metadata.ID
+func (store *store) writeIndex(id string, index *chainIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return store.backend.Put(chainsPrefix+id, data)
+}
+
+// writeRecord stores the binary version of the record
+// under its hex encoded hash
+func (store *store) writeRecord(hashHex string, rec record.Record) error {
+	recordPB, err := rec.Proto()
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(recordPB)
+	if err != nil {
+		return err
+	}
+
+	return store.backend.Put(recordsPrefix+hashHex, data)
+}
+
+// sizeOf returns the DataSize of the record for its index entry
+func sizeOf(rec record.Record) *int64 {
+	size := DataSize(rec)
+	return &size
+}
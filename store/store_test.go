@@ -0,0 +1,154 @@
+package store_test
+
+import (
+	"regexp"
+
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var sut store.Store
+	var err error
+
+	BeforeEach(func() {
+		sut = store.New(store.NewMemoryBackend())
+	})
+
+	Describe("Put", func() {
+		var records []record.Record
+
+		BeforeEach(func() {
+			records, _ = generateChain(2)
+		})
+
+		Describe("when given a root record and its updates in order", func() {
+			BeforeEach(func() {
+				for _, rec := range records {
+					err = sut.Put(rec)
+					Expect(err).To(BeNil())
+				}
+			})
+
+			It("should return the last update as the head", func() {
+				head, itErr := sut.Head(records[0].Metadata().ID)
+				Expect(itErr).To(BeNil())
+				Expect(head.Hash()).To(Equal(mustHash(records[2])))
+			})
+
+			It("should return a complete chain", func() {
+				chain, itErr := sut.Chain(records[0].Metadata().ID)
+				Expect(itErr).To(BeNil())
+				Expect(chain.Complete()).To(BeTrue())
+				Expect(chain.Records()).To(HaveLen(3))
+			})
+
+			It("should return records by hash", func() {
+				rec, itErr := sut.Get(mustHash(records[1]))
+				Expect(itErr).To(BeNil())
+				Expect(rec.Data()).To(Equal(records[1].Data()))
+			})
+
+			It("should return the hashes of the chain, oldest first", func() {
+				Expect(sut.Hashes(records[0].Metadata().ID)).To(Equal([][]byte{
+					mustHash(records[0]),
+					mustHash(records[1]),
+					mustHash(records[2]),
+				}))
+			})
+
+			It("should list the ID", func() {
+				Expect(sut.IDs()).To(Equal([]string{records[0].Metadata().ID}))
+			})
+
+			It("should return the usage of the chain", func() {
+				size := int64(0)
+				for _, rec := range records {
+					size += int64(len(rec.Data()))
+				}
+				Expect(sut.Usage(records[0].Metadata().ID)).To(Equal(&store.Usage{Records: 3, Bytes: size}))
+			})
+
+			Describe("when the same record is put again", func() {
+				BeforeEach(func() {
+					err = sut.Put(records[1])
+				})
+
+				It("should not yield an error", func() {
+					Expect(err).To(BeNil())
+				})
+			})
+
+			Describe("when a second root record is put for the ID", func() {
+				BeforeEach(func() {
+					root, _ := generateRootRecord()
+					err = sut.Put(root)
+					Expect(err).To(BeNil())
+				})
+
+				It("should start a separate chain", func() {
+					Expect(sut.IDs()).To(HaveLen(2))
+				})
+			})
+		})
+
+		Describe("when given an update without its root", func() {
+			BeforeEach(func() {
+				err = sut.Put(records[1])
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("no chain exists for metadata.ID '" + records[0].Metadata().ID + "'"))
+			})
+		})
+
+		Describe("when given an update whose parent is not the head", func() {
+			BeforeEach(func() {
+				Expect(sut.Put(records[0])).To(Succeed())
+				err = sut.Put(records[2])
+			})
+
+			It("should yield an error", func() {
+				Expect(err).NotTo(BeNil())
+				Expect(err.Error()).To(Equal("parent of the record is not the head of the chain"))
+			})
+		})
+	})
+
+	Describe("Usage of a chain indexed before sizes were kept", func() {
+		It("should read the sizes from the records", func() {
+			backend := store.NewMemoryBackend()
+			sut = store.New(backend)
+			records, _ := generateChain(1)
+			for _, rec := range records {
+				Expect(sut.Put(rec)).To(Succeed())
+			}
+
+			id := records[0].Metadata().ID
+			index, itErr := backend.Get("chains/" + id)
+			Expect(itErr).To(BeNil())
+			legacy := regexp.MustCompile(`,"size":\d+`).ReplaceAll(index, nil)
+			Expect(legacy).NotTo(Equal(index))
+			Expect(backend.Put("chains/"+id, legacy)).To(Succeed())
+
+			size := int64(len(records[0].Data()) + len(records[1].Data()))
+			Expect(sut.Usage(id)).To(Equal(&store.Usage{Records: 2, Bytes: size}))
+		})
+	})
+
+	Describe("Head", func() {
+		Describe("when the ID is not stored", func() {
+			BeforeEach(func() {
+				_, err = sut.Head("nope")
+			})
+
+			It("should yield ErrNotFound", func() {
+				Expect(err).To(Equal(store.ErrNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,193 @@
+package store_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/royvandewater/meshchain/chunks"
+	"github.com/royvandewater/meshchain/record"
+	"github.com/royvandewater/meshchain/record/generators"
+)
+
+func generateKeys() (string, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 512)
+	Expect(err).To(BeNil())
+
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	Expect(err).To(BeNil())
+
+	publicKeyBlock := pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyDer,
+	}
+	return string(pem.EncodeToMemory(&publicKeyBlock)), privateKey
+}
+
+// generateRootRecord creates a new record with public/private key pair.
+// it has assertions on all error cases, so it throws if anything goes
+// wrong.
+func generateRootRecord() (record.RootRecord, *rsa.PrivateKey) {
+	publicKey, privateKey := generateKeys()
+
+	metadata := record.Metadata{
+		ID:         generators.ID("", []string{publicKey}),
+		PublicKeys: []string{publicKey},
+	}
+	data := []byte(`root data`)
+
+	unsigned, err := record.NewUnsignedRootRecord(metadata, data)
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewRootRecord(metadata, data, signature)
+	Expect(err).To(BeNil())
+
+	return rec, privateKey
+}
+
+// generateUpdateRecord creates an update of the parent that keeps
+// the parent's key. It has assertions on all error cases, so it throws
+// if anything goes wrong.
+func generateUpdateRecord(parent record.Record, privateKey *rsa.PrivateKey, data string) record.UpdateRecord {
+	metadata := parent.Metadata()
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, []byte(data))
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewUpdateRecord(parent, metadata, []byte(data), signature)
+	Expect(err).To(BeNil())
+
+	return rec
+}
+
+// generateChain creates a root record followed by count updates,
+// all signed with the returned privateKey
+func generateChain(count int) ([]record.Record, *rsa.PrivateKey) {
+	root, privateKey := generateRootRecord()
+
+	records := []record.Record{root}
+	for i := 0; i < count; i++ {
+		update := generateUpdateRecord(records[i], privateKey, string(rune('a'+i)))
+		records = append(records, update)
+	}
+	return records, privateKey
+}
+
+func mustHash(rec record.Record) []byte {
+	hash, err := rec.Hash()
+	Expect(err).To(BeNil())
+	return hash
+}
+
+// generateRotation creates an update of the parent that rotates to
+// a new key pair and changes the localID. It has assertions on all
+// error cases, so it throws if anything goes wrong.
+func generateRotation(parent record.Record, privateKey *rsa.PrivateKey, localID string) (record.UpdateRecord, string, *rsa.PrivateKey) {
+	publicKey, newPrivateKey := generateKeys()
+
+	metadata := record.Metadata{
+		ID:         parent.Metadata().ID,
+		LocalID:    localID,
+		PublicKeys: []string{publicKey},
+	}
+	data := []byte(`rotated`)
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, data)
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewUpdateRecord(parent, metadata, data, signature)
+	Expect(err).To(BeNil())
+
+	return rec, publicKey, newPrivateKey
+}
+
+// generateAnnotatedUpdate creates an update of the parent that keeps
+// the parent's key and replaces its annotations. It has assertions on
+// all error cases, so it throws if anything goes wrong.
+func generateAnnotatedUpdate(parent record.Record, privateKey *rsa.PrivateKey, annotations map[string]string) record.UpdateRecord {
+	metadata := parent.Metadata()
+	metadata.Annotations = annotations
+	data := []byte(`annotated`)
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, data)
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewUpdateRecord(parent, metadata, data, signature)
+	Expect(err).To(BeNil())
+
+	return rec
+}
+
+// generateExpiringUpdate creates an update of the parent that keeps
+// the parent's key and expires at notAfter. It has assertions on
+// all error cases, so it throws if anything goes wrong.
+func generateExpiringUpdate(parent record.Record, privateKey *rsa.PrivateKey, notAfter time.Time) record.UpdateRecord {
+	metadata := parent.Metadata()
+	metadata.NotAfter = notAfter
+	data := []byte(`expiring`)
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, data)
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewUpdateRecord(parent, metadata, data, signature)
+	Expect(err).To(BeNil())
+
+	return rec
+}
+
+// generateDeltaUpdate creates an update of the parent that keeps the
+// parent's key and whose data is a patch of the kind. It has assertions
+// on all error cases, so it throws if anything goes wrong.
+func generateDeltaUpdate(parent record.Record, privateKey *rsa.PrivateKey, kind string, patch []byte) record.UpdateRecord {
+	metadata := parent.Metadata()
+	metadata.Delta = kind
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, patch)
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewUpdateRecord(parent, metadata, patch, signature)
+	Expect(err).To(BeNil())
+
+	return rec
+}
+
+// generateChunkedUpdate creates an update of the parent that keeps
+// the parent's key and whose data is stored in chunks described by
+// the manifest. It has assertions on all error cases, so it throws
+// if anything goes wrong.
+func generateChunkedUpdate(parent record.Record, privateKey *rsa.PrivateKey, manifest *chunks.Manifest) record.UpdateRecord {
+	metadata := parent.Metadata()
+	metadata.Manifest = manifest
+
+	unsigned, err := record.NewUnsignedUpdateRecord(parent, metadata, nil)
+	Expect(err).To(BeNil())
+
+	signature, err := unsigned.GenerateSignature(privateKey)
+	Expect(err).To(BeNil())
+
+	rec, err := record.NewUpdateRecord(parent, metadata, nil, signature)
+	Expect(err).To(BeNil())
+
+	return rec
+}